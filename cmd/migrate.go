@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/database"
+)
+
+const migrateUsage = `usage: migrate <command>
+
+  up [n]         apply all pending migrations, or the next n
+  down [n]       roll back the last migration, or the last n
+  status         list migrations and when they were applied
+  create <name>  add empty up/down files for a new migration (every driver)`
+
+func runMigrate(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dir := flags.String("dir", database.MigrationsDir, "directory holding the migrations of each driver (create only)")
+	flags.Usage = func() { fmt.Fprintln(flags.Output(), migrateUsage) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+
+	command, rest := flags.Arg(0), flags.Args()[1:]
+
+	if command == "create" {
+		if len(rest) != 1 {
+			return errors.New("usage: migrate create <name>")
+		}
+		paths, err := database.CreateMigration(*dir, rest[0])
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return err
+	}
+
+	steps := 0
+	if len(rest) > 0 {
+		n, err := strconv.Atoi(rest[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid step count %q", rest[0])
+		}
+		steps = n
+	}
+
+	if _, err := database.Connect(cfg); err != nil {
+		return err
+	}
+	migrator, err := database.NewMigrator(database.DB)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(steps)
+		for _, m := range applied {
+			fmt.Printf("Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Nothing to apply")
+		}
+		return err
+	case "down":
+		rolledBack, err := migrator.Down(steps)
+		for _, m := range rolledBack {
+			fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(rolledBack) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, appliedAt)
+		}
+		return nil
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/database"
+)
+
+const seedUsage = `usage: seed [-reset] [fixtures]
+
+  fixtures  built-in set (%s) or a .yaml/.json file; default demo
+  -reset    delete all categories, products and recipes first (local development only)
+
+Rows are matched by category name, product name and recipe name; existing
+rows are updated, so seeding twice is safe.`
+
+func runSeed(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	reset := flags.Bool("reset", false, "delete the catalog before seeding")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), seedUsage+"\n", strings.Join(database.FixtureSets, ", "))
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errors.New("too many arguments")
+	}
+
+	source := "demo"
+	if flags.NArg() == 1 {
+		source = flags.Arg(0)
+	}
+
+	// Fail on a bad fixture file before touching the database
+	fixtures, err := database.LoadFixtures(source)
+	if err != nil {
+		return err
+	}
+
+	if _, err := database.Connect(cfg); err != nil {
+		return err
+	}
+
+	if *reset {
+		if err := database.ResetCatalog(database.DB); err != nil {
+			return fmt.Errorf("reset failed: %w", err)
+		}
+		fmt.Println("Catalog cleared")
+	}
+
+	result, err := database.Seed(database.DB, fixtures)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Seeded %s: %s\n", source, result)
+	return nil
+}
@@ -15,6 +15,8 @@ import Cart from './pages/Cart';
 import Recipes from './pages/Recipes';
 import AIChef from './pages/AIChef';
 import Admin from './pages/Admin';
+import VerifyEmail from './pages/VerifyEmail';
+import ResetPassword from './pages/ResetPassword';
 
 // Protected Route Component
 function ProtectedRoute({ children, adminOnly = false }) {
@@ -24,7 +26,8 @@ function ProtectedRoute({ children, adminOnly = false }) {
     return <Navigate to="/login" replace />;
   }
 
-  if (adminOnly && user?.role !== 'admin') {
+  // Staff roles get the panel too; the API decides what each one may do
+  if (adminOnly && (!user?.role || user.role === 'user')) {
     return <Navigate to="/" replace />;
   }
 
@@ -51,6 +54,8 @@ function App() {
             <Route path="/ai-chef" element={<AIChef />} />
             <Route path="/login" element={<Login />} />
             <Route path="/register" element={<Register />} />
+            <Route path="/verify-email" element={<VerifyEmail />} />
+            <Route path="/reset-password" element={<ResetPassword />} />
 
             {/* Protected Routes */}
             <Route
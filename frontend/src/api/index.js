@@ -18,12 +18,47 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
+// Access tokens are short-lived: on 401, renew them once with the refresh
+// token and retry. Concurrent 401s share a single refresh request.
+let refreshPromise = null;
+
+const refreshTokens = () => {
+  if (!refreshPromise) {
+    const refreshToken = localStorage.getItem('refresh_token');
+    refreshPromise = (refreshToken
+      ? axios.post(`${API_URL}/auth/refresh`, { refresh_token: refreshToken })
+      : Promise.reject(new Error('no refresh token'))
+    )
+      .then((res) => {
+        localStorage.setItem('token', res.data.token);
+        localStorage.setItem('refresh_token', res.data.refresh_token);
+        return res.data.token;
+      })
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+};
+
 // Handle auth errors
 api.interceptors.response.use(
   (response) => response,
-  (error) => {
+  async (error) => {
+    const original = error.config;
+    if (error.response?.status === 401 && original && !original._retried && !original.url?.startsWith('/auth/')) {
+      original._retried = true;
+      try {
+        const token = await refreshTokens();
+        original.headers.Authorization = `Bearer ${token}`;
+        return api(original);
+      } catch {
+        // fall through to logout
+      }
+    }
     if (error.response?.status === 401) {
       localStorage.removeItem('token');
+      localStorage.removeItem('refresh_token');
       localStorage.removeItem('user');
       window.location.href = '/login';
     }
@@ -35,15 +70,21 @@ api.interceptors.response.use(
 export const authAPI = {
   register: (data) => api.post('/auth/register', data),
   login: (data) => api.post('/auth/login', data),
+  verifyEmail: (token) => api.post('/auth/verify-email', { token }),
+  resendVerification: (email) => api.post('/auth/verify-email/resend', { email }),
+  forgotPassword: (email) => api.post('/auth/forgot-password', { email }),
+  resetPassword: (token, password) => api.post('/auth/reset-password', { token, password }),
+  logout: () => api.post('/auth/logout'),
+  logoutAll: () => api.post('/auth/logout-all'),
   getProfile: () => api.get('/users/me'),
 };
 
 // Products API
 export const productsAPI = {
-  getAll: () => api.get('/products'),
+  getAll: (params) => api.get('/products', { params }),
   getById: (id) => api.get(`/products/${id}`),
-  getByCategory: (categoryId) => api.get(`/products/category/${categoryId}`),
-  search: (query) => api.get(`/products/search?q=${query}`),
+  getByCategory: (categoryId, params) => api.get(`/products/category/${categoryId}`, { params }),
+  search: (query, params) => api.get('/products/search', { params: { ...params, q: query } }),
 };
 
 // Categories API
@@ -55,10 +96,14 @@ export const categoriesAPI = {
 export const cartAPI = {
   get: () => api.get('/cart'),
   addItem: (productId, quantity) => api.post('/cart/items', { product_id: productId, quantity }),
-  updateItem: (productId, quantity) => api.put(`/cart/items/${productId}`, { quantity }),
-  removeItem: (productId) => api.delete(`/cart/items/${productId}`),
+  updateItem: (productId, quantity, variantId) =>
+    api.put(`/cart/items/${productId}`, { quantity }, { params: variantId ? { variant_id: variantId } : {} }),
+  removeItem: (productId, variantId) =>
+    api.delete(`/cart/items/${productId}`, { params: variantId ? { variant_id: variantId } : {} }),
   clear: () => api.delete('/cart'),
   addBulk: (items) => api.post('/cart/items/bulk', items),
+  applyCoupon: (code) => api.post('/cart/coupon', { code }),
+  removeCoupon: () => api.delete('/cart/coupon'),
 };
 
 // Recipes API
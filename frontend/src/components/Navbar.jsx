@@ -2,6 +2,7 @@ import { Link, useNavigate } from 'react-router-dom';
 import { FiShoppingCart, FiUser, FiSearch, FiLogOut, FiSettings } from 'react-icons/fi';
 import { useAuthStore, useCartStore } from '../store';
 import { useState } from 'react';
+import { authAPI } from '../api';
 
 export default function Navbar() {
   const { isAuthenticated, user, logout, isAdmin } = useAuthStore();
@@ -9,7 +10,12 @@ export default function Navbar() {
   const navigate = useNavigate();
   const [searchQuery, setSearchQuery] = useState('');
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    try {
+      await authAPI.logout();
+    } catch {
+      // The session may already be gone; log out locally anyway
+    }
     logout();
     navigate('/');
   };
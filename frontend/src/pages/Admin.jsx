@@ -96,8 +96,8 @@ export default function Admin() {
     setLoading(true);
     try {
       if (activeTab === 'products') {
-        const [prodRes, catRes] = await Promise.all([api.get('/products'), api.get('/categories')]);
-        setProducts(prodRes.data);
+        const [prodRes, catRes] = await Promise.all([api.get('/products', { params: { limit: 100 } }), api.get('/categories')]);
+        setProducts(prodRes.data.items);
         setCategories(catRes.data);
       } else if (activeTab === 'categories') {
         const res = await api.get('/categories');
@@ -106,9 +106,9 @@ export default function Admin() {
         const res = await api.get('/admin/users');
         setUsers(res.data);
       } else if (activeTab === 'recipes') {
-        const [recipeRes, productRes] = await Promise.all([api.get('/recipes'), api.get('/products')]);
+        const [recipeRes, productRes] = await Promise.all([api.get('/recipes'), api.get('/products', { params: { limit: 100 } })]);
         setRecipes(recipeRes.data);
-        setProducts(productRes.data);
+        setProducts(productRes.data.items);
       }
     } catch (error) {
       console.error('Error loading data:', error);
@@ -861,6 +861,10 @@ export default function Admin() {
                                 }}
                               >
                                 <option value="user">User</option>
+                                <option value="catalog_manager">Catalog manager</option>
+                                <option value="inventory_clerk">Inventory clerk</option>
+                                <option value="recipe_editor">Recipe editor</option>
+                                <option value="support_agent">Support agent</option>
                                 <option value="admin">Admin</option>
                               </select>
                             </td>
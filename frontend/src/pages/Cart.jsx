@@ -9,6 +9,7 @@ export default function Cart() {
   const { cart, setCart, loading } = useCartStore();
   const { isAuthenticated } = useAuthStore();
   const [updating, setUpdating] = useState(false);
+  const [couponCode, setCouponCode] = useState('');
   const navigate = useNavigate();
 
   useEffect(() => {
@@ -28,10 +29,10 @@ export default function Cart() {
     }
   };
 
-  const updateQuantity = async (productId, quantity) => {
+  const updateQuantity = async (productId, quantity, variantId) => {
     setUpdating(true);
     try {
-      const res = await cartAPI.updateItem(productId, quantity);
+      const res = await cartAPI.updateItem(productId, quantity, variantId);
       setCart(res.data);
     } catch (error) {
       toast.error('Failed to update quantity');
@@ -40,9 +41,9 @@ export default function Cart() {
     }
   };
 
-  const removeItem = async (productId) => {
+  const removeItem = async (productId, variantId) => {
     try {
-      const res = await cartAPI.removeItem(productId);
+      const res = await cartAPI.removeItem(productId, variantId);
       setCart(res.data);
       toast.success('Item removed');
     } catch (error) {
@@ -50,10 +51,32 @@ export default function Cart() {
     }
   };
 
+  const applyCoupon = async (e) => {
+    e.preventDefault();
+    if (!couponCode.trim()) return;
+    try {
+      const res = await cartAPI.applyCoupon(couponCode);
+      setCart(res.data);
+      setCouponCode('');
+      toast.success('Coupon applied');
+    } catch (error) {
+      toast.error(error.response?.data?.error || 'Failed to apply coupon');
+    }
+  };
+
+  const removeCoupon = async () => {
+    try {
+      const res = await cartAPI.removeCoupon();
+      setCart(res.data);
+    } catch (error) {
+      toast.error('Failed to remove coupon');
+    }
+  };
+
   const clearCart = async () => {
     try {
       await cartAPI.clear();
-      setCart({ items: [], total_price: 0, item_count: 0 });
+      setCart({ ...cart, items: [], subtotal: 0, discounts: [], discount_total: 0, total_price: 0, item_count: 0 });
       toast.success('Cart cleared');
     } catch (error) {
       toast.error('Failed to clear cart');
@@ -100,10 +123,10 @@ export default function Cart() {
                 {/* Product Info */}
                 <div style={{ flex: 1, minWidth: 0 }}>
                   <h3 style={{ fontWeight: '600', color: '#1f2937', fontSize: '18px', overflow: 'hidden', textOverflow: 'ellipsis', whiteSpace: 'nowrap' }}>
-                    {item.product_name}
+                    {item.product_name}{item.variant_name ? ` (${item.variant_name})` : ''}
                   </h3>
                   <p style={{ color: '#6b7280', fontSize: '14px' }}>
-                    ${item.price.toFixed(2)} per {item.unit}
+                    ${item.price.toFixed(2)} per {item.variant_name ? 'pack' : item.unit}
                   </p>
                   <p style={{ color: '#22c55e', fontWeight: 'bold', marginTop: '4px' }}>
                     Subtotal: ${item.subtotal.toFixed(2)}
@@ -113,7 +136,7 @@ export default function Cart() {
                 {/* Quantity Controls */}
                 <div style={{ display: 'flex', alignItems: 'center', gap: '12px' }}>
                   <button
-                    onClick={() => updateQuantity(item.product_id, item.quantity - 1)}
+                    onClick={() => updateQuantity(item.product_id, item.quantity - 1, item.variant_id)}
                     disabled={updating || item.quantity <= 1}
                     style={{ padding: '8px', borderRadius: '9999px', backgroundColor: '#f3f4f6', border: 'none', cursor: 'pointer', opacity: updating || item.quantity <= 1 ? 0.5 : 1 }}
                   >
@@ -121,7 +144,7 @@ export default function Cart() {
                   </button>
                   <span style={{ width: '48px', textAlign: 'center', fontWeight: '600' }}>{item.quantity}</span>
                   <button
-                    onClick={() => updateQuantity(item.product_id, item.quantity + 1)}
+                    onClick={() => updateQuantity(item.product_id, item.quantity + 1, item.variant_id)}
                     disabled={updating}
                     style={{ padding: '8px', borderRadius: '9999px', backgroundColor: '#f3f4f6', border: 'none', cursor: 'pointer', opacity: updating ? 0.5 : 1 }}
                   >
@@ -131,7 +154,7 @@ export default function Cart() {
 
                 {/* Remove Button */}
                 <button
-                  onClick={() => removeItem(item.product_id)}
+                  onClick={() => removeItem(item.product_id, item.variant_id)}
                   style={{ padding: '8px', color: '#ef4444', background: 'none', border: 'none', cursor: 'pointer', borderRadius: '9999px' }}
                 >
                   <FiTrash2 style={{ width: '20px', height: '20px' }} />
@@ -156,8 +179,14 @@ export default function Cart() {
               <div style={{ display: 'flex', flexDirection: 'column', gap: '12px', marginBottom: '24px' }}>
                 <div style={{ display: 'flex', justifyContent: 'space-between', color: '#4b5563' }}>
                   <span>Items ({cart.item_count})</span>
-                  <span>${cart.total_price?.toFixed(2)}</span>
+                  <span>${cart.subtotal?.toFixed(2)}</span>
                 </div>
+                {cart.discounts?.map((discount, i) => (
+                  <div key={i} style={{ display: 'flex', justifyContent: 'space-between', color: '#22c55e', fontSize: '14px' }}>
+                    <span>{discount.name}</span>
+                    <span>-${discount.amount.toFixed(2)}</span>
+                  </div>
+                ))}
                 <div style={{ display: 'flex', justifyContent: 'space-between', color: '#4b5563' }}>
                   <span>Delivery</span>
                   <span style={{ color: '#22c55e' }}>Free</span>
@@ -168,6 +197,30 @@ export default function Cart() {
                 </div>
               </div>
 
+              {cart.coupon_code ? (
+                <div style={{ marginBottom: '16px', fontSize: '14px' }}>
+                  <div style={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center' }}>
+                    <span>Coupon <strong>{cart.coupon_code}</strong></span>
+                    <button onClick={removeCoupon} style={{ color: '#ef4444', background: 'none', border: 'none', cursor: 'pointer' }}>
+                      Remove
+                    </button>
+                  </div>
+                  {cart.coupon_error && <p style={{ color: '#ef4444', marginTop: '4px' }}>{cart.coupon_error}</p>}
+                </div>
+              ) : (
+                <form onSubmit={applyCoupon} style={{ display: 'flex', gap: '8px', marginBottom: '16px' }}>
+                  <input
+                    value={couponCode}
+                    onChange={(e) => setCouponCode(e.target.value)}
+                    placeholder="Coupon code"
+                    style={{ flex: 1, minWidth: 0, padding: '8px 12px', border: '1px solid #e5e7eb', borderRadius: '9999px' }}
+                  />
+                  <button type="submit" style={{ padding: '8px 16px', backgroundColor: '#f3f4f6', border: 'none', borderRadius: '9999px', fontWeight: '500', cursor: 'pointer' }}>
+                    Apply
+                  </button>
+                </form>
+              )}
+
               <button style={{ width: '100%', backgroundColor: '#22c55e', color: 'white', padding: '12px', borderRadius: '9999px', fontWeight: '600', border: 'none', cursor: 'pointer' }}>
                 Proceed to Checkout
               </button>
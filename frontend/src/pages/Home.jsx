@@ -30,7 +30,7 @@ export default function Home() {
         productsAPI.getAll(),
         categoriesAPI.getAll(),
       ]);
-      setProducts(productsRes.data);
+      setProducts(productsRes.data.items);
       setCategories(categoriesRes.data);
     } catch (error) {
       toast.error('Failed to load products');
@@ -42,7 +42,7 @@ export default function Home() {
   const loadProducts = async () => {
     try {
       const res = await productsAPI.getAll();
-      setProducts(res.data);
+      setProducts(res.data.items);
     } catch (error) {
       toast.error('Failed to load products');
     }
@@ -52,7 +52,7 @@ export default function Home() {
     try {
       setLoading(true);
       const res = await productsAPI.getByCategory(categoryId);
-      setProducts(res.data);
+      setProducts(res.data.items);
     } catch (error) {
       toast.error('Failed to load products');
     } finally {
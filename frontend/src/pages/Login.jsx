@@ -19,7 +19,7 @@ export default function Login() {
 
     try {
       const res = await authAPI.login({ email, password });
-      setAuth(res.data.user, res.data.token);
+      setAuth(res.data.user, res.data.token, res.data.refresh_token);
       toast.success('Welcome back!');
       navigate('/');
     } catch (error) {
@@ -85,6 +85,12 @@ export default function Login() {
               </div>
             </div>
 
+            <div style={{ textAlign: 'right', marginTop: '-16px' }}>
+              <Link to="/reset-password" style={{ color: '#22c55e', fontSize: '14px', textDecoration: 'none' }}>
+                Forgot password?
+              </Link>
+            </div>
+
             <button
               type="submit"
               disabled={loading}
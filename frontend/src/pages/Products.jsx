@@ -43,7 +43,7 @@ export default function Products() {
     try {
       setLoading(true);
       const res = await productsAPI.getAll();
-      setProducts(res.data);
+      setProducts(res.data.items);
     } catch (error) {
       toast.error('Failed to load products');
     } finally {
@@ -55,7 +55,7 @@ export default function Products() {
     try {
       setLoading(true);
       const res = await productsAPI.getByCategory(categoryId);
-      setProducts(res.data);
+      setProducts(res.data.items);
     } catch (error) {
       toast.error('Failed to load products');
     } finally {
@@ -67,7 +67,7 @@ export default function Products() {
     try {
       setLoading(true);
       const res = await productsAPI.search(query);
-      setProducts(res.data);
+      setProducts(res.data.items);
     } catch (error) {
       toast.error('Search failed');
     } finally {
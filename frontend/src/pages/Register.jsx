@@ -32,7 +32,12 @@ export default function Register() {
 
     try {
       const res = await authAPI.register({ name, email, password });
-      setAuth(res.data.user, res.data.token);
+      if (res.data.verification_required) {
+        toast.success('Account created! Check your email to verify it, then sign in.');
+        navigate('/login');
+        return;
+      }
+      setAuth(res.data.user, res.data.token, res.data.refresh_token);
       toast.success('Account created successfully!');
       navigate('/');
     } catch (error) {
@@ -0,0 +1,105 @@
+import { useState } from 'react';
+import { Link, useNavigate, useSearchParams } from 'react-router-dom';
+import { authAPI } from '../api';
+import toast from 'react-hot-toast';
+import { FiMail, FiLock } from 'react-icons/fi';
+
+const inputStyle = { width: '100%', paddingLeft: '40px', paddingRight: '16px', paddingTop: '12px', paddingBottom: '12px', border: '1px solid #d1d5db', borderRadius: '8px', outline: 'none', fontSize: '16px', boxSizing: 'border-box' };
+const iconStyle = { position: 'absolute', left: '12px', top: '50%', transform: 'translateY(-50%)', color: '#9ca3af' };
+
+// Without a token the page asks for an email and sends a reset link; with
+// ?token=... (from that link) it sets the new password.
+export default function ResetPassword() {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token');
+  const [email, setEmail] = useState('');
+  const [password, setPassword] = useState('');
+  const [loading, setLoading] = useState(false);
+  const navigate = useNavigate();
+
+  const handleRequest = async (e) => {
+    e.preventDefault();
+    setLoading(true);
+    try {
+      await authAPI.forgotPassword(email);
+      toast.success('If the address has an account, a reset link is on its way');
+    } catch (error) {
+      toast.error(error.response?.data?.error || 'Failed to send reset link');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleReset = async (e) => {
+    e.preventDefault();
+    setLoading(true);
+    try {
+      await authAPI.resetPassword(token, password);
+      toast.success('Password updated, please sign in');
+      navigate('/login');
+    } catch (error) {
+      toast.error(error.response?.data?.error || 'Failed to reset password');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div style={{ minHeight: '100vh', backgroundColor: '#f9fafb', display: 'flex', alignItems: 'center', justifyContent: 'center', padding: '48px 16px' }}>
+      <div style={{ maxWidth: '448px', width: '100%' }}>
+        <div style={{ backgroundColor: 'white', borderRadius: '16px', boxShadow: '0 10px 15px -3px rgba(0,0,0,0.1)', padding: '32px' }}>
+          <div style={{ textAlign: 'center', marginBottom: '32px' }}>
+            <span style={{ fontSize: '36px' }}>🍕</span>
+            <h2 style={{ fontSize: '30px', fontWeight: 'bold', color: '#1f2937' }}>Reset Password</h2>
+            <p style={{ color: '#4b5563', marginTop: '8px' }}>
+              {token ? 'Choose a new password' : "We'll email you a link to reset it"}
+            </p>
+          </div>
+
+          <form onSubmit={token ? handleReset : handleRequest} style={{ display: 'flex', flexDirection: 'column', gap: '24px' }}>
+            {token ? (
+              <div style={{ position: 'relative' }}>
+                <FiLock style={iconStyle} />
+                <input
+                  type="password"
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  required
+                  minLength={6}
+                  style={inputStyle}
+                  placeholder="New password"
+                />
+              </div>
+            ) : (
+              <div style={{ position: 'relative' }}>
+                <FiMail style={iconStyle} />
+                <input
+                  type="email"
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  required
+                  style={inputStyle}
+                  placeholder="your@email.com"
+                />
+              </div>
+            )}
+
+            <button
+              type="submit"
+              disabled={loading}
+              style={{ width: '100%', backgroundColor: '#22c55e', color: 'white', padding: '12px', borderRadius: '8px', fontWeight: '600', border: 'none', cursor: 'pointer', opacity: loading ? 0.5 : 1 }}
+            >
+              {loading ? 'Please wait...' : token ? 'Set Password' : 'Send Reset Link'}
+            </button>
+          </form>
+
+          <p style={{ textAlign: 'center', color: '#4b5563', marginTop: '24px' }}>
+            <Link to="/login" style={{ color: '#22c55e', fontWeight: '500', textDecoration: 'none' }}>
+              Back to Sign In
+            </Link>
+          </p>
+        </div>
+      </div>
+    </div>
+  );
+}
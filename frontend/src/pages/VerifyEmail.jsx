@@ -0,0 +1,54 @@
+import { useEffect, useRef, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { authAPI } from '../api';
+
+export default function VerifyEmail() {
+  const [searchParams] = useSearchParams();
+  const [status, setStatus] = useState('loading');
+  const [message, setMessage] = useState('');
+  const requested = useRef(false);
+
+  useEffect(() => {
+    // Tokens are single-use; don't redeem twice under StrictMode
+    if (requested.current) return;
+    requested.current = true;
+
+    const token = searchParams.get('token');
+    if (!token) {
+      setStatus('error');
+      setMessage('This verification link is incomplete.');
+      return;
+    }
+
+    authAPI.verifyEmail(token)
+      .then(() => setStatus('success'))
+      .catch((error) => {
+        setStatus('error');
+        setMessage(error.response?.data?.error || 'Verification failed');
+      });
+  }, [searchParams]);
+
+  return (
+    <div style={{ minHeight: '100vh', backgroundColor: '#f9fafb', display: 'flex', alignItems: 'center', justifyContent: 'center', padding: '48px 16px' }}>
+      <div style={{ maxWidth: '448px', width: '100%', backgroundColor: 'white', borderRadius: '16px', boxShadow: '0 10px 15px -3px rgba(0,0,0,0.1)', padding: '32px', textAlign: 'center' }}>
+        <span style={{ fontSize: '36px' }}>🍕</span>
+        {status === 'loading' && <p style={{ color: '#4b5563', marginTop: '16px' }}>Verifying your email...</p>}
+        {status === 'success' && (
+          <>
+            <h2 style={{ fontSize: '24px', fontWeight: 'bold', color: '#1f2937', marginTop: '16px' }}>Email verified</h2>
+            <p style={{ color: '#4b5563', marginTop: '8px' }}>Thanks! Your email address is confirmed.</p>
+          </>
+        )}
+        {status === 'error' && (
+          <>
+            <h2 style={{ fontSize: '24px', fontWeight: 'bold', color: '#1f2937', marginTop: '16px' }}>Verification failed</h2>
+            <p style={{ color: '#4b5563', marginTop: '8px' }}>{message}</p>
+          </>
+        )}
+        <Link to="/login" style={{ display: 'inline-block', marginTop: '24px', color: '#22c55e', fontWeight: '500', textDecoration: 'none' }}>
+          Go to Sign In
+        </Link>
+      </div>
+    </div>
+  );
+}
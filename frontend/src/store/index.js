@@ -9,13 +9,17 @@ export const useAuthStore = create(
       token: null,
       isAuthenticated: false,
       
-      setAuth: (user, token) => {
+      setAuth: (user, token, refreshToken) => {
         localStorage.setItem('token', token);
+        if (refreshToken) {
+          localStorage.setItem('refresh_token', refreshToken);
+        }
         set({ user, token, isAuthenticated: true });
       },
       
       logout: () => {
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         set({ user: null, token: null, isAuthenticated: false });
       },
       
@@ -29,7 +33,8 @@ export const useAuthStore = create(
         }
       },
       
-      isAdmin: () => get().user?.role === 'admin',
+      // True for admin and staff roles (catalog manager, support agent, ...)
+      isAdmin: () => !!get().user?.role && get().user.role !== 'user',
     }),
     {
       name: 'auth-storage',
@@ -0,0 +1,59 @@
+// Package barcode validates the retail barcodes printed on packaging:
+// EAN-13, UPC-A and EAN-8.
+//
+// UPC-A is EAN-13 with the leading zero left off, so codes are normalized to
+// their EAN form. A scanner that reports the UPC-A spelling of a code then
+// finds the same product as one that reports the EAN-13 spelling.
+package barcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalid = errors.New("invalid barcode")
+
+// Normalize strips spaces and dashes from code, checks its length and check
+// digit, and returns it as EAN-8 or EAN-13
+func Normalize(code string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: %q must contain only digits", ErrInvalid, code)
+		}
+	}
+
+	switch len(digits) {
+	case 8, 13:
+	case 12:
+		digits = "0" + digits
+	default:
+		return "", fmt.Errorf("%w: %q must have 8 (EAN-8), 12 (UPC-A) or 13 (EAN-13) digits", ErrInvalid, code)
+	}
+
+	if CheckDigit(digits[:len(digits)-1]) != digits[len(digits)-1] {
+		return "", fmt.Errorf("%w: %q has a wrong check digit", ErrInvalid, code)
+	}
+	return digits, nil
+}
+
+// CheckDigit computes the GS1 check digit for a code without its last digit.
+// Digits are weighted 3 and 1 alternately, starting with 3 from the right.
+func CheckDigit(payload string) byte {
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		digit := int(payload[i] - '0')
+		if (len(payload)-1-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
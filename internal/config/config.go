@@ -1,7 +1,7 @@
 package config
 
 import (
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/joho/godotenv"
@@ -11,7 +11,23 @@ type Config struct {
 	// Server
 	ServerPort string
 
+	// HTTP server limits, how long shutdown fails readiness before it stops
+	// accepting connections, and how long it waits for requests to finish
+	HTTPReadTimeout       string
+	HTTPReadHeaderTimeout string
+	HTTPWriteTimeout      string
+	HTTPIdleTimeout       string
+	HTTPMaxHeaderBytes    string
+	ShutdownDelay         string
+	ShutdownTimeout       string
+
+	// Logging
+	LogLevel  string
+	LogFormat string
+
 	// Database
+	DBDriver   string
+	SQLitePath string
 	DBHost     string
 	DBPort     string
 	DBUser     string
@@ -19,12 +35,60 @@ type Config struct {
 	DBName     string
 	DBSSLMode  string
 
+	// SQL statements slower than this are logged as warnings
+	DBSlowQueryThreshold string
+
+	// Apply pending migrations on startup
+	AutoMigrate string
+
+	// Fixture set (or file) loaded on startup when the catalog is empty
+	SeedFixtures string
+
 	// JWT
-	JWTSecret     string
-	JWTExpiration string
+	JWTSecret            string
+	JWTExpiration        string
+	JWTRefreshExpiration string
+
+	// Account emails
+	AppBaseURL               string
+	EmailVerificationTTL     string
+	PasswordResetTTL         string
+	RequireEmailVerification string
+
+	// Mail
+	MailDriver   string
+	MailFrom     string
+	MailLogFile  string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// Stock reservations
+	StockHoldTTL       string
+	StockSweepInterval string
+
+	// How often due scheduled prices are applied
+	PriceScheduleInterval string
 
 	// Gemini AI
 	GeminiAPIKey string
+
+	// LLM provider
+	LLMProvider    string
+	LLMModel       string
+	LLMTemperature string
+	LLMBaseURL     string
+	LLMTimeout     string
+	LLMAPIKey      string
+
+	// How many times a malformed AI reply is sent back to the model for repair
+	AIMaxRepairAttempts string
+
+	// AI response cache
+	AICacheBackend string
+	AICacheTTL     string
+	AICacheSize    string
 }
 
 var AppConfig *Config
@@ -32,14 +96,29 @@ var AppConfig *Config
 func Load() *Config {
 	// Load .env file if exists
 	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+		slog.Info("No .env file found, using environment variables")
 	}
 
 	AppConfig = &Config{
 		// Server
 		ServerPort: getEnv("SERVER_PORT", "8080"),
 
+		// HTTP server
+		HTTPReadTimeout:       getEnv("HTTP_READ_TIMEOUT", "30s"),
+		HTTPReadHeaderTimeout: getEnv("HTTP_READ_HEADER_TIMEOUT", "5s"),
+		HTTPWriteTimeout:      getEnv("HTTP_WRITE_TIMEOUT", "4m"),
+		HTTPIdleTimeout:       getEnv("HTTP_IDLE_TIMEOUT", "2m"),
+		HTTPMaxHeaderBytes:    getEnv("HTTP_MAX_HEADER_BYTES", "1048576"),
+		ShutdownDelay:         getEnv("SHUTDOWN_DELAY", "5s"),
+		ShutdownTimeout:       getEnv("SHUTDOWN_TIMEOUT", "30s"),
+
+		// Logging
+		LogLevel:  getEnv("LOG_LEVEL", "info"),
+		LogFormat: getEnv("LOG_FORMAT", "json"),
+
 		// Database
+		DBDriver:   getEnv("DB_DRIVER", "postgres"),
+		SQLitePath: getEnv("SQLITE_PATH", "smart_food_store.db"),
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     getEnv("DB_PORT", "5432"),
 		DBUser:     getEnv("DB_USER", "postgres"),
@@ -47,12 +126,54 @@ func Load() *Config {
 		DBName:     getEnv("DB_NAME", "smart_food_store"),
 		DBSSLMode:  getEnv("DB_SSL_MODE", "disable"),
 
+		DBSlowQueryThreshold: getEnv("DB_SLOW_QUERY_THRESHOLD", "200ms"),
+
+		AutoMigrate:  getEnv("AUTO_MIGRATE", "true"),
+		SeedFixtures: getEnv("SEED_FIXTURES", "demo"),
+
 		// JWT
-		JWTSecret:     getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
-		JWTExpiration: getEnv("JWT_EXPIRATION", "24h"),
+		JWTSecret:            getEnv("JWT_SECRET", "your-super-secret-key-change-in-production"),
+		JWTExpiration:        getEnv("JWT_EXPIRATION", "15m"),
+		JWTRefreshExpiration: getEnv("JWT_REFRESH_EXPIRATION", "720h"),
+
+		// Account emails
+		AppBaseURL:               getEnv("APP_BASE_URL", "http://localhost:5173"),
+		EmailVerificationTTL:     getEnv("EMAIL_VERIFICATION_TTL", "24h"),
+		PasswordResetTTL:         getEnv("PASSWORD_RESET_TTL", "1h"),
+		RequireEmailVerification: getEnv("REQUIRE_EMAIL_VERIFICATION", "false"),
+
+		// Mail
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "Smart Food Store <no-reply@smartfood.local>"),
+		MailLogFile:  getEnv("MAIL_LOG_FILE", ""),
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		// Stock reservations
+		StockHoldTTL:       getEnv("STOCK_HOLD_TTL", "15m"),
+		StockSweepInterval: getEnv("STOCK_SWEEP_INTERVAL", "1m"),
+
+		PriceScheduleInterval: getEnv("PRICE_SCHEDULE_INTERVAL", "1m"),
 
 		// Gemini AI
 		GeminiAPIKey: getEnv("GEMINI_API_KEY", ""),
+
+		// LLM provider
+		LLMProvider:    getEnv("LLM_PROVIDER", "gemini"),
+		LLMModel:       getEnv("LLM_MODEL", ""),
+		LLMTemperature: getEnv("LLM_TEMPERATURE", "0.7"),
+		LLMBaseURL:     getEnv("LLM_BASE_URL", ""),
+		LLMTimeout:     getEnv("LLM_TIMEOUT", "60s"),
+		LLMAPIKey:      getEnv("LLM_API_KEY", ""),
+
+		AIMaxRepairAttempts: getEnv("AI_MAX_REPAIR_ATTEMPTS", "2"),
+
+		// AI response cache
+		AICacheBackend: getEnv("AI_CACHE_BACKEND", "memory"),
+		AICacheTTL:     getEnv("AI_CACHE_TTL", "24h"),
+		AICacheSize:    getEnv("AI_CACHE_SIZE", "1000"),
 	}
 
 	return AppConfig
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// defaultSlowQueryThreshold is used when DB_SLOW_QUERY_THRESHOLD is empty or
+// invalid
+const defaultSlowQueryThreshold = 200 * time.Millisecond
+
+// SlogLogger sends GORM's logging to slog with the caller's context, so SQL
+// logged while handling a request carries its request ID. Failed statements
+// are logged as errors and statements slower than the threshold as
+// warnings; everything else only shows up at the debug level. Statements
+// are logged with their placeholders, never the bound values, so password
+// and token hashes stay out of the logs.
+type SlogLogger struct {
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+// NewSlogLogger returns a GORM logger warning about statements slower than
+// slowThreshold; zero disables slow-query warnings
+func NewSlogLogger(slowThreshold time.Duration) *SlogLogger {
+	return &SlogLogger{level: logger.Info, slowThreshold: slowThreshold}
+}
+
+// ParseSlowQueryThreshold parses DB_SLOW_QUERY_THRESHOLD: a duration, "0" to
+// disable slow-query warnings, or empty for the default
+func ParseSlowQueryThreshold(value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return defaultSlowQueryThreshold
+	}
+	return d
+}
+
+func (l *SlogLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+func (l *SlogLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *SlogLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *SlogLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// ParamsFilter drops the bound values GORM would otherwise inline into the
+// logged SQL
+func (l *SlogLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+func (l *SlogLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	var level slog.Level
+	var msg string
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		level, msg = slog.LevelError, "SQL query failed"
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold && l.level >= logger.Warn:
+		level, msg = slog.LevelWarn, "Slow SQL query"
+	case l.level >= logger.Info:
+		level, msg = slog.LevelDebug, "SQL query"
+	default:
+		return
+	}
+	// Rendering the statement isn't free; skip it when the record is dropped
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", milliseconds(elapsed)),
+	}
+	if level == slog.LevelError {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// milliseconds converts d for logging, to the microsecond
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// One directory of migrations per driver, with the same versions in each
+//
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var embeddedMigrations embed.FS
+
+// MigrationsDir holds a directory of migration files per driver; `migrate
+// create` writes the new files into each of them
+const MigrationsDir = "internal/database/migrations"
+
+// MigrationDrivers are the drivers that have migrations
+var MigrationDrivers = []string{"postgres", "sqlite"}
+
+// Migration files are named <version>_<name>.up.sql and <version>_<name>.down.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// SchemaMigration is one row of schema_migrations: a migration that has been
+// applied to this database
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies and rolls back the embedded SQL migrations, one
+// transaction per migration
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewMigrator loads the migrations for db's driver
+func NewMigrator(db *gorm.DB) (*Migrator, error) {
+	driver := db.Dialector.Name()
+	if !slices.Contains(MigrationDrivers, driver) {
+		return nil, fmt.Errorf("no migrations for database driver %q", driver)
+	}
+	dir, err := fs.Sub(embeddedMigrations, "migrations/"+driver)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := LoadMigrations(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// LoadMigrations reads every migration in fsys, sorted by version. Each
+// version needs both an up and a down file, and both need a statement
+// besides comments.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected file %q in migrations", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !hasSQL(m.Up) || !hasSQL(m.Down) {
+			return nil, fmt.Errorf("migration %d_%s needs SQL in its up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// blockComment matches a /* */ comment, which may span lines
+var blockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// hasSQL reports whether a migration file has anything but comments and
+// whitespace
+func hasSQL(sql string) bool {
+	for _, line := range strings.Split(blockComment.ReplaceAllString(sql, ""), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+	return false
+}
+
+// Up applies pending migrations in order; steps <= 0 applies all of them
+func (m *Migrator) Up(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		ran, err := m.run(migration, true)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Down rolls back the most recently applied migrations; steps <= 0 rolls
+// back one
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		ran, err := m.run(migration, false)
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+	return done, nil
+}
+
+// Status lists every known migration and when it was applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	if err := m.db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	var rows []SchemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// run applies or rolls back one migration together with its
+// schema_migrations row. It reports false if another instance got there
+// first.
+func (m *Migrator) run(migration Migration, up bool) (bool, error) {
+	ran := false
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		// Serialize instances migrating the same database at boot
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+				return err
+			}
+		}
+
+		var count int64
+		if err := tx.Model(&SchemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if (count > 0) == up {
+			return nil
+		}
+
+		if up {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		}
+
+		if err := tx.Exec(migration.Down).Error; err != nil {
+			return err
+		}
+		ran = true
+		return tx.Delete(&SchemaMigration{}, migration.Version).Error
+	})
+	return ran && err == nil, err
+}
+
+// Arbitrary key for pg_advisory_xact_lock
+const migrationLockID = 7310482910
+
+// CreateMigration writes up and down files for a new migration into the
+// directory of every driver under dir, numbered after the highest existing
+// version. The files hold only a comment, so LoadMigrations rejects them
+// (and the server won't start) until SQL has been written into all of them.
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(name, "_")
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return nil, errors.New("migration name is required")
+	}
+
+	var version int64 = 1
+	for _, driver := range MigrationDrivers {
+		migrations, err := LoadMigrations(os.DirFS(filepath.Join(dir, driver)))
+		if err != nil {
+			return nil, err
+		}
+		if len(migrations) > 0 {
+			version = max(version, migrations[len(migrations)-1].Version+1)
+		}
+	}
+
+	var paths []string
+	for _, driver := range MigrationDrivers {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(dir, driver, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+			content := fmt.Sprintf("-- %04d_%s (%s): write the %s migration here\n", version, name, direction, driver)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				return paths, err
+			}
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,72 @@
+package database_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bexiiiii/smart_food_store/internal/database"
+)
+
+func TestLoadMigrationsNeedsSQL(t *testing.T) {
+	const statement = "CREATE TABLE t (id integer);\n"
+	cases := []struct {
+		name     string
+		up, down string
+		ok       bool
+	}{
+		{"statements", statement, "DROP TABLE t;", true},
+		{"statement after comments", "-- adds t\n/* see the docs */\n" + statement, "DROP TABLE t; -- gone", true},
+		{"empty up", "", "DROP TABLE t;", false},
+		{"blank down", statement, " \n\t\n", false},
+		{"line comments only", "-- 0001_add_t (up)\n--\n", "DROP TABLE t;", false},
+		{"block comment only", statement, "/* DROP TABLE t;\n   later */\n", false},
+	}
+
+	for _, tc := range cases {
+		fsys := fstest.MapFS{
+			"0001_add_t.up.sql":   {Data: []byte(tc.up)},
+			"0001_add_t.down.sql": {Data: []byte(tc.down)},
+		}
+		migrations, err := database.LoadMigrations(fsys)
+		if tc.ok && (err != nil || len(migrations) != 1) {
+			t.Errorf("%s: LoadMigrations = %v, %v, want the migration", tc.name, migrations, err)
+		}
+		if !tc.ok && (err == nil || !strings.Contains(err.Error(), "1_add_t")) {
+			t.Errorf("%s: LoadMigrations = %v, want an error naming the migration", tc.name, err)
+		}
+	}
+}
+
+func TestCreatedMigrationFailsUntilFilledIn(t *testing.T) {
+	dir := t.TempDir()
+	for _, driver := range database.MigrationDrivers {
+		if err := os.Mkdir(filepath.Join(dir, driver), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := database.CreateMigration(dir, "Add Widgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2*len(database.MigrationDrivers) || filepath.Base(paths[0]) != "0001_add_widgets.up.sql" {
+		t.Fatalf("CreateMigration wrote %v", paths)
+	}
+
+	driverDir := filepath.Join(dir, database.MigrationDrivers[0])
+	if _, err := database.LoadMigrations(os.DirFS(driverDir)); err == nil {
+		t.Fatal("LoadMigrations accepted the placeholder files")
+	}
+
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte("SELECT 1;\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if migrations, err := database.LoadMigrations(os.DirFS(driverDir)); err != nil || len(migrations) != 1 {
+		t.Errorf("LoadMigrations after filling in = %v, %v", migrations, err)
+	}
+}
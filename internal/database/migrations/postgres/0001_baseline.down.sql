@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS ai_cache_entries;
+DROP TABLE IF EXISTS stock_reservations;
+DROP TABLE IF EXISTS order_status_changes;
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS recipe_ingredients;
+DROP TABLE IF EXISTS recipes;
+DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS carts;
+DROP TABLE IF EXISTS products;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS users;
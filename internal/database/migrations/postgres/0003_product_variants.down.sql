@@ -0,0 +1,8 @@
+ALTER TABLE stock_reservations DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE order_items DROP COLUMN IF EXISTS variant_name;
+ALTER TABLE order_items DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE recipe_ingredients DROP COLUMN IF EXISTS variant_id;
+ALTER TABLE cart_items DROP COLUMN IF EXISTS variant_id;
+DROP TABLE IF EXISTS product_variants;
+DROP INDEX IF EXISTS idx_products_barcode;
+ALTER TABLE products DROP COLUMN IF EXISTS barcode;
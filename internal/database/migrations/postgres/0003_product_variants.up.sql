@@ -0,0 +1,37 @@
+-- Barcodes on products, and product variants (sizes and packs) with their own
+-- SKU, barcode, price and stock. Cart, recipe, order and reservation lines can
+-- point at a variant.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS barcode varchar(13);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_barcode ON products (barcode) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS product_variants (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    product_id bigint NOT NULL CONSTRAINT fk_products_variants REFERENCES products (id),
+    name       varchar(100) NOT NULL,
+    sku        varchar(64),
+    barcode    varchar(13),
+    size       decimal NOT NULL,
+    price      decimal NOT NULL,
+    stock      decimal DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_product_variants_deleted_at ON product_variants (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_product_variants_product_id ON product_variants (product_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_variants_sku ON product_variants (sku) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_variants_barcode ON product_variants (barcode) WHERE deleted_at IS NULL;
+
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS variant_id bigint CONSTRAINT fk_cart_items_variant REFERENCES product_variants (id);
+CREATE INDEX IF NOT EXISTS idx_cart_items_variant_id ON cart_items (variant_id);
+
+ALTER TABLE recipe_ingredients ADD COLUMN IF NOT EXISTS variant_id bigint CONSTRAINT fk_recipe_ingredients_variant REFERENCES product_variants (id);
+CREATE INDEX IF NOT EXISTS idx_recipe_ingredients_variant_id ON recipe_ingredients (variant_id);
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_id bigint;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_name varchar(100);
+CREATE INDEX IF NOT EXISTS idx_order_items_variant_id ON order_items (variant_id);
+
+ALTER TABLE stock_reservations ADD COLUMN IF NOT EXISTS variant_id bigint;
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_variant_id ON stock_reservations (variant_id);
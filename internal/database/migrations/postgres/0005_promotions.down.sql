@@ -0,0 +1,7 @@
+DELETE FROM role_permissions WHERE permission = 'promotions:write';
+ALTER TABLE orders DROP COLUMN IF EXISTS coupon_code;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount_total;
+ALTER TABLE orders DROP COLUMN IF EXISTS subtotal;
+ALTER TABLE carts DROP COLUMN IF EXISTS coupon_code;
+DROP TABLE IF EXISTS order_discounts;
+DROP TABLE IF EXISTS promotions;
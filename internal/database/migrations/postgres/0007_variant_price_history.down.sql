@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_price_changes_variant_id;
+ALTER TABLE price_changes DROP COLUMN IF EXISTS variant_id;
@@ -0,0 +1,249 @@
+-- Baseline for SQLite: the tables of the Postgres baseline. There is no
+-- full-text search column; searches fall back to LIKE.
+
+CREATE TABLE IF NOT EXISTS users (
+    id                integer PRIMARY KEY AUTOINCREMENT,
+    created_at        datetime,
+    updated_at        datetime,
+    deleted_at        datetime,
+    name              varchar(100) NOT NULL,
+    email             varchar(100) NOT NULL,
+    password          varchar(255) NOT NULL,
+    role              varchar(20) DEFAULT 'user',
+    token_version     bigint NOT NULL DEFAULT 0,
+    email_verified    boolean NOT NULL DEFAULT false,
+    email_verified_at datetime
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    name       varchar(100) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_at ON categories (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories (name);
+
+CREATE TABLE IF NOT EXISTS products (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    created_at   datetime,
+    updated_at   datetime,
+    deleted_at   datetime,
+    name         varchar(150) NOT NULL,
+    description  varchar(500),
+    price        numeric NOT NULL,
+    stock        numeric DEFAULT 0,
+    unit         varchar(10) DEFAULT 'g',
+    density      numeric DEFAULT 0,
+    piece_weight numeric DEFAULT 0,
+    category_id  bigint CONSTRAINT fk_categories_products REFERENCES categories (id),
+    image_url    varchar(255)
+);
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_products_category_id ON products (category_id);
+
+CREATE TABLE IF NOT EXISTS carts (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    user_id    bigint NOT NULL CONSTRAINT fk_users_cart REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_carts_deleted_at ON carts (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_carts_user_id ON carts (user_id);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    cart_id    bigint NOT NULL CONSTRAINT fk_carts_items REFERENCES carts (id),
+    product_id bigint NOT NULL CONSTRAINT fk_cart_items_product REFERENCES products (id),
+    quantity   numeric NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_cart_items_deleted_at ON cart_items (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_cart_items_cart_id ON cart_items (cart_id);
+CREATE INDEX IF NOT EXISTS idx_cart_items_product_id ON cart_items (product_id);
+
+CREATE TABLE IF NOT EXISTS recipes (
+    id              integer PRIMARY KEY AUTOINCREMENT,
+    created_at      datetime,
+    updated_at      datetime,
+    deleted_at      datetime,
+    name            varchar(200) NOT NULL,
+    description     text,
+    instructions    text,
+    servings        bigint DEFAULT 1,
+    prep_time       bigint,
+    cook_time       bigint,
+    image_url       varchar(255),
+    is_ai_generated boolean DEFAULT false,
+    status          varchar(20) DEFAULT 'approved',
+    normalized_name varchar(200),
+    created_by_id   bigint,
+    reviewed_by_id  bigint,
+    reviewed_at     datetime
+);
+CREATE INDEX IF NOT EXISTS idx_recipes_deleted_at ON recipes (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_recipes_status ON recipes (status);
+CREATE INDEX IF NOT EXISTS idx_recipes_normalized_name ON recipes (normalized_name);
+CREATE INDEX IF NOT EXISTS idx_recipes_created_by_id ON recipes (created_by_id);
+
+CREATE TABLE IF NOT EXISTS recipe_ingredients (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    recipe_id  bigint NOT NULL CONSTRAINT fk_recipes_ingredients REFERENCES recipes (id),
+    product_id bigint NOT NULL CONSTRAINT fk_recipe_ingredients_product REFERENCES products (id),
+    quantity   numeric NOT NULL,
+    unit       varchar(10),
+    notes      varchar(100)
+);
+CREATE INDEX IF NOT EXISTS idx_recipe_ingredients_deleted_at ON recipe_ingredients (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_recipe_ingredients_recipe_id ON recipe_ingredients (recipe_id);
+CREATE INDEX IF NOT EXISTS idx_recipe_ingredients_product_id ON recipe_ingredients (product_id);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id          integer PRIMARY KEY AUTOINCREMENT,
+    created_at  datetime,
+    updated_at  datetime,
+    deleted_at  datetime,
+    user_id     bigint NOT NULL CONSTRAINT fk_orders_user REFERENCES users (id),
+    status      varchar(30) DEFAULT 'pending',
+    total_price numeric NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_orders_deleted_at ON orders (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders (user_id);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders (status);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    created_at   datetime,
+    updated_at   datetime,
+    deleted_at   datetime,
+    order_id     bigint NOT NULL CONSTRAINT fk_orders_items REFERENCES orders (id),
+    product_id   bigint NOT NULL,
+    product_name varchar(150) NOT NULL,
+    price        numeric NOT NULL,
+    unit         varchar(10),
+    quantity     numeric NOT NULL,
+    subtotal     numeric NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_order_items_deleted_at ON order_items (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_order_items_order_id ON order_items (order_id);
+CREATE INDEX IF NOT EXISTS idx_order_items_product_id ON order_items (product_id);
+
+CREATE TABLE IF NOT EXISTS order_status_changes (
+    id            integer PRIMARY KEY AUTOINCREMENT,
+    created_at    datetime,
+    order_id      bigint NOT NULL CONSTRAINT fk_orders_history REFERENCES orders (id),
+    from_status   varchar(30),
+    to_status     varchar(30) NOT NULL,
+    changed_by_id bigint NOT NULL,
+    note          varchar(255)
+);
+CREATE INDEX IF NOT EXISTS idx_order_status_changes_order_id ON order_status_changes (order_id);
+CREATE INDEX IF NOT EXISTS idx_order_status_changes_changed_by_id ON order_status_changes (changed_by_id);
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    user_id    bigint NOT NULL,
+    product_id bigint NOT NULL,
+    quantity   numeric NOT NULL,
+    status     varchar(20) DEFAULT 'active',
+    expires_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_user_id ON stock_reservations (user_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_product_id ON stock_reservations (product_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_status ON stock_reservations (status);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_expires_at ON stock_reservations (expires_at);
+
+CREATE TABLE IF NOT EXISTS ai_cache_entries (
+    cache_key  varchar(64) PRIMARY KEY,
+    created_at datetime,
+    value      text NOT NULL,
+    expires_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_ai_cache_entries_expires_at ON ai_cache_entries (expires_at);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id                  integer PRIMARY KEY AUTOINCREMENT,
+    created_at          datetime,
+    updated_at          datetime,
+    user_id             bigint NOT NULL,
+    token_hash          varchar(64) NOT NULL,
+    previous_token_hash varchar(64),
+    expires_at          datetime NOT NULL,
+    last_used_at        datetime,
+    revoked_at          datetime,
+    user_agent          varchar(255),
+    ip                  varchar(45)
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_token_hash ON sessions (token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token_hash ON sessions (previous_token_hash);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions (expires_at);
+CREATE INDEX IF NOT EXISTS idx_sessions_revoked_at ON sessions (revoked_at);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id         integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    user_id    bigint NOT NULL,
+    purpose    varchar(30) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at    datetime
+);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens (user_id);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_purpose ON user_tokens (purpose);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_tokens_token_hash ON user_tokens (token_hash);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role       varchar(30),
+    permission varchar(50),
+    created_at datetime,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id          integer PRIMARY KEY AUTOINCREMENT,
+    created_at  datetime,
+    actor_id    bigint NOT NULL,
+    actor_role  varchar(30),
+    action      varchar(50) NOT NULL,
+    entity_type varchar(30) NOT NULL,
+    entity_id   varchar(64),
+    before      text,
+    after       text,
+    diff        text,
+    ip          varchar(45)
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs (action);
+CREATE INDEX IF NOT EXISTS idx_audit_entity ON audit_logs (entity_type, entity_id);
+
+-- Default staff permissions
+INSERT INTO role_permissions (role, permission, created_at)
+SELECT column1, column2, CURRENT_TIMESTAMP
+FROM (VALUES
+    ('catalog_manager', 'products:write'),
+    ('catalog_manager', 'categories:write'),
+    ('catalog_manager', 'inventory:write'),
+    ('inventory_clerk', 'inventory:write'),
+    ('inventory_clerk', 'orders:read'),
+    ('inventory_clerk', 'orders:update'),
+    ('recipe_editor', 'recipes:write'),
+    ('recipe_editor', 'recipes:review'),
+    ('support_agent', 'users:read'),
+    ('support_agent', 'orders:read'),
+    ('support_agent', 'orders:update'),
+    ('support_agent', 'orders:refund')
+)
+WHERE NOT EXISTS (SELECT 1 FROM role_permissions);
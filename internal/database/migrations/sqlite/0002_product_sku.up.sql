@@ -0,0 +1,4 @@
+-- Optional stock keeping unit, unique among products that are not deleted
+
+ALTER TABLE products ADD COLUMN sku varchar(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_sku ON products (sku) WHERE deleted_at IS NULL;
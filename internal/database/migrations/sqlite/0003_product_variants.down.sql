@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_stock_reservations_variant_id;
+ALTER TABLE stock_reservations DROP COLUMN variant_id;
+DROP INDEX IF EXISTS idx_order_items_variant_id;
+ALTER TABLE order_items DROP COLUMN variant_name;
+ALTER TABLE order_items DROP COLUMN variant_id;
+DROP INDEX IF EXISTS idx_recipe_ingredients_variant_id;
+ALTER TABLE recipe_ingredients DROP COLUMN variant_id;
+DROP INDEX IF EXISTS idx_cart_items_variant_id;
+ALTER TABLE cart_items DROP COLUMN variant_id;
+DROP TABLE IF EXISTS product_variants;
+DROP INDEX IF EXISTS idx_products_barcode;
+ALTER TABLE products DROP COLUMN barcode;
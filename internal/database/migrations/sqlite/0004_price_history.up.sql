@@ -0,0 +1,29 @@
+-- Product price history, and future prices applied by the price scheduler.
+
+CREATE TABLE IF NOT EXISTS price_changes (
+    id                 integer PRIMARY KEY AUTOINCREMENT,
+    created_at         datetime,
+    product_id         bigint NOT NULL CONSTRAINT fk_price_changes_product REFERENCES products (id),
+    old_price          numeric,
+    price              numeric NOT NULL,
+    source             varchar(20) NOT NULL,
+    scheduled_price_id bigint
+);
+CREATE INDEX IF NOT EXISTS idx_price_changes_created_at ON price_changes (created_at);
+CREATE INDEX IF NOT EXISTS idx_price_changes_product_id ON price_changes (product_id);
+
+CREATE TABLE IF NOT EXISTS scheduled_prices (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    created_at   datetime,
+    updated_at   datetime,
+    product_id   bigint NOT NULL CONSTRAINT fk_scheduled_prices_product REFERENCES products (id),
+    price        numeric NOT NULL,
+    effective_at datetime NOT NULL,
+    applied_at   datetime
+);
+CREATE INDEX IF NOT EXISTS idx_scheduled_prices_product_id ON scheduled_prices (product_id);
+CREATE INDEX IF NOT EXISTS idx_scheduled_prices_effective_at ON scheduled_prices (effective_at);
+
+-- Start every existing product's history at its current price
+INSERT INTO price_changes (created_at, product_id, price, source)
+SELECT CURRENT_TIMESTAMP, id, price, 'manual' FROM products WHERE deleted_at IS NULL;
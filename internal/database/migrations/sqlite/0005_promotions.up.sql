@@ -0,0 +1,56 @@
+-- Promotions and coupons, the discounts applied to orders, and the coupon
+-- entered on a cart.
+
+CREATE TABLE IF NOT EXISTS promotions (
+    id             integer PRIMARY KEY AUTOINCREMENT,
+    created_at     datetime,
+    updated_at     datetime,
+    deleted_at     datetime,
+    name           varchar(100) NOT NULL,
+    type           varchar(20) NOT NULL,
+    value          numeric,
+    buy_quantity   numeric,
+    get_quantity   numeric,
+    product_id     bigint,
+    category_id    bigint,
+    code           varchar(50),
+    starts_at      datetime,
+    ends_at        datetime,
+    usage_limit    bigint,
+    per_user_limit bigint,
+    used_count     bigint DEFAULT 0,
+    active         boolean DEFAULT true
+);
+CREATE INDEX IF NOT EXISTS idx_promotions_deleted_at ON promotions (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_promotions_product_id ON promotions (product_id);
+CREATE INDEX IF NOT EXISTS idx_promotions_category_id ON promotions (category_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promotions_code ON promotions (code) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS order_discounts (
+    id           integer PRIMARY KEY AUTOINCREMENT,
+    created_at   datetime,
+    order_id     bigint NOT NULL CONSTRAINT fk_orders_discounts REFERENCES orders (id),
+    user_id      bigint NOT NULL,
+    promotion_id bigint NOT NULL,
+    name         varchar(100) NOT NULL,
+    type         varchar(20) NOT NULL,
+    code         varchar(50),
+    product_id   bigint,
+    amount       numeric NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_order_discounts_order_id ON order_discounts (order_id);
+CREATE INDEX IF NOT EXISTS idx_order_discounts_user_id ON order_discounts (user_id);
+CREATE INDEX IF NOT EXISTS idx_order_discounts_promotion_id ON order_discounts (promotion_id);
+
+ALTER TABLE carts ADD COLUMN coupon_code varchar(50);
+
+ALTER TABLE orders ADD COLUMN subtotal numeric;
+ALTER TABLE orders ADD COLUMN discount_total numeric DEFAULT 0;
+ALTER TABLE orders ADD COLUMN coupon_code varchar(50);
+UPDATE orders SET subtotal = total_price WHERE subtotal IS NULL;
+
+-- Catalog managers run promotions, unless their permissions were changed
+INSERT INTO role_permissions (role, permission, created_at)
+SELECT 'catalog_manager', 'promotions:write', CURRENT_TIMESTAMP
+WHERE EXISTS (SELECT 1 FROM role_permissions WHERE role = 'catalog_manager' AND permission = 'products:write')
+  AND NOT EXISTS (SELECT 1 FROM role_permissions WHERE role = 'catalog_manager' AND permission = 'promotions:write');
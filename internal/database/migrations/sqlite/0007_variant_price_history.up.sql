@@ -0,0 +1,4 @@
+-- Variant price changes go into the price history of their product
+
+ALTER TABLE price_changes ADD COLUMN variant_id bigint;
+CREATE INDEX IF NOT EXISTS idx_price_changes_variant_id ON price_changes (variant_id);
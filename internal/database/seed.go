@@ -0,0 +1,407 @@
+package database
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/units"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+//go:embed fixtures/*.yaml
+var fixtureFiles embed.FS
+
+// FixtureSets are the built-in fixture files, by name
+var FixtureSets = []string{"demo", "test", "empty"}
+
+// Fixtures is the content of a fixture file. Products refer to categories
+// and recipe ingredients to products by name.
+type Fixtures struct {
+	Categories []CategoryFixture `yaml:"categories" json:"categories"`
+	Products   []ProductFixture  `yaml:"products" json:"products"`
+	Recipes    []RecipeFixture   `yaml:"recipes" json:"recipes"`
+}
+
+type CategoryFixture struct {
+	Name string `yaml:"name" json:"name"`
+}
+
+type ProductFixture struct {
+	SKU         string  `yaml:"sku" json:"sku"`
+	Name        string  `yaml:"name" json:"name"`
+	Description string  `yaml:"description" json:"description"`
+	Price       float64 `yaml:"price" json:"price"`
+	Stock       float64 `yaml:"stock" json:"stock"`
+	Unit        string  `yaml:"unit" json:"unit"`
+	Density     float64 `yaml:"density" json:"density"`
+	PieceWeight float64 `yaml:"piece_weight" json:"piece_weight"`
+	Category    string  `yaml:"category" json:"category"`
+	ImageURL    string  `yaml:"image_url" json:"image_url"`
+}
+
+type RecipeFixture struct {
+	Name         string                    `yaml:"name" json:"name"`
+	Description  string                    `yaml:"description" json:"description"`
+	Instructions string                    `yaml:"instructions" json:"instructions"`
+	Servings     int                       `yaml:"servings" json:"servings"`
+	PrepTime     int                       `yaml:"prep_time" json:"prep_time"`
+	CookTime     int                       `yaml:"cook_time" json:"cook_time"`
+	ImageURL     string                    `yaml:"image_url" json:"image_url"`
+	Ingredients  []RecipeIngredientFixture `yaml:"ingredients" json:"ingredients"`
+}
+
+type RecipeIngredientFixture struct {
+	Product  string  `yaml:"product" json:"product"`
+	Quantity float64 `yaml:"quantity" json:"quantity"`
+	Unit     string  `yaml:"unit" json:"unit"`
+	Notes    string  `yaml:"notes" json:"notes"`
+}
+
+// SeedResult counts what a seed run created and updated
+type SeedResult struct {
+	CategoriesCreated, CategoriesUpdated int
+	ProductsCreated, ProductsUpdated     int
+	RecipesCreated, RecipesUpdated       int
+}
+
+func (r *SeedResult) String() string {
+	return fmt.Sprintf("categories: %d created, %d updated; products: %d created, %d updated; recipes: %d created, %d updated",
+		r.CategoriesCreated, r.CategoriesUpdated, r.ProductsCreated, r.ProductsUpdated, r.RecipesCreated, r.RecipesUpdated)
+}
+
+// LoadFixtures reads a built-in fixture set by name, or a .yaml, .yml or
+// .json file by path
+func LoadFixtures(nameOrPath string) (*Fixtures, error) {
+	var data []byte
+	var err error
+	isJSON := false
+
+	if isFixtureSet(nameOrPath) {
+		data, err = fixtureFiles.ReadFile("fixtures/" + nameOrPath + ".yaml")
+	} else {
+		switch strings.ToLower(filepath.Ext(nameOrPath)) {
+		case ".yaml", ".yml":
+		case ".json":
+			isJSON = true
+		default:
+			return nil, fmt.Errorf("unknown fixture set %q (built-in: %s; or a .yaml/.json file)", nameOrPath, strings.Join(FixtureSets, ", "))
+		}
+		data, err = os.ReadFile(nameOrPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fixtures Fixtures
+	if isJSON {
+		err = json.Unmarshal(data, &fixtures)
+	} else {
+		err = yaml.Unmarshal(data, &fixtures)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture file %s: %w", nameOrPath, err)
+	}
+	return &fixtures, nil
+}
+
+func isFixtureSet(name string) bool {
+	for _, set := range FixtureSets {
+		if name == set {
+			return true
+		}
+	}
+	return false
+}
+
+// Seed upserts the fixtures in one transaction. Rows are matched by natural
+// key: category name, product name and normalized recipe name. Existing rows
+// are updated to match the fixture, so running a seed twice changes nothing.
+func Seed(db *gorm.DB, fixtures *Fixtures) (*SeedResult, error) {
+	result := &SeedResult{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		categoryIDs, err := seedCategories(tx, fixtures.Categories, result)
+		if err != nil {
+			return err
+		}
+		products, err := seedProducts(tx, fixtures.Products, categoryIDs, result)
+		if err != nil {
+			return err
+		}
+		return seedRecipes(tx, fixtures.Recipes, products, result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func seedCategories(tx *gorm.DB, fixtures []CategoryFixture, result *SeedResult) (map[string]uint, error) {
+	ids := make(map[string]uint)
+	for _, f := range fixtures {
+		if strings.TrimSpace(f.Name) == "" {
+			return nil, errors.New("category without a name")
+		}
+
+		var category models.Category
+		err := tx.Unscoped().Where("name = ?", f.Name).First(&category).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			category = models.Category{Name: f.Name}
+			if err := tx.Create(&category).Error; err != nil {
+				return nil, fmt.Errorf("category %q: %w", f.Name, err)
+			}
+			result.CategoriesCreated++
+		case err != nil:
+			return nil, err
+		case category.DeletedAt.Valid:
+			// Bring back a soft-deleted category; the name is unique anyway
+			if err := tx.Unscoped().Model(&category).Update("deleted_at", nil).Error; err != nil {
+				return nil, fmt.Errorf("category %q: %w", f.Name, err)
+			}
+			result.CategoriesUpdated++
+		}
+		ids[f.Name] = category.ID
+	}
+
+	// Products may also use categories that exist but aren't in the file
+	var existing []models.Category
+	if err := tx.Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	for _, category := range existing {
+		if _, ok := ids[category.Name]; !ok {
+			ids[category.Name] = category.ID
+		}
+	}
+	return ids, nil
+}
+
+func seedProducts(tx *gorm.DB, fixtures []ProductFixture, categoryIDs map[string]uint, result *SeedResult) (map[string]*models.Product, error) {
+	products := make(map[string]*models.Product)
+	for _, f := range fixtures {
+		categoryID, ok := categoryIDs[f.Category]
+		if !ok {
+			return nil, fmt.Errorf("product %q: unknown category %q", f.Name, f.Category)
+		}
+		unit, err := units.Parse(f.Unit)
+		if err != nil {
+			return nil, fmt.Errorf("product %q: %w", f.Name, err)
+		}
+		if strings.TrimSpace(f.Name) == "" || f.Price <= 0 || f.Stock < 0 {
+			return nil, fmt.Errorf("product %q: name, a positive price and a non-negative stock are required", f.Name)
+		}
+
+		fields := models.Product{
+			Name:        f.Name,
+			Description: f.Description,
+			Price:       f.Price,
+			Stock:       f.Stock,
+			Unit:        unit,
+			Density:     f.Density,
+			PieceWeight: f.PieceWeight,
+			CategoryID:  categoryID,
+			ImageURL:    f.ImageURL,
+		}
+		// Fixtures have no barcodes, so existing ones are kept. A fixture
+		// without a SKU keeps whatever SKU the product already has.
+		omit := []string{"id", "created_at", "deleted_at", "barcode", "sku"}
+		if sku := strings.TrimSpace(f.SKU); sku != "" {
+			fields.SKU = &sku
+			omit = omit[:len(omit)-1]
+		}
+
+		var product models.Product
+		err = tx.Where("name = ?", f.Name).First(&product).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			product = fields
+			if err := tx.Create(&product).Error; err != nil {
+				return nil, fmt.Errorf("product %q: %w", f.Name, err)
+			}
+			if err := seedPriceChange(tx, &product, nil); err != nil {
+				return nil, fmt.Errorf("product %q: %w", f.Name, err)
+			}
+			result.ProductsCreated++
+		case err != nil:
+			return nil, err
+		default:
+			oldPrice := product.Price
+			// Select("*") so zero values (e.g. stock 0) are written too
+			if err := tx.Model(&product).Select("*").Omit(omit...).Updates(&fields).Error; err != nil {
+				return nil, fmt.Errorf("product %q: %w", f.Name, err)
+			}
+			if oldPrice != f.Price {
+				if err := seedPriceChange(tx, &product, &oldPrice); err != nil {
+					return nil, fmt.Errorf("product %q: %w", f.Name, err)
+				}
+			}
+			result.ProductsUpdated++
+		}
+		products[f.Name] = &product
+	}
+	return products, nil
+}
+
+func seedRecipes(tx *gorm.DB, fixtures []RecipeFixture, products map[string]*models.Product, result *SeedResult) error {
+	for _, f := range fixtures {
+		if strings.TrimSpace(f.Name) == "" || len(f.Ingredients) == 0 {
+			return fmt.Errorf("recipe %q: name and at least one ingredient are required", f.Name)
+		}
+
+		var ingredients []models.RecipeIngredient
+		for _, i := range f.Ingredients {
+			product, err := seedProduct(tx, products, i.Product)
+			if err != nil {
+				return fmt.Errorf("recipe %q: %w", f.Name, err)
+			}
+			unit, err := units.Parse(i.Unit)
+			if err != nil {
+				return fmt.Errorf("recipe %q, %s: %w", f.Name, i.Product, err)
+			}
+			if _, err := units.Convert(1, unit, product.Unit, units.ProfileOf(product)); err != nil {
+				return fmt.Errorf("recipe %q: invalid unit for %s: %w", f.Name, product.Name, err)
+			}
+			if i.Quantity <= 0 {
+				return fmt.Errorf("recipe %q, %s: quantity must be positive", f.Name, i.Product)
+			}
+			ingredients = append(ingredients, models.RecipeIngredient{
+				ProductID: product.ID,
+				Quantity:  i.Quantity,
+				Unit:      unit,
+				Notes:     i.Notes,
+			})
+		}
+
+		servings := f.Servings
+		if servings <= 0 {
+			servings = 1
+		}
+		fields := models.Recipe{
+			Name:         f.Name,
+			Description:  f.Description,
+			Instructions: f.Instructions,
+			Servings:     servings,
+			PrepTime:     f.PrepTime,
+			CookTime:     f.CookTime,
+			ImageURL:     f.ImageURL,
+			Status:       models.RecipeStatusApproved,
+			// Set here as well as in BeforeSave: Updates runs the hook on
+			// the loaded row, not on these fields
+			NormalizedName: models.NormalizeRecipeName(f.Name),
+		}
+
+		var recipe models.Recipe
+		err := tx.Where("normalized_name = ?", models.NormalizeRecipeName(f.Name)).First(&recipe).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			recipe = fields
+			recipe.Ingredients = ingredients
+			if err := tx.Create(&recipe).Error; err != nil {
+				return fmt.Errorf("recipe %q: %w", f.Name, err)
+			}
+			result.RecipesCreated++
+			continue
+		case err != nil:
+			return err
+		}
+
+		if err := tx.Model(&recipe).
+			Select("name", "description", "instructions", "servings", "prep_time", "cook_time", "image_url", "status", "normalized_name").
+			Updates(&fields).Error; err != nil {
+			return fmt.Errorf("recipe %q: %w", f.Name, err)
+		}
+		if err := tx.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{}).Error; err != nil {
+			return err
+		}
+		for i := range ingredients {
+			ingredients[i].RecipeID = recipe.ID
+		}
+		if err := tx.Create(&ingredients).Error; err != nil {
+			return fmt.Errorf("recipe %q: %w", f.Name, err)
+		}
+		result.RecipesUpdated++
+	}
+	return nil
+}
+
+// seedPriceChange adds product's seeded price to its price history
+func seedPriceChange(tx *gorm.DB, product *models.Product, oldPrice *float64) error {
+	return tx.Create(&models.PriceChange{
+		ProductID: product.ID,
+		OldPrice:  oldPrice,
+		Price:     product.Price,
+		Source:    models.PriceSourceSeed,
+	}).Error
+}
+
+// seedProduct finds an ingredient's product among the seeded ones, falling
+// back to products already in the database
+func seedProduct(tx *gorm.DB, products map[string]*models.Product, name string) (*models.Product, error) {
+	if product, ok := products[name]; ok {
+		return product, nil
+	}
+	var product models.Product
+	if err := tx.Where("name = ?", name).First(&product).Error; err != nil {
+		return nil, fmt.Errorf("unknown product %q", name)
+	}
+	products[name] = &product
+	return &product, nil
+}
+
+// ResetCatalog deletes all categories, products and recipes, along with the
+// cart items, stock holds, promotions and price history that point at them.
+// Orders keep their own copy of product data and are left alone. For local
+// development only.
+func ResetCatalog(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.RecipeIngredient{},
+			&models.Recipe{},
+			&models.CartItem{},
+			&models.StockReservation{},
+			&models.Promotion{},
+			&models.PriceChange{},
+			&models.ScheduledPrice{},
+			&models.ProductVariant{},
+			&models.Product{},
+			&models.Category{},
+		} {
+			if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SeedIfEmpty loads a fixture set into a database without any categories.
+// Used on startup so a fresh install has a catalog to browse.
+func SeedIfEmpty(nameOrPath string) error {
+	var count int64
+	if err := DB.Model(&models.Category{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		slog.Info("Catalog already has data, skipping seed (use `seed` to load fixtures)")
+		return nil
+	}
+
+	fixtures, err := LoadFixtures(nameOrPath)
+	if err != nil {
+		return err
+	}
+	result, err := Seed(DB, fixtures)
+	if err != nil {
+		return err
+	}
+	slog.Info("Seeded fixtures", "fixtures", nameOrPath, "result", result.String())
+	return nil
+}
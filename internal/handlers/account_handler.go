@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AccountHandler struct {
+	accountService *services.AccountService
+}
+
+func NewAccountHandler(accountService *services.AccountService) *AccountHandler {
+	return &AccountHandler{accountService: accountService}
+}
+
+// VerifyEmail godoc
+// @Summary Confirm an email address
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.VerifyEmailRequest true "Token from the verification link"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/verify-email [post]
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		h.tokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification godoc
+// @Summary Send a new verification link
+// @Description Always succeeds, whether or not the address has an account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.EmailRequest true "Email address"
+// @Success 200 {object} map[string]string
+// @Router /auth/verify-email/resend [post]
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.ResendVerification(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address needs verification, a new link has been sent"})
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset link
+// @Description Always succeeds, whether or not the address has an account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.EmailRequest true "Email address"
+// @Success 200 {object} map[string]string
+// @Router /auth/forgot-password [post]
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req models.EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the address has an account, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Set a new password using a reset link
+// @Description Signs the user out of every session
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/reset-password [post]
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		h.tokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated, please log in again"})
+}
+
+func (h *AccountHandler) tokenError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidAccountToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/bexiiiii/smart_food_store/internal/middleware"
@@ -21,6 +22,15 @@ func NewAIHandler(aiService *services.AIService, cartService *services.CartServi
 	}
 }
 
+// aiErrorStatus maps AI service errors to HTTP status codes. A model that
+// keeps returning malformed output is an upstream failure, not a bad request.
+func aiErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidAIResponse) {
+		return http.StatusBadGateway
+	}
+	return http.StatusBadRequest
+}
+
 // GetIngredientsForDish godoc
 // @Summary Get ingredients for a dish from AI
 // @Description Enter a dish name and AI will suggest products from the store with quantities
@@ -30,6 +40,7 @@ func NewAIHandler(aiService *services.AIService, cartService *services.CartServi
 // @Param request body models.DishToIngredientsRequest true "Dish name and servings"
 // @Success 200 {object} models.DishIngredientsResponse
 // @Failure 400 {object} map[string]string
+// @Failure 502 {object} map[string]string
 // @Router /ai/dish-to-ingredients [post]
 func (h *AIHandler) GetIngredientsForDish(c *gin.Context) {
 	var req models.DishToIngredientsRequest
@@ -46,7 +57,7 @@ func (h *AIHandler) GetIngredientsForDish(c *gin.Context) {
 
 	response, err := h.aiService.GetIngredientsForDish(c.Request.Context(), req.DishName, servings)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(aiErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -70,14 +81,14 @@ func (h *AIHandler) GetRecipesFromCart(c *gin.Context) {
 	}
 
 	// Get cart items with names
-	cartItems, err := h.cartService.GetCartItemNames(userID)
+	cartItems, err := h.cartService.GetCartItemNames(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get cart items"})
 		return
 	}
 
 	// Get product IDs from cart
-	productIDs, err := h.cartService.GetCartProductIDs(userID)
+	productIDs, err := h.cartService.GetCartProductIDs(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get cart items"})
 		return
@@ -90,7 +101,7 @@ func (h *AIHandler) GetRecipesFromCart(c *gin.Context) {
 
 	suggestions, err := h.aiService.GetRecipesFromCart(c.Request.Context(), productIDs)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(aiErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -122,7 +133,7 @@ func (h *AIHandler) GetRecipesFromProducts(c *gin.Context) {
 
 	suggestions, err := h.aiService.GetRecipesFromCart(c.Request.Context(), req.ProductIDs)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(aiErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -169,7 +180,7 @@ func (h *AIHandler) AddAISuggestionToCart(c *gin.Context) {
 		return
 	}
 
-	cart, err := h.cartService.AddMultipleItems(userID, items)
+	cart, err := h.cartService.AddMultipleItems(c.Request.Context(), userID, items)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
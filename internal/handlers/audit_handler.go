@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// GetAuditLog godoc (Admin only)
+// @Summary List admin changes, newest first
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param actor_id query int false "Acting user ID"
+// @Param action query string false "Action, e.g. product.update"
+// @Param entity_type query string false "Entity type, e.g. product"
+// @Param entity_id query string false "Entity ID"
+// @Param from query string false "Earliest time (RFC 3339)"
+// @Param to query string false "Latest time, exclusive (RFC 3339)"
+// @Param page query int false "Page number"
+// @Param limit query int false "Page size (max 100)"
+// @Success 200 {object} models.AuditLogListResponse
+// @Failure 400 {object} map[string]string
+// @Router /admin/audit [get]
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	var q models.AuditQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.auditService.List(c.Request.Context(), &q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -11,11 +11,15 @@ import (
 )
 
 type CartHandler struct {
-	cartService *services.CartService
+	cartService        *services.CartService
+	reservationService *services.ReservationService
 }
 
-func NewCartHandler(cartService *services.CartService) *CartHandler {
-	return &CartHandler{cartService: cartService}
+func NewCartHandler(cartService *services.CartService, reservationService *services.ReservationService) *CartHandler {
+	return &CartHandler{
+		cartService:        cartService,
+		reservationService: reservationService,
+	}
 }
 
 // GetCart godoc
@@ -33,7 +37,7 @@ func (h *CartHandler) GetCart(c *gin.Context) {
 		return
 	}
 
-	cart, err := h.cartService.GetCart(userID)
+	cart, err := h.cartService.GetCart(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -65,7 +69,7 @@ func (h *CartHandler) AddItem(c *gin.Context) {
 		return
 	}
 
-	cart, err := h.cartService.AddItem(userID, &req)
+	cart, err := h.cartService.AddItem(c.Request.Context(), userID, &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -81,6 +85,7 @@ func (h *CartHandler) AddItem(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param product_id path int true "Product ID"
+// @Param variant_id query int false "Variant ID, for a line of one of the product's variants (quantity in packs)"
 // @Param quantity body map[string]float64 true "Quantity"
 // @Success 200 {object} models.CartResponse
 // @Failure 400 {object} map[string]string
@@ -98,6 +103,12 @@ func (h *CartHandler) UpdateItemQuantity(c *gin.Context) {
 		return
 	}
 
+	variantID, err := variantIDQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
 	var req struct {
 		Quantity float64 `json:"quantity" binding:"required"`
 	}
@@ -106,7 +117,7 @@ func (h *CartHandler) UpdateItemQuantity(c *gin.Context) {
 		return
 	}
 
-	cart, err := h.cartService.UpdateItemQuantity(userID, uint(productID), req.Quantity)
+	cart, err := h.cartService.UpdateItemQuantity(c.Request.Context(), userID, uint(productID), variantID, req.Quantity)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -121,6 +132,7 @@ func (h *CartHandler) UpdateItemQuantity(c *gin.Context) {
 // @Security BearerAuth
 // @Produce json
 // @Param product_id path int true "Product ID"
+// @Param variant_id query int false "Variant ID, for a line of one of the product's variants"
 // @Success 200 {object} models.CartResponse
 // @Failure 400 {object} map[string]string
 // @Router /cart/items/{product_id} [delete]
@@ -137,7 +149,13 @@ func (h *CartHandler) RemoveItem(c *gin.Context) {
 		return
 	}
 
-	cart, err := h.cartService.RemoveItem(userID, uint(productID))
+	variantID, err := variantIDQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	cart, err := h.cartService.RemoveItem(c.Request.Context(), userID, uint(productID), variantID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -146,6 +164,20 @@ func (h *CartHandler) RemoveItem(c *gin.Context) {
 	c.JSON(http.StatusOK, cart)
 }
 
+// variantIDQuery reads the optional variant_id query parameter
+func variantIDQuery(c *gin.Context) (*uint, error) {
+	value := c.Query("variant_id")
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	variantID := uint(id)
+	return &variantID, nil
+}
+
 // ClearCart godoc
 // @Summary Clear all items from cart
 // @Tags cart
@@ -161,7 +193,7 @@ func (h *CartHandler) ClearCart(c *gin.Context) {
 		return
 	}
 
-	if err := h.cartService.ClearCart(userID); err != nil {
+	if err := h.cartService.ClearCart(c.Request.Context(), userID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -192,7 +224,64 @@ func (h *CartHandler) AddMultipleItems(c *gin.Context) {
 		return
 	}
 
-	cart, err := h.cartService.AddMultipleItems(userID, items)
+	cart, err := h.cartService.AddMultipleItems(c.Request.Context(), userID, items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// ApplyCoupon godoc
+// @Summary Enter a coupon code on the cart
+// @Description Codes are case-insensitive. Coupons that are expired, used up or not yet valid are rejected.
+// @Tags cart
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param coupon body models.CouponRequest true "Coupon code"
+// @Success 200 {object} models.CartResponse
+// @Failure 400 {object} map[string]string
+// @Router /cart/coupon [post]
+func (h *CartHandler) ApplyCoupon(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req models.CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.ApplyCoupon(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// RemoveCoupon godoc
+// @Summary Remove the coupon from the cart
+// @Tags cart
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.CartResponse
+// @Failure 400 {object} map[string]string
+// @Router /cart/coupon [delete]
+func (h *CartHandler) RemoveCoupon(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	cart, err := h.cartService.RemoveCoupon(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -200,3 +289,51 @@ func (h *CartHandler) AddMultipleItems(c *gin.Context) {
 
 	c.JSON(http.StatusOK, cart)
 }
+
+// ReserveStock godoc
+// @Summary Hold stock for every cart item while the user checks out
+// @Description Holds expire after STOCK_HOLD_TTL; calling again refreshes the hold
+// @Tags cart
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.ReservationResponse
+// @Failure 400 {object} map[string]string
+// @Router /cart/reserve [post]
+func (h *CartHandler) ReserveStock(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	reservation, err := h.reservationService.Reserve(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// ReleaseStock godoc
+// @Summary Release stock held for the user's cart
+// @Tags cart
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /cart/reserve [delete]
+func (h *CartHandler) ReleaseStock(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.reservationService.Release(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reservation released successfully"})
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bexiiiii/smart_food_store/internal/middleware"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type OrderHandler struct {
+	orderService *services.OrderService
+	permissions  middleware.PermissionChecker
+}
+
+func NewOrderHandler(orderService *services.OrderService, permissions middleware.PermissionChecker) *OrderHandler {
+	return &OrderHandler{orderService: orderService, permissions: permissions}
+}
+
+// Checkout godoc
+// @Summary Place an order from the current cart
+// @Tags orders
+// @Security BearerAuth
+// @Produce json
+// @Success 201 {object} models.Order
+// @Failure 400 {object} map[string]string
+// @Router /orders [post]
+func (h *OrderHandler) Checkout(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	order, err := h.orderService.Checkout(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+// GetOrders godoc
+// @Summary Get order history of the current user
+// @Tags orders
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.Order
+// @Router /orders [get]
+func (h *OrderHandler) GetOrders(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	orders, err := h.orderService.GetUserOrders(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// GetOrderByID godoc
+// @Summary Get a single order of the current user
+// @Tags orders
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 404 {object} map[string]string
+// @Router /orders/{id} [get]
+func (h *OrderHandler) GetOrderByID(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := h.orderService.GetUserOrder(c.Request.Context(), userID, uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// Admin handlers
+
+// GetAllOrders godoc (Admin only)
+// @Summary Get all orders
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param status query string false "Filter by status"
+// @Success 200 {array} models.Order
+// @Router /admin/orders [get]
+func (h *OrderHandler) GetAllOrders(c *gin.Context) {
+	orders, err := h.orderService.GetAll(c.Request.Context(), models.OrderStatus(c.Query("status")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// GetAnyOrderByID godoc (Admin only)
+// @Summary Get any order by ID, including its status history
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 404 {object} map[string]string
+// @Router /admin/orders/{id} [get]
+func (h *OrderHandler) GetAnyOrderByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := h.orderService.GetByID(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// UpdateOrderStatus godoc (Admin only)
+// @Summary Move an order to a new status
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param request body models.OrderStatusUpdateRequest true "New status"
+// @Success 200 {object} models.Order
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/orders/{id}/status [patch]
+func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	adminID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req models.OrderStatusUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Refunds need their own permission on top of orders:update
+	if req.Status == models.OrderStatusRefunded {
+		role, _ := middleware.GetUserRole(c)
+		allowed, err := h.permissions.HasPermission(c.Request.Context(), role, models.PermOrdersRefund)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission: " + string(models.PermOrdersRefund)})
+			return
+		}
+	}
+
+	order, err := h.orderService.UpdateStatus(c.Request.Context(), uint(id), adminID, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
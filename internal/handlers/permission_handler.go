@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bexiiiii/smart_food_store/internal/middleware"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type PermissionHandler struct {
+	permissionService *services.PermissionService
+}
+
+func NewPermissionHandler(permissionService *services.PermissionService) *PermissionHandler {
+	return &PermissionHandler{permissionService: permissionService}
+}
+
+// GetRoles godoc (Admin only)
+// @Summary List roles with their permissions
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.RolePermissionsResponse
+// @Router /admin/roles [get]
+func (h *PermissionHandler) GetRoles(c *gin.Context) {
+	roles, err := h.permissionService.GetAll(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetPermissions godoc (Admin only)
+// @Summary List every permission that can be granted
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} string
+// @Router /admin/permissions [get]
+func (h *PermissionHandler) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.AllPermissions)
+}
+
+// UpdateRolePermissions godoc (Admin only)
+// @Summary Replace the permissions of a staff role
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param role path string true "Role"
+// @Param request body models.RolePermissionsUpdateRequest true "Permissions"
+// @Success 200 {object} models.RolePermissionsResponse
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /admin/roles/{role}/permissions [put]
+func (h *PermissionHandler) UpdateRolePermissions(c *gin.Context) {
+	var req models.RolePermissionsUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	caller, _ := middleware.GetUserRole(c)
+	response, err := h.permissionService.SetRolePermissions(c.Request.Context(), caller, models.Role(c.Param("role")), req.Permissions)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRolePermissions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrPermissionDenied) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
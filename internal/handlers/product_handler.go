@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/bexiiiii/smart_food_store/internal/barcode"
+	"github.com/bexiiiii/smart_food_store/internal/middleware"
 	"github.com/bexiiiii/smart_food_store/internal/models"
 	"github.com/bexiiiii/smart_food_store/internal/services"
 	"github.com/gin-gonic/gin"
@@ -18,14 +24,40 @@ func NewProductHandler(productService *services.ProductService) *ProductHandler
 }
 
 // GetAllProducts godoc
-// @Summary Get all products
+// @Summary List products
 // @Tags products
 // @Produce json
-// @Success 200 {array} models.Product
+// @Param page query int false "Page number (default 1)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "relevance (default with q), price, name or created_at (default)"
+// @Param order query string false "asc (default) or desc"
+// @Param category_id query int false "Category ID"
+// @Param min_price query number false "Minimum price"
+// @Param max_price query number false "Maximum price"
+// @Param unit query string false "Unit"
+// @Param in_stock query bool false "Only products in (true) or out of (false) stock"
+// @Param q query string false "Text search"
+// @Success 200 {object} models.ProductListResponse
+// @Failure 400 {object} map[string]string
 // @Router /products [get]
 func (h *ProductHandler) GetAllProducts(c *gin.Context) {
-	products, err := h.productService.GetAll()
+	var query models.ProductQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.listProducts(c, &query)
+}
+
+func (h *ProductHandler) listProducts(c *gin.Context, query *models.ProductQuery) {
+	products, err := h.productService.List(c.Request.Context(), query)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidProductQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get products"})
 		return
 	}
@@ -48,7 +80,7 @@ func (h *ProductHandler) GetProductByID(c *gin.Context) {
 		return
 	}
 
-	product, err := h.productService.GetByID(uint(id))
+	product, err := h.productService.GetByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
@@ -57,12 +89,78 @@ func (h *ProductHandler) GetProductByID(c *gin.Context) {
 	c.JSON(http.StatusOK, product)
 }
 
+// GetProductPriceHistory godoc
+// @Summary Get a product's price history
+// @Description Price changes oldest first, each with the previous price and what changed it (manual, import, schedule, seed)
+// @Tags products
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param days query int false "Only changes from the last N days"
+// @Success 200 {object} models.PriceHistoryResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /products/{id}/price-history [get]
+func (h *ProductHandler) GetProductPriceHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	days := 0
+	if value := c.Query("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive number"})
+			return
+		}
+	}
+
+	history, err := h.productService.GetPriceHistory(c.Request.Context(), uint(id), days)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// GetProductByBarcode godoc
+// @Summary Look up a product by a scanned barcode
+// @Description Accepts EAN-13, UPC-A and EAN-8. If the barcode belongs to a variant, the variant is returned along with its product.
+// @Tags products
+// @Produce json
+// @Param code path string true "Barcode"
+// @Success 200 {object} models.BarcodeLookupResponse
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /products/barcode/{code} [get]
+func (h *ProductHandler) GetProductByBarcode(c *gin.Context) {
+	result, err := h.productService.GetByBarcode(c.Request.Context(), c.Param("code"))
+	if err != nil {
+		if errors.Is(err, barcode.ErrInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // GetProductsByCategory godoc
 // @Summary Get products by category
+// @Description Accepts the same query parameters as GET /products
 // @Tags products
 // @Produce json
 // @Param category_id path int true "Category ID"
-// @Success 200 {array} models.Product
+// @Success 200 {object} models.ProductListResponse
+// @Failure 400 {object} map[string]string
 // @Router /products/category/{category_id} [get]
 func (h *ProductHandler) GetProductsByCategory(c *gin.Context) {
 	categoryID, err := strconv.ParseUint(c.Param("category_id"), 10, 32)
@@ -71,36 +169,38 @@ func (h *ProductHandler) GetProductsByCategory(c *gin.Context) {
 		return
 	}
 
-	products, err := h.productService.GetByCategory(uint(categoryID))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get products"})
+	var query models.ProductQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	id := uint(categoryID)
+	query.CategoryID = &id
 
-	c.JSON(http.StatusOK, products)
+	h.listProducts(c, &query)
 }
 
 // SearchProducts godoc
 // @Summary Search products
+// @Description Accepts the same query parameters as GET /products; q is required
 // @Tags products
 // @Produce json
 // @Param q query string true "Search query"
-// @Success 200 {array} models.Product
+// @Success 200 {object} models.ProductListResponse
+// @Failure 400 {object} map[string]string
 // @Router /products/search [get]
 func (h *ProductHandler) SearchProducts(c *gin.Context) {
-	query := c.Query("q")
-	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query required"})
+	var query models.ProductQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	products, err := h.productService.Search(query)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+	if query.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query required"})
 		return
 	}
 
-	c.JSON(http.StatusOK, products)
+	h.listProducts(c, &query)
 }
 
 // GetAllCategories godoc
@@ -110,7 +210,7 @@ func (h *ProductHandler) SearchProducts(c *gin.Context) {
 // @Success 200 {array} models.Category
 // @Router /categories [get]
 func (h *ProductHandler) GetAllCategories(c *gin.Context) {
-	categories, err := h.productService.GetAllCategories()
+	categories, err := h.productService.GetAllCategories(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get categories"})
 		return
@@ -138,7 +238,7 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := h.productService.Create(&req)
+	product, err := h.productService.Create(c.Request.Context(), &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -171,7 +271,7 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := h.productService.Update(uint(id), &req)
+	product, err := h.productService.Update(c.Request.Context(), uint(id), &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -180,6 +280,339 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	c.JSON(http.StatusOK, product)
 }
 
+// UpdateProductStock godoc (Admin only)
+// @Summary Set a product's stock level
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param request body models.ProductStockUpdateRequest true "New stock level"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} map[string]string
+// @Router /admin/products/{id}/stock [patch]
+func (h *ProductHandler) UpdateProductStock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.ProductStockUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.productService.Update(c.Request.Context(), uint(id), &models.ProductUpdateRequest{Stock: req.Stock})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// CreateProductVariant godoc (Admin only)
+// @Summary Add a size or pack to a product
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param variant body models.ProductVariantCreateRequest true "Variant data"
+// @Success 201 {object} models.Product
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/products/{id}/variants [post]
+func (h *ProductHandler) CreateProductVariant(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.ProductVariantCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.productService.CreateVariant(c.Request.Context(), uint(id), &req)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+// UpdateProductVariant godoc (Admin only)
+// @Summary Update a product variant
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param variant_id path int true "Variant ID"
+// @Param variant body models.ProductVariantUpdateRequest true "Variant data"
+// @Success 200 {object} models.Product
+// @Failure 400 {object} map[string]string
+// @Router /admin/products/{id}/variants/{variant_id} [put]
+func (h *ProductHandler) UpdateProductVariant(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	variantID, err := strconv.ParseUint(c.Param("variant_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var req models.ProductVariantUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.productService.UpdateVariant(c.Request.Context(), uint(id), uint(variantID), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// DeleteProductVariant godoc (Admin only)
+// @Summary Delete a product variant
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param variant_id path int true "Variant ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /admin/products/{id}/variants/{variant_id} [delete]
+func (h *ProductHandler) DeleteProductVariant(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	variantID, err := strconv.ParseUint(c.Param("variant_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	if err := h.productService.DeleteVariant(c.Request.Context(), uint(id), uint(variantID)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Variant deleted successfully"})
+}
+
+// Imports larger than this are rejected
+const maxProductImportSize = 10 << 20
+
+const importTooLargeMessage = "Import file is larger than 10 MB"
+
+// isTooLarge reports whether err comes from reading past a MaxBytesReader
+func isTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// GetScheduledPrices godoc (Admin only)
+// @Summary List a product's scheduled prices
+// @Description Includes applied ones (applied_at set), in the order they take effect
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Product ID"
+// @Success 200 {array} models.ScheduledPrice
+// @Failure 404 {object} map[string]string
+// @Router /admin/products/{id}/scheduled-prices [get]
+func (h *ProductHandler) GetScheduledPrices(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	scheduled, err := h.productService.GetScheduledPrices(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+// SchedulePrice godoc (Admin only)
+// @Summary Schedule a future price for a product
+// @Description The price is applied by a background job once effective_at has passed
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param price body models.ScheduledPriceRequest true "Price and when it takes effect"
+// @Success 201 {object} models.ScheduledPrice
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/products/{id}/scheduled-prices [post]
+func (h *ProductHandler) SchedulePrice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.ScheduledPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scheduled, err := h.productService.SchedulePrice(c.Request.Context(), uint(id), &req)
+	if err != nil {
+		if errors.Is(err, services.ErrProductNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, scheduled)
+}
+
+// CancelScheduledPrice godoc (Admin only)
+// @Summary Cancel a scheduled price that hasn't been applied yet
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param schedule_id path int true "Scheduled price ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /admin/products/{id}/scheduled-prices/{schedule_id} [delete]
+func (h *ProductHandler) CancelScheduledPrice(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	scheduleID, err := strconv.ParseUint(c.Param("schedule_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled price ID"})
+		return
+	}
+
+	if err := h.productService.CancelScheduledPrice(c.Request.Context(), uint(id), uint(scheduleID)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled price cancelled successfully"})
+}
+
+// ImportProducts godoc (Admin only)
+// @Summary Create and update products from CSV
+// @Description Columns: sku, barcode, name, description, price, stock, unit, category, density, piece_weight, image_url (any order, sku or name required). Rows update the product with the same SKU, else the same name, else create one. Empty cells keep the current value. Nothing is saved if any row is invalid.
+// @Tags admin
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Accept text/csv
+// @Produce json
+// @Param file formData file false "CSV file (or send the CSV as the request body)"
+// @Param dry_run query bool false "Validate only, save nothing"
+// @Success 200 {object} models.ProductImportResult
+// @Failure 400 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} models.ProductImportResult
+// @Router /admin/products/import [post]
+func (h *ProductHandler) ImportProducts(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxProductImportSize)
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			if isTooLarge(err) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": importTooLargeMessage})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing CSV file in the \"file\" field"})
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read uploaded file"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	actorID, _ := middleware.GetUserID(c)
+	actorRole, _ := middleware.GetUserRole(c)
+	actor := models.AuditEntry{ActorID: actorID, ActorRole: actorRole, IP: c.ClientIP()}
+
+	result, err := h.productService.Import(c.Request.Context(), body, dryRun, actor)
+	if err != nil {
+		if isTooLarge(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": importTooLargeMessage})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidImport) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// ExportProducts godoc (Admin only)
+// @Summary Download all products as CSV
+// @Description Same columns as the import, so an edited export can be imported back.
+// @Tags admin
+// @Security BearerAuth
+// @Produce text/csv
+// @Success 200 {file} file
+// @Router /admin/products/export [get]
+func (h *ProductHandler) ExportProducts(c *gin.Context) {
+	var buf bytes.Buffer
+	if err := h.productService.Export(c.Request.Context(), &buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="products.csv"`)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
 // DeleteProduct godoc (Admin only)
 // @Summary Delete a product
 // @Tags admin
@@ -196,7 +629,7 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.productService.Delete(uint(id)); err != nil {
+	if err := h.productService.Delete(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -221,7 +654,7 @@ func (h *ProductHandler) CreateCategory(c *gin.Context) {
 		return
 	}
 
-	category, err := h.productService.CreateCategory(&req)
+	category, err := h.productService.CreateCategory(c.Request.Context(), &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -254,7 +687,7 @@ func (h *ProductHandler) UpdateCategory(c *gin.Context) {
 		return
 	}
 
-	category, err := h.productService.UpdateCategory(uint(id), req.Name)
+	category, err := h.productService.UpdateCategory(c.Request.Context(), uint(id), req.Name)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -279,7 +712,7 @@ func (h *ProductHandler) DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	if err := h.productService.DeleteCategory(uint(id)); err != nil {
+	if err := h.productService.DeleteCategory(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
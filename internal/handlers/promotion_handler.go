@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type PromotionHandler struct {
+	promotionService *services.PromotionService
+}
+
+func NewPromotionHandler(promotionService *services.PromotionService) *PromotionHandler {
+	return &PromotionHandler{promotionService: promotionService}
+}
+
+// GetAllPromotions godoc (Admin only)
+// @Summary List promotions and coupons
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.Promotion
+// @Router /admin/promotions [get]
+func (h *PromotionHandler) GetAllPromotions(c *gin.Context) {
+	promotions, err := h.promotionService.GetAll(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, promotions)
+}
+
+// GetPromotionByID godoc (Admin only)
+// @Summary Get a promotion
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Success 200 {object} models.Promotion
+// @Failure 404 {object} map[string]string
+// @Router /admin/promotions/{id} [get]
+func (h *PromotionHandler) GetPromotionByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	promotion, err := h.promotionService.GetByID(c.Request.Context(), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, promotion)
+}
+
+// CreatePromotion godoc (Admin only)
+// @Summary Create a promotion or coupon
+// @Description percentage: value % off; fixed: value off each unit of the matching lines, or once off the order; buy_x_get_y: get_quantity free for every buy_quantity bought. Set product_id or category_id to discount matching lines, neither to discount the order. A code makes it a coupon.
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param promotion body models.PromotionCreateRequest true "Promotion data"
+// @Success 201 {object} models.Promotion
+// @Failure 400 {object} map[string]string
+// @Router /admin/promotions [post]
+func (h *PromotionHandler) CreatePromotion(c *gin.Context) {
+	var req models.PromotionCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	promotion, err := h.promotionService.Create(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, promotion)
+}
+
+// UpdatePromotion godoc (Admin only)
+// @Summary Update a promotion
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Param promotion body models.PromotionUpdateRequest true "Fields to change"
+// @Success 200 {object} models.Promotion
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/promotions/{id} [put]
+func (h *PromotionHandler) UpdatePromotion(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	var req models.PromotionUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	promotion, err := h.promotionService.Update(c.Request.Context(), uint(id), &req)
+	if err != nil {
+		if errors.Is(err, services.ErrPromotionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, promotion)
+}
+
+// DeletePromotion godoc (Admin only)
+// @Summary Delete a promotion
+// @Description Orders keep the discounts they were given
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /admin/promotions/{id} [delete]
+func (h *PromotionHandler) DeletePromotion(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return
+	}
+
+	if err := h.promotionService.Delete(c.Request.Context(), uint(id)); err != nil {
+		if errors.Is(err, services.ErrPromotionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Promotion deleted successfully"})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -25,7 +27,7 @@ func NewRecipeHandler(recipeService *services.RecipeService) *RecipeHandler {
 // @Success 200 {array} models.Recipe
 // @Router /recipes [get]
 func (h *RecipeHandler) GetAllRecipes(c *gin.Context) {
-	recipes, err := h.recipeService.GetAll()
+	recipes, err := h.recipeService.GetAll(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get recipes"})
 		return
@@ -49,7 +51,7 @@ func (h *RecipeHandler) GetRecipeByID(c *gin.Context) {
 		return
 	}
 
-	recipe, err := h.recipeService.GetByID(uint(id))
+	recipe, err := h.recipeService.GetByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Recipe not found"})
 		return
@@ -72,7 +74,7 @@ func (h *RecipeHandler) SearchRecipes(c *gin.Context) {
 		return
 	}
 
-	recipes, err := h.recipeService.Search(query)
+	recipes, err := h.recipeService.Search(c.Request.Context(), query)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
 		return
@@ -104,7 +106,7 @@ func (h *RecipeHandler) CalculateIngredients(c *gin.Context) {
 		return
 	}
 
-	ingredients, totalPrice, err := h.recipeService.CalculateIngredients(uint(id), servings)
+	ingredients, totalPrice, err := h.recipeService.CalculateIngredients(c.Request.Context(), uint(id), servings)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -148,7 +150,7 @@ func (h *RecipeHandler) AddRecipeToCart(c *gin.Context) {
 		return
 	}
 
-	cart, err := h.recipeService.AddRecipeToCart(userID, uint(id), req.Servings)
+	cart, err := h.recipeService.AddRecipeToCart(c.Request.Context(), userID, uint(id), req.Servings)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -174,7 +176,7 @@ func (h *RecipeHandler) CreateRecipe(c *gin.Context) {
 		return
 	}
 
-	recipe, err := h.recipeService.Create(&req)
+	recipe, err := h.recipeService.Create(c.Request.Context(), &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -207,7 +209,7 @@ func (h *RecipeHandler) UpdateRecipe(c *gin.Context) {
 		return
 	}
 
-	recipe, err := h.recipeService.Update(uint(id), &req)
+	recipe, err := h.recipeService.Update(c.Request.Context(), uint(id), &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -232,10 +234,127 @@ func (h *RecipeHandler) DeleteRecipe(c *gin.Context) {
 		return
 	}
 
-	if err := h.recipeService.Delete(uint(id)); err != nil {
+	if err := h.recipeService.Delete(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Recipe deleted successfully"})
 }
+
+// SaveAISuggestion godoc
+// @Summary Save an AI recipe suggestion for admin review
+// @Tags ai
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param suggestion body models.AIRecipeSuggestion true "Suggestion returned by the AI endpoints"
+// @Success 201 {object} models.Recipe
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]interface{}
+// @Router /ai/suggestions/save [post]
+func (h *RecipeHandler) SaveAISuggestion(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req models.AIRecipeSuggestion
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipe, err := h.recipeService.SaveAISuggestion(c.Request.Context(), userID, &req)
+	if err != nil {
+		var dup *services.DuplicateRecipeError
+		if errors.As(err, &dup) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "Recipe already exists",
+				"recipe_id": dup.Existing.ID,
+				"status":    dup.Existing.Status,
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, recipe)
+}
+
+// GetRecipesForReview godoc (Admin only)
+// @Summary List recipes by review status
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param status query string false "pending (default), approved or rejected"
+// @Success 200 {array} models.Recipe
+// @Failure 400 {object} map[string]string
+// @Router /admin/recipes [get]
+func (h *RecipeHandler) GetRecipesForReview(c *gin.Context) {
+	status := models.RecipeStatus(c.DefaultQuery("status", string(models.RecipeStatusPending)))
+	switch status {
+	case models.RecipeStatusPending, models.RecipeStatusApproved, models.RecipeStatusRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe status"})
+		return
+	}
+
+	recipes, err := h.recipeService.GetByStatus(c.Request.Context(), status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get recipes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, recipes)
+}
+
+// ApproveRecipe godoc (Admin only)
+// @Summary Approve a recipe so it is publicly listed
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Recipe ID"
+// @Success 200 {object} models.Recipe
+// @Failure 400 {object} map[string]string
+// @Router /admin/recipes/{id}/approve [post]
+func (h *RecipeHandler) ApproveRecipe(c *gin.Context) {
+	h.reviewRecipe(c, h.recipeService.Approve)
+}
+
+// RejectRecipe godoc (Admin only)
+// @Summary Reject a recipe
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Recipe ID"
+// @Success 200 {object} models.Recipe
+// @Failure 400 {object} map[string]string
+// @Router /admin/recipes/{id}/reject [post]
+func (h *RecipeHandler) RejectRecipe(c *gin.Context) {
+	h.reviewRecipe(c, h.recipeService.Reject)
+}
+
+func (h *RecipeHandler) reviewRecipe(c *gin.Context, review func(ctx context.Context, id uint, adminID uint) (*models.Recipe, error)) {
+	adminID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+
+	recipe, err := review(c.Request.Context(), uint(id), adminID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, recipe)
+}
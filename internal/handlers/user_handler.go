@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,10 +13,11 @@ import (
 
 type UserHandler struct {
 	userService *services.UserService
+	permissions *services.PermissionService
 }
 
-func NewUserHandler(userService *services.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService *services.UserService, permissions *services.PermissionService) *UserHandler {
+	return &UserHandler{userService: userService, permissions: permissions}
 }
 
 // Register godoc
@@ -24,6 +26,7 @@ func NewUserHandler(userService *services.UserService) *UserHandler {
 // @Accept json
 // @Produce json
 // @Param request body models.UserRegisterRequest true "Registration data"
+// @Description With REQUIRE_EMAIL_VERIFICATION=true no tokens are returned; the user signs in after following the mailed link.
 // @Success 201 {object} models.AuthResponse
 // @Failure 400 {object} map[string]string
 // @Router /auth/register [post]
@@ -34,7 +37,7 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
-	response, err := h.userService.Register(&req)
+	response, err := h.userService.Register(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -51,6 +54,7 @@ func (h *UserHandler) Register(c *gin.Context) {
 // @Param request body models.UserLoginRequest true "Login credentials"
 // @Success 200 {object} models.AuthResponse
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Router /auth/login [post]
 func (h *UserHandler) Login(c *gin.Context) {
 	var req models.UserLoginRequest
@@ -59,8 +63,12 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.userService.Login(&req)
+	response, err := h.userService.Login(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
@@ -68,6 +76,99 @@ func (h *UserHandler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// Refresh godoc
+// @Summary Exchange a refresh token for new tokens
+// @Description The refresh token is rotated; the old one stops working. Reusing an old refresh token revokes the session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.AuthResponse
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /auth/refresh [post]
+func (h *UserHandler) Refresh(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.userService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout godoc
+// @Summary Log out the current session
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/logout [post]
+func (h *UserHandler) Logout(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	sessionID, ok := middleware.GetSessionID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.userService.Logout(c.Request.Context(), userID, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll godoc
+// @Summary Log out every session of the current user
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/logout-all [post]
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.userService.LogoutAll(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all sessions"})
+}
+
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+}
+
 // GetProfile godoc
 // @Summary Get current user profile
 // @Tags users
@@ -83,7 +184,7 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetByID(userID)
+	user, err := h.userService.GetByID(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -101,7 +202,7 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 // @Failure 403 {object} map[string]string
 // @Router /admin/users [get]
 func (h *UserHandler) GetAllUsers(c *gin.Context) {
-	users, err := h.userService.GetAll()
+	users, err := h.userService.GetAll(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get users"})
 		return
@@ -126,7 +227,7 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.GetByID(uint(id))
+	user, err := h.userService.GetByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -145,6 +246,8 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 // @Param role body map[string]string true "New role"
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
 // @Router /admin/users/{id}/role [patch]
 func (h *UserHandler) UpdateUserRole(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -162,13 +265,20 @@ func (h *UserHandler) UpdateUserRole(c *gin.Context) {
 	}
 
 	role := models.Role(req.Role)
-	if role != models.RoleUser && role != models.RoleAdmin {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role. Must be 'user' or 'admin'"})
+	if !role.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
 		return
 	}
 
-	if err := h.userService.UpdateRole(uint(id), role); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+	// Staff granted roles:manage may only hand out roles with access they
+	// have themselves, and may not touch admins
+	caller, _ := middleware.GetUserRole(c)
+	if err := h.permissions.CanAssignRole(c.Request.Context(), caller, role); err != nil {
+		userError(c, err)
+		return
+	}
+	if err := h.userService.UpdateRole(c.Request.Context(), caller, uint(id), role); err != nil {
+		userError(c, err)
 		return
 	}
 
@@ -182,6 +292,7 @@ func (h *UserHandler) UpdateUserRole(c *gin.Context) {
 // @Produce json
 // @Param id path int true "User ID"
 // @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Router /admin/users/{id} [delete]
 func (h *UserHandler) DeleteUser(c *gin.Context) {
@@ -191,10 +302,23 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := h.userService.Delete(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+	caller, _ := middleware.GetUserRole(c)
+	if err := h.userService.Delete(c.Request.Context(), caller, uint(id)); err != nil {
+		userError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// userError answers a failed change to another user's account
+func userError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPermissionDenied):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,36 @@
+// Package mailer sends transactional email (verification links, password
+// resets). SMTPMailer talks to a real server; LogMailer writes messages to
+// the log or a file for development and tests.
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New builds the mailer selected by cfg.MailDriver: "log" (default) or "smtp"
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailDriver {
+	case "", "log":
+		return NewLogMailer(cfg.MailLogFile), nil
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER=smtp requires SMTP_HOST")
+		}
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.MailDriver)
+	}
+}
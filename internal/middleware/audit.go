@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditRecorder loads entity snapshots and stores audit entries
+type AuditRecorder interface {
+	Snapshot(ctx context.Context, entityType, entityID string) interface{}
+	Record(ctx context.Context, entry *models.AuditEntry) error
+}
+
+type AuditMiddleware struct {
+	recorder AuditRecorder
+}
+
+func NewAuditMiddleware(recorder AuditRecorder) *AuditMiddleware {
+	return &AuditMiddleware{recorder: recorder}
+}
+
+// Track records a successful admin write in the audit log. The entity is
+// identified by the route's path parameter (":id" or ":role"); it is
+// snapshotted before and after the handler runs. Routes without a parameter
+// create an entity, which is taken from the response body.
+// Must run after AuthRequired.
+func (m *AuditMiddleware) Track(action, entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entityID := ""
+		if len(c.Params) > 0 {
+			entityID = c.Params[0].Value
+		}
+
+		var before interface{}
+		var recorder *responseRecorder
+		if entityID != "" {
+			before = m.recorder.Snapshot(c.Request.Context(), entityType, entityID)
+		} else {
+			recorder = &responseRecorder{ResponseWriter: c.Writer}
+			c.Writer = recorder
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+
+		var after interface{}
+		if entityID != "" {
+			if c.Request.Method != http.MethodDelete {
+				after = m.recorder.Snapshot(c.Request.Context(), entityType, entityID)
+			}
+		} else {
+			var created map[string]interface{}
+			if err := json.Unmarshal(recorder.body.Bytes(), &created); err != nil {
+				slog.WarnContext(c.Request.Context(), "Failed to decode created entity for the audit log",
+					"action", action, "entity_type", entityType, "error", err)
+			} else {
+				after = created
+				if id, ok := created["id"]; ok {
+					entityID = fmt.Sprint(id)
+				}
+			}
+		}
+
+		actorID, _ := GetUserID(c)
+		actorRole, _ := GetUserRole(c)
+		entry := &models.AuditEntry{
+			ActorID:    actorID,
+			ActorRole:  actorRole,
+			Action:     action,
+			EntityType: entityType,
+			EntityID:   entityID,
+			IP:         c.ClientIP(),
+			Before:     before,
+			After:      after,
+		}
+		// The change has already been made; a failed write to the audit log
+		// must not turn it into an error response
+		if err := m.recorder.Record(c.Request.Context(), entry); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to record audit entry",
+				"action", action, "entity_type", entityType, "entity_id", entityID, "error", err)
+		}
+	}
+}
+
+// responseRecorder keeps a copy of the response body
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
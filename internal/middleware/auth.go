@@ -1,21 +1,40 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/bexiiiii/smart_food_store/internal/config"
 	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenValidator checks server-side state behind a signature-valid access
+// token, so logged-out sessions stop working before the token expires. It
+// returns the user's current role, which wins over the role in the token,
+// or services.ErrSessionRevoked or services.ErrEmailNotVerified.
+type TokenValidator interface {
+	ValidateAccessToken(ctx context.Context, userID, sessionID uint, version int) (models.Role, error)
+}
+
+// PermissionChecker reports whether a role has been granted a permission
+type PermissionChecker interface {
+	HasPermission(ctx context.Context, role models.Role, perm models.Permission) (bool, error)
+}
+
 type AuthMiddleware struct {
-	config *config.Config
+	config      *config.Config
+	validator   TokenValidator
+	permissions PermissionChecker
 }
 
-func NewAuthMiddleware(cfg *config.Config) *AuthMiddleware {
-	return &AuthMiddleware{config: cfg}
+func NewAuthMiddleware(cfg *config.Config, validator TokenValidator, permissions PermissionChecker) *AuthMiddleware {
+	return &AuthMiddleware{config: cfg, validator: validator, permissions: permissions}
 }
 
 // AuthRequired requires a valid JWT token
@@ -68,28 +87,61 @@ func (m *AuthMiddleware) AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		sessionID, ok := claims["sid"].(float64)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		version, _ := claims["ver"].(float64)
+
+		role, err := m.validator.ValidateAccessToken(c.Request.Context(), uint(userID), uint(sessionID), int(version))
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrSessionRevoked):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			case errors.Is(err, services.ErrEmailNotVerified):
+				c.JSON(http.StatusForbidden, gin.H{"error": "Email address is not verified"})
+			default:
+				slog.ErrorContext(c.Request.Context(), "Failed to validate access token", "user_id", uint(userID), "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to validate session"})
+			}
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", uint(userID))
+		c.Set("session_id", uint(sessionID))
 		c.Set("user_email", claims["email"])
-		c.Set("user_role", claims["role"])
+		c.Set("user_role", string(role))
 
 		c.Next()
 	}
 }
 
-// AdminRequired requires admin role
-func (m *AuthMiddleware) AdminRequired() gin.HandlerFunc {
+// RequirePermission allows the request only if the user's role has every
+// listed permission. Must run after AuthRequired.
+func (m *AuthMiddleware) RequirePermission(perms ...models.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("user_role")
-		if !exists {
+		role, ok := GetUserRole(c)
+		if !ok {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 			c.Abort()
 			return
 		}
 
-		if role != string(models.RoleAdmin) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-			c.Abort()
-			return
+		for _, perm := range perms {
+			allowed, err := m.permissions.HasPermission(c.Request.Context(), role, perm)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+				c.Abort()
+				return
+			}
+			if !allowed {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission: " + string(perm)})
+				c.Abort()
+				return
+			}
 		}
 
 		c.Next()
@@ -105,6 +157,15 @@ func GetUserID(c *gin.Context) (uint, bool) {
 	return userID.(uint), true
 }
 
+// GetSessionID helper to get the session ID of the access token from context
+func GetSessionID(c *gin.Context) (uint, bool) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		return 0, false
+	}
+	return sessionID.(uint), true
+}
+
 // GetUserRole helper to get user role from context
 func GetUserRole(c *gin.Context) (models.Role, bool) {
 	role, exists := c.Get("user_role")
@@ -119,7 +180,8 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 
 		if c.Request.Method == "OPTIONS" {
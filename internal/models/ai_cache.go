@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// AICacheEntry is a cached, already validated AI reply. Key is a hash of
+// everything the reply depends on (prompt inputs, catalog snapshot, model).
+type AICacheEntry struct {
+	Key       string    `gorm:"column:cache_key;primaryKey;size:64" json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+	Value     string    `gorm:"type:text;not null" json:"value"`
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+}
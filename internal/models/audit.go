@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Entity types recorded in the audit log
+const (
+	AuditEntityUser      = "user"
+	AuditEntityRole      = "role"
+	AuditEntityProduct   = "product"
+	AuditEntityCategory  = "category"
+	AuditEntityRecipe    = "recipe"
+	AuditEntityOrder     = "order"
+	AuditEntityPromotion = "promotion"
+)
+
+// AuditJSON is a JSON document stored as text. It is written out as raw JSON
+// rather than as a quoted string.
+type AuditJSON string
+
+func (j AuditJSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// AuditLog is one admin write: who did what to which entity, and the state
+// of the entity before and after. Diff maps each changed field to its old
+// and new value.
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	ActorID    uint      `gorm:"index;not null" json:"actor_id"`
+	ActorRole  Role      `gorm:"size:30" json:"actor_role"`
+	Action     string    `gorm:"size:50;index;not null" json:"action"`
+	EntityType string    `gorm:"size:30;index:idx_audit_entity;not null" json:"entity_type"`
+	EntityID   string    `gorm:"size:64;index:idx_audit_entity" json:"entity_id"`
+	Before     AuditJSON `gorm:"type:text" json:"before"`
+	After      AuditJSON `gorm:"type:text" json:"after"`
+	Diff       AuditJSON `gorm:"type:text" json:"diff"`
+	IP         string    `gorm:"size:45" json:"ip"`
+}
+
+// AuditEntry is what callers hand to the audit service; Before and After are
+// any JSON-serializable snapshots of the entity
+type AuditEntry struct {
+	ActorID    uint
+	ActorRole  Role
+	Action     string
+	EntityType string
+	EntityID   string
+	IP         string
+	Before     interface{}
+	After      interface{}
+}
+
+type AuditQuery struct {
+	Page       int        `form:"page" binding:"omitempty,min=1"`
+	Limit      int        `form:"limit" binding:"omitempty,min=1,max=100"`
+	ActorID    *uint      `form:"actor_id"`
+	Action     string     `form:"action"`
+	EntityType string     `form:"entity_type"`
+	EntityID   string     `form:"entity_id"`
+	From       *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To         *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+type AuditLogListResponse struct {
+	Items []AuditLog `json:"items"`
+	Total int64      `json:"total"`
+	Page  int        `json:"page"`
+	Limit int        `json:"limit"`
+}
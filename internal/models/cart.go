@@ -7,44 +7,63 @@ import (
 )
 
 type Cart struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	UserID    uint           `gorm:"uniqueIndex;not null" json:"user_id"`
-	User      *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Items     []CartItem     `gorm:"foreignKey:CartID" json:"items"`
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	UserID     uint           `gorm:"uniqueIndex;not null" json:"user_id"`
+	User       *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Items      []CartItem     `gorm:"foreignKey:CartID" json:"items"`
+	CouponCode *string        `gorm:"size:50" json:"coupon_code,omitempty"`
 }
 
 type CartItem struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	CartID    uint           `gorm:"index;not null" json:"cart_id"`
-	ProductID uint           `gorm:"index;not null" json:"product_id"`
-	Product   *Product       `gorm:"foreignKey:ProductID" json:"product,omitempty"`
-	Quantity  float64        `gorm:"not null" json:"quantity"`
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	DeletedAt gorm.DeletedAt  `gorm:"index" json:"-"`
+	CartID    uint            `gorm:"index;not null" json:"cart_id"`
+	ProductID uint            `gorm:"index;not null" json:"product_id"`
+	Product   *Product        `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	VariantID *uint           `gorm:"index" json:"variant_id,omitempty"`
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Quantity  float64         `gorm:"not null" json:"quantity"` // in the product's unit, or packs for a variant
 }
 
+// CartItemRequest adds a product to the cart. For a variant, a quantity
+// without a unit is a number of packs; with a unit it is rounded up to whole
+// packs. Without a variant, a product that is sold in variants gets the
+// cheapest packs that cover the quantity.
 type CartItemRequest struct {
 	ProductID uint    `json:"product_id" binding:"required"`
+	VariantID *uint   `json:"variant_id"`
 	Quantity  float64 `json:"quantity" binding:"required,gt=0"`
+	Unit      Unit    `json:"unit"` // Optional, defaults to the product's unit
 }
 
+// CartResponse prices a cart. TotalPrice is Subtotal less DiscountTotal, the
+// sum of the itemized Discounts. CouponError says why an entered coupon
+// doesn't apply (any more).
 type CartResponse struct {
-	ID         uint               `json:"id"`
-	Items      []CartItemResponse `json:"items"`
-	TotalPrice float64            `json:"total_price"`
-	ItemCount  int                `json:"item_count"`
+	ID            uint               `json:"id"`
+	Items         []CartItemResponse `json:"items"`
+	Subtotal      float64            `json:"subtotal"`
+	Discounts     []AppliedDiscount  `json:"discounts"`
+	DiscountTotal float64            `json:"discount_total"`
+	TotalPrice    float64            `json:"total_price"`
+	ItemCount     int                `json:"item_count"`
+	CouponCode    string             `json:"coupon_code,omitempty"`
+	CouponError   string             `json:"coupon_error,omitempty"`
 }
 
 type CartItemResponse struct {
 	ID          uint    `json:"id"`
 	ProductID   uint    `json:"product_id"`
 	ProductName string  `json:"product_name"`
+	VariantID   *uint   `json:"variant_id,omitempty"`
+	VariantName string  `json:"variant_name,omitempty"`
 	Price       float64 `json:"price"`
 	Quantity    float64 `json:"quantity"`
-	Unit        Unit    `json:"unit"`
+	Unit        Unit    `json:"unit"` // pcs (packs) for a variant
 	Subtotal    float64 `json:"subtotal"`
 }
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OrderStatus string
+
+const (
+	OrderStatusPending        OrderStatus = "pending"
+	OrderStatusPaid           OrderStatus = "paid"
+	OrderStatusPacked         OrderStatus = "packed"
+	OrderStatusOutForDelivery OrderStatus = "out_for_delivery"
+	OrderStatusDelivered      OrderStatus = "delivered"
+	OrderStatusCancelled      OrderStatus = "cancelled"
+	OrderStatusRefunded       OrderStatus = "refunded"
+)
+
+type Order struct {
+	ID         uint                `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time           `json:"created_at"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt      `gorm:"index" json:"-"`
+	UserID     uint                `gorm:"index;not null" json:"user_id"`
+	User       *User               `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Status     OrderStatus         `gorm:"size:30;index;default:pending" json:"status"`
+	TotalPrice float64             `gorm:"not null" json:"total_price"`
+	Items      []OrderItem         `gorm:"foreignKey:OrderID" json:"items"`
+	History    []OrderStatusChange `gorm:"foreignKey:OrderID" json:"history,omitempty"`
+
+	// Price before discounts, and the discounts that make up the difference
+	Subtotal      float64         `json:"subtotal"`
+	DiscountTotal float64         `gorm:"default:0" json:"discount_total"`
+	CouponCode    string          `gorm:"size:50" json:"coupon_code,omitempty"`
+	Discounts     []OrderDiscount `gorm:"foreignKey:OrderID" json:"discounts,omitempty"`
+}
+
+// OrderItem is a snapshot of a cart line at checkout time, so later
+// product edits don't rewrite order history.
+type OrderItem struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	OrderID     uint           `gorm:"index;not null" json:"order_id"`
+	ProductID   uint           `gorm:"index;not null" json:"product_id"`
+	ProductName string         `gorm:"size:150;not null" json:"product_name"`
+	VariantID   *uint          `gorm:"index" json:"variant_id,omitempty"`
+	VariantName string         `gorm:"size:100" json:"variant_name,omitempty"`
+	Price       float64        `gorm:"not null" json:"price"`
+	Unit        Unit           `gorm:"size:10" json:"unit"`
+	Quantity    float64        `gorm:"not null" json:"quantity"`
+	Subtotal    float64        `gorm:"not null" json:"subtotal"`
+}
+
+// OrderStatusChange records a single step of the order lifecycle and who made it
+type OrderStatusChange struct {
+	ID          uint        `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	OrderID     uint        `gorm:"index;not null" json:"order_id"`
+	FromStatus  OrderStatus `gorm:"size:30" json:"from_status"`
+	ToStatus    OrderStatus `gorm:"size:30;not null" json:"to_status"`
+	ChangedByID uint        `gorm:"index;not null" json:"changed_by_id"`
+	Note        string      `gorm:"size:255" json:"note"`
+}
+
+type OrderStatusUpdateRequest struct {
+	Status OrderStatus `json:"status" binding:"required"`
+	Note   string      `json:"note" binding:"max=255"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Permission names an action on the admin API, as "resource:action"
+type Permission string
+
+const (
+	PermUsersRead   Permission = "users:read"
+	PermUsersWrite  Permission = "users:write"
+	PermRolesManage Permission = "roles:manage"
+
+	PermProductsWrite   Permission = "products:write"
+	PermCategoriesWrite Permission = "categories:write"
+	PermInventoryWrite  Permission = "inventory:write"
+
+	PermRecipesWrite  Permission = "recipes:write"
+	PermRecipesReview Permission = "recipes:review"
+
+	PermOrdersRead   Permission = "orders:read"
+	PermOrdersUpdate Permission = "orders:update"
+	PermOrdersRefund Permission = "orders:refund"
+
+	PermPromotionsWrite Permission = "promotions:write"
+
+	PermAuditRead Permission = "audit:read"
+)
+
+var AllPermissions = []Permission{
+	PermUsersRead, PermUsersWrite, PermRolesManage,
+	PermProductsWrite, PermCategoriesWrite, PermInventoryWrite,
+	PermRecipesWrite, PermRecipesReview,
+	PermOrdersRead, PermOrdersUpdate, PermOrdersRefund,
+	PermPromotionsWrite,
+	PermAuditRead,
+}
+
+func (p Permission) IsValid() bool {
+	for _, perm := range AllPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type RolePermission struct {
+	Role       Role       `gorm:"primaryKey;size:30" json:"role"`
+	Permission Permission `gorm:"primaryKey;size:50" json:"permission"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type RolePermissionsResponse struct {
+	Role        Role         `json:"role"`
+	Permissions []Permission `json:"permissions"`
+}
+
+type RolePermissionsUpdateRequest struct {
+	Permissions []Permission `json:"permissions" binding:"required"`
+}
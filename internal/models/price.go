@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// PriceChangeSource says what changed a product's price
+type PriceChangeSource string
+
+const (
+	PriceSourceManual   PriceChangeSource = "manual"
+	PriceSourceImport   PriceChangeSource = "import"
+	PriceSourceSchedule PriceChangeSource = "schedule"
+	PriceSourceSeed     PriceChangeSource = "seed"
+)
+
+// PriceChange is one entry in a product's price history. OldPrice is nil for
+// the price a product was created with. VariantID is set for a change to the
+// price of one of the product's variants.
+type PriceChange struct {
+	ID               uint              `gorm:"primaryKey" json:"id"`
+	CreatedAt        time.Time         `gorm:"index" json:"created_at"`
+	ProductID        uint              `gorm:"index;not null" json:"product_id"`
+	OldPrice         *float64          `json:"old_price"`
+	Price            float64           `gorm:"not null" json:"price"`
+	Source           PriceChangeSource `gorm:"size:20;not null" json:"source"`
+	ScheduledPriceID *uint             `json:"scheduled_price_id,omitempty"`
+	VariantID        *uint             `gorm:"index" json:"variant_id,omitempty"`
+}
+
+// ScheduledPrice is a future price for a product. The price scheduler applies
+// it once EffectiveAt has passed and sets AppliedAt.
+type ScheduledPrice struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ProductID   uint       `gorm:"index;not null" json:"product_id"`
+	Price       float64    `gorm:"not null" json:"price"`
+	EffectiveAt time.Time  `gorm:"index;not null" json:"effective_at"`
+	AppliedAt   *time.Time `json:"applied_at"`
+}
+
+type ScheduledPriceRequest struct {
+	Price       float64   `json:"price" binding:"required,gt=0"`
+	EffectiveAt time.Time `json:"effective_at" binding:"required"`
+}
+
+// PriceHistoryResponse is a product's current price and its price changes,
+// oldest first
+type PriceHistoryResponse struct {
+	ProductID uint          `json:"product_id"`
+	Price     float64       `json:"price"`
+	Unit      Unit          `json:"unit"`
+	Changes   []PriceChange `json:"changes"`
+}
@@ -26,40 +26,105 @@ type Category struct {
 }
 
 type Product struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
-	Name        string         `gorm:"size:150;not null" json:"name"`
-	Description string         `gorm:"size:500" json:"description"`
-	Price       float64        `gorm:"not null" json:"price"`
-	Stock       float64        `gorm:"default:0" json:"stock"`
-	Unit        Unit           `gorm:"size:10;default:g" json:"unit"`
-	CategoryID  uint           `gorm:"index" json:"category_id"`
-	Category    *Category      `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
-	ImageURL    string         `gorm:"size:255" json:"image_url"`
+	ID          uint             `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt   `gorm:"index" json:"-"`
+	SKU         *string          `gorm:"size:64;uniqueIndex:idx_products_sku,where:deleted_at IS NULL" json:"sku,omitempty"`
+	Barcode     *string          `gorm:"size:13;uniqueIndex:idx_products_barcode,where:deleted_at IS NULL" json:"barcode,omitempty"` // EAN-13 or EAN-8
+	Name        string           `gorm:"size:150;not null" json:"name"`
+	Description string           `gorm:"size:500" json:"description"`
+	Price       float64          `gorm:"not null" json:"price"`
+	Stock       float64          `gorm:"default:0" json:"stock"`
+	Unit        Unit             `gorm:"size:10;default:g" json:"unit"`
+	Density     float64          `gorm:"default:0" json:"density,omitempty"`      // g per ml, for volume <-> mass
+	PieceWeight float64          `gorm:"default:0" json:"piece_weight,omitempty"` // g per piece, for pcs <-> mass/volume
+	CategoryID  uint             `gorm:"index" json:"category_id"`
+	Category    *Category        `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	ImageURL    string           `gorm:"size:255" json:"image_url"`
+	Variants    []ProductVariant `gorm:"foreignKey:ProductID" json:"variants,omitempty"`
+
+	// Filled by search queries only
+	SearchRank float64 `gorm:"->;-:migration" json:"search_rank,omitempty"`
+	Highlight  string  `gorm:"->;-:migration" json:"highlight,omitempty"`
 }
 
 type ProductCreateRequest struct {
+	SKU         string  `json:"sku" binding:"max=64"`
+	Barcode     string  `json:"barcode"` // EAN-13, UPC-A or EAN-8
 	Name        string  `json:"name" binding:"required,min=2,max=150"`
 	Description string  `json:"description" binding:"max=500"`
 	Price       float64 `json:"price" binding:"required,gt=0"`
 	Stock       float64 `json:"stock" binding:"gte=0"`
 	Unit        Unit    `json:"unit" binding:"required"`
+	Density     float64 `json:"density" binding:"gte=0"`
+	PieceWeight float64 `json:"piece_weight" binding:"gte=0"`
 	CategoryID  uint    `json:"category_id" binding:"required"`
 	ImageURL    string  `json:"image_url"`
 }
 
 type ProductUpdateRequest struct {
+	SKU         *string  `json:"sku" binding:"omitempty,max=64"` // "" removes the SKU
+	Barcode     *string  `json:"barcode"`                        // "" removes the barcode
 	Name        *string  `json:"name" binding:"omitempty,min=2,max=150"`
 	Description *string  `json:"description" binding:"omitempty,max=500"`
 	Price       *float64 `json:"price" binding:"omitempty,gt=0"`
 	Stock       *float64 `json:"stock" binding:"omitempty,gte=0"`
 	Unit        *Unit    `json:"unit"`
+	Density     *float64 `json:"density" binding:"omitempty,gte=0"`
+	PieceWeight *float64 `json:"piece_weight" binding:"omitempty,gte=0"`
 	CategoryID  *uint    `json:"category_id"`
 	ImageURL    *string  `json:"image_url"`
 }
 
+// ProductStockUpdateRequest is used by inventory staff, who may change stock
+// but not the rest of the product
+type ProductStockUpdateRequest struct {
+	Stock *float64 `json:"stock" binding:"required,gte=0"`
+}
+
 type CategoryCreateRequest struct {
 	Name string `json:"name" binding:"required,min=2,max=100"`
 }
+
+// ProductQuery filters, sorts and paginates product listings. Either Page or
+// Cursor is used; a cursor (from NextCursor) takes precedence.
+type ProductQuery struct {
+	Page       int      `form:"page" binding:"omitempty,min=1"`
+	Limit      int      `form:"limit" binding:"omitempty,min=1,max=100"`
+	Cursor     string   `form:"cursor"`
+	Sort       string   `form:"sort" binding:"omitempty,oneof=relevance price name created_at"`
+	Order      string   `form:"order" binding:"omitempty,oneof=asc desc"`
+	CategoryID *uint    `form:"category_id"`
+	MinPrice   *float64 `form:"min_price" binding:"omitempty,gte=0"`
+	MaxPrice   *float64 `form:"max_price" binding:"omitempty,gte=0"`
+	Unit       Unit     `form:"unit"`
+	InStock    *bool    `form:"in_stock"`
+	Query      string   `form:"q"`
+}
+
+type ProductListResponse struct {
+	Items      []Product `json:"items"`
+	Total      int64     `json:"total"`
+	Page       int       `json:"page,omitempty"`
+	Limit      int       `json:"limit"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// ProductImportResult reports a CSV import. With errors, nothing was
+// written; with DryRun, Created and Updated say what would have happened.
+type ProductImportResult struct {
+	DryRun  bool                 `json:"dry_run"`
+	Rows    int                  `json:"rows"`
+	Created int                  `json:"created"`
+	Updated int                  `json:"updated"`
+	Errors  []ProductImportError `json:"errors"`
+}
+
+// ProductImportError is a problem with one CSV row. Row is the line number
+// in the file, counting the header as line 1.
+type ProductImportError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PromotionType string
+
+const (
+	// Value percent off the matching lines, or off the order
+	PromotionPercentage PromotionType = "percentage"
+	// Value off each unit (or pack) of the matching lines, or once off the order
+	PromotionFixed PromotionType = "fixed"
+	// For every BuyQuantity units of a matching line, GetQuantity more are free
+	PromotionBuyXGetY PromotionType = "buy_x_get_y"
+)
+
+// Promotion is a discount applied to carts. With ProductID or CategoryID set
+// it applies to the matching cart lines, otherwise to the whole order. A
+// promotion with a Code is a coupon and only applies to carts the code has
+// been entered on.
+type Promotion struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	Name         string         `gorm:"size:100;not null" json:"name"`
+	Type         PromotionType  `gorm:"size:20;not null" json:"type"`
+	Value        float64        `json:"value"`
+	BuyQuantity  float64        `json:"buy_quantity,omitempty"`
+	GetQuantity  float64        `json:"get_quantity,omitempty"`
+	ProductID    *uint          `gorm:"index" json:"product_id,omitempty"`
+	CategoryID   *uint          `gorm:"index" json:"category_id,omitempty"`
+	Code         *string        `gorm:"size:50;uniqueIndex:idx_promotions_code,where:deleted_at IS NULL" json:"code,omitempty"`
+	StartsAt     *time.Time     `json:"starts_at"`
+	EndsAt       *time.Time     `json:"ends_at"`
+	UsageLimit   *int           `json:"usage_limit"`
+	PerUserLimit *int           `json:"per_user_limit"`
+	UsedCount    int            `gorm:"default:0" json:"used_count"`
+	Active       bool           `gorm:"default:true" json:"active"`
+}
+
+// IsOrderLevel reports whether the promotion discounts the whole order
+// rather than cart lines
+func (p *Promotion) IsOrderLevel() bool {
+	return p.ProductID == nil && p.CategoryID == nil
+}
+
+type PromotionCreateRequest struct {
+	Name         string        `json:"name" binding:"required,min=2,max=100"`
+	Type         PromotionType `json:"type" binding:"required"`
+	Value        float64       `json:"value" binding:"gte=0"`
+	BuyQuantity  float64       `json:"buy_quantity" binding:"gte=0"`
+	GetQuantity  float64       `json:"get_quantity" binding:"gte=0"`
+	ProductID    *uint         `json:"product_id"`
+	CategoryID   *uint         `json:"category_id"`
+	Code         string        `json:"code" binding:"max=50"`
+	StartsAt     *time.Time    `json:"starts_at"`
+	EndsAt       *time.Time    `json:"ends_at"`
+	UsageLimit   *int          `json:"usage_limit" binding:"omitempty,gte=1"`
+	PerUserLimit *int          `json:"per_user_limit" binding:"omitempty,gte=1"`
+	Active       *bool         `json:"active"` // Defaults to true
+}
+
+// PromotionUpdateRequest changes the fields that are set. An empty code
+// turns a coupon into an automatic promotion; 0 clears product_id,
+// category_id, usage_limit and per_user_limit.
+type PromotionUpdateRequest struct {
+	Name         *string        `json:"name" binding:"omitempty,min=2,max=100"`
+	Type         *PromotionType `json:"type"`
+	Value        *float64       `json:"value" binding:"omitempty,gte=0"`
+	BuyQuantity  *float64       `json:"buy_quantity" binding:"omitempty,gte=0"`
+	GetQuantity  *float64       `json:"get_quantity" binding:"omitempty,gte=0"`
+	ProductID    *uint          `json:"product_id"`
+	CategoryID   *uint          `json:"category_id"`
+	Code         *string        `json:"code" binding:"omitempty,max=50"`
+	StartsAt     *time.Time     `json:"starts_at"`
+	EndsAt       *time.Time     `json:"ends_at"`
+	UsageLimit   *int           `json:"usage_limit" binding:"omitempty,gte=0"`
+	PerUserLimit *int           `json:"per_user_limit" binding:"omitempty,gte=0"`
+	Active       *bool          `json:"active"`
+}
+
+type CouponRequest struct {
+	Code string `json:"code" binding:"required,max=50"`
+}
+
+// AppliedDiscount is one discount in a cart: a promotion applied to a cart
+// line (CartItemID set) or to the order
+type AppliedDiscount struct {
+	PromotionID uint          `json:"promotion_id"`
+	Name        string        `json:"name"`
+	Type        PromotionType `json:"type"`
+	Code        string        `json:"code,omitempty"`
+	CartItemID  *uint         `json:"cart_item_id,omitempty"`
+	ProductID   *uint         `json:"product_id,omitempty"`
+	Amount      float64       `json:"amount"`
+}
+
+// OrderDiscount is a snapshot of a discount applied at checkout
+type OrderDiscount struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	OrderID     uint          `gorm:"index;not null" json:"order_id"`
+	UserID      uint          `gorm:"index;not null" json:"user_id"`
+	PromotionID uint          `gorm:"index;not null" json:"promotion_id"`
+	Name        string        `gorm:"size:100;not null" json:"name"`
+	Type        PromotionType `gorm:"size:20;not null" json:"type"`
+	Code        string        `gorm:"size:50" json:"code,omitempty"`
+	ProductID   *uint         `json:"product_id,omitempty"`
+	Amount      float64       `gorm:"not null" json:"amount"`
+}
@@ -1,38 +1,77 @@
 package models
 
 import (
+	"strings"
 	"time"
+	"unicode"
 
 	"gorm.io/gorm"
 )
 
+type RecipeStatus string
+
+const (
+	RecipeStatusPending  RecipeStatus = "pending"
+	RecipeStatusApproved RecipeStatus = "approved"
+	RecipeStatusRejected RecipeStatus = "rejected"
+)
+
 type Recipe struct {
-	ID           uint               `gorm:"primaryKey" json:"id"`
-	CreatedAt    time.Time          `json:"created_at"`
-	UpdatedAt    time.Time          `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt     `gorm:"index" json:"-"`
-	Name         string             `gorm:"size:200;not null" json:"name"`
-	Description  string             `gorm:"type:text" json:"description"`
-	Instructions string             `gorm:"type:text" json:"instructions"`
-	Servings     int                `gorm:"default:1" json:"servings"`
-	PrepTime     int                `json:"prep_time"`  // in minutes
-	CookTime     int                `json:"cook_time"`  // in minutes
-	ImageURL     string             `gorm:"size:255" json:"image_url"`
-	Ingredients  []RecipeIngredient `gorm:"foreignKey:RecipeID" json:"ingredients"`
-	IsAIGenerated bool              `gorm:"default:false" json:"is_ai_generated"`
+	ID             uint               `gorm:"primaryKey" json:"id"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt     `gorm:"index" json:"-"`
+	Name           string             `gorm:"size:200;not null" json:"name"`
+	Description    string             `gorm:"type:text" json:"description"`
+	Instructions   string             `gorm:"type:text" json:"instructions"`
+	Servings       int                `gorm:"default:1" json:"servings"`
+	PrepTime       int                `json:"prep_time"` // in minutes
+	CookTime       int                `json:"cook_time"` // in minutes
+	ImageURL       string             `gorm:"size:255" json:"image_url"`
+	Ingredients    []RecipeIngredient `gorm:"foreignKey:RecipeID" json:"ingredients"`
+	IsAIGenerated  bool               `gorm:"default:false" json:"is_ai_generated"`
+	Status         RecipeStatus       `gorm:"size:20;index;default:approved" json:"status"`
+	NormalizedName string             `gorm:"size:200;index" json:"-"`
+	CreatedByID    *uint              `gorm:"index" json:"created_by_id,omitempty"`
+	ReviewedByID   *uint              `json:"reviewed_by_id,omitempty"`
+	ReviewedAt     *time.Time         `json:"reviewed_at,omitempty"`
+
+	// Filled by search queries only
+	SearchRank float64 `gorm:"->;-:migration" json:"search_rank,omitempty"`
+	Highlight  string  `gorm:"->;-:migration" json:"highlight,omitempty"`
+}
+
+// BeforeSave keeps NormalizedName in sync with Name for duplicate detection
+func (r *Recipe) BeforeSave(tx *gorm.DB) error {
+	r.NormalizedName = NormalizeRecipeName(r.Name)
+	return nil
+}
+
+// NormalizeRecipeName lowercases a recipe name, drops punctuation and
+// collapses whitespace, so "Plov (Uzbek)" and "plov  uzbek" compare equal.
+func NormalizeRecipeName(name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, name)
+	return strings.Join(strings.Fields(cleaned), " ")
 }
 
 type RecipeIngredient struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	RecipeID  uint           `gorm:"index;not null" json:"recipe_id"`
-	ProductID uint           `gorm:"index;not null" json:"product_id"`
-	Product   *Product       `gorm:"foreignKey:ProductID" json:"product,omitempty"`
-	Quantity  float64        `gorm:"not null" json:"quantity"`
-	Unit      Unit           `gorm:"size:10" json:"unit"`
-	Notes     string         `gorm:"size:100" json:"notes"` // e.g., "chopped", "melted"
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	DeletedAt gorm.DeletedAt  `gorm:"index" json:"-"`
+	RecipeID  uint            `gorm:"index;not null" json:"recipe_id"`
+	ProductID uint            `gorm:"index;not null" json:"product_id"`
+	Product   *Product        `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	VariantID *uint           `gorm:"index" json:"variant_id,omitempty"` // Optional pack to buy
+	Variant   *ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Quantity  float64         `gorm:"not null" json:"quantity"`
+	Unit      Unit            `gorm:"size:10" json:"unit"`
+	Notes     string          `gorm:"size:100" json:"notes"` // e.g., "chopped", "melted"
 }
 
 // AI Request/Response models
@@ -52,6 +91,11 @@ type AIIngredient struct {
 	Unit        Unit    `json:"unit"`
 	Available   bool    `json:"available"`
 	Price       float64 `json:"price"`
+
+	// Set for products sold in variants: the packs that cover Quantity
+	VariantID   *uint   `json:"variant_id,omitempty"`
+	VariantName string  `json:"variant_name,omitempty"`
+	Packs       float64 `json:"packs,omitempty"`
 }
 
 // RequiredIngredient - ingredient needed for a dish
@@ -105,18 +149,19 @@ type AddRecipeToCartRequest struct {
 
 // Recipe creation request for admins
 type RecipeCreateRequest struct {
-	Name         string                        `json:"name" binding:"required,min=2,max=200"`
-	Description  string                        `json:"description"`
-	Instructions string                        `json:"instructions" binding:"required"`
-	Servings     int                           `json:"servings" binding:"required,min=1"`
-	PrepTime     int                           `json:"prep_time" binding:"gte=0"`
-	CookTime     int                           `json:"cook_time" binding:"gte=0"`
-	ImageURL     string                        `json:"image_url"`
+	Name         string                          `json:"name" binding:"required,min=2,max=200"`
+	Description  string                          `json:"description"`
+	Instructions string                          `json:"instructions" binding:"required"`
+	Servings     int                             `json:"servings" binding:"required,min=1"`
+	PrepTime     int                             `json:"prep_time" binding:"gte=0"`
+	CookTime     int                             `json:"cook_time" binding:"gte=0"`
+	ImageURL     string                          `json:"image_url"`
 	Ingredients  []RecipeIngredientCreateRequest `json:"ingredients" binding:"required,min=1"`
 }
 
 type RecipeIngredientCreateRequest struct {
 	ProductID uint    `json:"product_id" binding:"required"`
+	VariantID *uint   `json:"variant_id"`
 	Quantity  float64 `json:"quantity" binding:"required,gt=0"`
 	Unit      Unit    `json:"unit" binding:"required"`
 	Notes     string  `json:"notes"`
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+type ReservationStatus string
+
+const (
+	ReservationActive   ReservationStatus = "active"
+	ReservationConsumed ReservationStatus = "consumed"
+	ReservationReleased ReservationStatus = "released"
+)
+
+// StockReservation is a time-limited hold on product stock while a user is in
+// checkout. The held quantity is already taken out of Product.Stock (or
+// ProductVariant.Stock for a variant); it is either consumed by an order or
+// put back when the hold is released.
+type StockReservation struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	UserID    uint              `gorm:"index;not null" json:"user_id"`
+	ProductID uint              `gorm:"index;not null" json:"product_id"`
+	VariantID *uint             `gorm:"index" json:"variant_id,omitempty"`
+	Quantity  float64           `gorm:"not null" json:"quantity"`
+	Status    ReservationStatus `gorm:"size:20;index;default:active" json:"status"`
+	ExpiresAt time.Time         `gorm:"index;not null" json:"expires_at"`
+}
+
+type ReservationResponse struct {
+	ExpiresAt time.Time          `json:"expires_at"`
+	Items     []StockReservation `json:"items"`
+}
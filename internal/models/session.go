@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Session is one signed-in device. It holds the hash of the current refresh
+// token; every refresh rotates the token and keeps the previous hash so a
+// replayed (stolen) token can be detected.
+type Session struct {
+	ID                uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	UserID            uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash         string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	PreviousTokenHash string     `gorm:"size:64;index" json:"-"`
+	ExpiresAt         time.Time  `gorm:"index;not null" json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	UserAgent         string     `gorm:"size:255" json:"user_agent"`
+	IP                string     `gorm:"size:45" json:"ip"`
+}
+
+// ClientInfo identifies the device a session was created from
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
@@ -11,8 +11,25 @@ type Role string
 const (
 	RoleUser  Role = "user"
 	RoleAdmin Role = "admin"
+
+	// Staff roles; what they may do is configured in role_permissions
+	RoleCatalogManager Role = "catalog_manager"
+	RoleInventoryClerk Role = "inventory_clerk"
+	RoleRecipeEditor   Role = "recipe_editor"
+	RoleSupportAgent   Role = "support_agent"
 )
 
+var AllRoles = []Role{RoleUser, RoleAdmin, RoleCatalogManager, RoleInventoryClerk, RoleRecipeEditor, RoleSupportAgent}
+
+func (r Role) IsValid() bool {
+	for _, role := range AllRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 type User struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -23,6 +40,10 @@ type User struct {
 	Password  string         `gorm:"size:255;not null" json:"-"`
 	Role      Role           `gorm:"size:20;default:user" json:"role"`
 	Cart      *Cart          `gorm:"foreignKey:UserID" json:"cart,omitempty"`
+	// Bumped to invalidate every access token issued so far
+	TokenVersion    int        `gorm:"not null;default:0" json:"-"`
+	EmailVerified   bool       `gorm:"not null;default:false" json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 }
 
 type UserRegisterRequest struct {
@@ -37,13 +58,20 @@ type UserLoginRequest struct {
 }
 
 type UserResponse struct {
-	ID    uint   `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Role  Role   `json:"role"`
+	ID            uint   `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	Role          Role   `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
+// AuthResponse is a new session. When email verification is required, a
+// new account gets no session: only User and VerificationRequired are set.
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	Token                string       `json:"token,omitempty"`
+	ExpiresAt            *time.Time   `json:"expires_at,omitempty"`
+	RefreshToken         string       `json:"refresh_token,omitempty"`
+	RefreshExpiresAt     *time.Time   `json:"refresh_expires_at,omitempty"`
+	User                 UserResponse `json:"user"`
+	VerificationRequired bool         `json:"verification_required,omitempty"`
 }
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type TokenPurpose string
+
+const (
+	TokenPurposeVerifyEmail   TokenPurpose = "verify_email"
+	TokenPurposeResetPassword TokenPurpose = "reset_password"
+)
+
+// UserToken backs a single-use link sent by email. Only a hash of the token
+// is stored; UsedAt is set when the link is redeemed.
+type UserToken struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UserID    uint         `gorm:"index;not null" json:"user_id"`
+	Purpose   TokenPurpose `gorm:"size:30;index;not null" json:"purpose"`
+	TokenHash string       `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time    `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time   `json:"used_at,omitempty"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductVariant is one size or pack of a product, e.g. "1 l" and "2 l" of
+// the same milk. Each variant has its own SKU, barcode, price and stock.
+// Size is how much of the product, in the product's unit, one pack holds;
+// Price and Stock count packs.
+type ProductVariant struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ProductID uint           `gorm:"index;not null" json:"product_id"`
+	Name      string         `gorm:"size:100;not null" json:"name"`
+	SKU       *string        `gorm:"size:64;uniqueIndex:idx_product_variants_sku,where:deleted_at IS NULL" json:"sku,omitempty"`
+	Barcode   *string        `gorm:"size:13;uniqueIndex:idx_product_variants_barcode,where:deleted_at IS NULL" json:"barcode,omitempty"`
+	Size      float64        `gorm:"not null" json:"size"`
+	Price     float64        `gorm:"not null" json:"price"`
+	Stock     float64        `gorm:"default:0" json:"stock"`
+}
+
+type ProductVariantCreateRequest struct {
+	Name    string  `json:"name" binding:"required,min=1,max=100"`
+	SKU     string  `json:"sku" binding:"max=64"`
+	Barcode string  `json:"barcode"`
+	Size    float64 `json:"size" binding:"required,gt=0"`
+	Price   float64 `json:"price" binding:"required,gt=0"`
+	Stock   float64 `json:"stock" binding:"gte=0"`
+}
+
+type ProductVariantUpdateRequest struct {
+	Name    *string  `json:"name" binding:"omitempty,min=1,max=100"`
+	SKU     *string  `json:"sku" binding:"omitempty,max=64"` // "" removes the SKU
+	Barcode *string  `json:"barcode"`                        // "" removes the barcode
+	Size    *float64 `json:"size" binding:"omitempty,gt=0"`
+	Price   *float64 `json:"price" binding:"omitempty,gt=0"`
+	Stock   *float64 `json:"stock" binding:"omitempty,gte=0"`
+}
+
+// BarcodeLookupResponse is the product a scanned barcode belongs to. Variant
+// is set when the barcode is printed on one of the product's variants.
+type BarcodeLookupResponse struct {
+	Product *Product        `json:"product"`
+	Variant *ProductVariant `json:"variant,omitempty"`
+}
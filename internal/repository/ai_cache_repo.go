@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AICacheRepository struct {
+	db *gorm.DB
+}
+
+func NewAICacheRepository(db *gorm.DB) *AICacheRepository {
+	return &AICacheRepository{db: db}
+}
+
+// Get returns the entry for key if it has not expired
+func (r *AICacheRepository) Get(ctx context.Context, key string, now time.Time) (*models.AICacheEntry, error) {
+	var entry models.AICacheEntry
+	err := r.db.WithContext(ctx).Where("cache_key = ? AND expires_at > ?", key, now).First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Upsert stores entry, replacing any existing value for the same key
+func (r *AICacheRepository) Upsert(ctx context.Context, entry *models.AICacheEntry) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expires_at", "created_at"}),
+	}).Create(entry).Error
+}
+
+func (r *AICacheRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.AICacheEntry{}).Error
+}
+
+func (r *AICacheRepository) DeleteAll(ctx context.Context) error {
+	return r.db.WithContext(ctx).Where("1 = 1").Delete(&models.AICacheEntry{}).Error
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+)
+
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) WithTx(tx *gorm.DB) AuditStore {
+	return &AuditRepository{db: tx}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+// List returns one page of matching entries, newest first, and the total
+// number of matches
+func (r *AuditRepository) List(ctx context.Context, q *models.AuditQuery) ([]models.AuditLog, int64, error) {
+	db := r.db.WithContext(ctx).Model(&models.AuditLog{})
+	if q.ActorID != nil {
+		db = db.Where("actor_id = ?", *q.ActorID)
+	}
+	if q.Action != "" {
+		db = db.Where("action = ?", q.Action)
+	}
+	if q.EntityType != "" {
+		db = db.Where("entity_type = ?", q.EntityType)
+	}
+	if q.EntityID != "" {
+		db = db.Where("entity_id = ?", q.EntityID)
+	}
+	if q.From != nil {
+		db = db.Where("created_at >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("created_at < ?", *q.To)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.AuditLog
+	err := db.Order("created_at DESC, id DESC").
+		Offset((q.Page - 1) * q.Limit).
+		Limit(q.Limit).
+		Find(&entries).Error
+	return entries, total, err
+}
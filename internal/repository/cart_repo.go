@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"context"
+
 	"github.com/bexiiiii/smart_food_store/internal/models"
 	"gorm.io/gorm"
 )
@@ -13,13 +15,17 @@ func NewCartRepository(db *gorm.DB) *CartRepository {
 	return &CartRepository{db: db}
 }
 
-func (r *CartRepository) GetOrCreateByUserID(userID uint) (*models.Cart, error) {
+func (r *CartRepository) WithTx(tx *gorm.DB) CartStore {
+	return &CartRepository{db: tx}
+}
+
+func (r *CartRepository) GetOrCreateByUserID(ctx context.Context, userID uint) (*models.Cart, error) {
 	var cart models.Cart
-	err := r.db.Preload("Items.Product").Where("user_id = ?", userID).First(&cart).Error
+	err := r.db.WithContext(ctx).Preload("Items.Product").Preload("Items.Variant").Where("user_id = ?", userID).First(&cart).Error
 	
 	if err == gorm.ErrRecordNotFound {
 		cart = models.Cart{UserID: userID}
-		if err := r.db.Create(&cart).Error; err != nil {
+		if err := r.db.WithContext(ctx).Create(&cart).Error; err != nil {
 			return nil, err
 		}
 		return &cart, nil
@@ -32,59 +38,73 @@ func (r *CartRepository) GetOrCreateByUserID(userID uint) (*models.Cart, error)
 	return &cart, nil
 }
 
-func (r *CartRepository) GetByUserID(userID uint) (*models.Cart, error) {
+func (r *CartRepository) GetByUserID(ctx context.Context, userID uint) (*models.Cart, error) {
 	var cart models.Cart
-	err := r.db.Preload("Items.Product").Where("user_id = ?", userID).First(&cart).Error
+	err := r.db.WithContext(ctx).Preload("Items.Product").Preload("Items.Variant").Where("user_id = ?", userID).First(&cart).Error
 	if err != nil {
 		return nil, err
 	}
 	return &cart, nil
 }
 
-func (r *CartRepository) AddItem(cartID uint, item *models.CartItem) error {
+func (r *CartRepository) AddItem(ctx context.Context, cartID uint, item *models.CartItem) error {
 	// Check if item already exists in cart
 	var existingItem models.CartItem
-	err := r.db.Where("cart_id = ? AND product_id = ?", cartID, item.ProductID).First(&existingItem).Error
+	err := whereItem(r.db.WithContext(ctx), cartID, item.ProductID, item.VariantID).First(&existingItem).Error
 	
 	if err == nil {
 		// Item exists, update quantity
 		existingItem.Quantity += item.Quantity
-		return r.db.Save(&existingItem).Error
+		return r.db.WithContext(ctx).Save(&existingItem).Error
 	}
 	
 	if err == gorm.ErrRecordNotFound {
 		// Item doesn't exist, create new
 		item.CartID = cartID
-		return r.db.Create(item).Error
+		return r.db.WithContext(ctx).Create(item).Error
 	}
 	
 	return err
 }
 
-func (r *CartRepository) UpdateItemQuantity(cartID uint, productID uint, quantity float64) error {
-	return r.db.Model(&models.CartItem{}).
-		Where("cart_id = ? AND product_id = ?", cartID, productID).
+func (r *CartRepository) UpdateItemQuantity(ctx context.Context, cartID uint, productID uint, variantID *uint, quantity float64) error {
+	return whereItem(r.db.WithContext(ctx).Model(&models.CartItem{}), cartID, productID, variantID).
 		Update("quantity", quantity).Error
 }
 
-func (r *CartRepository) RemoveItem(cartID uint, productID uint) error {
-	return r.db.Where("cart_id = ? AND product_id = ?", cartID, productID).
+func (r *CartRepository) RemoveItem(ctx context.Context, cartID uint, productID uint, variantID *uint) error {
+	return whereItem(r.db.WithContext(ctx), cartID, productID, variantID).
 		Delete(&models.CartItem{}).Error
 }
 
-func (r *CartRepository) ClearCart(cartID uint) error {
-	return r.db.Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error
+// whereItem selects the cart line for a product, or for one of its variants.
+// A product and each of its variants are separate lines.
+func whereItem(db *gorm.DB, cartID uint, productID uint, variantID *uint) *gorm.DB {
+	db = db.Where("cart_id = ? AND product_id = ?", cartID, productID)
+	if variantID == nil {
+		return db.Where("variant_id IS NULL")
+	}
+	return db.Where("variant_id = ?", *variantID)
+}
+
+func (r *CartRepository) ClearCart(ctx context.Context, cartID uint) error {
+	return r.db.WithContext(ctx).Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error
+}
+
+// SetCoupon enters a coupon code on the cart, or removes it if code is nil
+func (r *CartRepository) SetCoupon(ctx context.Context, cartID uint, code *string) error {
+	return r.db.WithContext(ctx).Model(&models.Cart{}).Where("id = ?", cartID).Update("coupon_code", code).Error
 }
 
-func (r *CartRepository) GetCartItems(cartID uint) ([]models.CartItem, error) {
+func (r *CartRepository) GetCartItems(ctx context.Context, cartID uint) ([]models.CartItem, error) {
 	var items []models.CartItem
-	err := r.db.Preload("Product").Where("cart_id = ?", cartID).Find(&items).Error
+	err := r.db.WithContext(ctx).Preload("Product").Preload("Variant").Where("cart_id = ?", cartID).Find(&items).Error
 	return items, err
 }
 
-func (r *CartRepository) AddMultipleItems(cartID uint, items []models.CartItem) error {
+func (r *CartRepository) AddMultipleItems(ctx context.Context, cartID uint, items []models.CartItem) error {
 	for _, item := range items {
-		if err := r.AddItem(cartID, &item); err != nil {
+		if err := r.AddItem(ctx, cartID, &item); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+)
+
+type AICacheRepository struct {
+	db *DB
+}
+
+func NewAICacheRepository(db *DB) *AICacheRepository {
+	return &AICacheRepository{db: db}
+}
+
+func (r *AICacheRepository) Get(ctx context.Context, key string, now time.Time) (*models.AICacheEntry, error) {
+	var entry models.AICacheEntry
+	err := r.db.view(func(t *tables) error {
+		row, ok := t.aiCache[key]
+		if !ok || !row.ExpiresAt.After(now) {
+			return gorm.ErrRecordNotFound
+		}
+		entry = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *AICacheRepository) Upsert(ctx context.Context, entry *models.AICacheEntry) error {
+	return r.db.write(false, func(t *tables) error {
+		stamp(&entry.CreatedAt, nil)
+		t.aiCache[entry.Key] = *entry
+		return nil
+	})
+}
+
+func (r *AICacheRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	return r.db.write(false, func(t *tables) error {
+		for key, entry := range t.aiCache {
+			if !entry.ExpiresAt.After(now) {
+				delete(t.aiCache, key)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *AICacheRepository) DeleteAll(ctx context.Context) error {
+	return r.db.write(false, func(t *tables) error {
+		clear(t.aiCache)
+		return nil
+	})
+}
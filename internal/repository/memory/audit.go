@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type AuditRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) WithTx(tx *gorm.DB) repository.AuditStore {
+	checkTx(tx)
+	return &AuditRepository{db: r.db, inTx: true}
+}
+
+func (r *AuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if !nextID(t, "audit_logs", t.auditLogs, &entry.ID) {
+			return gorm.ErrDuplicatedKey
+		}
+		stamp(&entry.CreatedAt, nil)
+		t.auditLogs[entry.ID] = *entry
+		return nil
+	})
+}
+
+func (r *AuditRepository) List(ctx context.Context, q *models.AuditQuery) ([]models.AuditLog, int64, error) {
+	var entries []models.AuditLog
+	err := r.db.view(func(t *tables) error {
+		entries = rowsOf(t.auditLogs, func(e *models.AuditLog) bool {
+			return (q.ActorID == nil || e.ActorID == *q.ActorID) &&
+				(q.Action == "" || e.Action == q.Action) &&
+				(q.EntityType == "" || e.EntityType == q.EntityType) &&
+				(q.EntityID == "" || e.EntityID == q.EntityID) &&
+				(q.From == nil || !e.CreatedAt.Before(*q.From)) &&
+				(q.To == nil || e.CreatedAt.Before(*q.To))
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Newest first
+	slices.SortFunc(entries, func(a, b models.AuditLog) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	total := int64(len(entries))
+	from := min((q.Page-1)*q.Limit, len(entries))
+	to := min(from+q.Limit, len(entries))
+	return entries[from:to], total, nil
+}
@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type CartRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewCartRepository(db *DB) *CartRepository {
+	return &CartRepository{db: db}
+}
+
+func (r *CartRepository) WithTx(tx *gorm.DB) repository.CartStore {
+	checkTx(tx)
+	return &CartRepository{db: r.db, inTx: true}
+}
+
+func (r *CartRepository) GetOrCreateByUserID(ctx context.Context, userID uint) (*models.Cart, error) {
+	var cart models.Cart
+	err := r.db.write(r.inTx, func(t *tables) error {
+		if row, ok := t.cartOf(userID); ok {
+			cart = t.withItems(row)
+			return nil
+		}
+
+		// user_id is unique, deleted carts included
+		for _, other := range t.carts {
+			if other.UserID == userID {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		cart = models.Cart{UserID: userID}
+		nextID(t, "carts", t.carts, &cart.ID)
+		stamp(&cart.CreatedAt, &cart.UpdatedAt)
+		t.carts[cart.ID] = cart
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func (r *CartRepository) GetByUserID(ctx context.Context, userID uint) (*models.Cart, error) {
+	var cart models.Cart
+	err := r.db.view(func(t *tables) error {
+		row, ok := t.cartOf(userID)
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		cart = t.withItems(row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func (t *tables) cartOf(userID uint) (models.Cart, bool) {
+	for _, cart := range t.carts {
+		if cart.UserID == userID && !cart.DeletedAt.Valid {
+			return cart, true
+		}
+	}
+	return models.Cart{}, false
+}
+
+// withItems preloads the cart's items with their product and variant
+func (t *tables) withItems(cart models.Cart) models.Cart {
+	cart.Items = t.itemsOf(cart.ID)
+	return cart
+}
+
+func (t *tables) itemsOf(cartID uint) []models.CartItem {
+	items := rowsOf(t.cartItems, func(item *models.CartItem) bool {
+		return item.CartID == cartID && !item.DeletedAt.Valid
+	})
+	for i := range items {
+		if product, ok := t.product(items[i].ProductID); ok {
+			items[i].Product = &product
+		}
+		if items[i].VariantID != nil {
+			if variant, ok := t.variant(*items[i].VariantID); ok {
+				items[i].Variant = &variant
+			}
+		}
+	}
+	return items
+}
+
+// item returns the cart line for a product, or for one of its variants
+func (t *tables) item(cartID, productID uint, variantID *uint) (models.CartItem, bool) {
+	for _, item := range t.cartItems {
+		if item.CartID == cartID && item.ProductID == productID && sameID(item.VariantID, variantID) && !item.DeletedAt.Valid {
+			return item, true
+		}
+	}
+	return models.CartItem{}, false
+}
+
+func (r *CartRepository) AddItem(ctx context.Context, cartID uint, item *models.CartItem) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		return t.addItem(cartID, item)
+	})
+}
+
+func (t *tables) addItem(cartID uint, item *models.CartItem) error {
+	if existing, ok := t.item(cartID, item.ProductID, item.VariantID); ok {
+		existing.Quantity += item.Quantity
+		existing.UpdatedAt = time.Now()
+		t.cartItems[existing.ID] = existing
+		return nil
+	}
+
+	item.CartID = cartID
+	if !nextID(t, "cart_items", t.cartItems, &item.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+	stamp(&item.CreatedAt, &item.UpdatedAt)
+	row := *item
+	row.Product = nil
+	row.Variant = nil
+	t.cartItems[item.ID] = row
+	return nil
+}
+
+func (r *CartRepository) AddMultipleItems(ctx context.Context, cartID uint, items []models.CartItem) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		for _, item := range items {
+			if err := t.addItem(cartID, &item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *CartRepository) UpdateItemQuantity(ctx context.Context, cartID uint, productID uint, variantID *uint, quantity float64) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if item, ok := t.item(cartID, productID, variantID); ok {
+			item.Quantity = quantity
+			item.UpdatedAt = time.Now()
+			t.cartItems[item.ID] = item
+		}
+		return nil
+	})
+}
+
+func (r *CartRepository) RemoveItem(ctx context.Context, cartID uint, productID uint, variantID *uint) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if item, ok := t.item(cartID, productID, variantID); ok {
+			softDelete(&item.DeletedAt)
+			t.cartItems[item.ID] = item
+		}
+		return nil
+	})
+}
+
+func (r *CartRepository) ClearCart(ctx context.Context, cartID uint) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		for id, item := range t.cartItems {
+			if item.CartID == cartID && !item.DeletedAt.Valid {
+				softDelete(&item.DeletedAt)
+				t.cartItems[id] = item
+			}
+		}
+		return nil
+	})
+}
+
+func (r *CartRepository) SetCoupon(ctx context.Context, cartID uint, code *string) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if cart, ok := t.carts[cartID]; ok && !cart.DeletedAt.Valid {
+			if code != nil {
+				code := *code
+				cart.CouponCode = &code
+			} else {
+				cart.CouponCode = nil
+			}
+			cart.UpdatedAt = time.Now()
+			t.carts[cartID] = cart
+		}
+		return nil
+	})
+}
+
+func (r *CartRepository) GetCartItems(ctx context.Context, cartID uint) ([]models.CartItem, error) {
+	var items []models.CartItem
+	err := r.db.view(func(t *tables) error {
+		items = t.itemsOf(cartID)
+		return nil
+	})
+	return items, err
+}
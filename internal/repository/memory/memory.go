@@ -0,0 +1,235 @@
+// Package memory implements the repository stores in memory, for tests that
+// shouldn't need Postgres. Rows live in maps and behave like the GORM
+// repositories: deletes are soft, lookups of deleted rows fail with
+// gorm.ErrRecordNotFound, unique columns are enforced and the same
+// associations are preloaded.
+//
+// A transaction is serialized with other transactions and rolled back by
+// restoring a copy of the data taken when it started, so every store of the
+// same DB takes part in it. Writes through stores that WithTx didn't bind to
+// the transaction wait for it to finish, so a rollback can't undo them; reads
+// don't wait and may see the transaction's uncommitted writes. The *gorm.DB
+// handed to the transaction function is nil; WithTx panics if it is handed a
+// GORM transaction instead, whose rollback wouldn't undo writes made here.
+package memory
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+var (
+	_ repository.ProductStore     = (*ProductRepository)(nil)
+	_ repository.CategoryStore    = (*CategoryRepository)(nil)
+	_ repository.CartStore        = (*CartRepository)(nil)
+	_ repository.RecipeStore      = (*RecipeRepository)(nil)
+	_ repository.UserStore        = (*UserRepository)(nil)
+	_ repository.OrderStore       = (*OrderRepository)(nil)
+	_ repository.ReservationStore = (*ReservationRepository)(nil)
+	_ repository.PromotionStore   = (*PromotionRepository)(nil)
+	_ repository.SessionStore     = (*SessionRepository)(nil)
+	_ repository.UserTokenStore   = (*UserTokenRepository)(nil)
+
+	_ repository.RolePermissionStore = (*RolePermissionRepository)(nil)
+	_ repository.AuditStore          = (*AuditRepository)(nil)
+	_ repository.AICacheStore        = (*AICacheRepository)(nil)
+)
+
+// DB holds the tables shared by the stores created from it, so a cart can
+// preload the products of its items like it does in Postgres
+type DB struct {
+	mu   sync.Mutex // guards t
+	txMu sync.Mutex // held by a transaction, and by writes outside one
+	t    tables
+}
+
+type tables struct {
+	lastID          map[string]uint
+	categories      map[uint]models.Category
+	products        map[uint]models.Product
+	variants        map[uint]models.ProductVariant
+	priceChanges    map[uint]models.PriceChange
+	scheduledPrices map[uint]models.ScheduledPrice
+	carts           map[uint]models.Cart
+	cartItems       map[uint]models.CartItem
+	recipes         map[uint]models.Recipe
+	ingredients     map[uint]models.RecipeIngredient
+	users           map[uint]models.User
+	orders          map[uint]models.Order
+	orderItems      map[uint]models.OrderItem
+	orderDiscounts  map[uint]models.OrderDiscount
+	statusChanges   map[uint]models.OrderStatusChange
+	reservations    map[uint]models.StockReservation
+	promotions      map[uint]models.Promotion
+	sessions        map[uint]models.Session
+	userTokens      map[uint]models.UserToken
+	rolePermissions []models.RolePermission
+	auditLogs       map[uint]models.AuditLog
+	aiCache         map[string]models.AICacheEntry
+}
+
+func New() *DB {
+	return &DB{t: tables{
+		lastID:          make(map[string]uint),
+		categories:      make(map[uint]models.Category),
+		products:        make(map[uint]models.Product),
+		variants:        make(map[uint]models.ProductVariant),
+		priceChanges:    make(map[uint]models.PriceChange),
+		scheduledPrices: make(map[uint]models.ScheduledPrice),
+		carts:           make(map[uint]models.Cart),
+		cartItems:       make(map[uint]models.CartItem),
+		recipes:         make(map[uint]models.Recipe),
+		ingredients:     make(map[uint]models.RecipeIngredient),
+		users:           make(map[uint]models.User),
+		orders:          make(map[uint]models.Order),
+		orderItems:      make(map[uint]models.OrderItem),
+		orderDiscounts:  make(map[uint]models.OrderDiscount),
+		statusChanges:   make(map[uint]models.OrderStatusChange),
+		reservations:    make(map[uint]models.StockReservation),
+		promotions:      make(map[uint]models.Promotion),
+		sessions:        make(map[uint]models.Session),
+		userTokens:      make(map[uint]models.UserToken),
+		auditLogs:       make(map[uint]models.AuditLog),
+		aiCache:         make(map[string]models.AICacheEntry),
+	}}
+}
+
+// Rows are stored by value without their associations, so a shallow copy
+// of every map and slice is a snapshot
+func (t *tables) clone() tables {
+	return tables{
+		lastID:          maps.Clone(t.lastID),
+		categories:      maps.Clone(t.categories),
+		products:        maps.Clone(t.products),
+		variants:        maps.Clone(t.variants),
+		priceChanges:    maps.Clone(t.priceChanges),
+		scheduledPrices: maps.Clone(t.scheduledPrices),
+		carts:           maps.Clone(t.carts),
+		cartItems:       maps.Clone(t.cartItems),
+		recipes:         maps.Clone(t.recipes),
+		ingredients:     maps.Clone(t.ingredients),
+		users:           maps.Clone(t.users),
+		orders:          maps.Clone(t.orders),
+		orderItems:      maps.Clone(t.orderItems),
+		orderDiscounts:  maps.Clone(t.orderDiscounts),
+		statusChanges:   maps.Clone(t.statusChanges),
+		reservations:    maps.Clone(t.reservations),
+		promotions:      maps.Clone(t.promotions),
+		sessions:        maps.Clone(t.sessions),
+		userTokens:      maps.Clone(t.userTokens),
+		rolePermissions: slices.Clone(t.rolePermissions),
+		auditLogs:       maps.Clone(t.auditLogs),
+		aiCache:         maps.Clone(t.aiCache),
+	}
+}
+
+// view runs fn with the tables locked
+func (db *DB) view(fn func(t *tables) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return fn(&db.t)
+}
+
+// write runs fn with the tables locked. Unless inTx, it first waits for the
+// running transaction, whose rollback would otherwise throw the write away.
+// A store calls it with inTx set only once WithTx bound it to a transaction;
+// a write through an unbound store inside a transaction would deadlock.
+func (db *DB) write(inTx bool, fn func(t *tables) error) error {
+	if !inTx {
+		db.txMu.Lock()
+		defer db.txMu.Unlock()
+	}
+	return db.view(fn)
+}
+
+// transaction runs fn and restores the tables if it fails or panics
+func (db *DB) transaction(fn func() error) error {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	db.mu.Lock()
+	saved := db.t.clone()
+	db.mu.Unlock()
+
+	committed := false
+	defer func() {
+		if !committed {
+			db.mu.Lock()
+			db.t = saved
+			db.mu.Unlock()
+		}
+	}()
+
+	if err := fn(); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// checkTx panics if a store is handed a GORM transaction: its writes would
+// survive that transaction's rollback
+func checkTx(tx *gorm.DB) {
+	if tx != nil {
+		panic("memory: store used in a GORM transaction")
+	}
+}
+
+// nextID assigns the next primary key of table, or keeps id if it is set.
+// It reports false if a row with that id exists.
+func nextID[T any](t *tables, table string, rows map[uint]T, id *uint) bool {
+	if *id != 0 {
+		if _, ok := rows[*id]; ok {
+			return false
+		}
+		t.lastID[table] = max(t.lastID[table], *id)
+		return true
+	}
+	t.lastID[table]++
+	*id = t.lastID[table]
+	return true
+}
+
+// rowsOf returns the rows for which keep is true, in ID order
+func rowsOf[T any](rows map[uint]T, keep func(*T) bool) []T {
+	ids := slices.Sorted(maps.Keys(rows))
+	result := []T{}
+	for _, id := range ids {
+		row := rows[id]
+		if keep(&row) {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+func stamp(createdAt, updatedAt *time.Time) {
+	now := time.Now()
+	if createdAt != nil && createdAt.IsZero() {
+		*createdAt = now
+	}
+	if updatedAt != nil && updatedAt.IsZero() {
+		*updatedAt = now
+	}
+}
+
+func softDelete(deletedAt *gorm.DeletedAt) {
+	*deletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+func sameString(a, b *string) bool {
+	return a != nil && b != nil && *a == *b
+}
@@ -0,0 +1,69 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository/memory"
+	"github.com/bexiiiii/smart_food_store/internal/repository/storetest"
+	"gorm.io/gorm"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		db := memory.New()
+		return storetest.Stores{
+			Products:     memory.NewProductRepository(db),
+			Categories:   memory.NewCategoryRepository(db),
+			Carts:        memory.NewCartRepository(db),
+			Recipes:      memory.NewRecipeRepository(db),
+			Users:        memory.NewUserRepository(db),
+			Orders:       memory.NewOrderRepository(db),
+			Reservations: memory.NewReservationRepository(db),
+			Promotions:   memory.NewPromotionRepository(db),
+			Sessions:     memory.NewSessionRepository(db),
+			Tokens:       memory.NewUserTokenRepository(db),
+
+			RolePermissions: memory.NewRolePermissionRepository(db),
+			Audit:           memory.NewAuditRepository(db),
+			AICache:         memory.NewAICacheRepository(db),
+		}
+	})
+}
+
+// A write from outside a transaction that fails survives its rollback
+func TestConcurrentWriteSurvivesRollback(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New()
+	carts := memory.NewCartRepository(db)
+	products := memory.NewProductRepository(db)
+	cart, err := carts.GetOrCreateByUserID(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("roll back")
+	done := make(chan error)
+	err = products.Transaction(ctx, func(tx *gorm.DB) error {
+		go func() {
+			done <- carts.AddItem(ctx, cart.ID, &models.CartItem{ProductID: 1, Quantity: 2})
+		}()
+		// Give the write time to run if it doesn't wait for the transaction
+		time.Sleep(20 * time.Millisecond)
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Transaction = %v, want the error of fn", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := carts.GetCartItems(ctx, cart.ID)
+	if err != nil || len(items) != 1 {
+		t.Errorf("cart items after the rollback = %v, %v, want the concurrent add", items, err)
+	}
+}
@@ -0,0 +1,169 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type OrderRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewOrderRepository(db *DB) *OrderRepository {
+	return &OrderRepository{db: db}
+}
+
+func (r *OrderRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.transaction(func() error { return fn(nil) })
+}
+
+func (r *OrderRepository) WithTx(tx *gorm.DB) repository.OrderStore {
+	checkTx(tx)
+	return &OrderRepository{db: r.db, inTx: true}
+}
+
+// Create stores the order with its items, discounts and history, like GORM
+// saves the associations of a new row
+func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if !nextID(t, "orders", t.orders, &order.ID) {
+			return gorm.ErrDuplicatedKey
+		}
+		if order.Status == "" {
+			order.Status = models.OrderStatusPending
+		}
+		stamp(&order.CreatedAt, &order.UpdatedAt)
+
+		for i := range order.Items {
+			item := &order.Items[i]
+			item.OrderID = order.ID
+			if !nextID(t, "order_items", t.orderItems, &item.ID) {
+				return gorm.ErrDuplicatedKey
+			}
+			stamp(&item.CreatedAt, &item.UpdatedAt)
+			t.orderItems[item.ID] = *item
+		}
+		for i := range order.Discounts {
+			discount := &order.Discounts[i]
+			discount.OrderID = order.ID
+			if !nextID(t, "order_discounts", t.orderDiscounts, &discount.ID) {
+				return gorm.ErrDuplicatedKey
+			}
+			stamp(&discount.CreatedAt, nil)
+			t.orderDiscounts[discount.ID] = *discount
+		}
+		for i := range order.History {
+			change := &order.History[i]
+			change.OrderID = order.ID
+			if err := t.addStatusChange(change); err != nil {
+				return err
+			}
+		}
+
+		row := *order
+		row.User = nil
+		row.Items = nil
+		row.Discounts = nil
+		row.History = nil
+		t.orders[order.ID] = row
+		return nil
+	})
+}
+
+func (r *OrderRepository) GetByID(ctx context.Context, id uint) (*models.Order, error) {
+	return r.find(true, func(o *models.Order) bool { return o.ID == id })
+}
+
+func (r *OrderRepository) GetByIDForUser(ctx context.Context, id uint, userID uint) (*models.Order, error) {
+	return r.find(true, func(o *models.Order) bool { return o.ID == id && o.UserID == userID })
+}
+
+// GetByIDForUpdate needs no lock: transactions are serialized
+func (r *OrderRepository) GetByIDForUpdate(ctx context.Context, id uint) (*models.Order, error) {
+	return r.find(false, func(o *models.Order) bool { return o.ID == id })
+}
+
+func (r *OrderRepository) GetByUserID(ctx context.Context, userID uint) ([]models.Order, error) {
+	return r.findAll(false, func(o *models.Order) bool { return o.UserID == userID })
+}
+
+func (r *OrderRepository) GetAll(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	return r.findAll(false, func(o *models.Order) bool { return status == "" || o.Status == status })
+}
+
+func (r *OrderRepository) find(history bool, match func(*models.Order) bool) (*models.Order, error) {
+	orders, err := r.findAll(history, match)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &orders[0], nil
+}
+
+// findAll returns the matching orders newest first, with their items and
+// discounts and, if history is set, their status changes
+func (r *OrderRepository) findAll(history bool, match func(*models.Order) bool) ([]models.Order, error) {
+	var orders []models.Order
+	err := r.db.view(func(t *tables) error {
+		orders = rowsOf(t.orders, func(o *models.Order) bool {
+			return !o.DeletedAt.Valid && match(o)
+		})
+		for i := range orders {
+			t.preloadOrder(&orders[i], history)
+		}
+		return nil
+	})
+	slices.SortStableFunc(orders, func(a, b models.Order) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return orders, err
+}
+
+func (t *tables) preloadOrder(order *models.Order, history bool) {
+	order.Items = rowsOf(t.orderItems, func(item *models.OrderItem) bool {
+		return item.OrderID == order.ID && !item.DeletedAt.Valid
+	})
+	order.Discounts = rowsOf(t.orderDiscounts, func(d *models.OrderDiscount) bool {
+		return d.OrderID == order.ID
+	})
+	if history {
+		order.History = rowsOf(t.statusChanges, func(c *models.OrderStatusChange) bool {
+			return c.OrderID == order.ID
+		})
+	}
+}
+
+func (r *OrderRepository) UpdateStatus(ctx context.Context, id uint, status models.OrderStatus) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if order, ok := t.orders[id]; ok && !order.DeletedAt.Valid {
+			order.Status = status
+			order.UpdatedAt = time.Now()
+			t.orders[id] = order
+		}
+		return nil
+	})
+}
+
+func (r *OrderRepository) AddStatusChange(ctx context.Context, change *models.OrderStatusChange) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		return t.addStatusChange(change)
+	})
+}
+
+func (t *tables) addStatusChange(change *models.OrderStatusChange) error {
+	if !nextID(t, "order_status_changes", t.statusChanges, &change.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+	stamp(&change.CreatedAt, nil)
+	t.statusChanges[change.ID] = *change
+	return nil
+}
@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+type RolePermissionRepository struct {
+	db *DB
+}
+
+func NewRolePermissionRepository(db *DB) *RolePermissionRepository {
+	return &RolePermissionRepository{db: db}
+}
+
+// GetAll returns the mappings sorted by role and permission, like the GORM
+// version
+func (r *RolePermissionRepository) GetAll(ctx context.Context) ([]models.RolePermission, error) {
+	var mappings []models.RolePermission
+	err := r.db.view(func(t *tables) error {
+		mappings = slices.Clone(t.rolePermissions)
+		return nil
+	})
+	slices.SortFunc(mappings, func(a, b models.RolePermission) int {
+		return cmp.Or(cmp.Compare(a.Role, b.Role), cmp.Compare(a.Permission, b.Permission))
+	})
+	return mappings, err
+}
+
+func (r *RolePermissionRepository) ReplaceForRole(ctx context.Context, role models.Role, permissions []models.Permission) error {
+	return r.db.write(false, func(t *tables) error {
+		t.rolePermissions = slices.DeleteFunc(t.rolePermissions, func(m models.RolePermission) bool { return m.Role == role })
+		now := time.Now()
+		for _, perm := range permissions {
+			t.rolePermissions = append(t.rolePermissions, models.RolePermission{Role: role, Permission: perm, CreatedAt: now})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,703 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type ProductRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewProductRepository(db *DB) *ProductRepository {
+	return &ProductRepository{db: db}
+}
+
+func (r *ProductRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.transaction(func() error { return fn(nil) })
+}
+
+func (r *ProductRepository) WithTx(tx *gorm.DB) repository.ProductStore {
+	checkTx(tx)
+	return &ProductRepository{db: r.db, inTx: true}
+}
+
+func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		return t.createProduct(product)
+	})
+}
+
+func (t *tables) createProduct(product *models.Product) error {
+	if t.productConflicts(product) {
+		return gorm.ErrDuplicatedKey
+	}
+	if !nextID(t, "products", t.products, &product.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+	if product.Unit == "" {
+		product.Unit = models.UnitGram
+	}
+	stamp(&product.CreatedAt, &product.UpdatedAt)
+	t.products[product.ID] = productRow(product)
+
+	for i := range product.Variants {
+		product.Variants[i].ProductID = product.ID
+		if err := t.createVariant(&product.Variants[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// productRow is what is stored of a product: its own columns
+func productRow(product *models.Product) models.Product {
+	row := *product
+	row.Category = nil
+	row.Variants = nil
+	row.SearchRank = 0
+	row.Highlight = ""
+	return row
+}
+
+// productConflicts reports whether another product that isn't deleted has
+// the SKU or barcode of product
+func (t *tables) productConflicts(product *models.Product) bool {
+	for _, other := range t.products {
+		if other.ID == product.ID || other.DeletedAt.Valid {
+			continue
+		}
+		if sameString(other.SKU, product.SKU) || sameString(other.Barcode, product.Barcode) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tables) product(id uint) (models.Product, bool) {
+	product, ok := t.products[id]
+	return product, ok && !product.DeletedAt.Valid
+}
+
+// withCategory preloads the product's category
+func (t *tables) withCategory(product models.Product) models.Product {
+	if category, ok := t.categories[product.CategoryID]; ok && !category.DeletedAt.Valid {
+		product.Category = &category
+	}
+	return product
+}
+
+// withVariants preloads the product's variants in ID order
+func (t *tables) withVariants(product models.Product) models.Product {
+	product.Variants = rowsOf(t.variants, func(v *models.ProductVariant) bool {
+		return v.ProductID == product.ID && !v.DeletedAt.Valid
+	})
+	return product
+}
+
+// findProduct returns the first product, in ID order, that isn't deleted
+// and matches
+func (t *tables) findProduct(match func(*models.Product) bool) (models.Product, error) {
+	products := t.findProducts(match)
+	if len(products) == 0 {
+		return models.Product{}, gorm.ErrRecordNotFound
+	}
+	return products[0], nil
+}
+
+func (t *tables) findProducts(match func(*models.Product) bool) []models.Product {
+	return rowsOf(t.products, func(p *models.Product) bool {
+		return !p.DeletedAt.Valid && match(p)
+	})
+}
+
+func (r *ProductRepository) GetByID(ctx context.Context, id uint) (*models.Product, error) {
+	var product models.Product
+	err := r.db.view(func(t *tables) error {
+		row, ok := t.product(id)
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+		product = t.withVariants(t.withCategory(row))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *ProductRepository) GetBySKU(ctx context.Context, sku string) (*models.Product, error) {
+	var product models.Product
+	err := r.db.view(func(t *tables) (err error) {
+		product, err = t.findProduct(func(p *models.Product) bool {
+			return p.SKU != nil && *p.SKU == sku
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *ProductRepository) GetByBarcode(ctx context.Context, barcode string) (*models.Product, error) {
+	var product models.Product
+	err := r.db.view(func(t *tables) error {
+		row, err := t.findProduct(func(p *models.Product) bool {
+			return p.Barcode != nil && *p.Barcode == barcode
+		})
+		if err != nil {
+			return err
+		}
+		product = t.withVariants(t.withCategory(row))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *ProductRepository) GetByName(ctx context.Context, name string) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.view(func(t *tables) error {
+		products = t.findProducts(func(p *models.Product) bool {
+			return strings.EqualFold(p.Name, name)
+		})
+		return nil
+	})
+	return products, err
+}
+
+func (r *ProductRepository) GetAll(ctx context.Context) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.view(func(t *tables) error {
+		products = t.findProducts(func(*models.Product) bool { return true })
+		for i := range products {
+			products[i] = t.withCategory(products[i])
+		}
+		return nil
+	})
+	return products, err
+}
+
+// List filters, sorts and pages like the GORM repository. Search matches
+// words as case-insensitive substrings, see searchScore.
+func (r *ProductRepository) List(ctx context.Context, q *models.ProductQuery, after *repository.ProductCursor) ([]models.Product, int64, error) {
+	var products []models.Product
+	err := r.db.view(func(t *tables) error {
+		products = t.findProducts(func(p *models.Product) bool {
+			return matchesProductQuery(p, q)
+		})
+		for i := range products {
+			products[i] = t.withVariants(t.withCategory(products[i]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	total := int64(len(products))
+
+	slices.SortStableFunc(products, func(a, b models.Product) int {
+		if q.Sort == "relevance" {
+			// Like "search_rank <order>, id": ties go by ID ascending
+			c := cmp.Compare(a.SearchRank, b.SearchRank)
+			if q.Order != "asc" {
+				c = -c
+			}
+			return cmp.Or(c, cmp.Compare(a.ID, b.ID))
+		}
+		c := cmp.Or(compareValues(sortValue(&a, q.Sort), sortValue(&b, q.Sort)), cmp.Compare(a.ID, b.ID))
+		if q.Order == "desc" {
+			c = -c
+		}
+		return c
+	})
+
+	if after != nil {
+		start := len(products)
+		for i := range products {
+			c := cmp.Or(compareValues(sortValue(&products[i], q.Sort), after.Value), cmp.Compare(products[i].ID, after.ID))
+			if q.Order == "desc" {
+				c = -c
+			}
+			if c > 0 {
+				start = i
+				break
+			}
+		}
+		products = products[start:]
+	} else if q.Page > 1 {
+		products = products[min((q.Page-1)*q.Limit, len(products)):]
+	}
+
+	if len(products) > q.Limit+1 {
+		products = products[:q.Limit+1]
+	}
+	return products, total, nil
+}
+
+// matchesProductQuery applies the filters of q to p and, for a search,
+// fills in SearchRank and Highlight
+func matchesProductQuery(p *models.Product, q *models.ProductQuery) bool {
+	if q.CategoryID != nil && p.CategoryID != *q.CategoryID {
+		return false
+	}
+	if q.MinPrice != nil && p.Price < *q.MinPrice {
+		return false
+	}
+	if q.MaxPrice != nil && p.Price > *q.MaxPrice {
+		return false
+	}
+	if q.Unit != "" && p.Unit != q.Unit {
+		return false
+	}
+	if q.InStock != nil && (p.Stock > 0) != *q.InStock {
+		return false
+	}
+	if q.Query != "" {
+		rank, ok := searchScore(q.Query, p.Name, p.Description)
+		if !ok {
+			return false
+		}
+		p.SearchRank = rank
+		p.Highlight = highlight(p.Name+" "+p.Description, q.Query)
+	}
+	return true
+}
+
+func sortValue(p *models.Product, sort string) interface{} {
+	switch sort {
+	case "price":
+		return p.Price
+	case "name":
+		return p.Name
+	default:
+		return p.CreatedAt
+	}
+}
+
+// compareValues compares two sort values of the same kind
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	}
+	return 0
+}
+
+func (r *ProductRepository) GetByIDs(ctx context.Context, ids []uint) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.view(func(t *tables) error {
+		products = t.findProducts(func(p *models.Product) bool {
+			return slices.Contains(ids, p.ID)
+		})
+		for i := range products {
+			products[i] = t.withVariants(t.withCategory(products[i]))
+		}
+		return nil
+	})
+	return products, err
+}
+
+func (r *ProductRepository) GetAllWithStock(ctx context.Context) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.view(func(t *tables) error {
+		products = t.findProducts(func(p *models.Product) bool { return p.Stock > 0 })
+		for i := range products {
+			products[i] = t.withCategory(products[i])
+		}
+		return nil
+	})
+	return products, err
+}
+
+// Update saves the product's own columns; associations are left alone
+func (r *ProductRepository) Update(ctx context.Context, product *models.Product) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if _, ok := t.products[product.ID]; !ok {
+			return t.createProduct(product)
+		}
+		if t.productConflicts(product) {
+			return gorm.ErrDuplicatedKey
+		}
+		product.UpdatedAt = time.Now()
+		t.products[product.ID] = productRow(product)
+		return nil
+	})
+}
+
+func (r *ProductRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if product, ok := t.product(id); ok {
+			softDelete(&product.DeletedAt)
+			t.products[id] = product
+		}
+		return nil
+	})
+}
+
+func (r *ProductRepository) UpdateStock(ctx context.Context, id uint, quantity float64) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		product, ok := t.product(id)
+		if !ok || product.Stock < quantity {
+			return repository.ErrInsufficientStock
+		}
+		product.Stock -= quantity
+		product.UpdatedAt = time.Now()
+		t.products[id] = product
+		return nil
+	})
+}
+
+func (r *ProductRepository) RestoreStock(ctx context.Context, id uint, quantity float64) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if product, ok := t.product(id); ok {
+			product.Stock += quantity
+			product.UpdatedAt = time.Now()
+			t.products[id] = product
+		}
+		return nil
+	})
+}
+
+// Variant methods
+
+func (r *ProductRepository) CreateVariant(ctx context.Context, variant *models.ProductVariant) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		return t.createVariant(variant)
+	})
+}
+
+func (t *tables) createVariant(variant *models.ProductVariant) error {
+	if t.variantConflicts(variant) || !nextID(t, "product_variants", t.variants, &variant.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+	stamp(&variant.CreatedAt, &variant.UpdatedAt)
+	t.variants[variant.ID] = *variant
+	return nil
+}
+
+func (t *tables) variantConflicts(variant *models.ProductVariant) bool {
+	for _, other := range t.variants {
+		if other.ID == variant.ID || other.DeletedAt.Valid {
+			continue
+		}
+		if sameString(other.SKU, variant.SKU) || sameString(other.Barcode, variant.Barcode) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tables) variant(id uint) (models.ProductVariant, bool) {
+	variant, ok := t.variants[id]
+	return variant, ok && !variant.DeletedAt.Valid
+}
+
+func (r *ProductRepository) GetVariant(ctx context.Context, productID, variantID uint) (*models.ProductVariant, error) {
+	return r.findVariant(func(v *models.ProductVariant) bool {
+		return v.ID == variantID && v.ProductID == productID
+	})
+}
+
+func (r *ProductRepository) GetVariantBySKU(ctx context.Context, sku string) (*models.ProductVariant, error) {
+	return r.findVariant(func(v *models.ProductVariant) bool {
+		return v.SKU != nil && *v.SKU == sku
+	})
+}
+
+func (r *ProductRepository) GetVariantByBarcode(ctx context.Context, barcode string) (*models.ProductVariant, error) {
+	return r.findVariant(func(v *models.ProductVariant) bool {
+		return v.Barcode != nil && *v.Barcode == barcode
+	})
+}
+
+func (r *ProductRepository) findVariant(match func(*models.ProductVariant) bool) (*models.ProductVariant, error) {
+	var variants []models.ProductVariant
+	r.db.view(func(t *tables) error {
+		variants = rowsOf(t.variants, func(v *models.ProductVariant) bool {
+			return !v.DeletedAt.Valid && match(v)
+		})
+		return nil
+	})
+	if len(variants) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &variants[0], nil
+}
+
+func (r *ProductRepository) UpdateVariant(ctx context.Context, variant *models.ProductVariant) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if _, ok := t.variants[variant.ID]; !ok {
+			return t.createVariant(variant)
+		}
+		if t.variantConflicts(variant) {
+			return gorm.ErrDuplicatedKey
+		}
+		variant.UpdatedAt = time.Now()
+		t.variants[variant.ID] = *variant
+		return nil
+	})
+}
+
+func (r *ProductRepository) DeleteVariant(ctx context.Context, id uint) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if variant, ok := t.variant(id); ok {
+			softDelete(&variant.DeletedAt)
+			t.variants[id] = variant
+		}
+		return nil
+	})
+}
+
+func (r *ProductRepository) UpdateVariantStock(ctx context.Context, id uint, quantity float64) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		variant, ok := t.variant(id)
+		if !ok || variant.Stock < quantity {
+			return repository.ErrInsufficientStock
+		}
+		variant.Stock -= quantity
+		variant.UpdatedAt = time.Now()
+		t.variants[id] = variant
+		return nil
+	})
+}
+
+func (r *ProductRepository) RestoreVariantStock(ctx context.Context, id uint, quantity float64) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if variant, ok := t.variant(id); ok {
+			variant.Stock += quantity
+			variant.UpdatedAt = time.Now()
+			t.variants[id] = variant
+		}
+		return nil
+	})
+}
+
+// Price history methods
+
+func (r *ProductRepository) CreatePriceChange(ctx context.Context, change *models.PriceChange) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if !nextID(t, "price_changes", t.priceChanges, &change.ID) {
+			return gorm.ErrDuplicatedKey
+		}
+		stamp(&change.CreatedAt, nil)
+		t.priceChanges[change.ID] = *change
+		return nil
+	})
+}
+
+func (r *ProductRepository) GetPriceHistory(ctx context.Context, productID uint, since *time.Time) ([]models.PriceChange, error) {
+	return r.priceChanges(func(c *models.PriceChange) bool {
+		return c.ProductID == productID && (since == nil || !c.CreatedAt.Before(*since))
+	})
+}
+
+func (r *ProductRepository) GetPriceChangesSince(ctx context.Context, productIDs []uint, since time.Time) ([]models.PriceChange, error) {
+	return r.priceChanges(func(c *models.PriceChange) bool {
+		return slices.Contains(productIDs, c.ProductID) && !c.CreatedAt.Before(since)
+	})
+}
+
+// priceChanges returns the matching price changes by product and oldest first
+func (r *ProductRepository) priceChanges(match func(*models.PriceChange) bool) ([]models.PriceChange, error) {
+	var changes []models.PriceChange
+	err := r.db.view(func(t *tables) error {
+		changes = rowsOf(t.priceChanges, match)
+		return nil
+	})
+	slices.SortStableFunc(changes, func(a, b models.PriceChange) int {
+		return cmp.Or(cmp.Compare(a.ProductID, b.ProductID), a.CreatedAt.Compare(b.CreatedAt))
+	})
+	return changes, err
+}
+
+func (r *ProductRepository) UpdatePrice(ctx context.Context, id uint, price float64) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if product, ok := t.product(id); ok {
+			product.Price = price
+			product.UpdatedAt = time.Now()
+			t.products[id] = product
+		}
+		return nil
+	})
+}
+
+func (r *ProductRepository) CreateScheduledPrice(ctx context.Context, scheduled *models.ScheduledPrice) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if !nextID(t, "scheduled_prices", t.scheduledPrices, &scheduled.ID) {
+			return gorm.ErrDuplicatedKey
+		}
+		stamp(&scheduled.CreatedAt, &scheduled.UpdatedAt)
+		t.scheduledPrices[scheduled.ID] = *scheduled
+		return nil
+	})
+}
+
+func (r *ProductRepository) GetScheduledPrices(ctx context.Context, productID uint) ([]models.ScheduledPrice, error) {
+	return r.scheduledPrices(func(t *tables, s *models.ScheduledPrice) bool {
+		return s.ProductID == productID
+	})
+}
+
+func (r *ProductRepository) GetScheduledPrice(ctx context.Context, productID, id uint) (*models.ScheduledPrice, error) {
+	scheduled, err := r.scheduledPrices(func(t *tables, s *models.ScheduledPrice) bool {
+		return s.ID == id && s.ProductID == productID
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(scheduled) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &scheduled[0], nil
+}
+
+func (r *ProductRepository) DeleteScheduledPrice(ctx context.Context, id uint) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		delete(t.scheduledPrices, id)
+		return nil
+	})
+}
+
+func (r *ProductRepository) GetDueScheduledPrices(ctx context.Context, now time.Time) ([]models.ScheduledPrice, error) {
+	return r.scheduledPrices(func(t *tables, s *models.ScheduledPrice) bool {
+		_, exists := t.product(s.ProductID)
+		return exists && s.AppliedAt == nil && !s.EffectiveAt.After(now)
+	})
+}
+
+// scheduledPrices returns the matching scheduled prices in the order they
+// take effect
+func (r *ProductRepository) scheduledPrices(match func(*tables, *models.ScheduledPrice) bool) ([]models.ScheduledPrice, error) {
+	var scheduled []models.ScheduledPrice
+	err := r.db.view(func(t *tables) error {
+		scheduled = rowsOf(t.scheduledPrices, func(s *models.ScheduledPrice) bool { return match(t, s) })
+		return nil
+	})
+	slices.SortStableFunc(scheduled, func(a, b models.ScheduledPrice) int {
+		return a.EffectiveAt.Compare(b.EffectiveAt)
+	})
+	return scheduled, err
+}
+
+func (r *ProductRepository) MarkScheduledPriceApplied(ctx context.Context, id uint, at time.Time) (bool, error) {
+	applied := false
+	err := r.db.write(r.inTx, func(t *tables) error {
+		scheduled, ok := t.scheduledPrices[id]
+		if !ok || scheduled.AppliedAt != nil {
+			return nil
+		}
+		scheduled.AppliedAt = &at
+		scheduled.UpdatedAt = time.Now()
+		t.scheduledPrices[id] = scheduled
+		applied = true
+		return nil
+	})
+	return applied, err
+}
+
+// Category methods
+type CategoryRepository struct {
+	db *DB
+}
+
+func NewCategoryRepository(db *DB) *CategoryRepository {
+	return &CategoryRepository{db: db}
+}
+
+func (r *CategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	return r.db.write(false, func(t *tables) error {
+		return t.createCategory(category)
+	})
+}
+
+func (t *tables) createCategory(category *models.Category) error {
+	if t.categoryConflicts(category) || !nextID(t, "categories", t.categories, &category.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+	stamp(&category.CreatedAt, &category.UpdatedAt)
+	t.categories[category.ID] = categoryRow(category)
+	return nil
+}
+
+func categoryRow(category *models.Category) models.Category {
+	row := *category
+	row.Products = nil
+	return row
+}
+
+// categoryConflicts reports whether another category has the name of
+// category. Like in the database, deleted categories count.
+func (t *tables) categoryConflicts(category *models.Category) bool {
+	for _, other := range t.categories {
+		if other.ID != category.ID && other.Name == category.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CategoryRepository) GetByID(ctx context.Context, id uint) (*models.Category, error) {
+	var category models.Category
+	err := r.db.view(func(t *tables) error {
+		row, ok := t.categories[id]
+		if !ok || row.DeletedAt.Valid {
+			return gorm.ErrRecordNotFound
+		}
+		category = row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *CategoryRepository) GetAll(ctx context.Context) ([]models.Category, error) {
+	var categories []models.Category
+	err := r.db.view(func(t *tables) error {
+		categories = rowsOf(t.categories, func(c *models.Category) bool { return !c.DeletedAt.Valid })
+		return nil
+	})
+	return categories, err
+}
+
+func (r *CategoryRepository) Update(ctx context.Context, category *models.Category) error {
+	return r.db.write(false, func(t *tables) error {
+		if _, ok := t.categories[category.ID]; !ok {
+			return t.createCategory(category)
+		}
+		if t.categoryConflicts(category) {
+			return gorm.ErrDuplicatedKey
+		}
+		category.UpdatedAt = time.Now()
+		t.categories[category.ID] = categoryRow(category)
+		return nil
+	})
+}
+
+func (r *CategoryRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.write(false, func(t *tables) error {
+		if category, ok := t.categories[id]; ok && !category.DeletedAt.Valid {
+			softDelete(&category.DeletedAt)
+			t.categories[id] = category
+		}
+		return nil
+	})
+}
@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type PromotionRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewPromotionRepository(db *DB) *PromotionRepository {
+	return &PromotionRepository{db: db}
+}
+
+func (r *PromotionRepository) WithTx(tx *gorm.DB) repository.PromotionStore {
+	checkTx(tx)
+	return &PromotionRepository{db: r.db, inTx: true}
+}
+
+func (r *PromotionRepository) Create(ctx context.Context, promotion *models.Promotion) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		return t.createPromotion(promotion)
+	})
+}
+
+func (t *tables) createPromotion(promotion *models.Promotion) error {
+	if t.promotionConflicts(promotion) || !nextID(t, "promotions", t.promotions, &promotion.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+	stamp(&promotion.CreatedAt, &promotion.UpdatedAt)
+	t.promotions[promotion.ID] = *promotion
+	return nil
+}
+
+// promotionConflicts reports whether another promotion that isn't deleted
+// has the coupon code of promotion
+func (t *tables) promotionConflicts(promotion *models.Promotion) bool {
+	for _, other := range t.promotions {
+		if other.ID != promotion.ID && !other.DeletedAt.Valid && sameString(other.Code, promotion.Code) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tables) promotion(id uint) (models.Promotion, bool) {
+	promotion, ok := t.promotions[id]
+	return promotion, ok && !promotion.DeletedAt.Valid
+}
+
+func (r *PromotionRepository) GetByID(ctx context.Context, id uint) (*models.Promotion, error) {
+	return r.find(func(p *models.Promotion) bool { return p.ID == id })
+}
+
+func (r *PromotionRepository) GetByCode(ctx context.Context, code string) (*models.Promotion, error) {
+	return r.find(func(p *models.Promotion) bool { return p.Code != nil && *p.Code == code })
+}
+
+func (r *PromotionRepository) find(match func(*models.Promotion) bool) (*models.Promotion, error) {
+	promotions, err := r.findAll(match)
+	if err != nil {
+		return nil, err
+	}
+	if len(promotions) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &promotions[0], nil
+}
+
+func (r *PromotionRepository) findAll(match func(*models.Promotion) bool) ([]models.Promotion, error) {
+	var promotions []models.Promotion
+	err := r.db.view(func(t *tables) error {
+		promotions = rowsOf(t.promotions, func(p *models.Promotion) bool {
+			return !p.DeletedAt.Valid && match(p)
+		})
+		return nil
+	})
+	return promotions, err
+}
+
+func (r *PromotionRepository) GetAll(ctx context.Context) ([]models.Promotion, error) {
+	return r.findAll(func(*models.Promotion) bool { return true })
+}
+
+func (r *PromotionRepository) GetActive(ctx context.Context, now time.Time, code string) ([]models.Promotion, error) {
+	return r.findAll(func(p *models.Promotion) bool {
+		return p.Active &&
+			(p.StartsAt == nil || !p.StartsAt.After(now)) &&
+			(p.EndsAt == nil || p.EndsAt.After(now)) &&
+			(p.UsageLimit == nil || p.UsedCount < *p.UsageLimit) &&
+			(p.Code == nil || *p.Code == code)
+	})
+}
+
+func (r *PromotionRepository) Update(ctx context.Context, promotion *models.Promotion) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if _, ok := t.promotions[promotion.ID]; !ok {
+			return t.createPromotion(promotion)
+		}
+		if t.promotionConflicts(promotion) {
+			return gorm.ErrDuplicatedKey
+		}
+		promotion.UpdatedAt = time.Now()
+		t.promotions[promotion.ID] = *promotion
+		return nil
+	})
+}
+
+func (r *PromotionRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if promotion, ok := t.promotion(id); ok {
+			softDelete(&promotion.DeletedAt)
+			t.promotions[id] = promotion
+		}
+		return nil
+	})
+}
+
+func (r *PromotionRepository) CountUserOrders(ctx context.Context, promotionID, userID uint) (int64, error) {
+	var count int64
+	err := r.db.view(func(t *tables) error {
+		count = t.countUserOrders(promotionID, userID)
+		return nil
+	})
+	return count, err
+}
+
+// countUserOrders counts the user's orders, cancelled ones aside, that used
+// the promotion
+func (t *tables) countUserOrders(promotionID, userID uint) int64 {
+	orders := make(map[uint]bool)
+	for _, discount := range t.orderDiscounts {
+		if discount.PromotionID != promotionID || discount.UserID != userID {
+			continue
+		}
+		if order, ok := t.orders[discount.OrderID]; ok && order.Status != models.OrderStatusCancelled {
+			orders[order.ID] = true
+		}
+	}
+	return int64(len(orders))
+}
+
+// Redeem checks and counts the use at once, under the lock of the tables
+func (r *PromotionRepository) Redeem(ctx context.Context, id, userID uint) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		promotion, ok := t.promotion(id)
+		if !ok {
+			return repository.ErrPromotionUsedUp
+		}
+		if promotion.PerUserLimit != nil && t.countUserOrders(id, userID) >= int64(*promotion.PerUserLimit) {
+			return repository.ErrPromotionUserLimit
+		}
+		if promotion.UsageLimit != nil && promotion.UsedCount >= *promotion.UsageLimit {
+			return repository.ErrPromotionUsedUp
+		}
+		promotion.UsedCount++
+		promotion.UpdatedAt = time.Now()
+		t.promotions[id] = promotion
+		return nil
+	})
+}
+
+// Release works on deleted promotions too, like the GORM version
+func (r *PromotionRepository) Release(ctx context.Context, id uint) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if promotion, ok := t.promotions[id]; ok && promotion.UsedCount > 0 {
+			promotion.UsedCount--
+			promotion.UpdatedAt = time.Now()
+			t.promotions[id] = promotion
+		}
+		return nil
+	})
+}
@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+)
+
+type RecipeRepository struct {
+	db *DB
+}
+
+func NewRecipeRepository(db *DB) *RecipeRepository {
+	return &RecipeRepository{db: db}
+}
+
+func (r *RecipeRepository) Create(ctx context.Context, recipe *models.Recipe) error {
+	return r.db.write(false, func(t *tables) error {
+		return t.createRecipe(recipe)
+	})
+}
+
+func (t *tables) createRecipe(recipe *models.Recipe) error {
+	if !nextID(t, "recipes", t.recipes, &recipe.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+	if recipe.Status == "" {
+		recipe.Status = models.RecipeStatusApproved
+	}
+	if recipe.Servings == 0 {
+		recipe.Servings = 1
+	}
+	stamp(&recipe.CreatedAt, &recipe.UpdatedAt)
+	return t.saveRecipe(recipe)
+}
+
+// saveRecipe stores the recipe's columns and its new ingredients. Like GORM
+// does for an association, an ingredient that already has an ID only gets
+// its recipe ID updated.
+func (t *tables) saveRecipe(recipe *models.Recipe) error {
+	recipe.BeforeSave(nil)
+	row := *recipe
+	row.Ingredients = nil
+	row.SearchRank = 0
+	row.Highlight = ""
+	t.recipes[recipe.ID] = row
+
+	for i := range recipe.Ingredients {
+		ingredient := &recipe.Ingredients[i]
+		ingredient.RecipeID = recipe.ID
+		if existing, ok := t.ingredients[ingredient.ID]; ok {
+			existing.RecipeID = recipe.ID
+			t.ingredients[ingredient.ID] = existing
+			continue
+		}
+		nextID(t, "recipe_ingredients", t.ingredients, &ingredient.ID)
+		stamp(&ingredient.CreatedAt, &ingredient.UpdatedAt)
+		row := *ingredient
+		row.Product = nil
+		row.Variant = nil
+		t.ingredients[ingredient.ID] = row
+	}
+	return nil
+}
+
+func (t *tables) recipe(id uint) (models.Recipe, bool) {
+	recipe, ok := t.recipes[id]
+	return recipe, ok && !recipe.DeletedAt.Valid
+}
+
+// withIngredients preloads the recipe's ingredients. With products set, each
+// ingredient also gets its product, with the product's variants, and its
+// variant.
+func (t *tables) withIngredients(recipe models.Recipe, products bool) models.Recipe {
+	recipe.Ingredients = rowsOf(t.ingredients, func(ing *models.RecipeIngredient) bool {
+		return ing.RecipeID == recipe.ID && !ing.DeletedAt.Valid
+	})
+	if !products {
+		return recipe
+	}
+	for i := range recipe.Ingredients {
+		ingredient := &recipe.Ingredients[i]
+		if product, ok := t.product(ingredient.ProductID); ok {
+			product = t.withVariants(product)
+			ingredient.Product = &product
+		}
+		if ingredient.VariantID != nil {
+			if variant, ok := t.variant(*ingredient.VariantID); ok {
+				ingredient.Variant = &variant
+			}
+		}
+	}
+	return recipe
+}
+
+// findRecipes returns the recipes that aren't deleted and match, in ID
+// order, with their ingredients
+func (r *RecipeRepository) findRecipes(products bool, match func(*tables, *models.Recipe) bool) ([]models.Recipe, error) {
+	var recipes []models.Recipe
+	err := r.db.view(func(t *tables) error {
+		recipes = rowsOf(t.recipes, func(recipe *models.Recipe) bool {
+			return !recipe.DeletedAt.Valid && match(t, recipe)
+		})
+		for i := range recipes {
+			recipes[i] = t.withIngredients(recipes[i], products)
+		}
+		return nil
+	})
+	return recipes, err
+}
+
+func (r *RecipeRepository) GetByID(ctx context.Context, id uint) (*models.Recipe, error) {
+	recipes, err := r.findRecipes(true, func(t *tables, recipe *models.Recipe) bool {
+		return recipe.ID == id
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(recipes) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &recipes[0], nil
+}
+
+func (r *RecipeRepository) GetAll(ctx context.Context, status models.RecipeStatus) ([]models.Recipe, error) {
+	return r.findRecipes(true, func(t *tables, recipe *models.Recipe) bool {
+		return status == "" || recipe.Status == status
+	})
+}
+
+// Search returns approved recipes matching query, best match first. Like
+// the search_vector of recipes, it looks at the name, description and
+// instructions.
+func (r *RecipeRepository) Search(ctx context.Context, query string) ([]models.Recipe, error) {
+	recipes, err := r.findRecipes(true, func(t *tables, recipe *models.Recipe) bool {
+		if recipe.Status != models.RecipeStatusApproved {
+			return false
+		}
+		rank, ok := searchScore(query, recipe.Name, recipe.Description, recipe.Instructions)
+		if !ok {
+			return false
+		}
+		recipe.SearchRank = rank
+		recipe.Highlight = highlight(recipe.Name+" "+recipe.Description, query)
+		return true
+	})
+	slices.SortStableFunc(recipes, func(a, b models.Recipe) int {
+		return cmp.Compare(b.SearchRank, a.SearchRank)
+	})
+	return recipes, err
+}
+
+func (r *RecipeRepository) GetByNormalizedName(ctx context.Context, normalizedName string) ([]models.Recipe, error) {
+	return r.findRecipes(false, func(t *tables, recipe *models.Recipe) bool {
+		return recipe.NormalizedName == normalizedName
+	})
+}
+
+// GetByProductIDs returns the approved recipes that use any of the products
+func (r *RecipeRepository) GetByProductIDs(ctx context.Context, productIDs []uint) ([]models.Recipe, error) {
+	return r.findRecipes(true, func(t *tables, recipe *models.Recipe) bool {
+		if recipe.Status != models.RecipeStatusApproved {
+			return false
+		}
+		for _, ingredient := range t.ingredients {
+			if ingredient.RecipeID == recipe.ID && !ingredient.DeletedAt.Valid && slices.Contains(productIDs, ingredient.ProductID) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *RecipeRepository) UpdateStatus(ctx context.Context, id uint, status models.RecipeStatus, reviewerID uint) error {
+	return r.db.write(false, func(t *tables) error {
+		if recipe, ok := t.recipe(id); ok {
+			now := time.Now()
+			recipe.Status = status
+			recipe.ReviewedByID = &reviewerID
+			recipe.ReviewedAt = &now
+			recipe.UpdatedAt = now
+			t.recipes[id] = recipe
+		}
+		return nil
+	})
+}
+
+// Update replaces the recipe's ingredients with recipe.Ingredients
+func (r *RecipeRepository) Update(ctx context.Context, recipe *models.Recipe) error {
+	return r.db.write(false, func(t *tables) error {
+		t.deleteIngredients(recipe.ID)
+		if _, ok := t.recipes[recipe.ID]; !ok {
+			return t.createRecipe(recipe)
+		}
+		recipe.UpdatedAt = time.Now()
+		return t.saveRecipe(recipe)
+	})
+}
+
+func (r *RecipeRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.write(false, func(t *tables) error {
+		t.deleteIngredients(id)
+		if recipe, ok := t.recipe(id); ok {
+			softDelete(&recipe.DeletedAt)
+			t.recipes[id] = recipe
+		}
+		return nil
+	})
+}
+
+func (t *tables) deleteIngredients(recipeID uint) {
+	for id, ingredient := range t.ingredients {
+		if ingredient.RecipeID == recipeID && !ingredient.DeletedAt.Valid {
+			softDelete(&ingredient.DeletedAt)
+			t.ingredients[id] = ingredient
+		}
+	}
+}
+
+// SaveAIGenerated stores a recipe suggested by AI. It stays pending until an
+// admin approves it.
+func (r *RecipeRepository) SaveAIGenerated(ctx context.Context, recipe *models.Recipe) error {
+	recipe.IsAIGenerated = true
+	recipe.Status = models.RecipeStatusPending
+	return r.Create(ctx, recipe)
+}
@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type ReservationRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewReservationRepository(db *DB) *ReservationRepository {
+	return &ReservationRepository{db: db}
+}
+
+func (r *ReservationRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.transaction(func() error { return fn(nil) })
+}
+
+func (r *ReservationRepository) WithTx(tx *gorm.DB) repository.ReservationStore {
+	checkTx(tx)
+	return &ReservationRepository{db: r.db, inTx: true}
+}
+
+func (r *ReservationRepository) Create(ctx context.Context, reservation *models.StockReservation) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if !nextID(t, "stock_reservations", t.reservations, &reservation.ID) {
+			return gorm.ErrDuplicatedKey
+		}
+		if reservation.Status == "" {
+			reservation.Status = models.ReservationActive
+		}
+		stamp(&reservation.CreatedAt, &reservation.UpdatedAt)
+		t.reservations[reservation.ID] = *reservation
+		return nil
+	})
+}
+
+// The ForUpdate lookups need no lock: transactions are serialized
+
+func (r *ReservationRepository) GetActiveByUserForUpdate(ctx context.Context, userID uint) ([]models.StockReservation, error) {
+	return r.findAll(func(s *models.StockReservation) bool {
+		return s.UserID == userID && s.Status == models.ReservationActive
+	})
+}
+
+func (r *ReservationRepository) GetExpiredForUpdate(ctx context.Context, now time.Time, limit int) ([]models.StockReservation, error) {
+	reservations, err := r.findAll(func(s *models.StockReservation) bool {
+		return s.Status == models.ReservationActive && s.ExpiresAt.Before(now)
+	})
+	if len(reservations) > limit {
+		reservations = reservations[:limit]
+	}
+	return reservations, err
+}
+
+func (r *ReservationRepository) findAll(match func(*models.StockReservation) bool) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	err := r.db.view(func(t *tables) error {
+		reservations = rowsOf(t.reservations, match)
+		return nil
+	})
+	return reservations, err
+}
+
+func (r *ReservationRepository) UpdateStatus(ctx context.Context, id uint, status models.ReservationStatus) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if reservation, ok := t.reservations[id]; ok {
+			reservation.Status = status
+			reservation.UpdatedAt = time.Now()
+			t.reservations[id] = reservation
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"regexp"
+	"strings"
+)
+
+// searchTerms splits a search query into the words a match must contain and
+// the words ("-butter") it must not. Quotes are ignored.
+func searchTerms(query string) (include, exclude []string) {
+	for _, word := range strings.Fields(strings.ToLower(strings.ReplaceAll(query, `"`, " "))) {
+		if strings.HasPrefix(word, "-") {
+			if word = strings.TrimLeft(word, "-"); word != "" {
+				exclude = append(exclude, word)
+			}
+			continue
+		}
+		include = append(include, word)
+	}
+	return include, exclude
+}
+
+// searchScore stands in for the Postgres full-text search: it matches when
+// the fields together contain every word of query, ignoring case, and none
+// of its excluded words. Occurrences in the first field (the name) count
+// twice towards the rank.
+func searchScore(query string, fields ...string) (float64, bool) {
+	include, exclude := searchTerms(query)
+	if len(include) == 0 {
+		return 0, false
+	}
+
+	text := strings.ToLower(strings.Join(fields, " "))
+	for _, word := range exclude {
+		if strings.Contains(text, word) {
+			return 0, false
+		}
+	}
+
+	var rank float64
+	for _, word := range include {
+		count := strings.Count(text, word)
+		if count == 0 {
+			return 0, false
+		}
+		rank += float64(count)
+		if len(fields) > 0 {
+			rank += float64(strings.Count(strings.ToLower(fields[0]), word))
+		}
+	}
+	return rank, true
+}
+
+// highlight wraps the words of query found in text in <mark> tags
+func highlight(text, query string) string {
+	include, _ := searchTerms(query)
+	if len(include) == 0 {
+		return text
+	}
+
+	quoted := make([]string, len(include))
+	for i, word := range include {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	words := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	return words.ReplaceAllString(text, "<mark>$0</mark>")
+}
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type SessionRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewSessionRepository(db *DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.transaction(func() error { return fn(nil) })
+}
+
+func (r *SessionRepository) WithTx(tx *gorm.DB) repository.SessionStore {
+	checkTx(tx)
+	return &SessionRepository{db: r.db, inTx: true}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		for _, other := range t.sessions {
+			if other.TokenHash == session.TokenHash {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		if !nextID(t, "sessions", t.sessions, &session.ID) {
+			return gorm.ErrDuplicatedKey
+		}
+		stamp(&session.CreatedAt, &session.UpdatedAt)
+		t.sessions[session.ID] = *session
+		return nil
+	})
+}
+
+// GetByTokenHashForUpdate needs no lock: transactions are serialized
+func (r *SessionRepository) GetByTokenHashForUpdate(ctx context.Context, hash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.view(func(t *tables) error {
+		sessions := rowsOf(t.sessions, func(s *models.Session) bool {
+			return s.TokenHash == hash || s.PreviousTokenHash == hash
+		})
+		if len(sessions) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		session = sessions[0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepository) Rotate(ctx context.Context, id uint, previousHash, newHash string, expiresAt, now time.Time) error {
+	return r.update(func(s *models.Session) bool { return s.ID == id }, func(s *models.Session) {
+		s.TokenHash = newHash
+		s.PreviousTokenHash = previousHash
+		s.ExpiresAt = expiresAt
+		s.LastUsedAt = now
+	})
+}
+
+func (r *SessionRepository) IsActive(ctx context.Context, id, userID uint, now time.Time) (bool, error) {
+	active := false
+	err := r.db.view(func(t *tables) error {
+		session, ok := t.sessions[id]
+		active = ok && session.UserID == userID && session.RevokedAt == nil && session.ExpiresAt.After(now)
+		return nil
+	})
+	return active, err
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id uint, now time.Time) error {
+	return r.revoke(func(s *models.Session) bool { return s.ID == id }, now)
+}
+
+func (r *SessionRepository) RevokeForUser(ctx context.Context, id, userID uint, now time.Time) error {
+	return r.revoke(func(s *models.Session) bool { return s.ID == id && s.UserID == userID }, now)
+}
+
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID uint, now time.Time) error {
+	return r.revoke(func(s *models.Session) bool { return s.UserID == userID }, now)
+}
+
+// revoke revokes the matching sessions that aren't revoked yet
+func (r *SessionRepository) revoke(match func(*models.Session) bool, now time.Time) error {
+	return r.update(func(s *models.Session) bool { return s.RevokedAt == nil && match(s) }, func(s *models.Session) {
+		s.RevokedAt = &now
+	})
+}
+
+// update changes the matching sessions with fn
+func (r *SessionRepository) update(match func(*models.Session) bool, fn func(s *models.Session)) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		for id, session := range t.sessions {
+			if match(&session) {
+				fn(&session)
+				session.UpdatedAt = time.Now()
+				t.sessions[id] = session
+			}
+		}
+		return nil
+	})
+}
+
+func (r *SessionRepository) DeleteStaleForUser(ctx context.Context, userID uint, now, cutoff time.Time) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		for id, session := range t.sessions {
+			revoked := session.RevokedAt != nil && !session.RevokedAt.After(cutoff)
+			if session.UserID == userID && (!session.ExpiresAt.After(now) || revoked) {
+				delete(t.sessions, id)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type UserRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewUserRepository(db *DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+func (r *UserRepository) WithTx(tx *gorm.DB) repository.UserStore {
+	checkTx(tx)
+	return &UserRepository{db: r.db, inTx: true}
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		return t.createUser(user)
+	})
+}
+
+func (t *tables) createUser(user *models.User) error {
+	if t.userConflicts(user) || !nextID(t, "users", t.users, &user.ID) {
+		return gorm.ErrDuplicatedKey
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	stamp(&user.CreatedAt, &user.UpdatedAt)
+	t.users[user.ID] = userRow(user)
+	return nil
+}
+
+func userRow(user *models.User) models.User {
+	row := *user
+	row.Cart = nil
+	return row
+}
+
+// userConflicts reports whether another user has the email of user. Like in
+// the database, deleted users count.
+func (t *tables) userConflicts(user *models.User) bool {
+	for _, other := range t.users {
+		if other.ID != user.ID && other.Email == user.Email {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Email == email })
+}
+
+func (r *UserRepository) find(match func(*models.User) bool) (*models.User, error) {
+	users, err := r.findAll(match)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &users[0], nil
+}
+
+func (r *UserRepository) findAll(match func(*models.User) bool) ([]models.User, error) {
+	var users []models.User
+	err := r.db.view(func(t *tables) error {
+		users = rowsOf(t.users, func(u *models.User) bool {
+			return !u.DeletedAt.Valid && match(u)
+		})
+		return nil
+	})
+	return users, err
+}
+
+func (r *UserRepository) GetAll(ctx context.Context) ([]models.User, error) {
+	return r.findAll(func(*models.User) bool { return true })
+}
+
+func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if _, ok := t.users[user.ID]; !ok {
+			return t.createUser(user)
+		}
+		if t.userConflicts(user) {
+			return gorm.ErrDuplicatedKey
+		}
+		user.UpdatedAt = time.Now()
+		t.users[user.ID] = userRow(user)
+		return nil
+	})
+}
+
+// update changes a user that isn't deleted with fn
+func (r *UserRepository) update(id uint, fn func(u *models.User)) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		if user, ok := t.users[id]; ok && !user.DeletedAt.Valid {
+			fn(&user)
+			user.UpdatedAt = time.Now()
+			t.users[id] = user
+		}
+		return nil
+	})
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id uint) error {
+	return r.update(id, func(u *models.User) { softDelete(&u.DeletedAt) })
+}
+
+func (r *UserRepository) UpdateRole(ctx context.Context, id uint, role models.Role) error {
+	return r.update(id, func(u *models.User) { u.Role = role })
+}
+
+func (r *UserRepository) IncrementTokenVersion(ctx context.Context, id uint) error {
+	return r.update(id, func(u *models.User) { u.TokenVersion++ })
+}
+
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id uint, at time.Time) error {
+	return r.update(id, func(u *models.User) {
+		u.EmailVerified = true
+		u.EmailVerifiedAt = &at
+	})
+}
+
+func (r *UserRepository) UpdatePassword(ctx context.Context, id uint, hashedPassword string) error {
+	return r.update(id, func(u *models.User) { u.Password = hashedPassword })
+}
@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+type UserTokenRepository struct {
+	db   *DB
+	inTx bool
+}
+
+func NewUserTokenRepository(db *DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+func (r *UserTokenRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.transaction(func() error { return fn(nil) })
+}
+
+func (r *UserTokenRepository) WithTx(tx *gorm.DB) repository.UserTokenStore {
+	checkTx(tx)
+	return &UserTokenRepository{db: r.db, inTx: true}
+}
+
+func (r *UserTokenRepository) Create(ctx context.Context, token *models.UserToken) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		for _, other := range t.userTokens {
+			if other.TokenHash == token.TokenHash {
+				return gorm.ErrDuplicatedKey
+			}
+		}
+		if !nextID(t, "user_tokens", t.userTokens, &token.ID) {
+			return gorm.ErrDuplicatedKey
+		}
+		stamp(&token.CreatedAt, nil)
+		t.userTokens[token.ID] = *token
+		return nil
+	})
+}
+
+// GetByHashForUpdate needs no lock: transactions are serialized
+func (r *UserTokenRepository) GetByHashForUpdate(ctx context.Context, hash string, purpose models.TokenPurpose) (*models.UserToken, error) {
+	return r.find(func(u *models.UserToken) bool { return u.TokenHash == hash && u.Purpose == purpose })
+}
+
+func (r *UserTokenRepository) GetLatest(ctx context.Context, userID uint, purpose models.TokenPurpose) (*models.UserToken, error) {
+	return r.find(func(u *models.UserToken) bool { return u.UserID == userID && u.Purpose == purpose })
+}
+
+// find returns the most recently issued matching token
+func (r *UserTokenRepository) find(match func(*models.UserToken) bool) (*models.UserToken, error) {
+	var tokens []models.UserToken
+	err := r.db.view(func(t *tables) error {
+		tokens = rowsOf(t.userTokens, match)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	latest := slices.MaxFunc(tokens, func(a, b models.UserToken) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(b.ID, a.ID))
+	})
+	return &latest, nil
+}
+
+func (r *UserTokenRepository) MarkAllUsed(ctx context.Context, userID uint, purpose models.TokenPurpose, now time.Time) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		for id, token := range t.userTokens {
+			if token.UserID == userID && token.Purpose == purpose && token.UsedAt == nil {
+				token.UsedAt = &now
+				t.userTokens[id] = token
+			}
+		}
+		return nil
+	})
+}
+
+func (r *UserTokenRepository) DeleteExpiredForUser(ctx context.Context, userID uint, purpose models.TokenPurpose, now time.Time) error {
+	return r.db.write(r.inTx, func(t *tables) error {
+		for id, token := range t.userTokens {
+			if token.UserID == userID && token.Purpose == purpose && !token.ExpiresAt.After(now) {
+				delete(t.userTokens, id)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OrderRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderRepository(db *gorm.DB) *OrderRepository {
+	return &OrderRepository{db: db}
+}
+
+// Transaction runs fn inside a single database transaction
+func (r *OrderRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.WithContext(ctx).Transaction(fn)
+}
+
+func (r *OrderRepository) WithTx(tx *gorm.DB) OrderStore {
+	return &OrderRepository{db: tx}
+}
+
+func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error {
+	return r.db.WithContext(ctx).Create(order).Error
+}
+
+func (r *OrderRepository) GetByID(ctx context.Context, id uint) (*models.Order, error) {
+	var order models.Order
+	err := r.db.WithContext(ctx).Preload("Items").Preload("Discounts").Preload("History").First(&order, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *OrderRepository) GetByIDForUser(ctx context.Context, id uint, userID uint) (*models.Order, error) {
+	var order models.Order
+	err := r.db.WithContext(ctx).Preload("Items").Preload("Discounts").Preload("History").Where("user_id = ?", userID).First(&order, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *OrderRepository) GetByUserID(ctx context.Context, userID uint) ([]models.Order, error) {
+	var orders []models.Order
+	err := r.db.WithContext(ctx).Preload("Items").Preload("Discounts").Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&orders).Error
+	return orders, err
+}
+
+func (r *OrderRepository) GetAll(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	var orders []models.Order
+	query := r.db.WithContext(ctx).Preload("Items").Preload("Discounts").Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&orders).Error
+	return orders, err
+}
+
+// GetByIDForUpdate loads an order and locks its row until the surrounding
+// transaction finishes, so concurrent status changes are serialized.
+func (r *OrderRepository) GetByIDForUpdate(ctx context.Context, id uint) (*models.Order, error) {
+	var order models.Order
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := r.db.WithContext(ctx).Where("order_id = ?", id).Find(&order.Items).Error; err != nil {
+		return nil, err
+	}
+	if err := r.db.WithContext(ctx).Where("order_id = ?", id).Find(&order.Discounts).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *OrderRepository) UpdateStatus(ctx context.Context, id uint, status models.OrderStatus) error {
+	return r.db.WithContext(ctx).Model(&models.Order{}).Where("id = ?", id).Update("status", status).Error
+}
+
+func (r *OrderRepository) AddStatusChange(ctx context.Context, change *models.OrderStatusChange) error {
+	return r.db.WithContext(ctx).Create(change).Error
+}
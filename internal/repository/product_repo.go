@@ -1,10 +1,20 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/bexiiiii/smart_food_store/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrInsufficientStock is returned when a conditional stock decrement finds
+// less stock than requested (or the product no longer exists).
+var ErrInsufficientStock = errors.New("insufficient stock")
+
 type ProductRepository struct {
 	db *gorm.DB
 }
@@ -13,62 +23,332 @@ func NewProductRepository(db *gorm.DB) *ProductRepository {
 	return &ProductRepository{db: db}
 }
 
-func (r *ProductRepository) Create(product *models.Product) error {
-	return r.db.Create(product).Error
+// Transaction runs fn inside a single database transaction
+func (r *ProductRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.WithContext(ctx).Transaction(fn)
+}
+
+func (r *ProductRepository) WithTx(tx *gorm.DB) ProductStore {
+	return &ProductRepository{db: tx}
+}
+
+func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
+	return r.db.WithContext(ctx).Create(product).Error
+}
+
+// withVariants preloads a product's variants in ID order
+func withVariants(db *gorm.DB) *gorm.DB {
+	return db.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+}
+
+func (r *ProductRepository) GetByID(ctx context.Context, id uint) (*models.Product, error) {
+	var product models.Product
+	err := withVariants(r.db.WithContext(ctx).Preload("Category")).First(&product, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *ProductRepository) GetBySKU(ctx context.Context, sku string) (*models.Product, error) {
+	var product models.Product
+	err := r.db.WithContext(ctx).Where("sku = ?", sku).First(&product).Error
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
 }
 
-func (r *ProductRepository) GetByID(id uint) (*models.Product, error) {
+func (r *ProductRepository) GetByBarcode(ctx context.Context, barcode string) (*models.Product, error) {
 	var product models.Product
-	err := r.db.Preload("Category").First(&product, id).Error
+	err := withVariants(r.db.WithContext(ctx).Preload("Category")).Where("barcode = ?", barcode).First(&product).Error
 	if err != nil {
 		return nil, err
 	}
 	return &product, nil
 }
 
-func (r *ProductRepository) GetAll() ([]models.Product, error) {
+// GetByName returns every product with this name, ignoring case; names
+// aren't unique
+func (r *ProductRepository) GetByName(ctx context.Context, name string) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Preload("Category").Find(&products).Error
+	err := r.db.WithContext(ctx).Where("LOWER(name) = LOWER(?)", name).Order("id").Find(&products).Error
 	return products, err
 }
 
-func (r *ProductRepository) GetByCategory(categoryID uint) ([]models.Product, error) {
+// GetAll returns every product with its category, in ID order
+func (r *ProductRepository) GetAll(ctx context.Context) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Preload("Category").Where("category_id = ?", categoryID).Find(&products).Error
+	err := r.db.WithContext(ctx).Preload("Category").Order("id").Find(&products).Error
 	return products, err
 }
 
-func (r *ProductRepository) Search(query string) ([]models.Product, error) {
+// ProductCursor is the sort value and ID of the last product on a page
+type ProductCursor struct {
+	Value interface{}
+	ID    uint
+}
+
+// List returns one page of products matching q together with the total
+// number of matches. q must already be normalized (Sort, Order and Limit
+// set). It fetches Limit+1 rows so the caller can tell if more follow.
+// With after set, rows are read after that position (keyset pagination)
+// instead of using Page.
+func (r *ProductRepository) List(ctx context.Context, q *models.ProductQuery, after *ProductCursor) ([]models.Product, int64, error) {
+	filtered := r.filter(r.db.WithContext(ctx).Model(&models.Product{}), q)
+
+	var total int64
+	if err := filtered.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	query := r.filter(withVariants(r.db.WithContext(ctx).Preload("Category")), q)
+	if q.Query != "" {
+		query = searchSelect(query, "products", q.Query, productSearchColumns...)
+	}
+
+	orderBy := fmt.Sprintf("%s %s, id %s", q.Sort, q.Order, q.Order)
+	if q.Sort == "relevance" {
+		orderBy = fmt.Sprintf("search_rank %s, id", q.Order)
+	}
+
+	if after != nil {
+		cmp := ">"
+		if q.Order == "desc" {
+			cmp = "<"
+		}
+		query = query.Where(
+			fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", q.Sort, cmp),
+			after.Value, after.Value, after.ID,
+		)
+	} else if q.Page > 1 {
+		query = query.Offset((q.Page - 1) * q.Limit)
+	}
+
 	var products []models.Product
-	err := r.db.Preload("Category").
-		Where("LOWER(name) LIKE LOWER(?) OR LOWER(description) LIKE LOWER(?)", 
-			"%"+query+"%", "%"+query+"%").
+	err := query.
+		Order(orderBy).
+		Limit(q.Limit + 1).
 		Find(&products).Error
-	return products, err
+	if q.Query != "" {
+		for i := range products {
+			products[i].Highlight = highlightTerms(r.db.WithContext(ctx), products[i].Highlight, q.Query)
+		}
+	}
+	return products, total, err
 }
 
-func (r *ProductRepository) GetByIDs(ids []uint) ([]models.Product, error) {
+// productSearchColumns are searched when the database has no full-text search
+var productSearchColumns = []string{"name", "description"}
+
+func (r *ProductRepository) filter(db *gorm.DB, q *models.ProductQuery) *gorm.DB {
+	if q.CategoryID != nil {
+		db = db.Where("category_id = ?", *q.CategoryID)
+	}
+	if q.MinPrice != nil {
+		db = db.Where("price >= ?", *q.MinPrice)
+	}
+	if q.MaxPrice != nil {
+		db = db.Where("price <= ?", *q.MaxPrice)
+	}
+	if q.Unit != "" {
+		db = db.Where("unit = ?", q.Unit)
+	}
+	if q.InStock != nil {
+		if *q.InStock {
+			db = db.Where("stock > 0")
+		} else {
+			db = db.Where("stock <= 0")
+		}
+	}
+	if q.Query != "" {
+		db = searchFilter(db, q.Query, productSearchColumns...)
+	}
+	return db
+}
+
+func (r *ProductRepository) GetByIDs(ctx context.Context, ids []uint) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Preload("Category").Where("id IN ?", ids).Find(&products).Error
+	err := withVariants(r.db.WithContext(ctx).Preload("Category")).Where("id IN ?", ids).Find(&products).Error
 	return products, err
 }
 
-func (r *ProductRepository) Update(product *models.Product) error {
-	return r.db.Save(product).Error
+// Update saves the product's own columns. Preloaded associations are left
+// alone: variants are saved with UpdateVariant, and a stale Category must
+// not overwrite a changed CategoryID.
+func (r *ProductRepository) Update(ctx context.Context, product *models.Product) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(product).Error
+}
+
+func (r *ProductRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Product{}, id).Error
+}
+
+// UpdateStock decrements stock only if enough is left. The check and the
+// decrement are a single statement, so concurrent callers can't oversell.
+func (r *ProductRepository) UpdateStock(ctx context.Context, id uint, quantity float64) error {
+	result := r.db.WithContext(ctx).Model(&models.Product{}).Where("id = ? AND stock >= ?", id, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// RestoreStock puts quantity back on the shelf, e.g. when an order is cancelled
+func (r *ProductRepository) RestoreStock(ctx context.Context, id uint, quantity float64) error {
+	return r.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", id).
+		Update("stock", gorm.Expr("stock + ?", quantity)).Error
+}
+
+// Variant methods
+
+func (r *ProductRepository) CreateVariant(ctx context.Context, variant *models.ProductVariant) error {
+	return r.db.WithContext(ctx).Create(variant).Error
+}
+
+// GetVariant returns a variant of the given product
+func (r *ProductRepository) GetVariant(ctx context.Context, productID, variantID uint) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := r.db.WithContext(ctx).Where("product_id = ?", productID).First(&variant, variantID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (r *ProductRepository) GetVariantBySKU(ctx context.Context, sku string) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := r.db.WithContext(ctx).Where("sku = ?", sku).First(&variant).Error
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (r *ProductRepository) GetVariantByBarcode(ctx context.Context, barcode string) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := r.db.WithContext(ctx).Where("barcode = ?", barcode).First(&variant).Error
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+func (r *ProductRepository) UpdateVariant(ctx context.Context, variant *models.ProductVariant) error {
+	return r.db.WithContext(ctx).Save(variant).Error
+}
+
+func (r *ProductRepository) DeleteVariant(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.ProductVariant{}, id).Error
+}
+
+// UpdateVariantStock is UpdateStock for a variant: it takes packs off the
+// shelf only if enough are left
+func (r *ProductRepository) UpdateVariantStock(ctx context.Context, id uint, quantity float64) error {
+	result := r.db.WithContext(ctx).Model(&models.ProductVariant{}).Where("id = ? AND stock >= ?", id, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+func (r *ProductRepository) RestoreVariantStock(ctx context.Context, id uint, quantity float64) error {
+	return r.db.WithContext(ctx).Model(&models.ProductVariant{}).Where("id = ?", id).
+		Update("stock", gorm.Expr("stock + ?", quantity)).Error
+}
+
+// Price history methods
+
+func (r *ProductRepository) CreatePriceChange(ctx context.Context, change *models.PriceChange) error {
+	return r.db.WithContext(ctx).Create(change).Error
+}
+
+// GetPriceHistory returns a product's price changes, oldest first. With since
+// set, only changes made since then are returned.
+func (r *ProductRepository) GetPriceHistory(ctx context.Context, productID uint, since *time.Time) ([]models.PriceChange, error) {
+	var changes []models.PriceChange
+	query := r.db.WithContext(ctx).Where("product_id = ?", productID)
+	if since != nil {
+		query = query.Where("created_at >= ?", *since)
+	}
+	err := query.Order("created_at, id").Find(&changes).Error
+	return changes, err
+}
+
+// GetPriceChangesSince returns the price changes of the given products made
+// since the given time, by product and oldest first
+func (r *ProductRepository) GetPriceChangesSince(ctx context.Context, productIDs []uint, since time.Time) ([]models.PriceChange, error) {
+	var changes []models.PriceChange
+	err := r.db.WithContext(ctx).Where("product_id IN ? AND created_at >= ?", productIDs, since).
+		Order("product_id, created_at, id").
+		Find(&changes).Error
+	return changes, err
+}
+
+// UpdatePrice sets only the price column, so a concurrent edit of other
+// fields isn't overwritten
+func (r *ProductRepository) UpdatePrice(ctx context.Context, id uint, price float64) error {
+	return r.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", id).Update("price", price).Error
+}
+
+func (r *ProductRepository) CreateScheduledPrice(ctx context.Context, scheduled *models.ScheduledPrice) error {
+	return r.db.WithContext(ctx).Create(scheduled).Error
+}
+
+// GetScheduledPrices returns a product's scheduled prices, applied ones
+// included, in the order they take effect
+func (r *ProductRepository) GetScheduledPrices(ctx context.Context, productID uint) ([]models.ScheduledPrice, error) {
+	var scheduled []models.ScheduledPrice
+	err := r.db.WithContext(ctx).Where("product_id = ?", productID).Order("effective_at, id").Find(&scheduled).Error
+	return scheduled, err
+}
+
+// GetScheduledPrice returns a scheduled price of the given product
+func (r *ProductRepository) GetScheduledPrice(ctx context.Context, productID, id uint) (*models.ScheduledPrice, error) {
+	var scheduled models.ScheduledPrice
+	err := r.db.WithContext(ctx).Where("product_id = ?", productID).First(&scheduled, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &scheduled, nil
+}
+
+func (r *ProductRepository) DeleteScheduledPrice(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.ScheduledPrice{}, id).Error
 }
 
-func (r *ProductRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Product{}, id).Error
+// GetDueScheduledPrices returns the unapplied scheduled prices of products
+// that still exist whose effective time is at or before now, in the order
+// they take effect
+func (r *ProductRepository) GetDueScheduledPrices(ctx context.Context, now time.Time) ([]models.ScheduledPrice, error) {
+	var scheduled []models.ScheduledPrice
+	err := r.db.WithContext(ctx).Joins("JOIN products ON products.id = scheduled_prices.product_id AND products.deleted_at IS NULL").
+		Where("scheduled_prices.applied_at IS NULL AND scheduled_prices.effective_at <= ?", now).
+		Order("scheduled_prices.effective_at, scheduled_prices.id").
+		Find(&scheduled).Error
+	return scheduled, err
 }
 
-func (r *ProductRepository) UpdateStock(id uint, quantity float64) error {
-	return r.db.Model(&models.Product{}).Where("id = ?", id).
-		Update("stock", gorm.Expr("stock - ?", quantity)).Error
+// MarkScheduledPriceApplied sets AppliedAt if it isn't set yet. It reports
+// false if the scheduled price was already applied (or deleted), so two
+// schedulers can't apply it twice.
+func (r *ProductRepository) MarkScheduledPriceApplied(ctx context.Context, id uint, at time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.ScheduledPrice{}).Where("id = ? AND applied_at IS NULL", id).
+		Update("applied_at", at)
+	return result.RowsAffected > 0, result.Error
 }
 
-func (r *ProductRepository) GetAllWithStock() ([]models.Product, error) {
+func (r *ProductRepository) GetAllWithStock(ctx context.Context) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Preload("Category").Where("stock > 0").Find(&products).Error
+	err := r.db.WithContext(ctx).Preload("Category").Where("stock > 0").Find(&products).Error
 	return products, err
 }
 
@@ -81,29 +361,29 @@ func NewCategoryRepository(db *gorm.DB) *CategoryRepository {
 	return &CategoryRepository{db: db}
 }
 
-func (r *CategoryRepository) Create(category *models.Category) error {
-	return r.db.Create(category).Error
+func (r *CategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Create(category).Error
 }
 
-func (r *CategoryRepository) GetByID(id uint) (*models.Category, error) {
+func (r *CategoryRepository) GetByID(ctx context.Context, id uint) (*models.Category, error) {
 	var category models.Category
-	err := r.db.First(&category, id).Error
+	err := r.db.WithContext(ctx).First(&category, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &category, nil
 }
 
-func (r *CategoryRepository) GetAll() ([]models.Category, error) {
+func (r *CategoryRepository) GetAll(ctx context.Context) ([]models.Category, error) {
 	var categories []models.Category
-	err := r.db.Find(&categories).Error
+	err := r.db.WithContext(ctx).Find(&categories).Error
 	return categories, err
 }
 
-func (r *CategoryRepository) Update(category *models.Category) error {
-	return r.db.Save(category).Error
+func (r *CategoryRepository) Update(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Save(category).Error
 }
 
-func (r *CategoryRepository) Delete(id uint) error {
-	return r.db.Delete(&models.Category{}, id).Error
+func (r *CategoryRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Category{}, id).Error
 }
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPromotionUsedUp is returned when a promotion has reached its usage limit
+var ErrPromotionUsedUp = errors.New("promotion usage limit reached")
+
+// ErrPromotionUserLimit is returned when a user has used a promotion as often
+// as its per-user limit allows
+var ErrPromotionUserLimit = errors.New("promotion per-user limit reached")
+
+type PromotionRepository struct {
+	db *gorm.DB
+}
+
+func NewPromotionRepository(db *gorm.DB) *PromotionRepository {
+	return &PromotionRepository{db: db}
+}
+
+func (r *PromotionRepository) WithTx(tx *gorm.DB) PromotionStore {
+	return &PromotionRepository{db: tx}
+}
+
+func (r *PromotionRepository) Create(ctx context.Context, promotion *models.Promotion) error {
+	return r.db.WithContext(ctx).Create(promotion).Error
+}
+
+func (r *PromotionRepository) GetByID(ctx context.Context, id uint) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := r.db.WithContext(ctx).First(&promotion, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// GetByCode finds a coupon by its code, which is stored in upper case
+func (r *PromotionRepository) GetByCode(ctx context.Context, code string) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := r.db.WithContext(ctx).Where("code = ?", code).First(&promotion).Error
+	if err != nil {
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+func (r *PromotionRepository) GetAll(ctx context.Context) ([]models.Promotion, error) {
+	var promotions []models.Promotion
+	err := r.db.WithContext(ctx).Order("id").Find(&promotions).Error
+	return promotions, err
+}
+
+// GetActive returns the promotions that can apply at now: active, inside
+// their validity window and below their usage limit. Coupons are included
+// only for the given code (none if code is empty).
+func (r *PromotionRepository) GetActive(ctx context.Context, now time.Time, code string) ([]models.Promotion, error) {
+	var promotions []models.Promotion
+	err := r.db.WithContext(ctx).
+		Where("active = ?", true).
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Where("usage_limit IS NULL OR used_count < usage_limit").
+		Where("code IS NULL OR code = ?", code).
+		Order("id").
+		Find(&promotions).Error
+	return promotions, err
+}
+
+func (r *PromotionRepository) Update(ctx context.Context, promotion *models.Promotion) error {
+	return r.db.WithContext(ctx).Save(promotion).Error
+}
+
+func (r *PromotionRepository) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Promotion{}, id).Error
+}
+
+// CountUserOrders returns how many of the user's orders, cancelled ones
+// aside, used the promotion
+func (r *PromotionRepository) CountUserOrders(ctx context.Context, promotionID, userID uint) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.OrderDiscount{}).
+		Joins("JOIN orders ON orders.id = order_discounts.order_id").
+		Where("order_discounts.promotion_id = ? AND order_discounts.user_id = ?", promotionID, userID).
+		Where("orders.status <> ?", models.OrderStatusCancelled).
+		Distinct("order_discounts.order_id").
+		Count(&count).Error
+	return count, err
+}
+
+// Redeem counts one use of the promotion by the user, only if that stays
+// within its usage limit and the user's limit. The promotion's row is locked
+// before the user's orders are counted, so concurrent checkouts by the same
+// user take turns; call it inside the checkout transaction. Like
+// ProductRepository.UpdateStock, the usage limit check and the increment are
+// a single statement.
+func (r *PromotionRepository) Redeem(ctx context.Context, id, userID uint) error {
+	var promotion models.Promotion
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&promotion, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrPromotionUsedUp
+	}
+	if err != nil {
+		return err
+	}
+	if promotion.PerUserLimit != nil {
+		used, err := r.CountUserOrders(ctx, id, userID)
+		if err != nil {
+			return err
+		}
+		if used >= int64(*promotion.PerUserLimit) {
+			return ErrPromotionUserLimit
+		}
+	}
+
+	result := r.db.WithContext(ctx).Model(&models.Promotion{}).
+		Where("id = ? AND (usage_limit IS NULL OR used_count < usage_limit)", id).
+		Update("used_count", gorm.Expr("used_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPromotionUsedUp
+	}
+	return nil
+}
+
+// Release gives back one use of the promotion, e.g. when an order is cancelled
+func (r *PromotionRepository) Release(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Unscoped().Model(&models.Promotion{}).Where("id = ? AND used_count > 0", id).
+		Update("used_count", gorm.Expr("used_count - 1")).Error
+}
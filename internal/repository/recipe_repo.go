@@ -1,6 +1,9 @@
 package repository
 
 import (
+	"context"
+	"time"
+
 	"github.com/bexiiiii/smart_food_store/internal/models"
 	"gorm.io/gorm"
 )
@@ -13,66 +16,98 @@ func NewRecipeRepository(db *gorm.DB) *RecipeRepository {
 	return &RecipeRepository{db: db}
 }
 
-func (r *RecipeRepository) Create(recipe *models.Recipe) error {
-	return r.db.Create(recipe).Error
+func (r *RecipeRepository) Create(ctx context.Context, recipe *models.Recipe) error {
+	return r.db.WithContext(ctx).Create(recipe).Error
 }
 
-func (r *RecipeRepository) GetByID(id uint) (*models.Recipe, error) {
+func (r *RecipeRepository) GetByID(ctx context.Context, id uint) (*models.Recipe, error) {
 	var recipe models.Recipe
-	err := r.db.Preload("Ingredients.Product").First(&recipe, id).Error
+	err := r.db.WithContext(ctx).Preload("Ingredients.Product.Variants").Preload("Ingredients.Variant").First(&recipe, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &recipe, nil
 }
 
-func (r *RecipeRepository) GetAll() ([]models.Recipe, error) {
+// GetAll returns recipes with the given review status, or all recipes if status is empty
+func (r *RecipeRepository) GetAll(ctx context.Context, status models.RecipeStatus) ([]models.Recipe, error) {
 	var recipes []models.Recipe
-	err := r.db.Preload("Ingredients.Product").Find(&recipes).Error
+	query := r.db.WithContext(ctx).Preload("Ingredients.Product.Variants").Preload("Ingredients.Variant")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&recipes).Error
 	return recipes, err
 }
 
-func (r *RecipeRepository) Search(query string) ([]models.Recipe, error) {
+// Search returns approved recipes matching query, most relevant first, with
+// matched terms highlighted
+func (r *RecipeRepository) Search(ctx context.Context, query string) ([]models.Recipe, error) {
 	var recipes []models.Recipe
-	err := r.db.Preload("Ingredients.Product").
-		Where("LOWER(name) LIKE LOWER(?) OR LOWER(description) LIKE LOWER(?)",
-			"%"+query+"%", "%"+query+"%").
+	db := r.db.WithContext(ctx).Preload("Ingredients.Product.Variants").Preload("Ingredients.Variant").
+		Where("status = ?", models.RecipeStatusApproved)
+	err := searchFilter(searchSelect(db, "recipes", query, recipeSearchColumns...), query, recipeSearchColumns...).
+		Order("search_rank DESC, id").
 		Find(&recipes).Error
+	for i := range recipes {
+		recipes[i].Highlight = highlightTerms(r.db.WithContext(ctx), recipes[i].Highlight, query)
+	}
+	return recipes, err
+}
+
+// recipeSearchColumns are searched when the database has no full-text search
+var recipeSearchColumns = []string{"name", "description", "instructions"}
+
+func (r *RecipeRepository) GetByNormalizedName(ctx context.Context, normalizedName string) ([]models.Recipe, error) {
+	var recipes []models.Recipe
+	err := r.db.WithContext(ctx).Preload("Ingredients").Where("normalized_name = ?", normalizedName).Find(&recipes).Error
 	return recipes, err
 }
 
-func (r *RecipeRepository) Update(recipe *models.Recipe) error {
+func (r *RecipeRepository) UpdateStatus(ctx context.Context, id uint, status models.RecipeStatus, reviewerID uint) error {
+	return r.db.WithContext(ctx).Model(&models.Recipe{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":         status,
+		"reviewed_by_id": reviewerID,
+		"reviewed_at":    time.Now(),
+	}).Error
+}
+
+func (r *RecipeRepository) Update(ctx context.Context, recipe *models.Recipe) error {
 	// Delete existing ingredients and recreate them
-	if err := r.db.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{}).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{}).Error; err != nil {
 		return err
 	}
-	return r.db.Save(recipe).Error
+	return r.db.WithContext(ctx).Save(recipe).Error
 }
 
-func (r *RecipeRepository) Delete(id uint) error {
+func (r *RecipeRepository) Delete(ctx context.Context, id uint) error {
 	// Delete ingredients first
-	if err := r.db.Where("recipe_id = ?", id).Delete(&models.RecipeIngredient{}).Error; err != nil {
+	if err := r.db.WithContext(ctx).Where("recipe_id = ?", id).Delete(&models.RecipeIngredient{}).Error; err != nil {
 		return err
 	}
-	return r.db.Delete(&models.Recipe{}, id).Error
+	return r.db.WithContext(ctx).Delete(&models.Recipe{}, id).Error
 }
 
-func (r *RecipeRepository) GetByProductIDs(productIDs []uint) ([]models.Recipe, error) {
+func (r *RecipeRepository) GetByProductIDs(ctx context.Context, productIDs []uint) ([]models.Recipe, error) {
 	var recipes []models.Recipe
 	
 	// Find recipes that contain any of the specified products
-	subQuery := r.db.Model(&models.RecipeIngredient{}).
+	subQuery := r.db.WithContext(ctx).Model(&models.RecipeIngredient{}).
 		Select("DISTINCT recipe_id").
 		Where("product_id IN ?", productIDs)
 	
-	err := r.db.Preload("Ingredients.Product").
+	err := r.db.WithContext(ctx).Preload("Ingredients.Product.Variants").Preload("Ingredients.Variant").
 		Where("id IN (?)", subQuery).
+		Where("status = ?", models.RecipeStatusApproved).
 		Find(&recipes).Error
 	
 	return recipes, err
 }
 
-func (r *RecipeRepository) SaveAIGenerated(recipe *models.Recipe) error {
+// SaveAIGenerated stores a recipe suggested by AI. It stays pending until an
+// admin approves it.
+func (r *RecipeRepository) SaveAIGenerated(ctx context.Context, recipe *models.Recipe) error {
 	recipe.IsAIGenerated = true
-	return r.db.Create(recipe).Error
+	recipe.Status = models.RecipeStatusPending
+	return r.db.WithContext(ctx).Create(recipe).Error
 }
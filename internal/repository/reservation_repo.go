@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ReservationRepository struct {
+	db *gorm.DB
+}
+
+func NewReservationRepository(db *gorm.DB) *ReservationRepository {
+	return &ReservationRepository{db: db}
+}
+
+// Transaction runs fn inside a single database transaction
+func (r *ReservationRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.WithContext(ctx).Transaction(fn)
+}
+
+func (r *ReservationRepository) WithTx(tx *gorm.DB) ReservationStore {
+	return &ReservationRepository{db: tx}
+}
+
+func (r *ReservationRepository) Create(ctx context.Context, reservation *models.StockReservation) error {
+	return r.db.WithContext(ctx).Create(reservation).Error
+}
+
+// GetActiveByUserForUpdate returns the user's active holds and locks them
+// until the surrounding transaction finishes.
+func (r *ReservationRepository) GetActiveByUserForUpdate(ctx context.Context, userID uint) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND status = ?", userID, models.ReservationActive).
+		Order("id").
+		Find(&reservations).Error
+	return reservations, err
+}
+
+// GetExpiredForUpdate returns up to limit active holds that expired before now,
+// locked until the surrounding transaction finishes.
+func (r *ReservationRepository) GetExpiredForUpdate(ctx context.Context, now time.Time, limit int) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("status = ? AND expires_at < ?", models.ReservationActive, now).
+		Order("id").
+		Limit(limit).
+		Find(&reservations).Error
+	return reservations, err
+}
+
+func (r *ReservationRepository) UpdateStatus(ctx context.Context, id uint, status models.ReservationStatus) error {
+	return r.db.WithContext(ctx).Model(&models.StockReservation{}).Where("id = ?", id).Update("status", status).Error
+}
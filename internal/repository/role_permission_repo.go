@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+)
+
+type RolePermissionRepository struct {
+	db *gorm.DB
+}
+
+func NewRolePermissionRepository(db *gorm.DB) *RolePermissionRepository {
+	return &RolePermissionRepository{db: db}
+}
+
+func (r *RolePermissionRepository) GetAll(ctx context.Context) ([]models.RolePermission, error) {
+	var mappings []models.RolePermission
+	err := r.db.WithContext(ctx).Order("role, permission").Find(&mappings).Error
+	return mappings, err
+}
+
+// ReplaceForRole sets the role's permissions to exactly permissions
+func (r *RolePermissionRepository) ReplaceForRole(ctx context.Context, role models.Role, permissions []models.Permission) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", role).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		for _, perm := range permissions {
+			if err := tx.Create(&models.RolePermission{Role: role, Permission: perm}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
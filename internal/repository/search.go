@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Full-text search helpers. On Postgres, tables taking part in search have a
+// generated search_vector tsvector column (GIN indexed) and a trigram index
+// on name, both created by the baseline migration. Other databases (SQLite)
+// fall back to LIKE: every word of the query has to appear in one of the
+// searched columns, and matches in the name rank higher.
+
+// searchMatch matches rows whose search_vector contains the query, or whose
+// name is a close trigram match (catches misspellings like "tomatoe").
+// Takes the query twice.
+const searchMatch = "(search_vector @@ websearch_to_tsquery('english', ?) OR name %> ?)"
+
+// searchRank scores a match; full-text rank plus name similarity, so exact
+// and fuzzy hits are ordered together. Takes the query twice.
+const searchRank = "ts_rank(search_vector, websearch_to_tsquery('english', ?)) + word_similarity(?, name)"
+
+// searchHeadline returns expr with matched terms wrapped in <mark> tags.
+// Takes the query once.
+func searchHeadline(expr string) string {
+	return fmt.Sprintf("ts_headline('english', %s, websearch_to_tsquery('english', ?), "+
+		"'StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, HighlightAll=false')", expr)
+}
+
+// headlineText is the text shown, highlighted, with a search result
+const headlineText = "name || ' ' || coalesce(description, '')"
+
+func fullTextSearch(db *gorm.DB) bool {
+	return db.Dialector.Name() == "postgres"
+}
+
+// searchFilter narrows db to rows matching query. columns are the columns
+// searched by the LIKE fallback, name first.
+func searchFilter(db *gorm.DB, query string, columns ...string) *gorm.DB {
+	if fullTextSearch(db) {
+		return db.Where(searchMatch, query, query)
+	}
+
+	terms := likeTerms(query)
+	if len(terms) == 0 {
+		return db.Where("1 = 0")
+	}
+	for _, term := range terms {
+		conditions := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, column := range columns {
+			conditions[i] = "coalesce(" + column + ", '') LIKE ? ESCAPE '\\'"
+			args[i] = term
+		}
+		db = db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	return db
+}
+
+// searchSelect selects table's columns together with search_rank and
+// highlight. Without full-text search, highlight is the plain text; pass it
+// through highlightTerms after loading.
+func searchSelect(db *gorm.DB, table, query string, columns ...string) *gorm.DB {
+	if fullTextSearch(db) {
+		return db.Select(
+			table+".*, "+searchRank+" AS search_rank, "+searchHeadline(headlineText)+" AS highlight",
+			query, query, query,
+		)
+	}
+
+	// A word found in the name counts twice
+	var scores []string
+	var args []interface{}
+	for _, term := range likeTerms(query) {
+		for i, column := range columns {
+			weight := 1
+			if i == 0 {
+				weight = 2
+			}
+			scores = append(scores, fmt.Sprintf("CASE WHEN coalesce(%s, '') LIKE ? ESCAPE '\\' THEN %d ELSE 0 END", column, weight))
+			args = append(args, term)
+		}
+	}
+	if len(scores) == 0 {
+		scores = []string{"0"}
+	}
+	return db.Select(table+".*, ("+strings.Join(scores, " + ")+") AS search_rank, "+headlineText+" AS highlight", args...)
+}
+
+// highlightTerms wraps the words of query found in text in <mark> tags, like
+// ts_headline does on Postgres. With full-text search text is returned as is.
+func highlightTerms(db *gorm.DB, text, query string) string {
+	if fullTextSearch(db) {
+		return text
+	}
+	var words []string
+	for _, word := range searchWords(query) {
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	if len(words) == 0 {
+		return text
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(words, "|"))
+	return pattern.ReplaceAllString(text, "<mark>$0</mark>")
+}
+
+// searchWords splits a websearch-style query into the words to look for.
+// Quotes are ignored, and "or" and excluded words ("-milk") are dropped.
+func searchWords(query string) []string {
+	var words []string
+	for _, word := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		if strings.HasPrefix(word, "-") || strings.EqualFold(word, "or") {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// likeTerms turns the words of query into LIKE patterns matching them
+// anywhere
+func likeTerms(query string) []string {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	words := searchWords(query)
+	for i, word := range words {
+		words[i] = "%" + escape.Replace(word) + "%"
+	}
+	return words
+}
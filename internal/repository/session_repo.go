@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Transaction runs fn inside a single database transaction
+func (r *SessionRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.WithContext(ctx).Transaction(fn)
+}
+
+func (r *SessionRepository) WithTx(tx *gorm.DB) SessionStore {
+	return &SessionRepository{db: tx}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+// GetByTokenHashForUpdate finds the session whose current or previous
+// refresh token has hash, and locks it until the transaction finishes.
+func (r *SessionRepository) GetByTokenHashForUpdate(ctx context.Context, hash string) (*models.Session, error) {
+	var session models.Session
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? OR previous_token_hash = ?", hash, hash).
+		First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepository) Rotate(ctx context.Context, id uint, previousHash, newHash string, expiresAt, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"token_hash":          newHash,
+		"previous_token_hash": previousHash,
+		"expires_at":          expiresAt,
+		"last_used_at":        now,
+	}).Error
+}
+
+// IsActive reports whether the session exists, belongs to userID and has
+// neither been revoked nor expired
+func (r *SessionRepository) IsActive(ctx context.Context, id, userID uint, now time.Time) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, now).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id uint, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", now).Error
+}
+
+func (r *SessionRepository) RevokeForUser(ctx context.Context, id, userID uint, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", now).Error
+}
+
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID uint, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+}
+
+// DeleteStaleForUser removes the user's expired sessions and sessions revoked
+// before cutoff
+func (r *SessionRepository) DeleteStaleForUser(ctx context.Context, userID uint, now, cutoff time.Time) error {
+	return r.db.WithContext(ctx).Where("user_id = ? AND (expires_at <= ? OR revoked_at <= ?)", userID, now, cutoff).
+		Delete(&models.Session{}).Error
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+)
+
+// Stores are what the services depend on. The GORM repositories in this
+// package implement them for Postgres and package memory implements them in
+// memory for tests; package storetest checks that both behave the same.
+//
+// Lookups of a missing or soft-deleted row fail with gorm.ErrRecordNotFound.
+// Stores that share a transaction (through Transaction and WithTx) must all
+// come from the same implementation.
+
+type ProductStore interface {
+	// Transaction runs fn in a transaction; stores passed tx with WithTx take
+	// part in it
+	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
+	WithTx(tx *gorm.DB) ProductStore
+
+	Create(ctx context.Context, product *models.Product) error
+	GetByID(ctx context.Context, id uint) (*models.Product, error)
+	GetBySKU(ctx context.Context, sku string) (*models.Product, error)
+	GetByBarcode(ctx context.Context, barcode string) (*models.Product, error)
+	GetByName(ctx context.Context, name string) ([]models.Product, error)
+	GetAll(ctx context.Context) ([]models.Product, error)
+	List(ctx context.Context, q *models.ProductQuery, after *ProductCursor) ([]models.Product, int64, error)
+	GetByIDs(ctx context.Context, ids []uint) ([]models.Product, error)
+	GetAllWithStock(ctx context.Context) ([]models.Product, error)
+	Update(ctx context.Context, product *models.Product) error
+	Delete(ctx context.Context, id uint) error
+	UpdateStock(ctx context.Context, id uint, quantity float64) error
+	RestoreStock(ctx context.Context, id uint, quantity float64) error
+
+	CreateVariant(ctx context.Context, variant *models.ProductVariant) error
+	GetVariant(ctx context.Context, productID, variantID uint) (*models.ProductVariant, error)
+	GetVariantBySKU(ctx context.Context, sku string) (*models.ProductVariant, error)
+	GetVariantByBarcode(ctx context.Context, barcode string) (*models.ProductVariant, error)
+	UpdateVariant(ctx context.Context, variant *models.ProductVariant) error
+	DeleteVariant(ctx context.Context, id uint) error
+	UpdateVariantStock(ctx context.Context, id uint, quantity float64) error
+	RestoreVariantStock(ctx context.Context, id uint, quantity float64) error
+
+	CreatePriceChange(ctx context.Context, change *models.PriceChange) error
+	GetPriceHistory(ctx context.Context, productID uint, since *time.Time) ([]models.PriceChange, error)
+	GetPriceChangesSince(ctx context.Context, productIDs []uint, since time.Time) ([]models.PriceChange, error)
+	UpdatePrice(ctx context.Context, id uint, price float64) error
+	CreateScheduledPrice(ctx context.Context, scheduled *models.ScheduledPrice) error
+	GetScheduledPrices(ctx context.Context, productID uint) ([]models.ScheduledPrice, error)
+	GetScheduledPrice(ctx context.Context, productID, id uint) (*models.ScheduledPrice, error)
+	DeleteScheduledPrice(ctx context.Context, id uint) error
+	GetDueScheduledPrices(ctx context.Context, now time.Time) ([]models.ScheduledPrice, error)
+	MarkScheduledPriceApplied(ctx context.Context, id uint, at time.Time) (bool, error)
+}
+
+type CategoryStore interface {
+	Create(ctx context.Context, category *models.Category) error
+	GetByID(ctx context.Context, id uint) (*models.Category, error)
+	GetAll(ctx context.Context) ([]models.Category, error)
+	Update(ctx context.Context, category *models.Category) error
+	Delete(ctx context.Context, id uint) error
+}
+
+type CartStore interface {
+	WithTx(tx *gorm.DB) CartStore
+
+	GetOrCreateByUserID(ctx context.Context, userID uint) (*models.Cart, error)
+	GetByUserID(ctx context.Context, userID uint) (*models.Cart, error)
+	AddItem(ctx context.Context, cartID uint, item *models.CartItem) error
+	AddMultipleItems(ctx context.Context, cartID uint, items []models.CartItem) error
+	UpdateItemQuantity(ctx context.Context, cartID uint, productID uint, variantID *uint, quantity float64) error
+	RemoveItem(ctx context.Context, cartID uint, productID uint, variantID *uint) error
+	ClearCart(ctx context.Context, cartID uint) error
+	SetCoupon(ctx context.Context, cartID uint, code *string) error
+	GetCartItems(ctx context.Context, cartID uint) ([]models.CartItem, error)
+}
+
+type RecipeStore interface {
+	Create(ctx context.Context, recipe *models.Recipe) error
+	GetByID(ctx context.Context, id uint) (*models.Recipe, error)
+	GetAll(ctx context.Context, status models.RecipeStatus) ([]models.Recipe, error)
+	Search(ctx context.Context, query string) ([]models.Recipe, error)
+	GetByNormalizedName(ctx context.Context, normalizedName string) ([]models.Recipe, error)
+	GetByProductIDs(ctx context.Context, productIDs []uint) ([]models.Recipe, error)
+	UpdateStatus(ctx context.Context, id uint, status models.RecipeStatus, reviewerID uint) error
+	Update(ctx context.Context, recipe *models.Recipe) error
+	Delete(ctx context.Context, id uint) error
+	SaveAIGenerated(ctx context.Context, recipe *models.Recipe) error
+}
+
+type UserStore interface {
+	WithTx(tx *gorm.DB) UserStore
+
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id uint) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetAll(ctx context.Context) ([]models.User, error)
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id uint) error
+	UpdateRole(ctx context.Context, id uint, role models.Role) error
+	IncrementTokenVersion(ctx context.Context, id uint) error
+	MarkEmailVerified(ctx context.Context, id uint, at time.Time) error
+	UpdatePassword(ctx context.Context, id uint, hashedPassword string) error
+}
+
+type OrderStore interface {
+	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
+	WithTx(tx *gorm.DB) OrderStore
+
+	Create(ctx context.Context, order *models.Order) error
+	GetByID(ctx context.Context, id uint) (*models.Order, error)
+	GetByIDForUser(ctx context.Context, id uint, userID uint) (*models.Order, error)
+	GetByUserID(ctx context.Context, userID uint) ([]models.Order, error)
+	GetAll(ctx context.Context, status models.OrderStatus) ([]models.Order, error)
+	GetByIDForUpdate(ctx context.Context, id uint) (*models.Order, error)
+	UpdateStatus(ctx context.Context, id uint, status models.OrderStatus) error
+	AddStatusChange(ctx context.Context, change *models.OrderStatusChange) error
+}
+
+type ReservationStore interface {
+	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
+	WithTx(tx *gorm.DB) ReservationStore
+
+	Create(ctx context.Context, reservation *models.StockReservation) error
+	GetActiveByUserForUpdate(ctx context.Context, userID uint) ([]models.StockReservation, error)
+	GetExpiredForUpdate(ctx context.Context, now time.Time, limit int) ([]models.StockReservation, error)
+	UpdateStatus(ctx context.Context, id uint, status models.ReservationStatus) error
+}
+
+type PromotionStore interface {
+	WithTx(tx *gorm.DB) PromotionStore
+
+	Create(ctx context.Context, promotion *models.Promotion) error
+	GetByID(ctx context.Context, id uint) (*models.Promotion, error)
+	GetByCode(ctx context.Context, code string) (*models.Promotion, error)
+	GetAll(ctx context.Context) ([]models.Promotion, error)
+	GetActive(ctx context.Context, now time.Time, code string) ([]models.Promotion, error)
+	Update(ctx context.Context, promotion *models.Promotion) error
+	Delete(ctx context.Context, id uint) error
+	CountUserOrders(ctx context.Context, promotionID, userID uint) (int64, error)
+	Redeem(ctx context.Context, id, userID uint) error
+	Release(ctx context.Context, id uint) error
+}
+
+type SessionStore interface {
+	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
+	WithTx(tx *gorm.DB) SessionStore
+
+	Create(ctx context.Context, session *models.Session) error
+	GetByTokenHashForUpdate(ctx context.Context, hash string) (*models.Session, error)
+	Rotate(ctx context.Context, id uint, previousHash, newHash string, expiresAt, now time.Time) error
+	IsActive(ctx context.Context, id, userID uint, now time.Time) (bool, error)
+	Revoke(ctx context.Context, id uint, now time.Time) error
+	RevokeForUser(ctx context.Context, id, userID uint, now time.Time) error
+	RevokeAllForUser(ctx context.Context, userID uint, now time.Time) error
+	DeleteStaleForUser(ctx context.Context, userID uint, now, cutoff time.Time) error
+}
+
+type UserTokenStore interface {
+	Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error
+	WithTx(tx *gorm.DB) UserTokenStore
+
+	Create(ctx context.Context, token *models.UserToken) error
+	GetByHashForUpdate(ctx context.Context, hash string, purpose models.TokenPurpose) (*models.UserToken, error)
+	GetLatest(ctx context.Context, userID uint, purpose models.TokenPurpose) (*models.UserToken, error)
+	MarkAllUsed(ctx context.Context, userID uint, purpose models.TokenPurpose, now time.Time) error
+	DeleteExpiredForUser(ctx context.Context, userID uint, purpose models.TokenPurpose, now time.Time) error
+}
+
+type RolePermissionStore interface {
+	GetAll(ctx context.Context) ([]models.RolePermission, error)
+	ReplaceForRole(ctx context.Context, role models.Role, permissions []models.Permission) error
+}
+
+type AuditStore interface {
+	WithTx(tx *gorm.DB) AuditStore
+
+	Create(ctx context.Context, entry *models.AuditLog) error
+	List(ctx context.Context, q *models.AuditQuery) ([]models.AuditLog, int64, error)
+}
+
+type AICacheStore interface {
+	Get(ctx context.Context, key string, now time.Time) (*models.AICacheEntry, error)
+	Upsert(ctx context.Context, entry *models.AICacheEntry) error
+	DeleteExpired(ctx context.Context, now time.Time) error
+	DeleteAll(ctx context.Context) error
+}
+
+var (
+	_ ProductStore     = (*ProductRepository)(nil)
+	_ CategoryStore    = (*CategoryRepository)(nil)
+	_ CartStore        = (*CartRepository)(nil)
+	_ RecipeStore      = (*RecipeRepository)(nil)
+	_ UserStore        = (*UserRepository)(nil)
+	_ OrderStore       = (*OrderRepository)(nil)
+	_ ReservationStore = (*ReservationRepository)(nil)
+	_ PromotionStore   = (*PromotionRepository)(nil)
+	_ SessionStore     = (*SessionRepository)(nil)
+	_ UserTokenStore   = (*UserTokenRepository)(nil)
+
+	_ RolePermissionStore = (*RolePermissionRepository)(nil)
+	_ AuditStore          = (*AuditRepository)(nil)
+	_ AICacheStore        = (*AICacheRepository)(nil)
+)
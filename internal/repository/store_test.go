@@ -0,0 +1,91 @@
+package repository_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/database"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"github.com/bexiiiii/smart_food_store/internal/repository/storetest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestGORMStores runs the store contract against the GORM repositories on a
+// fresh in-memory SQLite database per test, and on Postgres if
+// TEST_DATABASE_URL is set. The tables of that database are emptied before
+// every test.
+func TestGORMStores(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) storetest.Stores {
+			cfg := &config.Config{DBDriver: "sqlite", SQLitePath: ":memory:"}
+			db, err := database.Open(cfg, &gorm.Config{Logger: logger.Discard})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				if sqlDB, err := db.DB(); err == nil {
+					sqlDB.Close()
+				}
+			})
+			migrate(t, db)
+			return stores(db)
+		})
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dsn := os.Getenv("TEST_DATABASE_URL")
+		if dsn == "" {
+			t.Skip("TEST_DATABASE_URL not set")
+		}
+
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrate(t, db)
+
+		storetest.Run(t, func(t *testing.T) storetest.Stores {
+			err := db.Exec("TRUNCATE categories, products, product_variants, price_changes, scheduled_prices, " +
+				"carts, cart_items, recipes, recipe_ingredients, users, orders, order_items, order_discounts, " +
+				"order_status_changes, stock_reservations, promotions, sessions, user_tokens, audit_logs, ai_cache_entries " +
+				"RESTART IDENTITY CASCADE").Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			return stores(db)
+		})
+	})
+}
+
+func migrate(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func stores(db *gorm.DB) storetest.Stores {
+	return storetest.Stores{
+		Products:     repository.NewProductRepository(db),
+		Categories:   repository.NewCategoryRepository(db),
+		Carts:        repository.NewCartRepository(db),
+		Recipes:      repository.NewRecipeRepository(db),
+		Users:        repository.NewUserRepository(db),
+		Orders:       repository.NewOrderRepository(db),
+		Reservations: repository.NewReservationRepository(db),
+		Promotions:   repository.NewPromotionRepository(db),
+		Sessions:     repository.NewSessionRepository(db),
+		Tokens:       repository.NewUserTokenRepository(db),
+
+		RolePermissions: repository.NewRolePermissionRepository(db),
+		Audit:           repository.NewAuditRepository(db),
+		AICache:         repository.NewAICacheRepository(db),
+	}
+}
@@ -0,0 +1,124 @@
+package storetest
+
+import (
+	"cmp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func testRolePermissions(t *testing.T, s Stores) {
+	// The migrations seed the default mappings; only look at one role
+	permissionsOf := func(role models.Role) []models.Permission {
+		t.Helper()
+		mappings, err := s.RolePermissions.GetAll(ctx)
+		check(t, err)
+		var permissions []models.Permission
+		for _, m := range mappings {
+			if m.Role == role {
+				permissions = append(permissions, m.Permission)
+			}
+		}
+		return permissions
+	}
+
+	role := models.RoleSupportAgent
+	check(t, s.RolePermissions.ReplaceForRole(ctx, role, []models.Permission{models.PermOrdersUpdate, models.PermOrdersRead}))
+	want := []models.Permission{models.PermOrdersRead, models.PermOrdersUpdate}
+	if got := permissionsOf(role); !slices.Equal(got, want) {
+		t.Errorf("permissions = %v, want %v sorted", got, want)
+	}
+
+	check(t, s.RolePermissions.ReplaceForRole(ctx, role, nil))
+	if got := permissionsOf(role); len(got) != 0 {
+		t.Errorf("permissions after replacing with none = %v", got)
+	}
+
+	mappings, err := s.RolePermissions.GetAll(ctx)
+	check(t, err)
+	if !slices.IsSortedFunc(mappings, func(a, b models.RolePermission) int {
+		return cmp.Or(cmp.Compare(a.Role, b.Role), cmp.Compare(a.Permission, b.Permission))
+	}) {
+		t.Errorf("GetAll isn't sorted by role and permission: %v", mappings)
+	}
+}
+
+func testAuditLogs(t *testing.T, s Stores) {
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	entries := []models.AuditLog{
+		{CreatedAt: base, ActorID: 1, Action: "product.update", EntityType: models.AuditEntityProduct, EntityID: "1"},
+		{CreatedAt: base.Add(time.Minute), ActorID: 2, Action: "product.update", EntityType: models.AuditEntityProduct, EntityID: "2"},
+		{CreatedAt: base.Add(2 * time.Minute), ActorID: 1, Action: "user.delete", EntityType: models.AuditEntityUser, EntityID: "7", Before: `{"id": 7}`},
+	}
+	for i := range entries {
+		check(t, s.Audit.Create(ctx, &entries[i]))
+		if entries[i].ID == 0 {
+			t.Fatal("Create didn't assign an ID")
+		}
+	}
+
+	ids := func(logs []models.AuditLog) []uint {
+		var ids []uint
+		for _, l := range logs {
+			ids = append(ids, l.ID)
+		}
+		return ids
+	}
+	from := base.Add(time.Minute)
+	cases := []struct {
+		name  string
+		query models.AuditQuery
+		want  []uint
+		total int64
+	}{
+		{"all, newest first", models.AuditQuery{}, []uint{entries[2].ID, entries[1].ID, entries[0].ID}, 3},
+		{"actor", models.AuditQuery{ActorID: ptr(uint(1))}, []uint{entries[2].ID, entries[0].ID}, 2},
+		{"action", models.AuditQuery{Action: "product.update"}, []uint{entries[1].ID, entries[0].ID}, 2},
+		{"entity", models.AuditQuery{EntityType: models.AuditEntityProduct, EntityID: "2"}, []uint{entries[1].ID}, 1},
+		{"from is inclusive, to exclusive", models.AuditQuery{From: &from, To: ptr(base.Add(2 * time.Minute))}, []uint{entries[1].ID}, 1},
+		{"second page", models.AuditQuery{Page: 2, Limit: 2}, []uint{entries[0].ID}, 3},
+	}
+	for _, tc := range cases {
+		q := tc.query
+		q.Page, q.Limit = cmp.Or(q.Page, 1), cmp.Or(q.Limit, 50)
+		logs, total, err := s.Audit.List(ctx, &q)
+		if err != nil || !slices.Equal(ids(logs), tc.want) || total != tc.total {
+			t.Errorf("%s: List = %v, %d, %v, want %v, %d", tc.name, ids(logs), total, err, tc.want, tc.total)
+		}
+	}
+
+	logs, _, err := s.Audit.List(ctx, &models.AuditQuery{Page: 1, Limit: 1})
+	check(t, err)
+	if len(logs) != 1 || logs[0].Before != `{"id": 7}` {
+		t.Errorf("stored entry = %+v, want its before snapshot", logs)
+	}
+}
+
+func testAICache(t *testing.T, s Stores) {
+	now := time.Now()
+	check(t, s.AICache.Upsert(ctx, &models.AICacheEntry{Key: "fresh", Value: "1", ExpiresAt: now.Add(time.Hour)}))
+	check(t, s.AICache.Upsert(ctx, &models.AICacheEntry{Key: "stale", Value: "2", ExpiresAt: now.Add(-time.Minute)}))
+
+	if entry, err := s.AICache.Get(ctx, "fresh", now); err != nil || entry.Value != "1" {
+		t.Errorf("Get(fresh) = %+v, %v", entry, err)
+	}
+	_, err := s.AICache.Get(ctx, "stale", now)
+	notFound(t, "Get of an expired entry", err)
+
+	// Upsert replaces the value and expiry of an existing key
+	check(t, s.AICache.Upsert(ctx, &models.AICacheEntry{Key: "stale", Value: "3", ExpiresAt: now.Add(time.Hour)}))
+	if entry, err := s.AICache.Get(ctx, "stale", now); err != nil || entry.Value != "3" {
+		t.Errorf("Get after Upsert = %+v, %v, want the new value", entry, err)
+	}
+
+	check(t, s.AICache.DeleteExpired(ctx, now.Add(2*time.Hour)))
+	_, err = s.AICache.Get(ctx, "fresh", now)
+	notFound(t, "Get after DeleteExpired", err)
+
+	check(t, s.AICache.Upsert(ctx, &models.AICacheEntry{Key: "again", Value: "4", ExpiresAt: now.Add(time.Hour)}))
+	check(t, s.AICache.DeleteAll(ctx))
+	_, err = s.AICache.Get(ctx, "again", now)
+	notFound(t, "Get after DeleteAll", err)
+}
@@ -0,0 +1,290 @@
+package storetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+func createPromotion(t *testing.T, s Stores, promotion models.Promotion) *models.Promotion {
+	t.Helper()
+	if promotion.Type == "" {
+		promotion.Type = models.PromotionPercentage
+		promotion.Value = 10
+	}
+	promotion.Active = true
+	check(t, s.Promotions.Create(ctx, &promotion))
+	return &promotion
+}
+
+// newOrder is an order of quantity units of product for the user
+func newOrder(user *models.User, product *models.Product, quantity float64) *models.Order {
+	subtotal := product.Price * quantity
+	return &models.Order{
+		UserID:     user.ID,
+		Status:     models.OrderStatusPending,
+		TotalPrice: subtotal,
+		Subtotal:   subtotal,
+		Items: []models.OrderItem{{
+			ProductID: product.ID, ProductName: product.Name, Price: product.Price,
+			Unit: product.Unit, Quantity: quantity, Subtotal: subtotal,
+		}},
+	}
+}
+
+func orderIDs(orders []models.Order) []uint {
+	ids := make([]uint, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+	return ids
+}
+
+func testOrders(t *testing.T, s Stores) {
+	user := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+	category := createCategory(t, s, "Pantry")
+	salt := createProduct(t, s, models.Product{Name: "Salt", Price: 1, Stock: 10, CategoryID: category.ID})
+	promotion := createPromotion(t, s, models.Promotion{Name: "Ten off", Code: ptr("TEN")})
+
+	first := newOrder(user, salt, 3)
+	first.CreatedAt = time.Now().Add(-time.Hour)
+	first.Discounts = []models.OrderDiscount{{
+		UserID: user.ID, PromotionID: promotion.ID, Name: promotion.Name, Type: promotion.Type, Code: "TEN", Amount: 0.3,
+	}}
+	check(t, s.Orders.Create(ctx, first))
+	if first.ID == 0 || first.Items[0].OrderID != first.ID || first.Discounts[0].OrderID != first.ID {
+		t.Fatalf("Create didn't set the IDs: %+v", first)
+	}
+	check(t, s.Orders.AddStatusChange(ctx, &models.OrderStatusChange{
+		OrderID: first.ID, ToStatus: models.OrderStatusPending, ChangedByID: user.ID,
+	}))
+	second := newOrder(user, salt, 1)
+	check(t, s.Orders.Create(ctx, second))
+	third := newOrder(other, salt, 2)
+	check(t, s.Orders.Create(ctx, third))
+
+	got, err := s.Orders.GetByID(ctx, first.ID)
+	check(t, err)
+	if len(got.Items) != 1 || got.Items[0].Quantity != 3 || len(got.Discounts) != 1 || got.Discounts[0].Amount != 0.3 {
+		t.Errorf("GetByID = %+v, want its item and discount", got)
+	}
+	if len(got.History) != 1 || got.History[0].ToStatus != models.OrderStatusPending || got.History[0].CreatedAt.IsZero() {
+		t.Errorf("GetByID history = %+v", got.History)
+	}
+	if got, err := s.Orders.GetByIDForUser(ctx, first.ID, user.ID); err != nil || got.ID != first.ID {
+		t.Errorf("GetByIDForUser = %v, %v", got, err)
+	}
+	_, err = s.Orders.GetByIDForUser(ctx, first.ID, other.ID)
+	notFound(t, "GetByIDForUser of another user's order", err)
+	_, err = s.Orders.GetByID(ctx, 999)
+	notFound(t, "GetByID of an unknown order", err)
+
+	orders, err := s.Orders.GetByUserID(ctx, user.ID)
+	check(t, err)
+	if got, want := orderIDs(orders), []uint{second.ID, first.ID}; !equalIDs(got, want) {
+		t.Errorf("GetByUserID = %v, want %v (newest first)", got, want)
+	}
+	if len(orders[1].Items) != 1 || len(orders[1].Discounts) != 1 {
+		t.Errorf("GetByUserID didn't preload items and discounts: %+v", orders[1])
+	}
+
+	check(t, s.Orders.UpdateStatus(ctx, third.ID, models.OrderStatusPaid))
+	paid, err := s.Orders.GetAll(ctx, models.OrderStatusPaid)
+	check(t, err)
+	all, err := s.Orders.GetAll(ctx, "")
+	check(t, err)
+	if !equalIDs(orderIDs(paid), []uint{third.ID}) || len(all) != 3 {
+		t.Errorf("GetAll = %v paid of %v", orderIDs(paid), orderIDs(all))
+	}
+
+	locked, err := s.Orders.GetByIDForUpdate(ctx, third.ID)
+	check(t, err)
+	if locked.Status != models.OrderStatusPaid || len(locked.Items) != 1 {
+		t.Errorf("GetByIDForUpdate = %+v", locked)
+	}
+}
+
+// testOrderTransaction checks that a failed transaction opened by the order
+// store rolls back the writes of the other stores handed its tx, like
+// checkout does with stock
+func testOrderTransaction(t *testing.T, s Stores) {
+	user := createUser(t, s, "ann@example.com")
+	category := createCategory(t, s, "Pantry")
+	salt := createProduct(t, s, models.Product{Name: "Salt", Price: 1, Stock: 10, CategoryID: category.ID})
+	failed := errors.New("roll back")
+
+	err := s.Orders.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := s.Products.WithTx(tx).UpdateStock(ctx, salt.ID, 4); err != nil {
+			return err
+		}
+		if err := s.Reservations.WithTx(tx).Create(ctx, &models.StockReservation{
+			UserID: user.ID, ProductID: salt.ID, Quantity: 4, ExpiresAt: time.Now().Add(time.Hour),
+		}); err != nil {
+			return err
+		}
+		if err := s.Orders.WithTx(tx).Create(ctx, newOrder(user, salt, 4)); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Transaction = %v, want the error of fn", err)
+	}
+
+	if got, err := s.Products.GetByID(ctx, salt.ID); err != nil || got.Stock != 10 {
+		t.Errorf("stock after a failed transaction = %v, %v, want 10", got.Stock, err)
+	}
+	if orders, err := s.Orders.GetByUserID(ctx, user.ID); err != nil || len(orders) != 0 {
+		t.Errorf("orders after a failed transaction = %v, %v", orders, err)
+	}
+	if holds, err := s.Reservations.GetActiveByUserForUpdate(ctx, user.ID); err != nil || len(holds) != 0 {
+		t.Errorf("holds after a failed transaction = %v, %v", holds, err)
+	}
+
+	check(t, s.Orders.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := s.Products.WithTx(tx).UpdateStock(ctx, salt.ID, 4); err != nil {
+			return err
+		}
+		return s.Orders.WithTx(tx).Create(ctx, newOrder(user, salt, 4))
+	}))
+	if got, err := s.Products.GetByID(ctx, salt.ID); err != nil || got.Stock != 6 {
+		t.Errorf("stock after a committed transaction = %v, %v, want 6", got.Stock, err)
+	}
+}
+
+func testReservations(t *testing.T, s Stores) {
+	user := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+	category := createCategory(t, s, "Pantry")
+	salt := createProduct(t, s, models.Product{Name: "Salt", Price: 1, Stock: 10, CategoryID: category.ID})
+	now := time.Now()
+
+	hold := &models.StockReservation{UserID: user.ID, ProductID: salt.ID, Quantity: 2, ExpiresAt: now.Add(time.Hour)}
+	check(t, s.Reservations.Create(ctx, hold))
+	if hold.Status != models.ReservationActive {
+		t.Errorf("new hold is %q, want %q", hold.Status, models.ReservationActive)
+	}
+	expired := &models.StockReservation{UserID: user.ID, ProductID: salt.ID, Quantity: 1, ExpiresAt: now.Add(-time.Hour)}
+	check(t, s.Reservations.Create(ctx, expired))
+	otherExpired := &models.StockReservation{UserID: other.ID, ProductID: salt.ID, Quantity: 1, ExpiresAt: now.Add(-time.Minute)}
+	check(t, s.Reservations.Create(ctx, otherExpired))
+
+	active, err := s.Reservations.GetActiveByUserForUpdate(ctx, user.ID)
+	check(t, err)
+	if len(active) != 2 || active[0].ID != hold.ID || active[1].ID != expired.ID {
+		t.Errorf("GetActiveByUserForUpdate = %+v, want both holds of the user", active)
+	}
+
+	due, err := s.Reservations.GetExpiredForUpdate(ctx, now, 10)
+	check(t, err)
+	if len(due) != 2 || due[0].ID != expired.ID || due[1].ID != otherExpired.ID {
+		t.Errorf("GetExpiredForUpdate = %+v, want the two expired holds", due)
+	}
+	if due, err := s.Reservations.GetExpiredForUpdate(ctx, now, 1); err != nil || len(due) != 1 || due[0].ID != expired.ID {
+		t.Errorf("GetExpiredForUpdate with limit 1 = %+v, %v", due, err)
+	}
+
+	check(t, s.Reservations.UpdateStatus(ctx, expired.ID, models.ReservationReleased))
+	check(t, s.Reservations.UpdateStatus(ctx, hold.ID, models.ReservationConsumed))
+	if active, err := s.Reservations.GetActiveByUserForUpdate(ctx, user.ID); err != nil || len(active) != 0 {
+		t.Errorf("GetActiveByUserForUpdate after release = %+v, %v", active, err)
+	}
+}
+
+func testPromotions(t *testing.T, s Stores) {
+	user := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+	category := createCategory(t, s, "Pantry")
+	salt := createProduct(t, s, models.Product{Name: "Salt", Price: 1, Stock: 10, CategoryID: category.ID})
+	now := time.Now()
+
+	automatic := createPromotion(t, s, models.Promotion{Name: "Salt deal", ProductID: &salt.ID})
+	coupon := createPromotion(t, s, models.Promotion{Name: "Ten off", Code: ptr("TEN"), UsageLimit: ptr(1)})
+	perUser := createPromotion(t, s, models.Promotion{Name: "Welcome", Code: ptr("WELCOME"), PerUserLimit: ptr(1)})
+	createPromotion(t, s, models.Promotion{Name: "Expired", EndsAt: ptr(now.Add(-time.Hour))})
+	createPromotion(t, s, models.Promotion{Name: "Later", StartsAt: ptr(now.Add(time.Hour))})
+
+	if err := s.Promotions.Create(ctx, &models.Promotion{Name: "Again", Type: models.PromotionFixed, Value: 1, Code: ptr("TEN"), Active: true}); err == nil {
+		t.Error("Create accepted a duplicate coupon code")
+	}
+	if got, err := s.Promotions.GetByCode(ctx, "TEN"); err != nil || got.ID != coupon.ID {
+		t.Errorf("GetByCode = %v, %v", got, err)
+	}
+	_, err := s.Promotions.GetByCode(ctx, "NOPE")
+	notFound(t, "GetByCode of an unknown code", err)
+
+	active, err := s.Promotions.GetActive(ctx, now, "")
+	check(t, err)
+	if got, want := promotionIDs(active), []uint{automatic.ID}; !equalIDs(got, want) {
+		t.Errorf("GetActive without a code = %v, want %v", got, want)
+	}
+	active, err = s.Promotions.GetActive(ctx, now, "TEN")
+	check(t, err)
+	if got, want := promotionIDs(active), []uint{automatic.ID, coupon.ID}; !equalIDs(got, want) {
+		t.Errorf("GetActive with TEN = %v, want %v", got, want)
+	}
+
+	// Usage limit
+	check(t, s.Promotions.Redeem(ctx, coupon.ID, user.ID))
+	if err := s.Promotions.Redeem(ctx, coupon.ID, other.ID); !errors.Is(err, repository.ErrPromotionUsedUp) {
+		t.Errorf("Redeem beyond the usage limit = %v, want ErrPromotionUsedUp", err)
+	}
+	if active, _ := s.Promotions.GetActive(ctx, now, "TEN"); len(active) != 1 {
+		t.Errorf("GetActive includes a used up coupon: %v", promotionIDs(active))
+	}
+	check(t, s.Promotions.Release(ctx, coupon.ID))
+	check(t, s.Promotions.Release(ctx, coupon.ID))
+	if got, err := s.Promotions.GetByID(ctx, coupon.ID); err != nil || got.UsedCount != 0 {
+		t.Errorf("used count after release = %v, %v, want 0", got.UsedCount, err)
+	}
+
+	// Per-user limit, counted in orders that aren't cancelled
+	order := newOrder(user, salt, 1)
+	order.Discounts = []models.OrderDiscount{{UserID: user.ID, PromotionID: perUser.ID, Name: perUser.Name, Type: perUser.Type, Amount: 0.1}}
+	check(t, s.Orders.Create(ctx, order))
+	if used, err := s.Promotions.CountUserOrders(ctx, perUser.ID, user.ID); err != nil || used != 1 {
+		t.Errorf("CountUserOrders = %v, %v, want 1", used, err)
+	}
+	if err := s.Promotions.Redeem(ctx, perUser.ID, user.ID); !errors.Is(err, repository.ErrPromotionUserLimit) {
+		t.Errorf("Redeem beyond the per-user limit = %v, want ErrPromotionUserLimit", err)
+	}
+	check(t, s.Promotions.Redeem(ctx, perUser.ID, other.ID))
+	check(t, s.Orders.UpdateStatus(ctx, order.ID, models.OrderStatusCancelled))
+	if used, err := s.Promotions.CountUserOrders(ctx, perUser.ID, user.ID); err != nil || used != 0 {
+		t.Errorf("CountUserOrders after cancelling = %v, %v, want 0", used, err)
+	}
+	check(t, s.Promotions.Redeem(ctx, perUser.ID, user.ID))
+
+	coupon.Value = 15
+	check(t, s.Promotions.Update(ctx, coupon))
+	if got, err := s.Promotions.GetByID(ctx, coupon.ID); err != nil || got.Value != 15 {
+		t.Errorf("GetByID after Update = %v, %v", got, err)
+	}
+
+	check(t, s.Promotions.Delete(ctx, coupon.ID))
+	_, err = s.Promotions.GetByID(ctx, coupon.ID)
+	notFound(t, "GetByID of a deleted promotion", err)
+	if err := s.Promotions.Redeem(ctx, coupon.ID, user.ID); !errors.Is(err, repository.ErrPromotionUsedUp) {
+		t.Errorf("Redeem of a deleted promotion = %v, want ErrPromotionUsedUp", err)
+	}
+	// The code of a deleted coupon can be used again
+	createPromotion(t, s, models.Promotion{Name: "Ten off again", Code: ptr("TEN")})
+	all, err := s.Promotions.GetAll(ctx)
+	check(t, err)
+	if len(all) != 5 {
+		t.Errorf("GetAll = %v, want 5 promotions", promotionIDs(all))
+	}
+}
+
+func promotionIDs(promotions []models.Promotion) []uint {
+	ids := make([]uint, len(promotions))
+	for i, promotion := range promotions {
+		ids[i] = promotion.ID
+	}
+	return ids
+}
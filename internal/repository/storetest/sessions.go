@@ -0,0 +1,137 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func testSessions(t *testing.T, s Stores) {
+	user := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+	now := time.Now()
+
+	session := &models.Session{UserID: user.ID, TokenHash: "first", ExpiresAt: now.Add(time.Hour), LastUsedAt: now}
+	check(t, s.Sessions.Create(ctx, session))
+	if err := s.Sessions.Create(ctx, &models.Session{UserID: other.ID, TokenHash: "first", ExpiresAt: now.Add(time.Hour)}); err == nil {
+		t.Error("Create accepted a duplicate token hash")
+	}
+	second := &models.Session{UserID: user.ID, TokenHash: "second", ExpiresAt: now.Add(time.Hour), LastUsedAt: now}
+	check(t, s.Sessions.Create(ctx, second))
+
+	check(t, s.Sessions.Rotate(ctx, session.ID, "first", "rotated", now.Add(2*time.Hour), now))
+	for _, hash := range []string{"first", "rotated"} {
+		got, err := s.Sessions.GetByTokenHashForUpdate(ctx, hash)
+		if err != nil || got.ID != session.ID || got.TokenHash != "rotated" || got.PreviousTokenHash != "first" {
+			t.Errorf("GetByTokenHashForUpdate(%q) = %+v, %v", hash, got, err)
+		}
+	}
+	_, err := s.Sessions.GetByTokenHashForUpdate(ctx, "unknown")
+	notFound(t, "GetByTokenHashForUpdate of an unknown hash", err)
+
+	if active, err := s.Sessions.IsActive(ctx, session.ID, user.ID, now); err != nil || !active {
+		t.Errorf("IsActive = %v, %v, want true", active, err)
+	}
+	if active, _ := s.Sessions.IsActive(ctx, session.ID, other.ID, now); active {
+		t.Error("IsActive is true for another user")
+	}
+	if active, _ := s.Sessions.IsActive(ctx, session.ID, user.ID, now.Add(3*time.Hour)); active {
+		t.Error("IsActive is true for an expired session")
+	}
+
+	check(t, s.Sessions.RevokeForUser(ctx, session.ID, other.ID, now))
+	if active, _ := s.Sessions.IsActive(ctx, session.ID, user.ID, now); !active {
+		t.Error("RevokeForUser revoked a session of another user")
+	}
+	check(t, s.Sessions.Revoke(ctx, session.ID, now))
+	if active, _ := s.Sessions.IsActive(ctx, session.ID, user.ID, now); active {
+		t.Error("IsActive is true for a revoked session")
+	}
+	check(t, s.Sessions.RevokeAllForUser(ctx, user.ID, now.Add(time.Minute)))
+	if active, _ := s.Sessions.IsActive(ctx, second.ID, user.ID, now); active {
+		t.Error("RevokeAllForUser left a session active")
+	}
+	// Revoking again keeps the first revocation time
+	got, err := s.Sessions.GetByTokenHashForUpdate(ctx, "rotated")
+	check(t, err)
+	if got.RevokedAt == nil || got.RevokedAt.Sub(now).Abs() > time.Second {
+		t.Errorf("revoked at %v, want %v", got.RevokedAt, now)
+	}
+
+	current := &models.Session{UserID: user.ID, TokenHash: "current", ExpiresAt: now.Add(time.Hour), LastUsedAt: now}
+	check(t, s.Sessions.Create(ctx, current))
+	expired := &models.Session{UserID: user.ID, TokenHash: "expired", ExpiresAt: now.Add(-time.Hour), LastUsedAt: now}
+	check(t, s.Sessions.Create(ctx, expired))
+	otherExpired := &models.Session{UserID: other.ID, TokenHash: "other", ExpiresAt: now.Add(-time.Hour), LastUsedAt: now}
+	check(t, s.Sessions.Create(ctx, otherExpired))
+
+	// Sessions revoked at now stay until the cutoff passes them
+	check(t, s.Sessions.DeleteStaleForUser(ctx, user.ID, now, now.Add(-time.Hour)))
+	for hash, kept := range map[string]bool{"rotated": true, "second": true, "current": true, "expired": false, "other": true} {
+		_, err := s.Sessions.GetByTokenHashForUpdate(ctx, hash)
+		if (err == nil) != kept {
+			t.Errorf("session %q after DeleteStaleForUser: kept = %v, want %v", hash, err == nil, kept)
+		}
+	}
+	check(t, s.Sessions.DeleteStaleForUser(ctx, user.ID, now, now.Add(time.Hour)))
+	for hash, kept := range map[string]bool{"rotated": false, "second": false, "current": true} {
+		_, err := s.Sessions.GetByTokenHashForUpdate(ctx, hash)
+		if (err == nil) != kept {
+			t.Errorf("session %q after DeleteStaleForUser past the revocations: kept = %v, want %v", hash, err == nil, kept)
+		}
+	}
+}
+
+func testUserTokens(t *testing.T, s Stores) {
+	user := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+	now := time.Now()
+
+	older := &models.UserToken{
+		UserID: user.ID, Purpose: models.TokenPurposeVerifyEmail, TokenHash: "older",
+		ExpiresAt: now.Add(-time.Minute), CreatedAt: now.Add(-time.Hour),
+	}
+	check(t, s.Tokens.Create(ctx, older))
+	newer := &models.UserToken{UserID: user.ID, Purpose: models.TokenPurposeVerifyEmail, TokenHash: "newer", ExpiresAt: now.Add(time.Hour)}
+	check(t, s.Tokens.Create(ctx, newer))
+	reset := &models.UserToken{UserID: user.ID, Purpose: models.TokenPurposeResetPassword, TokenHash: "reset", ExpiresAt: now.Add(time.Hour)}
+	check(t, s.Tokens.Create(ctx, reset))
+	check(t, s.Tokens.Create(ctx, &models.UserToken{
+		UserID: other.ID, Purpose: models.TokenPurposeVerifyEmail, TokenHash: "other", ExpiresAt: now.Add(-time.Minute),
+	}))
+	if err := s.Tokens.Create(ctx, &models.UserToken{UserID: other.ID, Purpose: models.TokenPurposeVerifyEmail, TokenHash: "newer"}); err == nil {
+		t.Error("Create accepted a duplicate token hash")
+	}
+
+	if got, err := s.Tokens.GetLatest(ctx, user.ID, models.TokenPurposeVerifyEmail); err != nil || got.ID != newer.ID {
+		t.Errorf("GetLatest = %v, %v, want %d", got, err, newer.ID)
+	}
+	_, err := s.Tokens.GetLatest(ctx, other.ID, models.TokenPurposeResetPassword)
+	notFound(t, "GetLatest without a token", err)
+	if got, err := s.Tokens.GetByHashForUpdate(ctx, "reset", models.TokenPurposeResetPassword); err != nil || got.ID != reset.ID {
+		t.Errorf("GetByHashForUpdate = %v, %v", got, err)
+	}
+	_, err = s.Tokens.GetByHashForUpdate(ctx, "reset", models.TokenPurposeVerifyEmail)
+	notFound(t, "GetByHashForUpdate for another purpose", err)
+
+	check(t, s.Tokens.MarkAllUsed(ctx, user.ID, models.TokenPurposeVerifyEmail, now))
+	for hash, used := range map[string]bool{"newer": true, "reset": false} {
+		purpose := models.TokenPurposeVerifyEmail
+		if hash == "reset" {
+			purpose = models.TokenPurposeResetPassword
+		}
+		got, err := s.Tokens.GetByHashForUpdate(ctx, hash, purpose)
+		check(t, err)
+		if (got.UsedAt != nil) != used {
+			t.Errorf("token %q used = %v after MarkAllUsed, want %v", hash, got.UsedAt != nil, used)
+		}
+	}
+
+	check(t, s.Tokens.DeleteExpiredForUser(ctx, user.ID, models.TokenPurposeVerifyEmail, now))
+	_, err = s.Tokens.GetByHashForUpdate(ctx, "older", models.TokenPurposeVerifyEmail)
+	notFound(t, "GetByHashForUpdate of a deleted token", err)
+	if _, err := s.Tokens.GetByHashForUpdate(ctx, "other", models.TokenPurposeVerifyEmail); err != nil {
+		t.Errorf("DeleteExpiredForUser deleted a token of another user: %v", err)
+	}
+}
@@ -0,0 +1,833 @@
+// Package storetest is the contract every implementation of the repository
+// stores has to meet. The GORM repositories and the in-memory ones in
+// package memory both run it, which keeps the in-memory stores a faithful
+// stand-in for Postgres in service tests.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+// ctx is passed to every store call
+var ctx = context.Background()
+
+// Stores is a set of stores sharing one database
+type Stores struct {
+	Products     repository.ProductStore
+	Categories   repository.CategoryStore
+	Carts        repository.CartStore
+	Recipes      repository.RecipeStore
+	Users        repository.UserStore
+	Orders       repository.OrderStore
+	Reservations repository.ReservationStore
+	Promotions   repository.PromotionStore
+	Sessions     repository.SessionStore
+	Tokens       repository.UserTokenStore
+
+	RolePermissions repository.RolePermissionStore
+	Audit           repository.AuditStore
+	AICache         repository.AICacheStore
+}
+
+// Run runs the contract tests. open is called once per test and must return
+// stores backed by an empty database.
+func Run(t *testing.T, open func(t *testing.T) Stores) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Stores)
+	}{
+		{"ProductGet", testProductGet},
+		{"ProductSoftDelete", testProductSoftDelete},
+		{"ProductUpdate", testProductUpdate},
+		{"ProductStock", testProductStock},
+		{"VariantStock", testVariantStock},
+		{"StockContention", testStockContention},
+		{"ProductList", testProductList},
+		{"ProductSearch", testProductSearch},
+		{"Transaction", testTransaction},
+		{"PriceHistory", testPriceHistory},
+		{"ScheduledPrices", testScheduledPrices},
+		{"Categories", testCategories},
+		{"Cart", testCart},
+		{"CartPreload", testCartPreload},
+		{"Recipes", testRecipes},
+		{"RecipeReview", testRecipeReview},
+		{"Users", testUsers},
+		{"Orders", testOrders},
+		{"OrderTransaction", testOrderTransaction},
+		{"Reservations", testReservations},
+		{"Promotions", testPromotions},
+		{"Sessions", testSessions},
+		{"UserTokens", testUserTokens},
+		{"RolePermissions", testRolePermissions},
+		{"AuditLogs", testAuditLogs},
+		{"AICache", testAICache},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func notFound(t *testing.T, what string, err error) {
+	t.Helper()
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("%s: got error %v, want gorm.ErrRecordNotFound", what, err)
+	}
+}
+
+func createCategory(t *testing.T, s Stores, name string) *models.Category {
+	t.Helper()
+	category := &models.Category{Name: name}
+	check(t, s.Categories.Create(ctx, category))
+	return category
+}
+
+func createProduct(t *testing.T, s Stores, product models.Product) *models.Product {
+	t.Helper()
+	if product.Unit == "" {
+		product.Unit = models.UnitPiece
+	}
+	check(t, s.Products.Create(ctx, &product))
+	if product.ID == 0 {
+		t.Fatal("Create didn't set the product ID")
+	}
+	return &product
+}
+
+func createUser(t *testing.T, s Stores, email string) *models.User {
+	t.Helper()
+	user := &models.User{Name: "Test", Email: email, Password: "hash"}
+	check(t, s.Users.Create(ctx, user))
+	return user
+}
+
+func productIDs(products []models.Product) []uint {
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testProductGet(t *testing.T, s Stores) {
+	dairy := createCategory(t, s, "Dairy")
+	milk := createProduct(t, s, models.Product{
+		Name: "Whole Milk", Price: 1.5, Stock: 10, Unit: models.UnitLiter, CategoryID: dairy.ID,
+		SKU: ptr("MILK"), Barcode: ptr("4006381333931"),
+	})
+	check(t, s.Products.CreateVariant(ctx, &models.ProductVariant{ProductID: milk.ID, Name: "2 l", Size: 2, Price: 2.8, Stock: 5}))
+	check(t, s.Products.CreateVariant(ctx, &models.ProductVariant{ProductID: milk.ID, Name: "1 l", Size: 1, Price: 1.5, Stock: 5}))
+
+	got, err := s.Products.GetByID(ctx, milk.ID)
+	check(t, err)
+	if got.Name != "Whole Milk" || got.Price != 1.5 || got.Unit != models.UnitLiter {
+		t.Errorf("GetByID = %+v", got)
+	}
+	if got.Category == nil || got.Category.Name != "Dairy" {
+		t.Errorf("GetByID didn't preload the category: %+v", got.Category)
+	}
+	if len(got.Variants) != 2 || got.Variants[0].Name != "2 l" || got.Variants[1].Name != "1 l" {
+		t.Errorf("GetByID variants = %+v, want 2 l and 1 l in ID order", got.Variants)
+	}
+
+	if got, err := s.Products.GetBySKU(ctx, "MILK"); err != nil || got.ID != milk.ID {
+		t.Errorf("GetBySKU = %v, %v", got, err)
+	}
+	if got, err := s.Products.GetByBarcode(ctx, "4006381333931"); err != nil || got.ID != milk.ID || len(got.Variants) != 2 {
+		t.Errorf("GetByBarcode = %v, %v", got, err)
+	}
+	if products, err := s.Products.GetByName(ctx, "whole MILK"); err != nil || !equalIDs(productIDs(products), []uint{milk.ID}) {
+		t.Errorf("GetByName ignoring case = %v, %v", products, err)
+	}
+	_, err = s.Products.GetByID(ctx, milk.ID+100)
+	notFound(t, "GetByID of a missing product", err)
+
+	variant, err := s.Products.GetVariantBySKU(ctx, "none")
+	notFound(t, "GetVariantBySKU of a missing SKU", err)
+	if variant != nil {
+		t.Error("GetVariantBySKU returned a variant with an error")
+	}
+	_, err = s.Products.GetVariant(ctx, milk.ID+100, got.Variants[0].ID)
+	notFound(t, "GetVariant of another product", err)
+}
+
+func testProductSoftDelete(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	rice := createProduct(t, s, models.Product{Name: "Rice", Price: 2, Stock: 5, CategoryID: category.ID, SKU: ptr("RICE")})
+	oats := createProduct(t, s, models.Product{Name: "Oats", Price: 3, Stock: 5, CategoryID: category.ID})
+
+	if err := s.Products.Create(ctx, &models.Product{Name: "Other rice", Price: 1, Unit: models.UnitPiece, CategoryID: category.ID, SKU: ptr("RICE")}); err == nil {
+		t.Error("Create accepted a SKU used by another product")
+	}
+
+	check(t, s.Products.Delete(ctx, rice.ID))
+
+	_, err := s.Products.GetByID(ctx, rice.ID)
+	notFound(t, "GetByID of a deleted product", err)
+	_, err = s.Products.GetBySKU(ctx, "RICE")
+	notFound(t, "GetBySKU of a deleted product", err)
+	products, err := s.Products.GetAll(ctx)
+	check(t, err)
+	if !equalIDs(productIDs(products), []uint{oats.ID}) {
+		t.Errorf("GetAll = %v, want only the product that isn't deleted", productIDs(products))
+	}
+	products, err = s.Products.GetByIDs(ctx, []uint{rice.ID, oats.ID})
+	check(t, err)
+	if !equalIDs(productIDs(products), []uint{oats.ID}) {
+		t.Errorf("GetByIDs = %v, want only the product that isn't deleted", productIDs(products))
+	}
+
+	// The SKU of a deleted product is free again
+	createProduct(t, s, models.Product{Name: "Brown rice", Price: 2.5, CategoryID: category.ID, SKU: ptr("RICE")})
+}
+
+func testProductUpdate(t *testing.T, s Stores) {
+	dairy := createCategory(t, s, "Dairy")
+	bakery := createCategory(t, s, "Bakery")
+	product := createProduct(t, s, models.Product{Name: "Butter", Price: 2, CategoryID: dairy.ID})
+	check(t, s.Products.CreateVariant(ctx, &models.ProductVariant{ProductID: product.ID, Name: "250 g", Size: 1, Price: 2}))
+
+	loaded, err := s.Products.GetByID(ctx, product.ID)
+	check(t, err)
+	loaded.Name = "Croissant"
+	loaded.CategoryID = bakery.ID // loaded.Category is now stale
+	loaded.Variants = nil
+	check(t, s.Products.Update(ctx, loaded))
+
+	got, err := s.Products.GetByID(ctx, product.ID)
+	check(t, err)
+	if got.Name != "Croissant" || got.CategoryID != bakery.ID {
+		t.Errorf("Update didn't save the product's columns: %+v", got)
+	}
+	if got.Category == nil || got.Category.ID != bakery.ID {
+		t.Errorf("a stale preloaded category overwrote the new one: %+v", got.Category)
+	}
+	if len(got.Variants) != 1 {
+		t.Errorf("Update touched the variants: %+v", got.Variants)
+	}
+
+	check(t, s.Products.UpdatePrice(ctx, product.ID, 4.25))
+	got, err = s.Products.GetByID(ctx, product.ID)
+	check(t, err)
+	if got.Price != 4.25 || got.Name != "Croissant" {
+		t.Errorf("UpdatePrice = %+v", got)
+	}
+}
+
+func testProductStock(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	product := createProduct(t, s, models.Product{Name: "Flour", Price: 1, Stock: 10, CategoryID: category.ID})
+
+	check(t, s.Products.UpdateStock(ctx, product.ID, 4))
+	if err := s.Products.UpdateStock(ctx, product.ID, 7); !errors.Is(err, repository.ErrInsufficientStock) {
+		t.Errorf("UpdateStock beyond the stock = %v, want ErrInsufficientStock", err)
+	}
+	check(t, s.Products.RestoreStock(ctx, product.ID, 1.5))
+
+	got, err := s.Products.GetByID(ctx, product.ID)
+	check(t, err)
+	if got.Stock != 7.5 {
+		t.Errorf("stock = %v, want 7.5", got.Stock)
+	}
+
+	withStock, err := s.Products.GetAllWithStock(ctx)
+	check(t, err)
+	check(t, s.Products.UpdateStock(ctx, product.ID, 7.5))
+	withoutStock, err := s.Products.GetAllWithStock(ctx)
+	check(t, err)
+	if len(withStock) != 1 || withStock[0].Category == nil || len(withoutStock) != 0 {
+		t.Errorf("GetAllWithStock = %v then %v", withStock, withoutStock)
+	}
+
+	check(t, s.Products.Delete(ctx, product.ID))
+	if err := s.Products.UpdateStock(ctx, product.ID, 0); !errors.Is(err, repository.ErrInsufficientStock) {
+		t.Errorf("UpdateStock of a deleted product = %v, want ErrInsufficientStock", err)
+	}
+}
+
+func testVariantStock(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Drinks")
+	product := createProduct(t, s, models.Product{Name: "Water", Price: 1, CategoryID: category.ID})
+	variant := &models.ProductVariant{ProductID: product.ID, Name: "6-pack", SKU: ptr("WATER-6"), Size: 6, Price: 4, Stock: 3}
+	check(t, s.Products.CreateVariant(ctx, variant))
+
+	if err := s.Products.CreateVariant(ctx, &models.ProductVariant{ProductID: product.ID, Name: "12-pack", SKU: ptr("WATER-6"), Size: 12, Price: 7}); err == nil {
+		t.Error("CreateVariant accepted a SKU used by another variant")
+	}
+
+	check(t, s.Products.UpdateVariantStock(ctx, variant.ID, 2))
+	if err := s.Products.UpdateVariantStock(ctx, variant.ID, 2); !errors.Is(err, repository.ErrInsufficientStock) {
+		t.Errorf("UpdateVariantStock beyond the stock = %v, want ErrInsufficientStock", err)
+	}
+	check(t, s.Products.RestoreVariantStock(ctx, variant.ID, 1))
+
+	got, err := s.Products.GetVariant(ctx, product.ID, variant.ID)
+	check(t, err)
+	if got.Stock != 2 {
+		t.Errorf("variant stock = %v, want 2", got.Stock)
+	}
+
+	got.Price = 3.5
+	check(t, s.Products.UpdateVariant(ctx, got))
+	if got, err := s.Products.GetVariantBySKU(ctx, "WATER-6"); err != nil || got.Price != 3.5 {
+		t.Errorf("GetVariantBySKU after UpdateVariant = %v, %v", got, err)
+	}
+
+	check(t, s.Products.DeleteVariant(ctx, variant.ID))
+	_, err = s.Products.GetVariant(ctx, product.ID, variant.ID)
+	notFound(t, "GetVariant of a deleted variant", err)
+	loaded, err := s.Products.GetByID(ctx, product.ID)
+	check(t, err)
+	if len(loaded.Variants) != 0 {
+		t.Errorf("GetByID preloaded a deleted variant: %+v", loaded.Variants)
+	}
+}
+
+// testStockContention has buyers take stock at the same time; the stock
+// check and the decrement must be one step, so exactly as many succeed as
+// the stock covers and it never goes negative
+func testStockContention(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	cases := []struct {
+		name     string
+		stock    float64
+		quantity float64
+		buyers   int
+		inTx     bool
+		sold     int
+	}{
+		{"more buyers than stock", 5, 1, 12, false, 5},
+		{"uneven quantities", 10, 3, 8, false, 3},
+		{"weighed", 2, 0.75, 6, false, 2},
+		{"enough for everyone", 12, 2, 6, false, 6},
+		{"in transactions", 4, 1, 10, true, 4},
+	}
+
+	for _, tc := range cases {
+		product := createProduct(t, s, models.Product{Name: tc.name, Price: 1, Stock: tc.stock, CategoryID: category.ID})
+		take := func() error {
+			if !tc.inTx {
+				return s.Products.UpdateStock(ctx, product.ID, tc.quantity)
+			}
+			return s.Products.Transaction(ctx, func(tx *gorm.DB) error {
+				return s.Products.WithTx(tx).UpdateStock(ctx, product.ID, tc.quantity)
+			})
+		}
+
+		errs := make(chan error, tc.buyers)
+		var wg sync.WaitGroup
+		for range tc.buyers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- take()
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		sold := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				sold++
+			case !errors.Is(err, repository.ErrInsufficientStock):
+				t.Errorf("%s: UpdateStock = %v, want nil or ErrInsufficientStock", tc.name, err)
+			}
+		}
+		got, err := s.Products.GetByID(ctx, product.ID)
+		check(t, err)
+		if want := tc.stock - float64(tc.sold)*tc.quantity; sold != tc.sold || got.Stock != want {
+			t.Errorf("%s: %d sold leaving %v, want %d leaving %v", tc.name, sold, got.Stock, tc.sold, want)
+		}
+	}
+}
+
+func testProductList(t *testing.T, s Stores) {
+	fruit := createCategory(t, s, "Fruit")
+	other := createCategory(t, s, "Other")
+	apple := createProduct(t, s, models.Product{Name: "Apple", Price: 1, Stock: 10, CategoryID: fruit.ID})
+	banana := createProduct(t, s, models.Product{Name: "Banana", Price: 3, Stock: 0, CategoryID: fruit.ID})
+	cherry := createProduct(t, s, models.Product{Name: "Cherry", Price: 2, Stock: 5, Unit: models.UnitKilogram, CategoryID: fruit.ID})
+	date := createProduct(t, s, models.Product{Name: "Date", Price: 2, Stock: 5, CategoryID: fruit.ID})
+	createProduct(t, s, models.Product{Name: "Soap", Price: 2, Stock: 5, CategoryID: other.ID})
+	deleted := createProduct(t, s, models.Product{Name: "Elderberry", Price: 2, Stock: 5, CategoryID: fruit.ID})
+	check(t, s.Products.Delete(ctx, deleted.ID))
+
+	list := func(q models.ProductQuery, after *repository.ProductCursor) ([]uint, int64) {
+		t.Helper()
+		if q.Limit == 0 {
+			q.Limit = 10
+		}
+		if q.Order == "" {
+			q.Order = "asc"
+		}
+		products, total, err := s.Products.List(ctx, &q, after)
+		check(t, err)
+		return productIDs(products), total
+	}
+
+	ids, total := list(models.ProductQuery{Sort: "price", CategoryID: &fruit.ID}, nil)
+	if want := []uint{apple.ID, cherry.ID, date.ID, banana.ID}; !equalIDs(ids, want) || total != 4 {
+		t.Errorf("by price = %v (total %d), want %v (4)", ids, total, want)
+	}
+	ids, _ = list(models.ProductQuery{Sort: "price", Order: "desc", CategoryID: &fruit.ID}, nil)
+	if want := []uint{banana.ID, date.ID, cherry.ID, apple.ID}; !equalIDs(ids, want) {
+		t.Errorf("by price desc = %v, want %v (ties by ID, reversed)", ids, want)
+	}
+	ids, _ = list(models.ProductQuery{Sort: "name", CategoryID: &fruit.ID, MinPrice: ptr(1.5), MaxPrice: ptr(2.5)}, nil)
+	if want := []uint{cherry.ID, date.ID}; !equalIDs(ids, want) {
+		t.Errorf("price range = %v, want %v", ids, want)
+	}
+	ids, _ = list(models.ProductQuery{Sort: "name", CategoryID: &fruit.ID, InStock: ptr(false)}, nil)
+	if want := []uint{banana.ID}; !equalIDs(ids, want) {
+		t.Errorf("out of stock = %v, want %v", ids, want)
+	}
+	ids, _ = list(models.ProductQuery{Sort: "name", Unit: models.UnitKilogram}, nil)
+	if want := []uint{cherry.ID}; !equalIDs(ids, want) {
+		t.Errorf("by unit = %v, want %v", ids, want)
+	}
+
+	// One more row than the limit tells the caller a next page exists
+	ids, total = list(models.ProductQuery{Sort: "name", CategoryID: &fruit.ID, Limit: 2, Page: 2}, nil)
+	if want := []uint{cherry.ID, date.ID}; !equalIDs(ids, want) || total != 4 {
+		t.Errorf("page 2 = %v (total %d), want %v (4)", ids, total, want)
+	}
+	ids, _ = list(models.ProductQuery{Sort: "name", CategoryID: &fruit.ID, Limit: 1}, nil)
+	if want := []uint{apple.ID, banana.ID}; !equalIDs(ids, want) {
+		t.Errorf("limit 1 = %v, want %v", ids, want)
+	}
+	ids, _ = list(models.ProductQuery{Sort: "price", CategoryID: &fruit.ID, Limit: 2}, &repository.ProductCursor{Value: 2.0, ID: cherry.ID})
+	if want := []uint{date.ID, banana.ID}; !equalIDs(ids, want) {
+		t.Errorf("after cursor = %v, want %v", ids, want)
+	}
+	ids, _ = list(models.ProductQuery{Sort: "name", Order: "desc", CategoryID: &fruit.ID}, &repository.ProductCursor{Value: "Cherry", ID: cherry.ID})
+	if want := []uint{banana.ID, apple.ID}; !equalIDs(ids, want) {
+		t.Errorf("after cursor desc = %v, want %v", ids, want)
+	}
+}
+
+func testProductSearch(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	rice := createProduct(t, s, models.Product{Name: "Basmati Rice", Description: "Long grain", Price: 3, CategoryID: category.ID})
+	createProduct(t, s, models.Product{Name: "Cheddar", Description: "Aged cheese", Price: 4, CategoryID: category.ID})
+
+	q := &models.ProductQuery{Query: "basmati", Sort: "relevance", Order: "desc", Limit: 10}
+	products, total, err := s.Products.List(ctx, q, nil)
+	check(t, err)
+	if total != 1 || !equalIDs(productIDs(products), []uint{rice.ID}) {
+		t.Fatalf("search = %v (total %d), want only %d", productIDs(products), total, rice.ID)
+	}
+	if products[0].SearchRank <= 0 || products[0].Highlight == "" {
+		t.Errorf("search result has no rank or highlight: %+v", products[0])
+	}
+}
+
+func testTransaction(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	failed := errors.New("roll back")
+
+	err := s.Products.Transaction(ctx, func(tx *gorm.DB) error {
+		products := s.Products.WithTx(tx)
+		if err := products.Create(ctx, &models.Product{Name: "Salt", Price: 1, Unit: models.UnitGram, CategoryID: category.ID}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Transaction = %v, want the error of fn", err)
+	}
+	if products, _ := s.Products.GetByName(ctx, "Salt"); len(products) != 0 {
+		t.Error("a failed transaction kept its writes")
+	}
+
+	check(t, s.Products.Transaction(ctx, func(tx *gorm.DB) error {
+		return s.Products.WithTx(tx).Create(ctx, &models.Product{Name: "Pepper", Price: 1, Unit: models.UnitGram, CategoryID: category.ID})
+	}))
+	if products, _ := s.Products.GetByName(ctx, "Pepper"); len(products) != 1 {
+		t.Error("a committed transaction lost its writes")
+	}
+}
+
+func testPriceHistory(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	sugar := createProduct(t, s, models.Product{Name: "Sugar", Price: 2, CategoryID: category.ID})
+	salt := createProduct(t, s, models.Product{Name: "Salt", Price: 1, CategoryID: category.ID})
+
+	check(t, s.Products.CreatePriceChange(ctx, &models.PriceChange{ProductID: sugar.ID, Price: 2, Source: models.PriceSourceManual}))
+	check(t, s.Products.CreatePriceChange(ctx, &models.PriceChange{ProductID: salt.ID, Price: 1, Source: models.PriceSourceManual}))
+	check(t, s.Products.CreatePriceChange(ctx, &models.PriceChange{ProductID: sugar.ID, OldPrice: ptr(2.0), Price: 2.5, Source: models.PriceSourceImport}))
+
+	changes, err := s.Products.GetPriceHistory(ctx, sugar.ID, nil)
+	check(t, err)
+	if len(changes) != 2 || changes[0].OldPrice != nil || changes[1].Price != 2.5 || *changes[1].OldPrice != 2 || changes[1].CreatedAt.IsZero() {
+		t.Errorf("GetPriceHistory = %+v", changes)
+	}
+
+	future := time.Now().Add(time.Hour)
+	if changes, err := s.Products.GetPriceHistory(ctx, sugar.ID, &future); err != nil || len(changes) != 0 {
+		t.Errorf("GetPriceHistory since the future = %v, %v", changes, err)
+	}
+
+	changes, err = s.Products.GetPriceChangesSince(ctx, []uint{salt.ID, sugar.ID}, time.Now().Add(-time.Hour))
+	check(t, err)
+	var got []uint
+	for _, change := range changes {
+		got = append(got, change.ProductID)
+	}
+	if want := []uint{sugar.ID, sugar.ID, salt.ID}; !equalIDs(got, want) {
+		t.Errorf("GetPriceChangesSince products = %v, want %v (by product, oldest first)", got, want)
+	}
+}
+
+func testScheduledPrices(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	sugar := createProduct(t, s, models.Product{Name: "Sugar", Price: 2, CategoryID: category.ID})
+	salt := createProduct(t, s, models.Product{Name: "Salt", Price: 1, CategoryID: category.ID})
+	now := time.Now()
+
+	later := &models.ScheduledPrice{ProductID: sugar.ID, Price: 3, EffectiveAt: now.Add(time.Hour)}
+	due := &models.ScheduledPrice{ProductID: sugar.ID, Price: 2.5, EffectiveAt: now.Add(-time.Hour)}
+	orphan := &models.ScheduledPrice{ProductID: salt.ID, Price: 1.2, EffectiveAt: now.Add(-time.Hour)}
+	for _, scheduled := range []*models.ScheduledPrice{later, due, orphan} {
+		check(t, s.Products.CreateScheduledPrice(ctx, scheduled))
+	}
+	check(t, s.Products.Delete(ctx, salt.ID))
+
+	scheduled, err := s.Products.GetScheduledPrices(ctx, sugar.ID)
+	check(t, err)
+	if len(scheduled) != 2 || scheduled[0].ID != due.ID || scheduled[1].ID != later.ID {
+		t.Errorf("GetScheduledPrices = %+v, want them in the order they take effect", scheduled)
+	}
+
+	scheduled, err = s.Products.GetDueScheduledPrices(ctx, now)
+	check(t, err)
+	if len(scheduled) != 1 || scheduled[0].ID != due.ID {
+		t.Errorf("GetDueScheduledPrices = %+v, want only %d (the other is later or of a deleted product)", scheduled, due.ID)
+	}
+
+	if applied, err := s.Products.MarkScheduledPriceApplied(ctx, due.ID, now); err != nil || !applied {
+		t.Errorf("MarkScheduledPriceApplied = %v, %v, want true", applied, err)
+	}
+	if applied, err := s.Products.MarkScheduledPriceApplied(ctx, due.ID, now); err != nil || applied {
+		t.Errorf("MarkScheduledPriceApplied twice = %v, %v, want false", applied, err)
+	}
+	if scheduled, err := s.Products.GetDueScheduledPrices(ctx, now); err != nil || len(scheduled) != 0 {
+		t.Errorf("GetDueScheduledPrices after applying = %v, %v", scheduled, err)
+	}
+	if got, err := s.Products.GetScheduledPrice(ctx, sugar.ID, due.ID); err != nil || got.AppliedAt == nil {
+		t.Errorf("GetScheduledPrice = %v, %v, want it applied", got, err)
+	}
+
+	_, err = s.Products.GetScheduledPrice(ctx, salt.ID, later.ID)
+	notFound(t, "GetScheduledPrice of another product", err)
+	check(t, s.Products.DeleteScheduledPrice(ctx, later.ID))
+	_, err = s.Products.GetScheduledPrice(ctx, sugar.ID, later.ID)
+	notFound(t, "GetScheduledPrice after DeleteScheduledPrice", err)
+}
+
+func testCategories(t *testing.T, s Stores) {
+	dairy := createCategory(t, s, "Dairy")
+	bakery := createCategory(t, s, "Bakery")
+
+	if err := s.Categories.Create(ctx, &models.Category{Name: "Dairy"}); err == nil {
+		t.Error("Create accepted a duplicate name")
+	}
+
+	dairy.Name = "Milk & Eggs"
+	check(t, s.Categories.Update(ctx, dairy))
+	if got, err := s.Categories.GetByID(ctx, dairy.ID); err != nil || got.Name != "Milk & Eggs" {
+		t.Errorf("GetByID after Update = %v, %v", got, err)
+	}
+
+	check(t, s.Categories.Delete(ctx, bakery.ID))
+	_, err := s.Categories.GetByID(ctx, bakery.ID)
+	notFound(t, "GetByID of a deleted category", err)
+	categories, err := s.Categories.GetAll(ctx)
+	check(t, err)
+	if len(categories) != 1 || categories[0].ID != dairy.ID {
+		t.Errorf("GetAll = %+v, want only %d", categories, dairy.ID)
+	}
+
+	// A product's deleted category isn't preloaded
+	product := createProduct(t, s, models.Product{Name: "Bread", Price: 2, CategoryID: bakery.ID})
+	if got, err := s.Products.GetByID(ctx, product.ID); err != nil || got.Category != nil {
+		t.Errorf("GetByID preloaded a deleted category: %v, %v", got, err)
+	}
+}
+
+func testCart(t *testing.T, s Stores) {
+	user := createUser(t, s, "cart@example.com")
+	category := createCategory(t, s, "Dairy")
+	milk := createProduct(t, s, models.Product{Name: "Milk", Price: 1.5, Stock: 10, Unit: models.UnitLiter, CategoryID: category.ID})
+	pack := &models.ProductVariant{ProductID: milk.ID, Name: "2 l", Size: 2, Price: 2.8, Stock: 5}
+	check(t, s.Products.CreateVariant(ctx, pack))
+
+	_, err := s.Carts.GetByUserID(ctx, user.ID)
+	notFound(t, "GetByUserID before the cart exists", err)
+
+	cart, err := s.Carts.GetOrCreateByUserID(ctx, user.ID)
+	check(t, err)
+	again, err := s.Carts.GetOrCreateByUserID(ctx, user.ID)
+	check(t, err)
+	if cart.ID == 0 || again.ID != cart.ID || len(again.Items) != 0 {
+		t.Fatalf("GetOrCreateByUserID = %+v then %+v, want the same empty cart", cart, again)
+	}
+
+	check(t, s.Carts.AddItem(ctx, cart.ID, &models.CartItem{ProductID: milk.ID, Quantity: 1}))
+	check(t, s.Carts.AddItem(ctx, cart.ID, &models.CartItem{ProductID: milk.ID, Quantity: 0.5}))
+	check(t, s.Carts.AddMultipleItems(ctx, cart.ID, []models.CartItem{{ProductID: milk.ID, VariantID: &pack.ID, Quantity: 2}}))
+
+	cart, err = s.Carts.GetByUserID(ctx, user.ID)
+	check(t, err)
+	if len(cart.Items) != 2 {
+		t.Fatalf("items = %+v, want the product and its variant as separate lines", cart.Items)
+	}
+	for _, item := range cart.Items {
+		switch {
+		case item.VariantID == nil:
+			if item.Quantity != 1.5 || item.Product == nil || item.Product.Name != "Milk" || item.Variant != nil {
+				t.Errorf("product line = %+v, want merged quantity 1.5 with the product preloaded", item)
+			}
+		default:
+			if item.Quantity != 2 || item.Variant == nil || item.Variant.Name != "2 l" || item.Product == nil {
+				t.Errorf("variant line = %+v, want quantity 2 with the product and variant preloaded", item)
+			}
+		}
+	}
+
+	check(t, s.Carts.UpdateItemQuantity(ctx, cart.ID, milk.ID, &pack.ID, 3))
+	check(t, s.Carts.RemoveItem(ctx, cart.ID, milk.ID, nil))
+	items, err := s.Carts.GetCartItems(ctx, cart.ID)
+	check(t, err)
+	if len(items) != 1 || items[0].VariantID == nil || items[0].Quantity != 3 || items[0].Variant == nil {
+		t.Errorf("GetCartItems after update and remove = %+v, want only the variant line with 3 packs", items)
+	}
+
+	check(t, s.Carts.SetCoupon(ctx, cart.ID, ptr("WELCOME10")))
+	if cart, err := s.Carts.GetByUserID(ctx, user.ID); err != nil || cart.CouponCode == nil || *cart.CouponCode != "WELCOME10" {
+		t.Errorf("coupon after SetCoupon = %v, %v", cart, err)
+	}
+	check(t, s.Carts.SetCoupon(ctx, cart.ID, nil))
+	if cart, err := s.Carts.GetByUserID(ctx, user.ID); err != nil || cart.CouponCode != nil {
+		t.Errorf("coupon after removing it = %v, %v", cart, err)
+	}
+
+	check(t, s.Carts.ClearCart(ctx, cart.ID))
+	if cart, err := s.Carts.GetByUserID(ctx, user.ID); err != nil || len(cart.Items) != 0 {
+		t.Errorf("cart after ClearCart = %v, %v", cart, err)
+	}
+}
+
+func testCartPreload(t *testing.T, s Stores) {
+	user := createUser(t, s, "preload@example.com")
+	category := createCategory(t, s, "Dairy")
+	milk := createProduct(t, s, models.Product{Name: "Milk", Price: 1.5, Stock: 10, CategoryID: category.ID})
+	pack := &models.ProductVariant{ProductID: milk.ID, Name: "2 l", Size: 2, Price: 2.8, Stock: 5}
+	check(t, s.Products.CreateVariant(ctx, pack))
+	cheese := createProduct(t, s, models.Product{Name: "Cheese", Price: 4, Stock: 10, CategoryID: category.ID})
+
+	cart, err := s.Carts.GetOrCreateByUserID(ctx, user.ID)
+	check(t, err)
+	check(t, s.Carts.AddItem(ctx, cart.ID, &models.CartItem{ProductID: milk.ID, VariantID: &pack.ID, Quantity: 1}))
+	check(t, s.Carts.AddItem(ctx, cart.ID, &models.CartItem{ProductID: cheese.ID, Quantity: 1}))
+
+	check(t, s.Products.DeleteVariant(ctx, pack.ID))
+	check(t, s.Products.Delete(ctx, cheese.ID))
+
+	cart, err = s.Carts.GetByUserID(ctx, user.ID)
+	check(t, err)
+	if len(cart.Items) != 2 {
+		t.Fatalf("items = %+v, want both lines", cart.Items)
+	}
+	for _, item := range cart.Items {
+		if item.ProductID == milk.ID && (item.Product == nil || item.Variant != nil) {
+			t.Errorf("line of a deleted variant = %+v, want the product but no variant", item)
+		}
+		if item.ProductID == cheese.ID && item.Product != nil {
+			t.Errorf("line of a deleted product = %+v, want no product", item)
+		}
+	}
+}
+
+func testRecipes(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	pasta := createProduct(t, s, models.Product{Name: "Spaghetti", Price: 2, CategoryID: category.ID})
+	check(t, s.Products.CreateVariant(ctx, &models.ProductVariant{ProductID: pasta.ID, Name: "1 kg", Size: 1, Price: 3}))
+	eggs := createProduct(t, s, models.Product{Name: "Eggs", Price: 3, CategoryID: category.ID})
+	rice := createProduct(t, s, models.Product{Name: "Rice", Price: 2, CategoryID: category.ID})
+
+	recipe := &models.Recipe{
+		Name:         "Spaghetti  Carbonara!",
+		Instructions: "Cook the pasta.",
+		Servings:     2,
+		Ingredients: []models.RecipeIngredient{
+			{ProductID: pasta.ID, Quantity: 200, Unit: models.UnitGram},
+			{ProductID: eggs.ID, Quantity: 2, Unit: models.UnitPiece},
+		},
+	}
+	check(t, s.Recipes.Create(ctx, recipe))
+	if recipe.ID == 0 || recipe.Ingredients[0].ID == 0 || recipe.Ingredients[0].RecipeID != recipe.ID {
+		t.Fatalf("Create didn't set the IDs: %+v", recipe)
+	}
+
+	got, err := s.Recipes.GetByID(ctx, recipe.ID)
+	check(t, err)
+	if got.Status != models.RecipeStatusApproved {
+		t.Errorf("status = %q, want the default %q", got.Status, models.RecipeStatusApproved)
+	}
+	if len(got.Ingredients) != 2 || got.Ingredients[0].Product == nil || len(got.Ingredients[0].Product.Variants) != 1 {
+		t.Errorf("GetByID didn't preload the ingredients' products with their variants: %+v", got.Ingredients)
+	}
+
+	if recipes, err := s.Recipes.GetByNormalizedName(ctx, "spaghetti carbonara"); err != nil || len(recipes) != 1 || len(recipes[0].Ingredients) != 2 {
+		t.Errorf("GetByNormalizedName = %v, %v", recipes, err)
+	}
+
+	got.Name = "Carbonara"
+	got.Ingredients = []models.RecipeIngredient{{ProductID: rice.ID, Quantity: 100, Unit: models.UnitGram}}
+	check(t, s.Recipes.Update(ctx, got))
+	got, err = s.Recipes.GetByID(ctx, recipe.ID)
+	check(t, err)
+	if got.Name != "Carbonara" || len(got.Ingredients) != 1 || got.Ingredients[0].ProductID != rice.ID {
+		t.Errorf("Update didn't replace the ingredients: %+v", got)
+	}
+	if recipes, err := s.Recipes.GetByNormalizedName(ctx, "carbonara"); err != nil || len(recipes) != 1 {
+		t.Errorf("GetByNormalizedName after a rename = %v, %v", recipes, err)
+	}
+
+	if recipes, err := s.Recipes.GetByProductIDs(ctx, []uint{pasta.ID}); err != nil || len(recipes) != 0 {
+		t.Errorf("GetByProductIDs of a removed ingredient = %v, %v", recipes, err)
+	}
+	if recipes, err := s.Recipes.GetByProductIDs(ctx, []uint{eggs.ID, rice.ID}); err != nil || len(recipes) != 1 {
+		t.Errorf("GetByProductIDs = %v, %v", recipes, err)
+	}
+
+	check(t, s.Recipes.Delete(ctx, recipe.ID))
+	_, err = s.Recipes.GetByID(ctx, recipe.ID)
+	notFound(t, "GetByID of a deleted recipe", err)
+	if recipes, err := s.Recipes.GetAll(ctx, ""); err != nil || len(recipes) != 0 {
+		t.Errorf("GetAll after Delete = %v, %v", recipes, err)
+	}
+}
+
+func testRecipeReview(t *testing.T, s Stores) {
+	category := createCategory(t, s, "Pantry")
+	pasta := createProduct(t, s, models.Product{Name: "Spaghetti", Price: 2, CategoryID: category.ID})
+	reviewer := createUser(t, s, "editor@example.com")
+
+	approved := &models.Recipe{Name: "Spaghetti Carbonara", Description: "Creamy pasta", Instructions: "Cook.", Servings: 2,
+		Ingredients: []models.RecipeIngredient{{ProductID: pasta.ID, Quantity: 200, Unit: models.UnitGram}}}
+	check(t, s.Recipes.Create(ctx, approved))
+	suggested := &models.Recipe{Name: "Carbonara Bake", Instructions: "Bake.", Servings: 2,
+		Ingredients: []models.RecipeIngredient{{ProductID: pasta.ID, Quantity: 200, Unit: models.UnitGram}}}
+	check(t, s.Recipes.SaveAIGenerated(ctx, suggested))
+
+	if got, err := s.Recipes.GetByID(ctx, suggested.ID); err != nil || got.Status != models.RecipeStatusPending || !got.IsAIGenerated {
+		t.Errorf("SaveAIGenerated stored %v, %v, want a pending AI recipe", got, err)
+	}
+
+	pending, err := s.Recipes.GetAll(ctx, models.RecipeStatusPending)
+	check(t, err)
+	if len(pending) != 1 || pending[0].ID != suggested.ID {
+		t.Errorf("GetAll(pending) = %+v", pending)
+	}
+	if recipes, err := s.Recipes.GetByProductIDs(ctx, []uint{pasta.ID}); err != nil || len(recipes) != 1 || recipes[0].ID != approved.ID {
+		t.Errorf("GetByProductIDs = %v, %v, want only the approved recipe", recipes, err)
+	}
+
+	recipes, err := s.Recipes.Search(ctx, "carbonara")
+	check(t, err)
+	if len(recipes) != 1 || recipes[0].ID != approved.ID || recipes[0].SearchRank <= 0 {
+		t.Errorf("Search = %+v, want only the approved recipe, ranked", recipes)
+	}
+
+	check(t, s.Recipes.UpdateStatus(ctx, suggested.ID, models.RecipeStatusApproved, reviewer.ID))
+	got, err := s.Recipes.GetByID(ctx, suggested.ID)
+	check(t, err)
+	if got.Status != models.RecipeStatusApproved || got.ReviewedByID == nil || *got.ReviewedByID != reviewer.ID || got.ReviewedAt == nil {
+		t.Errorf("UpdateStatus = %+v", got)
+	}
+	if recipes, err := s.Recipes.Search(ctx, "carbonara"); err != nil || len(recipes) != 2 {
+		t.Errorf("Search after approval = %v, %v, want both recipes", recipes, err)
+	}
+}
+
+func testUsers(t *testing.T, s Stores) {
+	user := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+
+	if user.Role != models.RoleUser {
+		t.Errorf("role = %q, want the default %q", user.Role, models.RoleUser)
+	}
+	if err := s.Users.Create(ctx, &models.User{Name: "Ann", Email: "ann@example.com", Password: "hash"}); err == nil {
+		t.Error("Create accepted a duplicate email")
+	}
+
+	if got, err := s.Users.GetByEmail(ctx, "ann@example.com"); err != nil || got.ID != user.ID {
+		t.Errorf("GetByEmail = %v, %v", got, err)
+	}
+	_, err := s.Users.GetByEmail(ctx, "nobody@example.com")
+	notFound(t, "GetByEmail of an unknown email", err)
+
+	verifiedAt := time.Now()
+	check(t, s.Users.UpdateRole(ctx, user.ID, models.RoleSupportAgent))
+	check(t, s.Users.IncrementTokenVersion(ctx, user.ID))
+	check(t, s.Users.IncrementTokenVersion(ctx, user.ID))
+	check(t, s.Users.MarkEmailVerified(ctx, user.ID, verifiedAt))
+	check(t, s.Users.UpdatePassword(ctx, user.ID, "new-hash"))
+
+	got, err := s.Users.GetByID(ctx, user.ID)
+	check(t, err)
+	if got.Role != models.RoleSupportAgent || got.TokenVersion != 2 || !got.EmailVerified || got.EmailVerifiedAt == nil || got.Password != "new-hash" {
+		t.Errorf("user after updates = %+v", got)
+	}
+
+	got.Name = "Ann Lee"
+	check(t, s.Users.Update(ctx, got))
+	if got, err := s.Users.GetByID(ctx, user.ID); err != nil || got.Name != "Ann Lee" || got.Role != models.RoleSupportAgent {
+		t.Errorf("GetByID after Update = %v, %v", got, err)
+	}
+
+	check(t, s.Users.Delete(ctx, other.ID))
+	_, err = s.Users.GetByID(ctx, other.ID)
+	notFound(t, "GetByID of a deleted user", err)
+	users, err := s.Users.GetAll(ctx)
+	check(t, err)
+	if len(users) != 1 || users[0].ID != user.ID {
+		t.Errorf("GetAll = %+v, want only %d", users, user.ID)
+	}
+}
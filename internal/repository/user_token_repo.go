@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UserTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewUserTokenRepository(db *gorm.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+// Transaction runs fn inside a single database transaction
+func (r *UserTokenRepository) Transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return r.db.WithContext(ctx).Transaction(fn)
+}
+
+func (r *UserTokenRepository) WithTx(tx *gorm.DB) UserTokenStore {
+	return &UserTokenRepository{db: tx}
+}
+
+func (r *UserTokenRepository) Create(ctx context.Context, token *models.UserToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+// GetByHashForUpdate finds a token by hash and purpose and locks it
+func (r *UserTokenRepository) GetByHashForUpdate(ctx context.Context, hash string, purpose models.TokenPurpose) (*models.UserToken, error) {
+	var token models.UserToken
+	err := r.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", hash, purpose).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetLatest returns the user's most recently issued token for purpose
+func (r *UserTokenRepository) GetLatest(ctx context.Context, userID uint, purpose models.TokenPurpose) (*models.UserToken, error) {
+	var token models.UserToken
+	err := r.db.WithContext(ctx).Where("user_id = ? AND purpose = ?", userID, purpose).
+		Order("created_at DESC").
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkAllUsed consumes every outstanding token of the user for purpose, so
+// redeeming one link invalidates older ones
+func (r *UserTokenRepository) MarkAllUsed(ctx context.Context, userID uint, purpose models.TokenPurpose, now time.Time) error {
+	return r.db.WithContext(ctx).Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error
+}
+
+// DeleteExpiredForUser removes the user's expired tokens for purpose
+func (r *UserTokenRepository) DeleteExpiredForUser(ctx context.Context, userID uint, purpose models.TokenPurpose, now time.Time) error {
+	return r.db.WithContext(ctx).Where("user_id = ? AND purpose = ? AND expires_at <= ?", userID, purpose, now).
+		Delete(&models.UserToken{}).Error
+}
@@ -0,0 +1,407 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func TestAdminAccess(t *testing.T) {
+	h := newHarness(t)
+
+	h.get("/admin/users", "").expect(http.StatusUnauthorized, nil)
+	h.get("/admin/users", h.userToken()).expect(http.StatusForbidden, nil)
+	h.post("/admin/categories", h.userToken(), models.CategoryCreateRequest{Name: "Bakery"}).expect(http.StatusForbidden, nil)
+
+	// Staff roles only get their own permissions
+	clerk := h.tokenFor(models.RoleInventoryClerk)
+	stock := 10.0
+	h.patch(fmt.Sprintf("/admin/products/%d/stock", h.productID("Cucumber")), clerk, models.ProductStockUpdateRequest{Stock: &stock}).
+		expect(http.StatusOK, nil)
+	h.post("/admin/categories", clerk, models.CategoryCreateRequest{Name: "Bakery"}).expect(http.StatusForbidden, nil)
+
+	h.get("/admin/users", h.adminToken()).expect(http.StatusOK, nil)
+}
+
+func TestAdminCatalog(t *testing.T) {
+	h := newHarness(t)
+	admin := h.adminToken()
+
+	var category models.Category
+	h.post("/admin/categories", admin, models.CategoryCreateRequest{Name: "Bakery"}).expect(http.StatusCreated, &category)
+	h.put(fmt.Sprintf("/admin/categories/%d", category.ID), admin, models.CategoryCreateRequest{Name: "Bread"}).
+		expect(http.StatusOK, &category)
+	if category.Name != "Bread" {
+		t.Errorf("renamed category = %q, want Bread", category.Name)
+	}
+
+	var product models.Product
+	h.post("/admin/products", admin, map[string]interface{}{
+		"name": "Baguette", "price": 1.20, "stock": 30, "unit": "pcs", "category_id": category.ID,
+		"barcode": "4006381333931",
+	}).expect(http.StatusCreated, &product)
+	h.post("/admin/products", admin, map[string]interface{}{"name": "No price", "unit": "pcs", "category_id": category.ID}).
+		expect(http.StatusBadRequest, nil)
+
+	var lookup models.BarcodeLookupResponse
+	h.get("/products/barcode/4006381333931", "").expect(http.StatusOK, &lookup)
+	if lookup.Product.ID != product.ID {
+		t.Errorf("barcode lookup = %+v, want the baguette", lookup.Product)
+	}
+
+	price := 1.40
+	h.put(fmt.Sprintf("/admin/products/%d", product.ID), admin, models.ProductUpdateRequest{Price: &price}).
+		expect(http.StatusOK, &product)
+	var history models.PriceHistoryResponse
+	h.get(fmt.Sprintf("/products/%d/price-history", product.ID), "").expect(http.StatusOK, &history)
+	if history.Price != 1.40 || len(history.Changes) == 0 {
+		t.Errorf("price history = %+v, want the change to 1.40", history)
+	}
+
+	path := fmt.Sprintf("/admin/products/%d/variants", product.ID)
+	h.post(path, admin, models.ProductVariantCreateRequest{Name: "Pack of 3", Size: 3, Price: 3.60, Stock: 10}).
+		expect(http.StatusCreated, &product)
+	if len(product.Variants) != 1 {
+		t.Fatalf("product has %d variants, want 1", len(product.Variants))
+	}
+	variant := product.Variants[0]
+	variantPrice := 3.30
+	h.put(fmt.Sprintf("%s/%d", path, variant.ID), admin, models.ProductVariantUpdateRequest{Price: &variantPrice}).
+		expect(http.StatusOK, nil)
+	h.get(fmt.Sprintf("/products/%d/price-history", product.ID), "").expect(http.StatusOK, &history)
+	last := history.Changes[len(history.Changes)-1]
+	if last.VariantID == nil || *last.VariantID != variant.ID || last.OldPrice == nil || *last.OldPrice != 3.60 || last.Price != 3.30 {
+		t.Errorf("last price change = %+v, want variant %d from 3.60 to 3.30", last, variant.ID)
+	}
+	h.delete(fmt.Sprintf("%s/%d", path, variant.ID), admin).expect(http.StatusOK, nil)
+
+	var scheduled models.ScheduledPrice
+	path = fmt.Sprintf("/admin/products/%d/scheduled-prices", product.ID)
+	h.post(path, admin, models.ScheduledPriceRequest{Price: 0.99, EffectiveAt: time.Now().Add(24 * time.Hour)}).
+		expect(http.StatusCreated, &scheduled)
+	h.post(path, admin, models.ScheduledPriceRequest{Price: 0.99, EffectiveAt: time.Now().Add(-time.Hour)}).
+		expect(http.StatusBadRequest, nil)
+	var pending []models.ScheduledPrice
+	h.get(path, admin).expect(http.StatusOK, &pending)
+	if len(pending) != 1 {
+		t.Errorf("%d scheduled prices, want 1", len(pending))
+	}
+	h.delete(fmt.Sprintf("%s/%d", path, scheduled.ID), admin).expect(http.StatusOK, nil)
+
+	h.delete(fmt.Sprintf("/admin/products/%d", product.ID), admin).expect(http.StatusOK, nil)
+	h.get(fmt.Sprintf("/products/%d", product.ID), "").expect(http.StatusNotFound, nil)
+	h.delete(fmt.Sprintf("/admin/categories/%d", category.ID), admin).expect(http.StatusOK, nil)
+}
+
+func TestProductImportExport(t *testing.T) {
+	h := newHarness(t)
+	admin := h.adminToken()
+
+	csv := "name,price,stock,unit,category\nTomato,2.75,,,\nButter,4.20,20,pcs,Dairy\n"
+
+	var result models.ProductImportResult
+	h.post("/admin/products/import?dry_run=true", admin, csv).expect(http.StatusOK, &result)
+	if !result.DryRun || result.Created != 1 || result.Updated != 1 {
+		t.Errorf("dry run = %+v, want 1 created and 1 updated", result)
+	}
+	var found models.ProductListResponse
+	h.get("/products/search?q=butter", "").expect(http.StatusOK, &found)
+	if len(found.Items) != 0 {
+		t.Error("dry run created a product")
+	}
+
+	// Dry runs change nothing, so they aren't audited
+	var log struct {
+		Items []struct {
+			EntityID string          `json:"entity_id"`
+			Before   json.RawMessage `json:"before"`
+			After    json.RawMessage `json:"after"`
+		} `json:"items"`
+	}
+	h.get("/admin/audit?action=product.import", admin).expect(http.StatusOK, &log)
+	if len(log.Items) != 0 {
+		t.Errorf("dry run left %d audit entries", len(log.Items))
+	}
+
+	h.post("/admin/products/import", admin, csv).expect(http.StatusOK, &result)
+	var product models.Product
+	h.get(fmt.Sprintf("/products/%d", h.productID("Tomato")), "").expect(http.StatusOK, &product)
+	if product.Price != 2.75 || product.Stock != 100 {
+		t.Errorf("imported tomato = %v at %v, want 100 at 2.75", product.Stock, product.Price)
+	}
+
+	// One entry per product, newest first: the created butter, then the
+	// updated tomato with its old price
+	h.get("/admin/audit?action=product.import", admin).expect(http.StatusOK, &log)
+	if len(log.Items) != 2 {
+		t.Fatalf("%d audit entries for the import, want 2", len(log.Items))
+	}
+	butter, tomato := log.Items[0], log.Items[1]
+	if butter.EntityID != fmt.Sprint(h.productID("Butter")) || string(butter.Before) != "null" || !strings.Contains(string(butter.After), `"name":"Butter"`) {
+		t.Errorf("audit entry of the created product = %s %s -> %s", butter.EntityID, butter.Before, butter.After)
+	}
+	if tomato.EntityID != fmt.Sprint(product.ID) || strings.Contains(string(tomato.Before), `"price":2.75`) || !strings.Contains(string(tomato.After), `"price":2.75`) {
+		t.Errorf("audit entry of the updated product = %s %s -> %s", tomato.EntityID, tomato.Before, tomato.After)
+	}
+
+	h.post("/admin/products/import", admin, "name,price,unit\nBread,-1,pcs\n").
+		expect(http.StatusUnprocessableEntity, &result)
+	if len(result.Errors) == 0 {
+		t.Error("invalid row imported without errors")
+	}
+	h.post("/admin/products/import", admin, "colour\nred\n").expectError(http.StatusBadRequest, "invalid import file")
+	huge := "name,description\nSoup,\"" + strings.Repeat("x", 11<<20) + "\"\n"
+	h.post("/admin/products/import", admin, huge).expectError(http.StatusRequestEntityTooLarge, "larger than 10 MB")
+
+	// Text that a spreadsheet would run as a formula is exported quoted, and
+	// imports back unchanged
+	h.post("/admin/products/import", admin, "name,price,unit,category\n=1+1,1,pcs,Dairy\n").expect(http.StatusOK, nil)
+	export := h.get("/admin/products/export", admin).expect(http.StatusOK, nil)
+	lines := strings.Split(strings.TrimSpace(string(export.Body)), "\n")
+	if len(lines) != 7 || !strings.HasPrefix(lines[0], "sku,barcode,name") {
+		t.Errorf("export = %q, want a header and 6 products", export.Body)
+	}
+	if !strings.Contains(string(export.Body), ",'=1+1,") {
+		t.Errorf("export = %q, want the formula name quoted", export.Body)
+	}
+	h.post("/admin/products/import", admin, string(export.Body)).expect(http.StatusOK, &result)
+	if result.Created != 0 || result.Updated != 6 {
+		t.Errorf("re-import of the export = %+v, want all 6 products updated", result)
+	}
+	h.productID("=1+1") // fails if the quote was kept
+}
+
+func TestRecipeReview(t *testing.T) {
+	h := newHarness(t)
+	admin := h.adminToken()
+	user := h.userToken()
+
+	suggestion := models.AIRecipeSuggestion{
+		Name:         "Tomato Salad",
+		Instructions: "Slice and season.",
+		Servings:     2,
+		Ingredients:  []models.AIIngredient{{ProductID: h.productID("Tomato"), Quantity: 300, Unit: models.UnitGram}},
+	}
+	var recipe models.Recipe
+	h.post("/ai/suggestions/save", user, suggestion).expect(http.StatusCreated, &recipe)
+	if recipe.Status != models.RecipeStatusPending {
+		t.Fatalf("saved suggestion is %q, want pending", recipe.Status)
+	}
+	h.post("/ai/suggestions/save", user, suggestion).expect(http.StatusConflict, nil)
+
+	// Pending recipes aren't public
+	h.get(fmt.Sprintf("/recipes/%d", recipe.ID), "").expect(http.StatusNotFound, nil)
+
+	var pending []models.Recipe
+	h.get("/admin/recipes", admin).expect(http.StatusOK, &pending)
+	if len(pending) != 1 || pending[0].ID != recipe.ID {
+		t.Fatalf("pending recipes = %+v, want the saved suggestion", pending)
+	}
+	h.get("/admin/recipes?status=bogus", admin).expect(http.StatusBadRequest, nil)
+
+	h.post(fmt.Sprintf("/admin/recipes/%d/approve", recipe.ID), admin, nil).expect(http.StatusOK, &recipe)
+	if recipe.Status != models.RecipeStatusApproved {
+		t.Errorf("approved recipe is %q", recipe.Status)
+	}
+	h.get(fmt.Sprintf("/recipes/%d", recipe.ID), "").expect(http.StatusOK, nil)
+
+	var created models.Recipe
+	h.post("/admin/recipes", admin, models.RecipeCreateRequest{
+		Name:         "Milk Glass",
+		Instructions: "Pour.",
+		Servings:     1,
+		Ingredients:  []models.RecipeIngredientCreateRequest{{ProductID: h.productID("Milk"), Quantity: 250, Unit: models.UnitMilliliter}},
+	}).expect(http.StatusCreated, &created)
+	h.post(fmt.Sprintf("/admin/recipes/%d/reject", created.ID), admin, nil).expect(http.StatusOK, &created)
+	if created.Status != models.RecipeStatusRejected {
+		t.Errorf("rejected recipe is %q", created.Status)
+	}
+	h.delete(fmt.Sprintf("/admin/recipes/%d", created.ID), admin).expect(http.StatusOK, nil)
+}
+
+func TestPromotions(t *testing.T) {
+	h := newHarness(t)
+	admin := h.adminToken()
+	user := h.userToken()
+
+	var promotion models.Promotion
+	h.post("/admin/promotions", admin, models.PromotionCreateRequest{
+		Name: "Ten off", Type: models.PromotionPercentage, Value: 10, Code: "TEN",
+	}).expect(http.StatusCreated, &promotion)
+	h.post("/admin/promotions", admin, models.PromotionCreateRequest{Name: "Bad", Type: "bogus"}).
+		expect(http.StatusBadRequest, nil)
+
+	h.post("/cart/items", user, models.CartItemRequest{ProductID: h.productID("Tomato"), Quantity: 4}).
+		expect(http.StatusOK, nil)
+	milk := h.productID("Milk")
+	h.post("/admin/promotions", admin, models.PromotionCreateRequest{
+		Name: "Milk deal", Type: models.PromotionPercentage, Value: 20, Code: "MILK", ProductID: &milk,
+	}).expect(http.StatusCreated, nil)
+	h.post("/cart/coupon", user, models.CouponRequest{Code: "MILK"}).
+		expectError(http.StatusBadRequest, "doesn't apply to anything in your cart")
+
+	var cart models.CartResponse
+	h.post("/cart/coupon", user, models.CouponRequest{Code: "TEN"}).expect(http.StatusOK, &cart)
+	if cart.CouponCode != "TEN" || cart.DiscountTotal != 1 || cart.TotalPrice != 9 {
+		t.Fatalf("cart = %+v, want 10%% off 10", cart)
+	}
+
+	var order models.Order
+	h.post("/orders", user, nil).expect(http.StatusCreated, &order)
+	if order.TotalPrice != 9 || order.DiscountTotal != 1 {
+		t.Errorf("order total = %v less %v, want 9 after a discount of 1", order.TotalPrice, order.DiscountTotal)
+	}
+
+	h.get(fmt.Sprintf("/admin/promotions/%d", promotion.ID), admin).expect(http.StatusOK, &promotion)
+	if promotion.UsedCount != 1 {
+		t.Errorf("coupon used %d times, want 1", promotion.UsedCount)
+	}
+	h.delete(fmt.Sprintf("/admin/promotions/%d", promotion.ID), admin).expect(http.StatusOK, nil)
+	h.get(fmt.Sprintf("/admin/promotions/%d", promotion.ID), admin).expect(http.StatusNotFound, nil)
+}
+
+func TestOrderManagement(t *testing.T) {
+	h := newHarness(t)
+	admin := h.adminToken()
+	user := h.userToken()
+
+	h.post("/cart/items", user, models.CartItemRequest{ProductID: h.productID("Eggs"), Quantity: 6}).expect(http.StatusOK, nil)
+	var order models.Order
+	h.post("/orders", user, nil).expect(http.StatusCreated, &order)
+
+	var orders []models.Order
+	h.get("/admin/orders", admin).expect(http.StatusOK, &orders)
+	if len(orders) != 1 {
+		t.Fatalf("%d orders, want 1", len(orders))
+	}
+
+	path := fmt.Sprintf("/admin/orders/%d/status", order.ID)
+	h.patch(path, admin, models.OrderStatusUpdateRequest{Status: models.OrderStatusDelivered}).expect(http.StatusBadRequest, nil)
+	h.patch(path, admin, models.OrderStatusUpdateRequest{Status: models.OrderStatusPaid}).expect(http.StatusOK, &order)
+	if order.Status != models.OrderStatusPaid {
+		t.Errorf("order is %q, want paid", order.Status)
+	}
+
+	// Refunds need orders:refund, which inventory clerks don't have
+	clerk := h.tokenFor(models.RoleInventoryClerk)
+	h.patch(path, clerk, models.OrderStatusUpdateRequest{Status: models.OrderStatusRefunded}).
+		expectError(http.StatusForbidden, string(models.PermOrdersRefund))
+	h.patch(path, admin, models.OrderStatusUpdateRequest{Status: models.OrderStatusRefunded}).expect(http.StatusOK, nil)
+}
+
+func TestUserAndRoleManagement(t *testing.T) {
+	h := newHarness(t)
+	admin := h.adminToken()
+	user := h.register()
+
+	path := fmt.Sprintf("/admin/users/%d/role", user.User.ID)
+	h.patch(path, admin, map[string]string{"role": "emperor"}).expectError(http.StatusBadRequest, "Invalid role")
+	h.patch(path, admin, map[string]string{"role": string(models.RoleRecipeEditor)}).expect(http.StatusOK, nil)
+
+	var profile models.UserResponse
+	h.get(fmt.Sprintf("/admin/users/%d", user.User.ID), admin).expect(http.StatusOK, &profile)
+	if profile.Role != models.RoleRecipeEditor {
+		t.Errorf("role = %q, want %q", profile.Role, models.RoleRecipeEditor)
+	}
+
+	var roles []models.RolePermissionsResponse
+	h.get("/admin/roles", admin).expect(http.StatusOK, &roles)
+	if len(roles) == 0 {
+		t.Fatal("no roles listed")
+	}
+	h.get("/admin/permissions", admin).expect(http.StatusOK, nil)
+
+	// Granting a permission takes effect on the next request
+	editor := h.login(user.User.Email, testPassword).Token
+	h.get("/admin/orders", editor).expect(http.StatusForbidden, nil)
+	h.put("/admin/roles/recipe_editor/permissions", admin, models.RolePermissionsUpdateRequest{
+		Permissions: []models.Permission{models.PermRecipesWrite, models.PermRecipesReview, models.PermOrdersRead},
+	}).expect(http.StatusOK, nil)
+	h.get("/admin/orders", editor).expect(http.StatusOK, nil)
+
+	h.delete(fmt.Sprintf("/admin/users/%d", user.User.ID), admin).expect(http.StatusOK, nil)
+	h.get(fmt.Sprintf("/admin/users/%d", user.User.ID), admin).expect(http.StatusNotFound, nil)
+}
+
+func TestStaffCantEscalate(t *testing.T) {
+	h := newHarness(t)
+	admin := h.adminToken()
+	h.put("/admin/roles/support_agent/permissions", admin, models.RolePermissionsUpdateRequest{
+		Permissions: []models.Permission{models.PermUsersRead, models.PermUsersWrite, models.PermRolesManage, models.PermOrdersRead},
+	}).expect(http.StatusOK, nil)
+	agent := h.tokenFor(models.RoleSupportAgent)
+
+	// Not their own role, and nothing they don't hold
+	h.put("/admin/roles/support_agent/permissions", agent, models.RolePermissionsUpdateRequest{
+		Permissions: models.AllPermissions,
+	}).expectError(http.StatusForbidden, "own role")
+	h.put("/admin/roles/recipe_editor/permissions", agent, models.RolePermissionsUpdateRequest{
+		Permissions: []models.Permission{models.PermRecipesWrite, models.PermAuditRead},
+	}).expectError(http.StatusForbidden, "audit:read")
+	// Keeping what the role already has is fine
+	h.put("/admin/roles/recipe_editor/permissions", agent, models.RolePermissionsUpdateRequest{
+		Permissions: []models.Permission{models.PermRecipesWrite, models.PermRecipesReview, models.PermOrdersRead},
+	}).expect(http.StatusOK, nil)
+
+	// No roles with more access than their own
+	user := h.register().User
+	rolePath := fmt.Sprintf("/admin/users/%d/role", user.ID)
+	h.patch(rolePath, agent, map[string]string{"role": string(models.RoleAdmin)}).expectError(http.StatusForbidden, "admin")
+	h.patch(rolePath, agent, map[string]string{"role": string(models.RoleCatalogManager)}).
+		expectError(http.StatusForbidden, "products:write")
+	h.patch(rolePath, agent, map[string]string{"role": string(models.RoleSupportAgent)}).expect(http.StatusOK, nil)
+	h.patch("/admin/users/999/role", agent, map[string]string{"role": string(models.RoleUser)}).expect(http.StatusNotFound, nil)
+
+	// Admins are out of reach
+	other := h.register().User
+	if err := h.db.Model(&models.User{}).Where("id = ?", other.ID).Update("role", models.RoleAdmin).Error; err != nil {
+		t.Fatal(err)
+	}
+	h.patch(fmt.Sprintf("/admin/users/%d/role", other.ID), agent, map[string]string{"role": string(models.RoleUser)}).
+		expectError(http.StatusForbidden, "admin accounts")
+	h.delete(fmt.Sprintf("/admin/users/%d", other.ID), agent).expectError(http.StatusForbidden, "admin accounts")
+	h.delete(fmt.Sprintf("/admin/users/%d", user.ID), agent).expect(http.StatusOK, nil)
+
+	var profile models.UserResponse
+	h.get(fmt.Sprintf("/admin/users/%d", other.ID), admin).expect(http.StatusOK, &profile)
+	if profile.Role != models.RoleAdmin {
+		t.Errorf("admin's role = %q after the attempts, want admin", profile.Role)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	h := newHarness(t)
+	admin := h.adminToken()
+
+	var category models.Category
+	h.post("/admin/categories", admin, models.CategoryCreateRequest{Name: "Bakery"}).expect(http.StatusCreated, &category)
+	h.put(fmt.Sprintf("/admin/categories/%d", category.ID), admin, models.CategoryCreateRequest{Name: "Bread"}).
+		expect(http.StatusOK, nil)
+	// Failed writes aren't recorded
+	h.post("/admin/categories", admin, models.CategoryCreateRequest{Name: "X"}).expect(http.StatusBadRequest, nil)
+
+	// AuditJSON only marshals, so the snapshots are left out
+	var log struct {
+		Items []struct {
+			Action    string      `json:"action"`
+			EntityID  string      `json:"entity_id"`
+			ActorRole models.Role `json:"actor_role"`
+		} `json:"items"`
+	}
+	h.get("/admin/audit?entity_type=category", admin).expect(http.StatusOK, &log)
+	if len(log.Items) != 2 {
+		t.Fatalf("%d audit entries, want 2", len(log.Items))
+	}
+	for _, entry := range log.Items {
+		if entry.EntityID != fmt.Sprint(category.ID) || entry.ActorRole != models.RoleAdmin {
+			t.Errorf("audit entry = %+v, want one for category %d by an admin", entry, category.ID)
+		}
+	}
+
+	h.get("/admin/audit", h.tokenFor(models.RoleCatalogManager)).expect(http.StatusForbidden, nil)
+}
@@ -0,0 +1,106 @@
+package server_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func TestHealth(t *testing.T) {
+	h := newHarness(t)
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	h.get("/health", "").expect(http.StatusOK, &body)
+	if body.Status != "ok" {
+		t.Errorf("status = %q, want ok", body.Status)
+	}
+}
+
+func TestAuthSession(t *testing.T) {
+	h := newHarness(t)
+	auth := h.register()
+
+	if auth.Token == "" || auth.RefreshToken == "" || auth.User.Role != models.RoleUser {
+		t.Fatalf("register = %+v, want tokens for a customer", auth)
+	}
+	h.post("/auth/register", "", map[string]string{"name": "Again", "email": auth.User.Email, "password": testPassword}).
+		expectError(http.StatusBadRequest, "")
+	h.post("/auth/login", "", map[string]string{"email": auth.User.Email, "password": "wrong-password"}).
+		expectError(http.StatusUnauthorized, "")
+
+	var me models.UserResponse
+	h.get("/users/me", auth.Token).expect(http.StatusOK, &me)
+	if me.ID != auth.User.ID || me.Email != auth.User.Email {
+		t.Errorf("/users/me = %+v, want %+v", me, auth.User)
+	}
+	h.get("/users/me", "").expect(http.StatusUnauthorized, nil)
+	h.get("/users/me", "not-a-token").expect(http.StatusUnauthorized, nil)
+
+	var refreshed models.AuthResponse
+	h.post("/auth/refresh", "", map[string]string{"refresh_token": auth.RefreshToken}).expect(http.StatusOK, &refreshed)
+	if refreshed.RefreshToken == auth.RefreshToken {
+		t.Error("refresh didn't rotate the refresh token")
+	}
+	// Reusing a rotated token revokes the session
+	h.post("/auth/refresh", "", map[string]string{"refresh_token": auth.RefreshToken}).expect(http.StatusUnauthorized, nil)
+	h.post("/auth/refresh", "", map[string]string{"refresh_token": refreshed.RefreshToken}).expect(http.StatusUnauthorized, nil)
+
+	session := h.login(auth.User.Email, testPassword)
+	h.post("/auth/logout", session.Token, map[string]string{"refresh_token": session.RefreshToken}).expect(http.StatusOK, nil)
+	h.post("/auth/refresh", "", map[string]string{"refresh_token": session.RefreshToken}).expect(http.StatusUnauthorized, nil)
+
+	other := h.login(auth.User.Email, testPassword)
+	h.post("/auth/logout-all", other.Token, nil).expect(http.StatusOK, nil)
+	h.get("/users/me", other.Token).expect(http.StatusUnauthorized, nil)
+}
+
+func TestEmailVerificationAndPasswordReset(t *testing.T) {
+	h := newHarness(t)
+	auth := h.register()
+	email := auth.User.Email
+
+	h.post("/auth/verify-email", "", map[string]string{"token": "bogus"}).expect(http.StatusBadRequest, nil)
+	h.post("/auth/verify-email", "", map[string]string{"token": h.mail.token(t, email)}).expect(http.StatusOK, nil)
+
+	var me models.UserResponse
+	h.get("/users/me", auth.Token).expect(http.StatusOK, &me)
+	if !me.EmailVerified {
+		t.Error("email not verified after following the mailed link")
+	}
+
+	// Unknown addresses get the same reply, so accounts can't be probed
+	h.post("/auth/forgot-password", "", map[string]string{"email": "nobody@example.com"}).expect(http.StatusOK, nil)
+	h.post("/auth/forgot-password", "", map[string]string{"email": email}).expect(http.StatusOK, nil)
+	h.post("/auth/reset-password", "", map[string]string{"token": h.mail.token(t, email), "password": "new-password"}).
+		expect(http.StatusOK, nil)
+
+	h.post("/auth/login", "", map[string]string{"email": email, "password": testPassword}).expect(http.StatusUnauthorized, nil)
+	h.login(email, "new-password")
+}
+
+func TestRequiredEmailVerification(t *testing.T) {
+	h := newHarness(t)
+	// A session opened before verification became required
+	before := h.register()
+	h.cfg.RequireEmailVerification = "true"
+
+	var auth models.AuthResponse
+	h.post("/auth/register", "", map[string]string{"name": "New", "email": "new@example.com", "password": testPassword}).
+		expect(http.StatusCreated, &auth)
+	if auth.Token != "" || auth.RefreshToken != "" || !auth.VerificationRequired {
+		t.Fatalf("register = %+v, want no session until the email is verified", auth)
+	}
+	h.post("/auth/login", "", map[string]string{"email": "new@example.com", "password": testPassword}).
+		expectError(http.StatusForbidden, "not verified")
+
+	// Unverified sessions stop working too
+	h.get("/users/me", before.Token).expectError(http.StatusForbidden, "not verified")
+	h.post("/auth/refresh", "", map[string]string{"refresh_token": before.RefreshToken}).
+		expectError(http.StatusForbidden, "not verified")
+
+	h.post("/auth/verify-email", "", map[string]string{"token": h.mail.token(t, "new@example.com")}).expect(http.StatusOK, nil)
+	h.login("new@example.com", testPassword)
+}
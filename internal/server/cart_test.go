@@ -0,0 +1,115 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func TestCart(t *testing.T) {
+	h := newHarness(t)
+	token := h.userToken()
+	tomato, milk := h.productID("Tomato"), h.productID("Milk")
+
+	h.get("/cart", "").expect(http.StatusUnauthorized, nil)
+
+	var cart models.CartResponse
+	h.get("/cart", token).expect(http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Fatalf("new cart has %d items, want none", len(cart.Items))
+	}
+
+	h.post("/cart/items", token, models.CartItemRequest{ProductID: tomato, Quantity: 2}).expect(http.StatusOK, &cart)
+	h.post("/cart/items", token, models.CartItemRequest{ProductID: milk, Quantity: 500, Unit: models.UnitMilliliter}).
+		expect(http.StatusOK, &cart)
+	if len(cart.Items) != 2 || cart.TotalPrice != 5.75 {
+		t.Fatalf("cart = %+v, want 2 kg of tomatoes and 500 ml of milk for 5.75", cart)
+	}
+	h.post("/cart/items", token, models.CartItemRequest{ProductID: h.productID("Cucumber"), Quantity: 1}).
+		expect(http.StatusBadRequest, nil)
+	h.post("/cart/items", token, models.CartItemRequest{ProductID: 999, Quantity: 1}).expect(http.StatusBadRequest, nil)
+	h.post("/cart/items", token, map[string]interface{}{"product_id": tomato}).expect(http.StatusBadRequest, nil)
+
+	h.put(fmt.Sprintf("/cart/items/%d", tomato), token, map[string]float64{"quantity": 4}).expect(http.StatusOK, &cart)
+	if cart.TotalPrice != 10.75 {
+		t.Errorf("total after 4 kg of tomatoes = %v, want 10.75", cart.TotalPrice)
+	}
+	h.delete(fmt.Sprintf("/cart/items/%d", milk), token).expect(http.StatusOK, &cart)
+	if len(cart.Items) != 1 || cart.TotalPrice != 10 {
+		t.Errorf("cart after removing milk = %+v, want 4 kg of tomatoes for 10", cart)
+	}
+
+	h.post("/cart/coupon", token, models.CouponRequest{Code: "NOPE"}).expectError(http.StatusBadRequest, "not valid")
+
+	h.delete("/cart", token).expect(http.StatusOK, nil)
+	h.get("/cart", token).expect(http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Errorf("cleared cart has %d items", len(cart.Items))
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	h := newHarness(t)
+	token := h.userToken()
+	tomato := h.productID("Tomato")
+
+	h.post("/orders", token, nil).expect(http.StatusBadRequest, nil)
+
+	h.post("/cart/items", token, models.CartItemRequest{ProductID: tomato, Quantity: 3}).expect(http.StatusOK, nil)
+	var reservation models.ReservationResponse
+	h.post("/cart/reserve", token, nil).expect(http.StatusOK, &reservation)
+	if len(reservation.Items) != 1 || reservation.Items[0].Quantity != 3 {
+		t.Fatalf("reservation = %+v, want a hold on 3 kg of tomatoes", reservation)
+	}
+
+	var order models.Order
+	h.post("/orders", token, nil).expect(http.StatusCreated, &order)
+	if order.Status != models.OrderStatusPending || order.TotalPrice != 7.50 || len(order.Items) != 1 {
+		t.Fatalf("order = %+v, want a pending order of 7.50", order)
+	}
+
+	var product models.Product
+	h.get(fmt.Sprintf("/products/%d", tomato), "").expect(http.StatusOK, &product)
+	if product.Stock != 97 {
+		t.Errorf("stock after checkout = %v, want 97", product.Stock)
+	}
+	var cart models.CartResponse
+	h.get("/cart", token).expect(http.StatusOK, &cart)
+	if len(cart.Items) != 0 {
+		t.Errorf("cart has %d items after checkout, want none", len(cart.Items))
+	}
+
+	var orders []models.Order
+	h.get("/orders", token).expect(http.StatusOK, &orders)
+	if len(orders) != 1 || orders[0].ID != order.ID {
+		t.Errorf("orders = %+v, want the new order", orders)
+	}
+	h.get(fmt.Sprintf("/orders/%d", order.ID), token).expect(http.StatusOK, nil)
+	// Other customers can't see it
+	h.get(fmt.Sprintf("/orders/%d", order.ID), h.userToken()).expectError(http.StatusNotFound, "Order not found")
+}
+
+func TestRecipeToCart(t *testing.T) {
+	h := newHarness(t)
+	token := h.userToken()
+
+	var recipes []models.Recipe
+	h.get("/recipes", "").expect(http.StatusOK, &recipes)
+	path := fmt.Sprintf("/recipes/%d/add-to-cart", recipes[0].ID)
+
+	h.post(path, "", map[string]int{"servings": 2}).expect(http.StatusUnauthorized, nil)
+	h.post(path, token, map[string]int{"servings": 0}).expect(http.StatusBadRequest, nil)
+
+	var cart models.CartResponse
+	h.post(path, token, map[string]int{"servings": 2}).expect(http.StatusOK, &cart)
+	if len(cart.Items) != 2 {
+		t.Fatalf("cart = %+v, want eggs and milk", cart)
+	}
+	for _, item := range cart.Items {
+		if item.ProductName == "Eggs" && item.Quantity != 4 {
+			t.Errorf("eggs for 2 servings = %v, want 4", item.Quantity)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func TestProducts(t *testing.T) {
+	h := newHarness(t)
+
+	var list models.ProductListResponse
+	h.get("/products", "").expect(http.StatusOK, &list)
+	if list.Total != 4 || len(list.Items) != 4 {
+		t.Fatalf("listed %d of %d products, want 4", len(list.Items), list.Total)
+	}
+
+	h.get("/products?in_stock=true&sort=price&order=asc", "").expect(http.StatusOK, &list)
+	if got := productNames(list.Items); fmt.Sprint(got) != "[Milk Tomato Eggs]" {
+		t.Errorf("in stock by price = %v, want [Milk Tomato Eggs]", got)
+	}
+	h.get("/products?limit=2", "").expect(http.StatusOK, &list)
+	if len(list.Items) != 2 || list.NextCursor == "" {
+		t.Errorf("limit=2 gave %d products, cursor %q; want 2 and a cursor", len(list.Items), list.NextCursor)
+	}
+	h.get("/products?limit=1000", "").expect(http.StatusBadRequest, nil)
+
+	var product models.Product
+	h.get(fmt.Sprintf("/products/%d", h.productID("Milk")), "").expect(http.StatusOK, &product)
+	if product.Name != "Milk" || product.Price != 1.50 || product.Unit != models.UnitLiter {
+		t.Errorf("product = %+v, want Milk at 1.50/l", product)
+	}
+	h.get("/products/999", "").expectError(http.StatusNotFound, "Product not found")
+	h.get("/products/abc", "").expectError(http.StatusBadRequest, "Invalid product ID")
+
+	h.get(fmt.Sprintf("/products/category/%d", product.CategoryID), "").expect(http.StatusOK, &list)
+	if got := productNames(list.Items); len(got) != 2 {
+		t.Errorf("Dairy products = %v, want Milk and Eggs", got)
+	}
+
+	var history models.PriceHistoryResponse
+	h.get(fmt.Sprintf("/products/%d/price-history", product.ID), "").expect(http.StatusOK, &history)
+	if history.ProductID != product.ID || history.Price != 1.50 {
+		t.Errorf("price history = %+v, want the current price of Milk", history)
+	}
+	h.get(fmt.Sprintf("/products/%d/price-history?days=0", product.ID), "").expect(http.StatusBadRequest, nil)
+
+	h.get("/products/barcode/4006381333931", "").expectError(http.StatusNotFound, "Product not found")
+	h.get("/products/barcode/123", "").expect(http.StatusBadRequest, nil)
+}
+
+func TestProductSearch(t *testing.T) {
+	h := newHarness(t)
+
+	var result models.ProductListResponse
+	h.get("/products/search?q=milk", "").expect(http.StatusOK, &result)
+	if len(result.Items) != 1 || result.Items[0].Name != "Milk" {
+		t.Fatalf("search milk = %v, want [Milk]", productNames(result.Items))
+	}
+	if result.Items[0].Highlight == "" {
+		t.Error("search result has no highlight")
+	}
+
+	h.get("/products/search?q=fresh", "").expect(http.StatusOK, &result)
+	if len(result.Items) != 4 {
+		t.Errorf("search fresh = %v, want every product", productNames(result.Items))
+	}
+	h.get("/products/search", "").expectError(http.StatusBadRequest, "Search query required")
+}
+
+func TestCategories(t *testing.T) {
+	h := newHarness(t)
+
+	var categories []models.Category
+	h.get("/categories", "").expect(http.StatusOK, &categories)
+	if len(categories) != 2 {
+		t.Fatalf("categories = %+v, want Vegetables and Dairy", categories)
+	}
+}
+
+func TestRecipes(t *testing.T) {
+	h := newHarness(t)
+
+	var recipes []models.Recipe
+	h.get("/recipes", "").expect(http.StatusOK, &recipes)
+	if len(recipes) != 1 || recipes[0].Name != "Test Omelette" {
+		t.Fatalf("recipes = %+v, want the test omelette", recipes)
+	}
+	id := recipes[0].ID
+
+	var recipe models.Recipe
+	h.get(fmt.Sprintf("/recipes/%d", id), "").expect(http.StatusOK, &recipe)
+	if len(recipe.Ingredients) != 2 {
+		t.Errorf("recipe has %d ingredients, want 2", len(recipe.Ingredients))
+	}
+	h.get("/recipes/999", "").expectError(http.StatusNotFound, "Recipe not found")
+
+	h.get("/recipes/search?q=omelette", "").expect(http.StatusOK, &recipes)
+	if len(recipes) != 1 {
+		t.Errorf("search omelette found %d recipes, want 1", len(recipes))
+	}
+	h.get("/recipes/search", "").expectError(http.StatusBadRequest, "Search query required")
+
+	var calculated struct {
+		Servings    int           `json:"servings"`
+		TotalPrice  float64       `json:"total_price"`
+		Ingredients []interface{} `json:"ingredients"`
+	}
+	h.get(fmt.Sprintf("/recipes/%d/calculate?servings=3", id), "").expect(http.StatusOK, &calculated)
+	if calculated.Servings != 3 || len(calculated.Ingredients) != 2 || calculated.TotalPrice <= 0 {
+		t.Errorf("calculate for 3 = %+v, want two priced ingredients", calculated)
+	}
+	h.get(fmt.Sprintf("/recipes/%d/calculate?servings=0", id), "").expect(http.StatusBadRequest, nil)
+}
+
+func TestAI(t *testing.T) {
+	h := newHarness(t)
+
+	h.post("/ai/dish-to-ingredients", "", map[string]string{}).expect(http.StatusBadRequest, nil)
+	h.post("/ai/products-to-recipes", "", map[string][]uint{"product_ids": {}}).expect(http.StatusBadRequest, nil)
+
+	// The fake provider answers with an empty list, which fails validation
+	h.post("/ai/products-to-recipes", "", map[string][]uint{"product_ids": {h.productID("Eggs")}}).
+		expectError(http.StatusBadGateway, "invalid response")
+
+	h.get("/ai/cart-to-recipes", "").expect(http.StatusUnauthorized, nil)
+}
+
+func productNames(products []models.Product) []string {
+	names := make([]string, len(products))
+	for i, p := range products {
+		names[i] = p.Name
+	}
+	return names
+}
@@ -0,0 +1,291 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/database"
+	"github.com/bexiiiii/smart_food_store/internal/mailer"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/server"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const testPassword = "password123"
+
+// harness is the API on a fresh in-memory SQLite database seeded with the
+// "test" fixtures. Requests go straight to the handler, without a network.
+type harness struct {
+	t     *testing.T
+	cfg   *config.Config
+	srv   *server.Server
+	db    *gorm.DB
+	mail  *outbox
+	users int
+}
+
+// newHarness starts the API. configure can change the configuration
+// before the server is built.
+func newHarness(t *testing.T, configure ...func(cfg *config.Config)) *harness {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	cfg := &config.Config{
+		DBDriver:                 "sqlite",
+		SQLitePath:               ":memory:",
+		SeedFixtures:             "test",
+		JWTSecret:                "test-secret",
+		JWTExpiration:            "15m",
+		JWTRefreshExpiration:     "720h",
+		AppBaseURL:               "http://localhost:5173",
+		EmailVerificationTTL:     "24h",
+		PasswordResetTTL:         "1h",
+		RequireEmailVerification: "false",
+		StockHoldTTL:             "15m",
+		LLMProvider:              "fake",
+		AIMaxRepairAttempts:      "0",
+		AICacheBackend:           "memory",
+		AICacheTTL:               "24h",
+		AICacheSize:              "100",
+	}
+	for _, fn := range configure {
+		fn(cfg)
+	}
+
+	db, err := database.Open(cfg, &gorm.Config{Logger: database.NewSlogLogger(0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	fixtures, err := database.LoadFixtures(cfg.SeedFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Seed(db, fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	mail := &outbox{}
+	srv, err := server.NewServer(server.Deps{Config: cfg, DB: db, Mailer: mail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	return &harness{t: t, cfg: cfg, srv: srv, db: db, mail: mail}
+}
+
+// response is a recorded reply
+type response struct {
+	t    *testing.T
+	req  string
+	Code int
+	Body []byte
+}
+
+// do sends a request. body is encoded as JSON unless it is a string; token,
+// if not empty, is sent as the bearer token.
+func (h *harness) do(method, path, token string, body interface{}) *response {
+	h.t.Helper()
+
+	var reader io.Reader
+	contentType := "application/json"
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+		contentType = "text/csv"
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, "/api/v1"+path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.srv.ServeHTTP(rec, req)
+
+	return &response{t: h.t, req: method + " " + path, Code: rec.Code, Body: rec.Body.Bytes()}
+}
+
+func (h *harness) get(path, token string) *response {
+	h.t.Helper()
+	return h.do(http.MethodGet, path, token, nil)
+}
+
+func (h *harness) post(path, token string, body interface{}) *response {
+	h.t.Helper()
+	return h.do(http.MethodPost, path, token, body)
+}
+
+func (h *harness) put(path, token string, body interface{}) *response {
+	h.t.Helper()
+	return h.do(http.MethodPut, path, token, body)
+}
+
+func (h *harness) patch(path, token string, body interface{}) *response {
+	h.t.Helper()
+	return h.do(http.MethodPatch, path, token, body)
+}
+
+func (h *harness) delete(path, token string) *response {
+	h.t.Helper()
+	return h.do(http.MethodDelete, path, token, nil)
+}
+
+// expect fails the test unless the reply has the status code, and decodes
+// the JSON body into v if v isn't nil
+func (r *response) expect(code int, v interface{}) *response {
+	r.t.Helper()
+	if r.Code != code {
+		r.t.Fatalf("%s: status %d, want %d; body: %s", r.req, r.Code, code, r.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(r.Body, v); err != nil {
+			r.t.Fatalf("%s: decoding %s: %v", r.req, r.Body, err)
+		}
+	}
+	return r
+}
+
+// expectError fails the test unless the reply has the status code and an
+// error message containing want
+func (r *response) expectError(code int, want string) {
+	r.t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	r.expect(code, &body)
+	if !strings.Contains(body.Error, want) {
+		r.t.Fatalf("%s: error %q, want it to contain %q", r.req, body.Error, want)
+	}
+}
+
+// register signs up a new user with a unique email and returns the session
+func (h *harness) register() models.AuthResponse {
+	h.t.Helper()
+	h.users++
+	var auth models.AuthResponse
+	h.post("/auth/register", "", map[string]string{
+		"name":     fmt.Sprintf("User %d", h.users),
+		"email":    fmt.Sprintf("user%d@example.com", h.users),
+		"password": testPassword,
+	}).expect(http.StatusCreated, &auth)
+	return auth
+}
+
+// userToken registers a customer and returns their access token
+func (h *harness) userToken() string {
+	h.t.Helper()
+	return h.register().Token
+}
+
+func (h *harness) login(email, password string) models.AuthResponse {
+	h.t.Helper()
+	var auth models.AuthResponse
+	h.post("/auth/login", "", map[string]string{"email": email, "password": password}).
+		expect(http.StatusOK, &auth)
+	return auth
+}
+
+// tokenFor registers a user with the role and returns their access token
+func (h *harness) tokenFor(role models.Role) string {
+	h.t.Helper()
+	user := h.register().User
+	if err := h.db.Model(&models.User{}).Where("id = ?", user.ID).Update("role", role).Error; err != nil {
+		h.t.Fatal(err)
+	}
+	return h.login(user.Email, testPassword).Token
+}
+
+// adminToken registers an admin and returns their access token
+func (h *harness) adminToken() string {
+	h.t.Helper()
+	return h.tokenFor(models.RoleAdmin)
+}
+
+// productID returns the ID of a seeded product
+func (h *harness) productID(name string) uint {
+	h.t.Helper()
+	var product models.Product
+	if err := h.db.Where("name = ?", name).First(&product).Error; err != nil {
+		h.t.Fatalf("product %q: %v", name, err)
+	}
+	return product.ID
+}
+
+// outbox is a mailer that keeps the messages it is given
+type outbox struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (o *outbox) Send(ctx context.Context, msg mailer.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=([A-Za-z0-9_.-]+)`)
+
+// token returns the token of the last link mailed to the address. It
+// waits a moment for one, as verification emails are sent in the background.
+func (o *outbox) token(t *testing.T, to string) string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if token := o.lastToken(to); token != "" {
+			return token
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no link mailed to %s", to)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (o *outbox) lastToken(to string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To != to {
+			continue
+		}
+		if match := linkToken.FindStringSubmatch(o.messages[i].Body); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
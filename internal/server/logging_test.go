@@ -0,0 +1,81 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/logging"
+)
+
+func TestRequestID(t *testing.T) {
+	h := newHarness(t)
+
+	var logs bytes.Buffer
+	logger, err := logging.New(&config.Config{LogLevel: "debug", LogFormat: "json"}, &logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	slog.SetDefault(logger)
+
+	send := func(id string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/products/999", nil)
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		rec := httptest.NewRecorder()
+		h.srv.ServeHTTP(rec, req)
+		return rec.Header().Get("X-Request-ID")
+	}
+
+	if got := send("abc-123"); got != "abc-123" {
+		t.Errorf("request ID = %q, want the caller's abc-123", got)
+	}
+	generated := send("")
+	if len(generated) != 32 {
+		t.Errorf("generated request ID = %q, want 32 hex digits", generated)
+	}
+	if got := send("bad id\n"); got == "bad id\n" || len(got) != 32 {
+		t.Errorf("request ID for an invalid header = %q, want a generated one", got)
+	}
+
+	// The request log and the SQL run for the request carry the ID, and the
+	// SQL keeps its placeholders instead of the product ID
+	seen := map[string]bool{}
+	for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+		var record struct {
+			Msg       string `json:"msg"`
+			RequestID string `json:"request_id"`
+			SQL       string `json:"sql"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("log line %s: %v", line, err)
+		}
+		if strings.Contains(record.SQL, "999") {
+			t.Errorf("logged SQL has the bound value inlined: %s", record.SQL)
+		}
+		if record.RequestID == generated {
+			seen[record.Msg] = true
+		}
+	}
+	if !seen["Request"] || !seen["SQL query"] {
+		t.Errorf("records logged with request ID %s: %v, want the request and its SQL", generated, seen)
+	}
+}
+
+func TestLoggingConfig(t *testing.T) {
+	if _, err := logging.New(&config.Config{LogLevel: "verbose"}, &bytes.Buffer{}); err == nil {
+		t.Error("LOG_LEVEL=verbose accepted")
+	}
+	if _, err := logging.New(&config.Config{LogFormat: "xml"}, &bytes.Buffer{}); err == nil {
+		t.Error("LOG_FORMAT=xml accepted")
+	}
+}
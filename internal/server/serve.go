@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readyTimeout bounds the database ping of the readiness probe
+const readyTimeout = 2 * time.Second
+
+// defaultShutdownDelay is used when SHUTDOWN_DELAY is empty or invalid
+const defaultShutdownDelay = 5 * time.Second
+
+// HTTPServer returns an http.Server for the API on addr, with the timeouts
+// and header limit from the configuration
+func (s *Server) HTTPServer(addr string) *http.Server {
+	cfg := s.config
+
+	maxHeaderBytes, err := strconv.Atoi(cfg.HTTPMaxHeaderBytes)
+	if err != nil || maxHeaderBytes <= 0 {
+		maxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+
+	return &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadTimeout:       duration(cfg.HTTPReadTimeout, 30*time.Second),
+		ReadHeaderTimeout: duration(cfg.HTTPReadHeaderTimeout, 5*time.Second),
+		WriteTimeout:      duration(cfg.HTTPWriteTimeout, 4*time.Minute),
+		IdleTimeout:       duration(cfg.HTTPIdleTimeout, 2*time.Minute),
+		MaxHeaderBytes:    maxHeaderBytes,
+	}
+}
+
+// ListenAndServe listens on addr and calls Serve
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves the API on listener until ctx is done. Readiness then fails
+// for the shutdown delay while requests are still served, so load balancers
+// stop routing to this instance before it stops accepting connections and
+// waits up to the shutdown timeout for requests in flight. Requests still
+// running after that are cut off and an error is returned.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	httpServer := s.HTTPServer(listener.Addr().String())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.draining.Store(true)
+	if delay := shutdownDelay(s.config.ShutdownDelay); delay > 0 {
+		slog.Info("Shutting down, failing readiness before closing the listener", "delay", delay.String())
+		select {
+		case err := <-served:
+			return err
+		case <-time.After(delay):
+		}
+	}
+
+	timeout := duration(s.config.ShutdownTimeout, 30*time.Second)
+	slog.Info("Shutting down, waiting for requests in flight", "timeout", timeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		httpServer.Close()
+		return err
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func (s *Server) ready(c *gin.Context) {
+	if s.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Shutting down"})
+		return
+	}
+
+	sqlDB, err := s.db.DB()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+		defer cancel()
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "error": "Database unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// shutdownDelay parses SHUTDOWN_DELAY: a duration, "0" to skip the delay, or
+// empty for the default
+func shutdownDelay(value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return defaultShutdownDelay
+	}
+	return d
+}
+
+// duration parses value, falling back for empty, invalid or non-positive
+// values
+func duration(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,112 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/database"
+)
+
+func TestProbes(t *testing.T) {
+	h := newHarness(t)
+
+	h.get("/health/live", "").expect(http.StatusOK, nil)
+	h.get("/health/ready", "").expect(http.StatusOK, nil)
+
+	database.Close(h.db)
+	h.get("/health/live", "").expect(http.StatusOK, nil)
+	h.get("/health/ready", "").expectError(http.StatusServiceUnavailable, "Database unavailable")
+}
+
+func TestHTTPServerLimits(t *testing.T) {
+	h := newHarness(t, func(cfg *config.Config) {
+		cfg.HTTPReadTimeout = "10s"
+		cfg.HTTPWriteTimeout = "bogus"
+		cfg.HTTPMaxHeaderBytes = "4096"
+	})
+
+	s := h.srv.HTTPServer(":8080")
+	if s.ReadTimeout != 10*time.Second || s.WriteTimeout != 4*time.Minute || s.MaxHeaderBytes != 4096 {
+		t.Errorf("read %s, write %s, max header %d; want 10s, the 4m default and 4096",
+			s.ReadTimeout, s.WriteTimeout, s.MaxHeaderBytes)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	h := newHarness(t, func(cfg *config.Config) {
+		cfg.ShutdownDelay = "300ms"
+		cfg.ShutdownTimeout = "5s"
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- h.srv.Serve(ctx, listener) }()
+
+	// A request whose handler is running when shutdown begins (here,
+	// waiting for the rest of its body) is still answered
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	body := `{"email":"nobody@example.com","password":"secret"}`
+	conn.Write([]byte(fmt.Sprintf("POST /api/v1/auth/login HTTP/1.1\r\nHost: test\r\n"+
+		"Content-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body[:10])))
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+
+	// During the delay new connections are still accepted, and readiness
+	// fails on them, so a load balancer sees the 503 before being refused
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get("http://" + addr + "/api/v1/health/ready")
+	if err != nil {
+		t.Fatalf("readiness probe during the shutdown delay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("readiness during the shutdown delay = %d, want 503", resp.StatusCode)
+	}
+
+	// After the delay the listener is closed, with the request still in flight
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case err := <-served:
+		t.Fatalf("Serve returned %v with a request in flight", err)
+	default:
+	}
+	if c, err := net.Dial("tcp", addr); err == nil {
+		c.Close()
+		t.Error("still accepting connections after the shutdown delay")
+	}
+
+	conn.Write([]byte(body[10:]))
+	resp, err = http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("login while draining = %d, want 401", resp.StatusCode)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve = %v, want nil after a clean shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve didn't return after the last request")
+	}
+}
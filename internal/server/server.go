@@ -0,0 +1,327 @@
+// Package server builds the HTTP API: repositories, services, handlers,
+// middleware and the route table, wired together from a database
+// connection and the configuration.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/handlers"
+	"github.com/bexiiiii/smart_food_store/internal/mailer"
+	"github.com/bexiiiii/smart_food_store/internal/middleware"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"github.com/bexiiiii/smart_food_store/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Deps are what the API is built from. Config and DB are required; Mailer
+// defaults to the one selected by Config.MailDriver.
+type Deps struct {
+	Config *config.Config
+	DB     *gorm.DB
+	Mailer mailer.Mailer
+}
+
+// Server is the API's http.Handler, together with the services that run
+// background jobs
+type Server struct {
+	router             http.Handler
+	config             *config.Config
+	db                 *gorm.DB
+	reservationService *services.ReservationService
+	productService     *services.ProductService
+	accountService     *services.AccountService
+	aiService          *services.AIService
+
+	// Closed when the background jobs have stopped
+	jobs []<-chan struct{}
+	// Set once shutdown has begun; readiness then fails
+	draining atomic.Bool
+}
+
+// NewServer wires up the API. Background jobs don't run until StartJobs is
+// called.
+func NewServer(deps Deps) (*Server, error) {
+	cfg := deps.Config
+	db := deps.DB
+
+	// Initialize repositories
+	userRepo := repository.NewUserRepository(db)
+	productRepo := repository.NewProductRepository(db)
+	categoryRepo := repository.NewCategoryRepository(db)
+	cartRepo := repository.NewCartRepository(db)
+	recipeRepo := repository.NewRecipeRepository(db)
+	orderRepo := repository.NewOrderRepository(db)
+	reservationRepo := repository.NewReservationRepository(db)
+	aiCacheRepo := repository.NewAICacheRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	userTokenRepo := repository.NewUserTokenRepository(db)
+	rolePermRepo := repository.NewRolePermissionRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	promotionRepo := repository.NewPromotionRepository(db)
+
+	// Mail delivery for verification and password reset links
+	mail := deps.Mailer
+	if mail == nil {
+		var err error
+		mail, err = mailer.New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize mailer: %v", err)
+		}
+	}
+
+	// Initialize services
+	userService := services.NewUserService(userRepo, cartRepo, sessionRepo, cfg)
+	accountService := services.NewAccountService(userRepo, userTokenRepo, userService, mail, cfg)
+	userService.OnRegister(accountService.SendVerificationEmail)
+	permissionService := services.NewPermissionService(rolePermRepo)
+	auditService := services.NewAuditService(auditRepo, userRepo, productRepo, categoryRepo, recipeRepo, orderRepo, rolePermRepo, promotionRepo)
+	productService := services.NewProductService(productRepo, categoryRepo, auditService)
+	cartService := services.NewCartService(cartRepo, productRepo, promotionRepo)
+	recipeService := services.NewRecipeService(recipeRepo, productRepo, cartRepo, promotionRepo)
+	reservationService := services.NewReservationService(reservationRepo, cartRepo, productRepo, cfg)
+	orderService := services.NewOrderService(orderRepo, cartRepo, productRepo, promotionRepo, reservationService)
+	promotionService := services.NewPromotionService(promotionRepo, productRepo, categoryRepo)
+	aiService, err := services.NewAIService(productRepo, recipeRepo, aiCacheRepo, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize AI service: %v", err)
+	}
+	// Cached AI replies are tied to the catalog they were generated from
+	productService.OnChange(aiService.InvalidateCache)
+
+	// Initialize handlers
+	userHandler := handlers.NewUserHandler(userService, permissionService)
+	accountHandler := handlers.NewAccountHandler(accountService)
+	productHandler := handlers.NewProductHandler(productService)
+	cartHandler := handlers.NewCartHandler(cartService, reservationService)
+	recipeHandler := handlers.NewRecipeHandler(recipeService)
+	aiHandler := handlers.NewAIHandler(aiService, cartService)
+	orderHandler := handlers.NewOrderHandler(orderService, permissionService)
+	permissionHandler := handlers.NewPermissionHandler(permissionService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	promotionHandler := handlers.NewPromotionHandler(promotionService)
+
+	// Initialize middleware
+	authMiddleware := middleware.NewAuthMiddleware(cfg, userService, permissionService)
+	auditMiddleware := middleware.NewAuditMiddleware(auditService)
+
+	srv := &Server{
+		config:             cfg,
+		db:                 db,
+		reservationService: reservationService,
+		productService:     productService,
+		accountService:     accountService,
+		aiService:          aiService,
+	}
+
+	// Setup Gin router
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.RequestLogger(), middleware.Recovery(), middleware.CORSMiddleware())
+
+	// API v1
+	v1 := router.Group("/api/v1")
+	{
+		// Health check
+		v1.GET("/health", func(c *gin.Context) {
+			c.JSON(200, gin.H{"status": "ok", "message": "Smart Food Store API is running"})
+		})
+		// Probes: live while the process serves requests, ready while the
+		// database answers and the server isn't shutting down
+		v1.GET("/health/live", srv.live)
+		v1.GET("/health/ready", srv.ready)
+
+		// Auth routes (public)
+		auth := v1.Group("/auth")
+		{
+			auth.POST("/register", userHandler.Register)
+			auth.POST("/login", userHandler.Login)
+			auth.POST("/refresh", userHandler.Refresh)
+			auth.POST("/verify-email", accountHandler.VerifyEmail)
+			auth.POST("/verify-email/resend", accountHandler.ResendVerification)
+			auth.POST("/forgot-password", accountHandler.ForgotPassword)
+			auth.POST("/reset-password", accountHandler.ResetPassword)
+		}
+
+		// Products routes (public)
+		products := v1.Group("/products")
+		{
+			products.GET("", productHandler.GetAllProducts)
+			products.GET("/:id", productHandler.GetProductByID)
+			products.GET("/category/:category_id", productHandler.GetProductsByCategory)
+			products.GET("/search", productHandler.SearchProducts)
+			products.GET("/barcode/:code", productHandler.GetProductByBarcode)
+			products.GET("/:id/price-history", productHandler.GetProductPriceHistory)
+		}
+
+		// Categories routes (public)
+		categories := v1.Group("/categories")
+		{
+			categories.GET("", productHandler.GetAllCategories)
+		}
+
+		// Recipes routes (public read)
+		recipes := v1.Group("/recipes")
+		{
+			recipes.GET("", recipeHandler.GetAllRecipes)
+			recipes.GET("/:id", recipeHandler.GetRecipeByID)
+			recipes.GET("/search", recipeHandler.SearchRecipes)
+			recipes.GET("/:id/calculate", recipeHandler.CalculateIngredients)
+		}
+
+		// AI routes (public for dish-to-ingredients)
+		ai := v1.Group("/ai")
+		{
+			ai.POST("/dish-to-ingredients", aiHandler.GetIngredientsForDish)
+			ai.POST("/products-to-recipes", aiHandler.GetRecipesFromProducts)
+		}
+
+		// Protected routes (requires authentication)
+		protected := v1.Group("")
+		protected.Use(authMiddleware.AuthRequired())
+		{
+			// Sessions
+			protected.POST("/auth/logout", userHandler.Logout)
+			protected.POST("/auth/logout-all", userHandler.LogoutAll)
+
+			// User profile
+			users := protected.Group("/users")
+			{
+				users.GET("/me", userHandler.GetProfile)
+			}
+
+			// Cart routes
+			cart := protected.Group("/cart")
+			{
+				cart.GET("", cartHandler.GetCart)
+				cart.POST("/items", cartHandler.AddItem)
+				cart.POST("/items/bulk", cartHandler.AddMultipleItems)
+				cart.PUT("/items/:product_id", cartHandler.UpdateItemQuantity)
+				cart.DELETE("/items/:product_id", cartHandler.RemoveItem)
+				cart.DELETE("", cartHandler.ClearCart)
+				cart.POST("/coupon", cartHandler.ApplyCoupon)
+				cart.DELETE("/coupon", cartHandler.RemoveCoupon)
+				cart.POST("/reserve", cartHandler.ReserveStock)
+				cart.DELETE("/reserve", cartHandler.ReleaseStock)
+			}
+
+			// Orders
+			orders := protected.Group("/orders")
+			{
+				orders.POST("", orderHandler.Checkout)
+				orders.GET("", orderHandler.GetOrders)
+				orders.GET("/:id", orderHandler.GetOrderByID)
+			}
+
+			// Recipe - add to cart
+			protected.POST("/recipes/:id/add-to-cart", recipeHandler.AddRecipeToCart)
+
+			// AI - cart based suggestions
+			protected.GET("/ai/cart-to-recipes", aiHandler.GetRecipesFromCart)
+			protected.POST("/ai/add-to-cart", aiHandler.AddAISuggestionToCart)
+
+			// AI - save a suggestion as a recipe (pending admin review)
+			protected.POST("/ai/suggestions/save", recipeHandler.SaveAISuggestion)
+		}
+
+		// Admin routes (admin or a staff role with the matching permission).
+		// Every write is recorded in the audit log.
+		admin := v1.Group("/admin")
+		admin.Use(authMiddleware.AuthRequired())
+		{
+			can := authMiddleware.RequirePermission
+			track := auditMiddleware.Track
+
+			// User management
+			admin.GET("/users", can(models.PermUsersRead), userHandler.GetAllUsers)
+			admin.GET("/users/:id", can(models.PermUsersRead), userHandler.GetUserByID)
+			admin.PATCH("/users/:id/role", can(models.PermRolesManage), track("user.role_update", models.AuditEntityUser), userHandler.UpdateUserRole)
+			admin.DELETE("/users/:id", can(models.PermUsersWrite), track("user.delete", models.AuditEntityUser), userHandler.DeleteUser)
+
+			// Roles and permissions
+			admin.GET("/roles", can(models.PermRolesManage), permissionHandler.GetRoles)
+			admin.GET("/permissions", can(models.PermRolesManage), permissionHandler.GetPermissions)
+			admin.PUT("/roles/:role/permissions", can(models.PermRolesManage), track("role.permissions_update", models.AuditEntityRole), permissionHandler.UpdateRolePermissions)
+
+			// Product management
+			admin.POST("/products", can(models.PermProductsWrite), track("product.create", models.AuditEntityProduct), productHandler.CreateProduct)
+			admin.PUT("/products/:id", can(models.PermProductsWrite), track("product.update", models.AuditEntityProduct), productHandler.UpdateProduct)
+			admin.DELETE("/products/:id", can(models.PermProductsWrite), track("product.delete", models.AuditEntityProduct), productHandler.DeleteProduct)
+			// Audited per product by the import itself
+			admin.POST("/products/import", can(models.PermProductsWrite), productHandler.ImportProducts)
+			admin.GET("/products/export", can(models.PermProductsWrite), productHandler.ExportProducts)
+			admin.PATCH("/products/:id/stock", can(models.PermInventoryWrite), track("product.stock_update", models.AuditEntityProduct), productHandler.UpdateProductStock)
+			admin.POST("/products/:id/variants", can(models.PermProductsWrite), track("product.variant_create", models.AuditEntityProduct), productHandler.CreateProductVariant)
+			admin.PUT("/products/:id/variants/:variant_id", can(models.PermProductsWrite), track("product.variant_update", models.AuditEntityProduct), productHandler.UpdateProductVariant)
+			admin.DELETE("/products/:id/variants/:variant_id", can(models.PermProductsWrite), track("product.variant_delete", models.AuditEntityProduct), productHandler.DeleteProductVariant)
+			admin.GET("/products/:id/scheduled-prices", can(models.PermProductsWrite), productHandler.GetScheduledPrices)
+			admin.POST("/products/:id/scheduled-prices", can(models.PermProductsWrite), track("product.price_schedule", models.AuditEntityProduct), productHandler.SchedulePrice)
+			admin.DELETE("/products/:id/scheduled-prices/:schedule_id", can(models.PermProductsWrite), track("product.price_schedule_cancel", models.AuditEntityProduct), productHandler.CancelScheduledPrice)
+
+			// Category management
+			admin.POST("/categories", can(models.PermCategoriesWrite), track("category.create", models.AuditEntityCategory), productHandler.CreateCategory)
+			admin.PUT("/categories/:id", can(models.PermCategoriesWrite), track("category.update", models.AuditEntityCategory), productHandler.UpdateCategory)
+			admin.DELETE("/categories/:id", can(models.PermCategoriesWrite), track("category.delete", models.AuditEntityCategory), productHandler.DeleteCategory)
+
+			// Recipe management
+			admin.GET("/recipes", can(models.PermRecipesReview), recipeHandler.GetRecipesForReview)
+			admin.POST("/recipes", can(models.PermRecipesWrite), track("recipe.create", models.AuditEntityRecipe), recipeHandler.CreateRecipe)
+			admin.PUT("/recipes/:id", can(models.PermRecipesWrite), track("recipe.update", models.AuditEntityRecipe), recipeHandler.UpdateRecipe)
+			admin.DELETE("/recipes/:id", can(models.PermRecipesWrite), track("recipe.delete", models.AuditEntityRecipe), recipeHandler.DeleteRecipe)
+			admin.POST("/recipes/:id/approve", can(models.PermRecipesReview), track("recipe.approve", models.AuditEntityRecipe), recipeHandler.ApproveRecipe)
+			admin.POST("/recipes/:id/reject", can(models.PermRecipesReview), track("recipe.reject", models.AuditEntityRecipe), recipeHandler.RejectRecipe)
+
+			// Order management (refunds additionally need orders:refund)
+			admin.GET("/orders", can(models.PermOrdersRead), orderHandler.GetAllOrders)
+			admin.GET("/orders/:id", can(models.PermOrdersRead), orderHandler.GetAnyOrderByID)
+			admin.PATCH("/orders/:id/status", can(models.PermOrdersUpdate), track("order.status_update", models.AuditEntityOrder), orderHandler.UpdateOrderStatus)
+
+			// Promotions and coupons
+			admin.GET("/promotions", can(models.PermPromotionsWrite), promotionHandler.GetAllPromotions)
+			admin.GET("/promotions/:id", can(models.PermPromotionsWrite), promotionHandler.GetPromotionByID)
+			admin.POST("/promotions", can(models.PermPromotionsWrite), track("promotion.create", models.AuditEntityPromotion), promotionHandler.CreatePromotion)
+			admin.PUT("/promotions/:id", can(models.PermPromotionsWrite), track("promotion.update", models.AuditEntityPromotion), promotionHandler.UpdatePromotion)
+			admin.DELETE("/promotions/:id", can(models.PermPromotionsWrite), track("promotion.delete", models.AuditEntityPromotion), promotionHandler.DeletePromotion)
+
+			// Audit log
+			admin.GET("/audit", can(models.PermAuditRead), auditHandler.GetAuditLog)
+		}
+	}
+
+	srv.router = router
+	return srv, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// StartJobs starts the background jobs; they stop when ctx is done
+func (s *Server) StartJobs(ctx context.Context) {
+	cfg := s.config
+
+	// Release expired stock holds in the background
+	sweepInterval := duration(cfg.StockSweepInterval, time.Minute)
+	s.jobs = append(s.jobs, s.reservationService.StartSweeper(ctx, sweepInterval))
+
+	// Apply scheduled price changes in the background
+	priceInterval := duration(cfg.PriceScheduleInterval, time.Minute)
+	s.jobs = append(s.jobs, s.productService.StartPriceScheduler(ctx, priceInterval))
+}
+
+// Close waits for the background jobs to stop (cancel their context first)
+// and for verification emails still being sent, then releases the resources
+// held by the services. The database isn't closed; it belongs to the caller.
+func (s *Server) Close() error {
+	for _, done := range s.jobs {
+		<-done
+	}
+	s.accountService.Wait()
+	return s.aiService.Close()
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/mailer"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidAccountToken is returned for verification and reset links that
+// are malformed, forged, expired or already used
+var ErrInvalidAccountToken = errors.New("invalid or expired token")
+
+// A new link is not sent if the previous one is younger than this
+const accountTokenResendInterval = time.Minute
+
+// AccountService drives the email verification and password reset flows
+type AccountService struct {
+	userRepo    repository.UserStore
+	tokenRepo   repository.UserTokenStore
+	userService *UserService
+	mailer      mailer.Mailer
+	config      *config.Config
+
+	// Verification emails still being sent
+	background sync.WaitGroup
+}
+
+func NewAccountService(userRepo repository.UserStore, tokenRepo repository.UserTokenStore, userService *UserService, m mailer.Mailer, cfg *config.Config) *AccountService {
+	return &AccountService{
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		userService: userService,
+		mailer:      m,
+		config:      cfg,
+	}
+}
+
+// SendVerificationEmail mails a verification link to a new user in the
+// background, so a slow mail server doesn't hold up signup. Errors are
+// logged: registration has already succeeded and the user can ask again.
+func (s *AccountService) SendVerificationEmail(ctx context.Context, user *models.User) {
+	ctx = context.WithoutCancel(ctx)
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		if err := s.sendVerification(ctx, user); err != nil {
+			slog.WarnContext(ctx, "Failed to send verification email", "user_id", user.ID, "error", err)
+		}
+	}()
+}
+
+// Wait blocks until the emails sent in the background have gone out
+func (s *AccountService) Wait() {
+	s.background.Wait()
+}
+
+// ResendVerification sends a new verification link. Unknown or already
+// verified addresses are ignored so the endpoint can't be used to probe
+// which emails have accounts.
+func (s *AccountService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || user.EmailVerified {
+		return nil
+	}
+	if s.recentlySent(ctx, user.ID, models.TokenPurposeVerifyEmail) {
+		return nil
+	}
+	return s.sendVerification(ctx, user)
+}
+
+// VerifyEmail redeems a verification link
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	return s.redeem(ctx, token, models.TokenPurposeVerifyEmail, func(tx *gorm.DB, userID uint) error {
+		return s.userRepo.WithTx(tx).MarkEmailVerified(ctx, userID, time.Now())
+	})
+}
+
+// ForgotPassword mails a password reset link if the address has an account.
+// Like ResendVerification it reports success either way.
+func (s *AccountService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+	if s.recentlySent(ctx, user.ID, models.TokenPurposeResetPassword) {
+		return nil
+	}
+
+	token, err := s.issue(ctx, user.ID, models.TokenPurposeResetPassword, s.ttl(s.config.PasswordResetTTL, time.Hour))
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Smart Food Store password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. Open this link to choose a new one:\n\n%s\n\n"+
+			"The link works once and expires in %s. If you didn't ask for this, ignore this email.\n",
+			user.Name, s.link("/reset-password", token), s.ttl(s.config.PasswordResetTTL, time.Hour)),
+	})
+}
+
+// ResetPassword redeems a reset link, sets the new password and signs the
+// user out everywhere
+func (s *AccountService) ResetPassword(ctx context.Context, token, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.New("failed to hash password")
+	}
+
+	var userID uint
+	err = s.redeem(ctx, token, models.TokenPurposeResetPassword, func(tx *gorm.DB, id uint) error {
+		userID = id
+		return s.userRepo.WithTx(tx).UpdatePassword(ctx, id, string(hashedPassword))
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.userService.LogoutAll(ctx, userID)
+}
+
+func (s *AccountService) sendVerification(ctx context.Context, user *models.User) error {
+	token, err := s.issue(ctx, user.ID, models.TokenPurposeVerifyEmail, s.ttl(s.config.EmailVerificationTTL, 24*time.Hour))
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Smart Food Store email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n",
+			user.Name, s.link("/verify-email", token), s.ttl(s.config.EmailVerificationTTL, 24*time.Hour)),
+	})
+}
+
+// issue stores a new single-use token and returns its signed form
+func (s *AccountService) issue(ctx context.Context, userID uint, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	now := time.Now()
+	if err := s.tokenRepo.DeleteExpiredForUser(ctx, userID, purpose, now); err != nil {
+		return "", errors.New("failed to create token")
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.New("failed to create token")
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+
+	record := &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.tokenRepo.Create(ctx, record); err != nil {
+		return "", errors.New("failed to create token")
+	}
+
+	return raw + "." + s.sign(purpose, raw), nil
+}
+
+// redeem checks the signature, then consumes the token and runs apply in
+// the same transaction. All outstanding tokens of the same purpose are
+// consumed, so older links stop working too.
+func (s *AccountService) redeem(ctx context.Context, token string, purpose models.TokenPurpose, apply func(tx *gorm.DB, userID uint) error) error {
+	raw, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(purpose, raw))) {
+		return ErrInvalidAccountToken
+	}
+
+	err := s.tokenRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		tokenRepo := s.tokenRepo.WithTx(tx)
+
+		record, err := tokenRepo.GetByHashForUpdate(ctx, hashToken(raw), purpose)
+		if err != nil {
+			return ErrInvalidAccountToken
+		}
+		now := time.Now()
+		if record.UsedAt != nil || !record.ExpiresAt.After(now) {
+			return ErrInvalidAccountToken
+		}
+
+		if err := tokenRepo.MarkAllUsed(ctx, record.UserID, purpose, now); err != nil {
+			return err
+		}
+		return apply(tx, record.UserID)
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidAccountToken) {
+			return err
+		}
+		return errors.New("failed to redeem token")
+	}
+	return nil
+}
+
+// sign binds a token to its purpose, so a verification link can't be used
+// as a reset link and forged tokens are rejected before touching the database
+func (s *AccountService) sign(purpose models.TokenPurpose, raw string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.JWTSecret))
+	mac.Write([]byte(string(purpose) + ":" + raw))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *AccountService) recentlySent(ctx context.Context, userID uint, purpose models.TokenPurpose) bool {
+	latest, err := s.tokenRepo.GetLatest(ctx, userID, purpose)
+	return err == nil && time.Since(latest.CreatedAt) < accountTokenResendInterval
+}
+
+// send mails msg. A request that is cancelled once the mail is on its way
+// doesn't cut the delivery short.
+func (s *AccountService) send(ctx context.Context, msg mailer.Message) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	return s.mailer.Send(ctx, msg)
+}
+
+func (s *AccountService) link(path, token string) string {
+	return strings.TrimSuffix(s.config.AppBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func (s *AccountService) ttl(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+)
+
+// AICache stores validated AI replies so identical requests against the same
+// catalog don't pay for another model round trip.
+type AICache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte)
+	// Purge drops every entry; called whenever the catalog changes
+	Purge(ctx context.Context)
+}
+
+// NewAICache builds the cache selected by cfg.AICacheBackend: "memory"
+// (default), "postgres" or "none".
+func NewAICache(cfg *config.Config, cacheRepo repository.AICacheStore) (AICache, error) {
+	ttl, err := time.ParseDuration(cfg.AICacheTTL)
+	if err != nil || ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	size, err := strconv.Atoi(cfg.AICacheSize)
+	if err != nil || size <= 0 {
+		size = 1000
+	}
+
+	switch cfg.AICacheBackend {
+	case "", "memory":
+		return NewMemoryAICache(size, ttl), nil
+	case "postgres":
+		return NewDBAICache(cacheRepo, ttl), nil
+	case "none":
+		return noopAICache{}, nil
+	default:
+		return nil, fmt.Errorf("unknown AI cache backend %q", cfg.AICacheBackend)
+	}
+}
+
+// aiCacheKey hashes the parts a cached reply depends on
+func aiCacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// catalogKey is the part of a cache key standing for the products in a
+// prompt: their IDs, names and prices. Stock is left out, since it changes
+// with every order and would make each cached reply single-use.
+func catalogKey(products []models.Product) string {
+	lines := make([]string, len(products))
+	for i, p := range products {
+		lines[i] = fmt.Sprintf("%d\x00%s\x00%.2f", p.ID, p.Name, p.Price)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// generateCached is generateStructured behind the cache. Only replies that
+// passed validation are stored, before any enrichment with live data.
+func (s *AIService) generateCached(ctx context.Context, key string, prompt string, schema *jsonSchema, out interface{}) error {
+	if cached, ok := s.cache.Get(ctx, key); ok {
+		if err := json.Unmarshal(cached, out); err == nil {
+			return nil
+		}
+	}
+
+	if err := s.generateStructured(ctx, prompt, schema, out); err != nil {
+		return err
+	}
+
+	if data, err := json.Marshal(out); err == nil {
+		s.cache.Set(ctx, key, data)
+	}
+	return nil
+}
+
+// InvalidateCache drops all cached AI replies
+func (s *AIService) InvalidateCache(ctx context.Context) {
+	s.cache.Purge(ctx)
+}
+
+// MemoryAICache is a size-bounded LRU with a per-entry TTL
+type MemoryAICache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front = most recently used
+	entries map[string]*list.Element
+}
+
+type memoryAICacheEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewMemoryAICache(size int, ttl time.Duration) *MemoryAICache {
+	return &MemoryAICache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryAICache) Get(ctx context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*memoryAICacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *MemoryAICache) Set(ctx context.Context, key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*memoryAICacheEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryAICacheEntry{key: key, value: value, expiresAt: expiresAt})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryAICacheEntry).key)
+	}
+}
+
+func (c *MemoryAICache) Purge(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// DBAICache keeps entries in the ai_cache_entries table so they survive
+// restarts and are shared between instances
+type DBAICache struct {
+	cacheRepo repository.AICacheStore
+	ttl       time.Duration
+}
+
+func NewDBAICache(cacheRepo repository.AICacheStore, ttl time.Duration) *DBAICache {
+	return &DBAICache{cacheRepo: cacheRepo, ttl: ttl}
+}
+
+func (c *DBAICache) Get(ctx context.Context, key string) ([]byte, bool) {
+	entry, err := c.cacheRepo.Get(ctx, key, time.Now())
+	if err != nil {
+		return nil, false
+	}
+	return []byte(entry.Value), true
+}
+
+// Set stores value and drops expired rows. Cache write failures are logged
+// and otherwise ignored: the reply has already been computed.
+func (c *DBAICache) Set(ctx context.Context, key string, value []byte) {
+	now := time.Now()
+	entry := &models.AICacheEntry{
+		Key:       key,
+		Value:     string(value),
+		ExpiresAt: now.Add(c.ttl),
+	}
+	if err := c.cacheRepo.Upsert(ctx, entry); err != nil {
+		slog.WarnContext(ctx, "Failed to write AI cache entry", "error", err)
+		return
+	}
+	if err := c.cacheRepo.DeleteExpired(ctx, now); err != nil {
+		slog.WarnContext(ctx, "Failed to delete expired AI cache entries", "error", err)
+	}
+}
+
+func (c *DBAICache) Purge(ctx context.Context) {
+	if err := c.cacheRepo.DeleteAll(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to purge AI cache", "error", err)
+	}
+}
+
+type noopAICache struct{}
+
+func (noopAICache) Get(context.Context, string) ([]byte, bool) { return nil, false }
+func (noopAICache) Set(context.Context, string, []byte)        {}
+func (noopAICache) Purge(context.Context)                      {}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func TestCatalogKey(t *testing.T) {
+	catalog := func(edit func(p *models.Product)) string {
+		products := []models.Product{
+			{ID: 1, Name: "Tomatoes", Price: 4, Stock: 12, Unit: models.UnitKilogram},
+			{ID: 2, Name: "Basil", Price: 1.5, Stock: 30, Unit: models.UnitPiece},
+		}
+		edit(&products[0])
+		return catalogKey(products)
+	}
+	base := catalog(func(p *models.Product) {})
+
+	cases := []struct {
+		name string
+		edit func(p *models.Product)
+		same bool
+	}{
+		{"stock sold", func(p *models.Product) { p.Stock = 3 }, true},
+		{"stock restocked", func(p *models.Product) { p.Stock = 500 }, true},
+		{"price", func(p *models.Product) { p.Price = 4.5 }, false},
+		{"name", func(p *models.Product) { p.Name = "Cherry tomatoes" }, false},
+		{"ID", func(p *models.Product) { p.ID = 3 }, false},
+	}
+	for _, tc := range cases {
+		if same := catalog(tc.edit) == base; same != tc.same {
+			t.Errorf("%s: key unchanged = %v, want %v", tc.name, same, tc.same)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidAIResponse is returned when the model keeps replying with JSON
+// that doesn't match the expected shape, even after repair attempts.
+var ErrInvalidAIResponse = errors.New("AI returned an invalid response")
+
+// jsonSchema is a small subset of JSON Schema, enough to describe the
+// replies we ask the model for.
+type jsonSchema struct {
+	Type       string // object, array, string, number, integer, boolean
+	Required   []string
+	Properties map[string]*jsonSchema
+	Items      *jsonSchema
+	MinItems   int
+	Enum       []string
+	Minimum    *float64
+	Maximum    *float64
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+var unitSchema = &jsonSchema{Type: "string", Enum: []string{"g", "kg", "l", "ml", "pcs"}}
+
+var dishIngredientsSchema = &jsonSchema{
+	Type:     "object",
+	Required: []string{"dish_name", "servings", "required_ingredients", "matched_products"},
+	Properties: map[string]*jsonSchema{
+		"dish_name":    {Type: "string"},
+		"description":  {Type: "string"},
+		"servings":     {Type: "integer", Minimum: floatPtr(1)},
+		"cooking_tips": {Type: "string"},
+		"required_ingredients": {
+			Type: "array",
+			Items: &jsonSchema{
+				Type:     "object",
+				Required: []string{"name", "quantity", "unit"},
+				Properties: map[string]*jsonSchema{
+					"name":     {Type: "string"},
+					"quantity": {Type: "number", Minimum: floatPtr(0)},
+					"unit":     unitSchema,
+				},
+			},
+		},
+		"matched_products": {
+			Type: "array",
+			Items: &jsonSchema{
+				Type:     "object",
+				Required: []string{"id"},
+				Properties: map[string]*jsonSchema{
+					"id":   {Type: "integer", Minimum: floatPtr(1)},
+					"name": {Type: "string"},
+				},
+			},
+		},
+	},
+}
+
+var recipeSuggestionsSchema = &jsonSchema{
+	Type:     "array",
+	MinItems: 1,
+	Items: &jsonSchema{
+		Type:     "object",
+		Required: []string{"name", "instructions", "servings", "ingredients"},
+		Properties: map[string]*jsonSchema{
+			"name":         {Type: "string"},
+			"description":  {Type: "string"},
+			"instructions": {Type: "string"},
+			"prep_time":    {Type: "integer", Minimum: floatPtr(0)},
+			"cook_time":    {Type: "integer", Minimum: floatPtr(0)},
+			"servings":     {Type: "integer", Minimum: floatPtr(1)},
+			"confidence":   {Type: "number", Minimum: floatPtr(0), Maximum: floatPtr(1)},
+			"ingredients": {
+				Type:     "array",
+				MinItems: 1,
+				Items: &jsonSchema{
+					Type:     "object",
+					Required: []string{"product_id", "quantity", "unit"},
+					Properties: map[string]*jsonSchema{
+						"product_id":   {Type: "integer", Minimum: floatPtr(1)},
+						"product_name": {Type: "string"},
+						"quantity":     {Type: "number", Minimum: floatPtr(0)},
+						"unit":         unitSchema,
+					},
+				},
+			},
+		},
+	},
+}
+
+// validate checks a decoded JSON value and returns one message per problem
+func (s *jsonSchema) validate(value interface{}, path string) []string {
+	var problems []string
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s must be an object", path)}
+		}
+		for _, key := range s.Required {
+			if _, ok := obj[key]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is required", path, key))
+			}
+		}
+		keys := make([]string, 0, len(s.Properties))
+		for key := range s.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if v, ok := obj[key]; ok && v != nil {
+				problems = append(problems, s.Properties[key].validate(v, path+"."+key)...)
+			}
+		}
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s must be an array", path)}
+		}
+		if len(arr) < s.MinItems {
+			problems = append(problems, fmt.Sprintf("%s must have at least %d item(s)", path, s.MinItems))
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				problems = append(problems, s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be a string", path)}
+		}
+		if len(s.Enum) > 0 && !containsString(s.Enum, str) {
+			problems = append(problems, fmt.Sprintf("%s must be one of %s, got %q", path, strings.Join(s.Enum, ", "), str))
+		}
+
+	case "number", "integer":
+		num, ok := value.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s must be a number", path)}
+		}
+		if s.Type == "integer" && num != math.Trunc(num) {
+			problems = append(problems, fmt.Sprintf("%s must be an integer", path))
+		}
+		if s.Minimum != nil && num < *s.Minimum {
+			problems = append(problems, fmt.Sprintf("%s must be >= %g", path, *s.Minimum))
+		}
+		if s.Maximum != nil && num > *s.Maximum {
+			problems = append(problems, fmt.Sprintf("%s must be <= %g", path, *s.Maximum))
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s must be a boolean", path)}
+		}
+	}
+
+	return problems
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// extractJSON returns the first complete JSON value of type want ("object"
+// or "array"; anything else accepts both) in a model reply, ignoring
+// markdown fences, chatter and values of the other type around it.
+func extractJSON(reply, want string) (string, error) {
+	opens, kind := "{[", "object or array"
+	switch want {
+	case "object":
+		opens, kind = "{", "object"
+	case "array":
+		opens, kind = "[", "array"
+	}
+
+	start := strings.IndexAny(reply, "{[")
+	for start >= 0 {
+		from := start + 1
+		if end := matchingBracket(reply, start); end > 0 {
+			candidate := reply[start : end+1]
+			if json.Valid([]byte(candidate)) {
+				if strings.IndexByte(opens, reply[start]) >= 0 {
+					return candidate, nil
+				}
+				// Don't look inside a value of the wrong type
+				from = end + 1
+			}
+		}
+		next := strings.IndexAny(reply[from:], "{[")
+		if next < 0 {
+			break
+		}
+		start = from + next
+	}
+	return "", fmt.Errorf("no JSON %s found in reply", kind)
+}
+
+// matchingBracket returns the index of the bracket closing the one at start,
+// skipping over string literals, or -1 if it is never closed.
+func matchingBracket(s string, start int) int {
+	depth := 0
+	inString := false
+	escaped := false
+
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// generateStructured asks the model for JSON matching schema and decodes it
+// into out. Replies that can't be parsed or don't validate are sent back to
+// the model together with the problems found, up to maxRepairs times.
+func (s *AIService) generateStructured(ctx context.Context, prompt string, schema *jsonSchema, out interface{}) error {
+	currentPrompt := prompt
+	var problems []string
+
+	for attempt := 0; attempt <= s.maxRepairs; attempt++ {
+		reply, err := s.generate(ctx, currentPrompt, attempt)
+		if err != nil {
+			return err
+		}
+
+		problems = checkStructuredReply(reply, schema, out)
+		if len(problems) == 0 {
+			return nil
+		}
+
+		currentPrompt = fmt.Sprintf(`%s
+
+Your previous reply was:
+%s
+
+It was rejected because:
+- %s
+
+Reply again with ONLY the corrected JSON.`, prompt, truncate(reply, 2000), strings.Join(problems, "\n- "))
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidAIResponse, strings.Join(problems, "; "))
+}
+
+// generate calls the model and logs how the call went
+func (s *AIService) generate(ctx context.Context, prompt string, attempt int) (string, error) {
+	start := time.Now()
+	reply, err := s.provider.Generate(ctx, prompt)
+	attrs := []slog.Attr{
+		slog.String("provider", s.provider.Name()),
+		slog.Int("attempt", attempt),
+		slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+	}
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelError, "LLM call failed", append(attrs, slog.String("error", err.Error()))...)
+		return "", err
+	}
+	slog.LogAttrs(ctx, slog.LevelInfo, "LLM call", append(attrs, slog.Int("reply_bytes", len(reply)))...)
+	return reply, nil
+}
+
+// checkStructuredReply extracts, validates and decodes a reply, returning
+// the problems found (none on success)
+func checkStructuredReply(reply string, schema *jsonSchema, out interface{}) []string {
+	raw, err := extractJSON(reply, schema.Type)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+
+	if problems := schema.validate(decoded, "$"); len(problems) > 0 {
+		return problems
+	}
+
+	if err := json.Unmarshal([]byte(raw), out); err != nil {
+		return []string{fmt.Sprintf("unexpected JSON shape: %v", err)}
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes, without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
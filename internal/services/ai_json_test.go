@@ -0,0 +1,63 @@
+package services
+
+import "testing"
+
+func TestExtractJSON(t *testing.T) {
+	cases := []struct {
+		name  string
+		reply string
+		want  string // type asked for: "object", "array" or "" for either
+		json  string // empty when no JSON should be found
+	}{
+		{"bare object", `{"a": 1}`, "object", `{"a": 1}`},
+		{"fenced", "```json\n{\"a\": [1, 2]}\n```", "object", `{"a": [1, 2]}`},
+		{"fenced without language", "```\n[1, 2]\n```", "array", `[1, 2]`},
+		{"prose around", `Sure! Here it is: {"a": 1} Enjoy your meal.`, "object", `{"a": 1}`},
+		{"braces in strings", `{"tip": "use {curly} and [square] brackets \"}\""}`, "object", `{"tip": "use {curly} and [square] brackets \"}\""}`},
+		{"escaped backslash before quote", `{"path": "C:\\"} trailing }`, "object", `{"path": "C:\\"}`},
+		{"bracket in prose before the JSON", `Step [1]: {"a": 1}`, "object", `{"a": 1}`},
+		{"array skipped for object", `[{"a": 1}] then {"b": 2}`, "object", `{"b": 2}`},
+		{"object skipped for array", `{"items": [1]} then [2]`, "array", `[2]`},
+		{"either type", `text [1] text`, "", `[1]`},
+		{"invalid candidate skipped", `{not json} {"a": 1}`, "object", `{"a": 1}`},
+		{"truncated", `{"a": [1, 2`, "object", ""},
+		{"truncated inside a string", `{"a": "unterminated }`, "object", ""},
+		{"wrong type only", `[1, 2]`, "object", ""},
+		{"no JSON", "I can't help with that.", "object", ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := extractJSON(tc.reply, tc.want)
+			switch {
+			case tc.json == "" && err == nil:
+				t.Errorf("extractJSON(%q) = %q, want an error", tc.reply, got)
+			case tc.json != "" && (err != nil || got != tc.json):
+				t.Errorf("extractJSON(%q) = %q, %v, want %q", tc.reply, got, err, tc.json)
+			}
+		})
+	}
+}
+
+func TestMatchingBracket(t *testing.T) {
+	cases := []struct {
+		s     string
+		start int
+		want  int
+	}{
+		{`{}`, 0, 1},
+		{`{"a": {"b": []}}`, 0, 15},
+		{`{"a": {"b": []}}`, 6, 14},
+		{`{"a": "}"}`, 0, 9},
+		{`{"a": "\"}"}`, 0, 11},
+		{`{"a": "\\"}`, 0, 10},
+		{`{"a": [1, 2]`, 0, -1},
+		{`{"a": "}`, 0, -1},
+	}
+
+	for _, tc := range cases {
+		if got := matchingBracket(tc.s, tc.start); got != tc.want {
+			t.Errorf("matchingBracket(%q, %d) = %d, want %d", tc.s, tc.start, got, tc.want)
+		}
+	}
+}
@@ -1,139 +1,64 @@
 package services
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bexiiiii/smart_food_store/internal/config"
 	"github.com/bexiiiii/smart_food_store/internal/models"
 	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"github.com/bexiiiii/smart_food_store/internal/units"
 )
 
 type AIService struct {
-	productRepo *repository.ProductRepository
-	recipeRepo  *repository.RecipeRepository
+	productRepo repository.ProductStore
+	recipeRepo  repository.RecipeStore
 	config      *config.Config
-	apiKey      string
+	provider    LLMProvider
+	maxRepairs  int
+	cache       AICache
 }
 
-// Gemini REST API structures
-type GeminiRequest struct {
-	Contents         []GeminiContent        `json:"contents"`
-	GenerationConfig GeminiGenerationConfig `json:"generationConfig,omitempty"`
-}
-
-type GeminiContent struct {
-	Parts []GeminiPart `json:"parts"`
-}
-
-type GeminiPart struct {
-	Text string `json:"text"`
-}
-
-type GeminiGenerationConfig struct {
-	Temperature float64 `json:"temperature,omitempty"`
-}
-
-type GeminiResponse struct {
-	Candidates []struct {
-		Content struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
-		} `json:"content"`
-	} `json:"candidates"`
-	Error *struct {
-		Message string `json:"message"`
-		Code    int    `json:"code"`
-	} `json:"error,omitempty"`
-}
-
-func NewAIService(productRepo *repository.ProductRepository, recipeRepo *repository.RecipeRepository, cfg *config.Config) (*AIService, error) {
-	return &AIService{
-		productRepo: productRepo,
-		recipeRepo:  recipeRepo,
-		config:      cfg,
-		apiKey:      cfg.GeminiAPIKey,
-	}, nil
-}
-
-// callGeminiAPI - вызов Gemini REST API напрямую
-func (s *AIService) callGeminiAPI(ctx context.Context, prompt string) (string, error) {
-	if s.apiKey == "" || s.apiKey == "your-gemini-api-key-here" {
-		return "", errors.New("Gemini API not configured. Please set GEMINI_API_KEY in .env file")
-	}
-
-
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models/gemini-2.5-flash:generateContent?key=%s", s.apiKey)
-
-	reqBody := GeminiRequest{
-		Contents: []GeminiContent{
-			{
-				Parts: []GeminiPart{
-					{Text: prompt},
-				},
-			},
-		},
-		GenerationConfig: GeminiGenerationConfig{
-			Temperature: 0.7,
-		},
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+func NewAIService(productRepo repository.ProductStore, recipeRepo repository.RecipeStore, cacheRepo repository.AICacheStore, cfg *config.Config) (*AIService, error) {
+	provider, err := NewLLMProvider(cfg)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to call Gemini API: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	cache, err := NewAICache(cfg, cacheRepo)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %v", err)
-	}
-
-	var geminiResp GeminiResponse
-	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %v (body: %s)", err, string(body))
-	}
-
-	if geminiResp.Error != nil {
-		return "", fmt.Errorf("Gemini API error: %s (code: %d)", geminiResp.Error.Message, geminiResp.Error.Code)
+		return nil, err
 	}
 
-	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", errors.New("empty response from Gemini API")
+	maxRepairs, err := strconv.Atoi(cfg.AIMaxRepairAttempts)
+	if err != nil || maxRepairs < 0 {
+		maxRepairs = 2
 	}
 
-	return geminiResp.Candidates[0].Content.Parts[0].Text, nil
+	return &AIService{
+		productRepo: productRepo,
+		recipeRepo:  recipeRepo,
+		config:      cfg,
+		provider:    provider,
+		maxRepairs:  maxRepairs,
+		cache:       cache,
+	}, nil
 }
 
 // GetIngredientsForDish - вводишь название блюда, AI подбирает продукты из магазина
 func (s *AIService) GetIngredientsForDish(ctx context.Context, dishName string, servings int) (*models.DishIngredientsResponse, error) {
 	// Get all available products from store
-	products, err := s.productRepo.GetAllWithStock()
+	products, err := s.productRepo.GetAllWithStock(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get products: %v", err)
 	}
 
 	// Build product list for AI
-	productList := s.buildProductListString(products)
+	productList := s.buildProductListString(ctx, products)
 
 	prompt := fmt.Sprintf(`You are a cooking assistant for a food store. A user wants to make "%s" for %d servings.
 
@@ -162,23 +87,18 @@ Important rules:
 5. Units: "g", "kg", "l", "ml", "pcs"
 6. Return ONLY valid JSON, no markdown code blocks`, dishName, servings, productList, dishName, servings)
 
-	responseText, err := s.callGeminiAPI(ctx, prompt)
-	if err != nil {
-		return nil, err
-	}
+	key := aiCacheKey("dish-to-ingredients", s.provider.Name(), models.NormalizeRecipeName(dishName), strconv.Itoa(servings), catalogKey(products))
 
-	// Parse JSON response
 	var response models.DishIngredientsResponse
-	cleanedResponse := s.cleanJSONResponse(responseText)
-	if err := json.Unmarshal([]byte(cleanedResponse), &response); err != nil {
-		return nil, fmt.Errorf("failed to parse AI response: %v (response: %s)", err, cleanedResponse[:min(200, len(cleanedResponse))])
+	if err := s.generateCached(ctx, key, prompt, dishIngredientsSchema, &response); err != nil {
+		return nil, err
 	}
 
 	// Verify and enrich matched products with real data
 	var validProducts []models.MatchedProduct
 	var totalPrice float64
 	for _, mp := range response.MatchedProducts {
-		product, err := s.productRepo.GetByID(mp.ID)
+		product, err := s.productRepo.GetByID(ctx, mp.ID)
 		if err == nil && product != nil {
 			validProducts = append(validProducts, models.MatchedProduct{
 				ID:    product.ID,
@@ -198,7 +118,7 @@ Important rules:
 // GetRecipesFromCart - на основе продуктов в корзине AI предлагает что можно приготовить
 func (s *AIService) GetRecipesFromCart(ctx context.Context, productIDs []uint) ([]models.AIRecipeSuggestion, error) {
 	// Get products from cart
-	products, err := s.productRepo.GetByIDs(productIDs)
+	products, err := s.productRepo.GetByIDs(ctx, productIDs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get products: %v", err)
 	}
@@ -210,8 +130,9 @@ func (s *AIService) GetRecipesFromCart(ctx context.Context, productIDs []uint) (
 	// Build product list
 	var productNames []string
 	productMap := make(map[uint]models.Product)
+	trends := s.priceTrends(ctx, products)
 	for _, p := range products {
-		productNames = append(productNames, fmt.Sprintf("- %s (ID: %d, Unit: %s, Price: %.2f)", p.Name, p.ID, p.Unit, p.Price))
+		productNames = append(productNames, fmt.Sprintf("- %s (ID: %d, Unit: %s, Price: %.2f%s)", p.Name, p.ID, p.Unit, p.Price, priceTrend(&p, trends)))
 		productMap[p.ID] = p
 	}
 
@@ -247,16 +168,11 @@ Rules:
 4. confidence reflects how complete the recipe is with available ingredients
 5. Return ONLY valid JSON array`, strings.Join(productNames, "\n"))
 
-	responseText, err := s.callGeminiAPI(ctx, prompt)
-	if err != nil {
-		return nil, err
-	}
+	key := aiCacheKey("products-to-recipes", s.provider.Name(), catalogKey(products))
 
-	// Parse JSON response
 	var suggestions []models.AIRecipeSuggestion
-	cleanedResponse := s.cleanJSONResponse(responseText)
-	if err := json.Unmarshal([]byte(cleanedResponse), &suggestions); err != nil {
-		return nil, fmt.Errorf("failed to parse AI response: %v", err)
+	if err := s.generateCached(ctx, key, prompt, recipeSuggestionsSchema, &suggestions); err != nil {
+		return nil, err
 	}
 
 	// Calculate prices
@@ -264,9 +180,14 @@ Rules:
 		suggestions[i].TotalPrice = 0
 		for j := range suggestions[i].Ingredients {
 			if product, ok := productMap[suggestions[i].Ingredients[j].ProductID]; ok {
+				price, err := s.calculatePrice(&product, suggestions[i].Ingredients[j].Quantity, suggestions[i].Ingredients[j].Unit)
+				if err != nil {
+					// The model picked a unit we can't price this product in
+					continue
+				}
 				suggestions[i].Ingredients[j].Available = true
-				suggestions[i].Ingredients[j].Price = s.calculatePrice(&product, suggestions[i].Ingredients[j].Quantity, suggestions[i].Ingredients[j].Unit)
-				suggestions[i].TotalPrice += suggestions[i].Ingredients[j].Price
+				suggestions[i].Ingredients[j].Price = price
+				suggestions[i].TotalPrice += price
 			}
 		}
 	}
@@ -275,28 +196,71 @@ Rules:
 }
 
 // Helper functions
-func (s *AIService) buildProductListString(products []models.Product) string {
+func (s *AIService) buildProductListString(ctx context.Context, products []models.Product) string {
 	var lines []string
+	trends := s.priceTrends(ctx, products)
 	for _, p := range products {
-		lines = append(lines, fmt.Sprintf("- ID: %d, Name: %s, Price: %.2f per %s, Stock: %.0f %s", 
-			p.ID, p.Name, p.Price, p.Unit, p.Stock, p.Unit))
+		lines = append(lines, fmt.Sprintf("- ID: %d, Name: %s, Price: %.2f per %s%s, Stock: %.0f %s", 
+			p.ID, p.Name, p.Price, p.Unit, priceTrend(&p, trends), p.Stock, p.Unit))
 	}
 	return strings.Join(lines, "\n")
 }
 
-func (s *AIService) cleanJSONResponse(response string) string {
-	// Remove markdown code blocks
-	response = strings.TrimSpace(response)
-	response = strings.TrimPrefix(response, "```json")
-	response = strings.TrimPrefix(response, "```")
-	response = strings.TrimSuffix(response, "```")
-	return strings.TrimSpace(response)
+// priceTrendDays is how far back the price trends in prompts look
+const priceTrendDays = 30
+
+// priceTrends returns the price each of products had priceTrendDays ago (or
+// when it was added, if later), for those with price changes since. Trends
+// are only a hint for the model, so a failed lookup just leaves them out.
+func (s *AIService) priceTrends(ctx context.Context, products []models.Product) map[uint]float64 {
+	ids := make([]uint, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	changes, err := s.productRepo.GetPriceChangesSince(ctx, ids, time.Now().AddDate(0, 0, -priceTrendDays))
+	if err != nil {
+		return nil
+	}
+
+	trends := make(map[uint]float64)
+	for _, change := range changes {
+		// The prompt lists products at their own price, not their variants'
+		if change.VariantID != nil {
+			continue
+		}
+		if _, ok := trends[change.ProductID]; ok {
+			continue
+		}
+		// Products added within the window are compared to their first price
+		trends[change.ProductID] = change.Price
+		if change.OldPrice != nil {
+			trends[change.ProductID] = *change.OldPrice
+		}
+	}
+	return trends
 }
 
-func (s *AIService) calculatePrice(product *models.Product, quantity float64, unit models.Unit) float64 {
-	// Simple price calculation - assumes product price is per base unit
-	// In real scenario, you'd need more sophisticated unit conversion
-	return product.Price * quantity / 1000 // Assuming price is per kg/liter and quantity in g/ml
+// priceTrend describes how product's price has moved, for a prompt
+func priceTrend(product *models.Product, trends map[uint]float64) string {
+	was, ok := trends[product.ID]
+	switch {
+	case !ok || was == product.Price:
+		return ""
+	case product.Price < was:
+		return fmt.Sprintf(" (down from %.2f in the last %d days)", was, priceTrendDays)
+	default:
+		return fmt.Sprintf(" (up from %.2f in the last %d days)", was, priceTrendDays)
+	}
+}
+
+// calculatePrice prices quantity (in the unit the model used) for product,
+// whose price is per product.Unit
+func (s *AIService) calculatePrice(product *models.Product, quantity float64, unit models.Unit) (float64, error) {
+	parsed, err := units.Parse(string(unit))
+	if err != nil {
+		return 0, err
+	}
+	return units.Cost(product.Price, product.Unit, quantity, parsed, units.ProfileOf(product))
 }
 
 func (s *AIService) Close() error {
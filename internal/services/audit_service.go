@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strconv"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+const defaultAuditPageSize = 50
+
+// Fields left out of the diff: they change on every write and say nothing
+var auditIgnoredFields = map[string]bool{"updated_at": true}
+
+// AuditService records admin writes and loads the entity snapshots that go
+// into them
+type AuditService struct {
+	auditRepo     repository.AuditStore
+	userRepo      repository.UserStore
+	productRepo   repository.ProductStore
+	categoryRepo  repository.CategoryStore
+	recipeRepo    repository.RecipeStore
+	orderRepo     repository.OrderStore
+	rolePermRepo  repository.RolePermissionStore
+	promotionRepo repository.PromotionStore
+}
+
+func NewAuditService(
+	auditRepo repository.AuditStore,
+	userRepo repository.UserStore,
+	productRepo repository.ProductStore,
+	categoryRepo repository.CategoryStore,
+	recipeRepo repository.RecipeStore,
+	orderRepo repository.OrderStore,
+	rolePermRepo repository.RolePermissionStore,
+	promotionRepo repository.PromotionStore,
+) *AuditService {
+	return &AuditService{
+		auditRepo:     auditRepo,
+		userRepo:      userRepo,
+		productRepo:   productRepo,
+		categoryRepo:  categoryRepo,
+		recipeRepo:    recipeRepo,
+		orderRepo:     orderRepo,
+		rolePermRepo:  rolePermRepo,
+		promotionRepo: promotionRepo,
+	}
+}
+
+// Snapshot loads the current state of an entity, or nil if it doesn't exist.
+// Other failures are logged and also give nil. Implements
+// middleware.AuditRecorder.
+func (s *AuditService) Snapshot(ctx context.Context, entityType, entityID string) interface{} {
+	if entityType == models.AuditEntityRole {
+		return s.roleSnapshot(ctx, models.Role(entityID))
+	}
+
+	id, err := strconv.ParseUint(entityID, 10, 32)
+	if err != nil {
+		slog.WarnContext(ctx, "Audit snapshot skipped: invalid entity ID", "entity_type", entityType, "entity_id", entityID)
+		return nil
+	}
+
+	var snapshot interface{}
+	switch entityType {
+	case models.AuditEntityUser:
+		snapshot, err = s.userRepo.GetByID(ctx, uint(id))
+	case models.AuditEntityProduct:
+		snapshot, err = s.productRepo.GetByID(ctx, uint(id))
+	case models.AuditEntityCategory:
+		snapshot, err = s.categoryRepo.GetByID(ctx, uint(id))
+	case models.AuditEntityRecipe:
+		snapshot, err = s.recipeRepo.GetByID(ctx, uint(id))
+	case models.AuditEntityOrder:
+		snapshot, err = s.orderRepo.GetByID(ctx, uint(id))
+	case models.AuditEntityPromotion:
+		snapshot, err = s.promotionRepo.GetByID(ctx, uint(id))
+	default:
+		slog.WarnContext(ctx, "Audit snapshot skipped: unknown entity type", "entity_type", entityType, "entity_id", entityID)
+		return nil
+	}
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			slog.ErrorContext(ctx, "Failed to load audit snapshot", "entity_type", entityType, "entity_id", entityID, "error", err)
+		}
+		return nil
+	}
+	return snapshot
+}
+
+func (s *AuditService) roleSnapshot(ctx context.Context, role models.Role) interface{} {
+	if !role.IsValid() {
+		return nil
+	}
+	rows, err := s.rolePermRepo.GetAll(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load audit snapshot", "entity_type", models.AuditEntityRole, "entity_id", role, "error", err)
+		return nil
+	}
+
+	perms := []models.Permission{}
+	for _, row := range rows {
+		if row.Role == role {
+			perms = append(perms, row.Permission)
+		}
+	}
+	return &models.RolePermissionsResponse{Role: role, Permissions: perms}
+}
+
+// Record stores an audit entry with the diff between its snapshots.
+// Implements middleware.AuditRecorder.
+func (s *AuditService) Record(ctx context.Context, entry *models.AuditEntry) error {
+	return recordAudit(ctx, s.auditRepo, entry)
+}
+
+// RecordTx is Record within tx, for writes whose entries must be saved
+// together with them
+func (s *AuditService) RecordTx(ctx context.Context, tx *gorm.DB, entry *models.AuditEntry) error {
+	return recordAudit(ctx, s.auditRepo.WithTx(tx), entry)
+}
+
+func recordAudit(ctx context.Context, auditRepo repository.AuditStore, entry *models.AuditEntry) error {
+	before, beforeFields, err := auditDocument(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, afterFields, err := auditDocument(entry.After)
+	if err != nil {
+		return err
+	}
+
+	diff, err := json.Marshal(auditDiff(beforeFields, afterFields))
+	if err != nil {
+		return err
+	}
+
+	return auditRepo.Create(ctx, &models.AuditLog{
+		ActorID:    entry.ActorID,
+		ActorRole:  entry.ActorRole,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Before:     before,
+		After:      after,
+		Diff:       models.AuditJSON(diff),
+		IP:         entry.IP,
+	})
+}
+
+func (s *AuditService) List(ctx context.Context, q *models.AuditQuery) (*models.AuditLogListResponse, error) {
+	if q.Page == 0 {
+		q.Page = 1
+	}
+	if q.Limit == 0 {
+		q.Limit = defaultAuditPageSize
+	}
+
+	entries, total, err := s.auditRepo.List(ctx, q)
+	if err != nil {
+		return nil, errors.New("failed to load audit log")
+	}
+
+	return &models.AuditLogListResponse{
+		Items: entries,
+		Total: total,
+		Page:  q.Page,
+		Limit: q.Limit,
+	}, nil
+}
+
+// auditDocument serializes a snapshot and also decodes it into its
+// top-level fields for diffing
+func auditDocument(v interface{}) (models.AuditJSON, map[string]interface{}, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return "", nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode audit snapshot: %w", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		// Not an object; diff it as a single value
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return "", nil, fmt.Errorf("failed to decode audit snapshot: %w", err)
+		}
+		fields = map[string]interface{}{"value": value}
+	}
+	return models.AuditJSON(data), fields, nil
+}
+
+// auditDiff maps every changed field to {"from": old, "to": new}. A field
+// missing on one side (created or deleted entity) shows up as null.
+func auditDiff(before, after map[string]interface{}) map[string]map[string]interface{} {
+	diff := make(map[string]map[string]interface{})
+	for key, old := range before {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if updated, ok := after[key]; !ok || !reflect.DeepEqual(old, updated) {
+			diff[key] = map[string]interface{}{"from": old, "to": after[key]}
+		}
+	}
+	for key, updated := range after {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if _, ok := before[key]; !ok {
+			diff[key] = map[string]interface{}{"from": nil, "to": updated}
+		}
+	}
+	return diff
+}
@@ -1,171 +1,252 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
+	"time"
 
 	"github.com/bexiiiii/smart_food_store/internal/models"
 	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"github.com/bexiiiii/smart_food_store/internal/units"
 )
 
 type CartService struct {
-	cartRepo    *repository.CartRepository
-	productRepo *repository.ProductRepository
+	cartRepo      repository.CartStore
+	productRepo   repository.ProductStore
+	promotionRepo repository.PromotionStore
 }
 
-func NewCartService(cartRepo *repository.CartRepository, productRepo *repository.ProductRepository) *CartService {
+func NewCartService(cartRepo repository.CartStore, productRepo repository.ProductStore, promotionRepo repository.PromotionStore) *CartService {
 	return &CartService{
-		cartRepo:    cartRepo,
-		productRepo: productRepo,
+		cartRepo:      cartRepo,
+		productRepo:   productRepo,
+		promotionRepo: promotionRepo,
 	}
 }
 
-func (s *CartService) GetCart(userID uint) (*models.CartResponse, error) {
-	cart, err := s.cartRepo.GetOrCreateByUserID(userID)
+func (s *CartService) GetCart(ctx context.Context, userID uint) (*models.CartResponse, error) {
+	cart, err := s.cartRepo.GetOrCreateByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("failed to get cart")
 	}
 
-	return s.buildCartResponse(cart)
+	return buildCartResponse(ctx, cart, s.promotionRepo)
 }
 
-func (s *CartService) AddItem(userID uint, req *models.CartItemRequest) (*models.CartResponse, error) {
+func (s *CartService) AddItem(ctx context.Context, userID uint, req *models.CartItemRequest) (*models.CartResponse, error) {
 	// Validate product exists
-	product, err := s.productRepo.GetByID(req.ProductID)
+	product, err := s.productRepo.GetByID(ctx, req.ProductID)
 	if err != nil {
 		return nil, errors.New("product not found")
 	}
 
-	// Check stock
-	if product.Stock < req.Quantity {
+	variant, quantity, err := cartLine(product, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check stock. This is only a hint for the shopper: stock is actually
+	// claimed with a conditional decrement when it is reserved or checked out.
+	if stockOf(product, variant) < quantity {
 		return nil, errors.New("insufficient stock")
 	}
 
-	cart, err := s.cartRepo.GetOrCreateByUserID(userID)
+	cart, err := s.cartRepo.GetOrCreateByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("failed to get cart")
 	}
 
 	item := &models.CartItem{
 		ProductID: req.ProductID,
-		Quantity:  req.Quantity,
+		VariantID: variantIDOf(variant),
+		Quantity:  quantity,
 	}
 
-	if err := s.cartRepo.AddItem(cart.ID, item); err != nil {
+	if err := s.cartRepo.AddItem(ctx, cart.ID, item); err != nil {
 		return nil, errors.New("failed to add item to cart")
 	}
 
 	// Refresh cart data
-	cart, err = s.cartRepo.GetByUserID(userID)
+	cart, err = s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("failed to get updated cart")
 	}
 
-	return s.buildCartResponse(cart)
+	return buildCartResponse(ctx, cart, s.promotionRepo)
 }
 
-func (s *CartService) UpdateItemQuantity(userID uint, productID uint, quantity float64) (*models.CartResponse, error) {
-	cart, err := s.cartRepo.GetByUserID(userID)
+// UpdateItemQuantity sets the quantity of a cart line. variantID selects the
+// line of one of the product's variants, whose quantity is a number of packs.
+func (s *CartService) UpdateItemQuantity(ctx context.Context, userID uint, productID uint, variantID *uint, quantity float64) (*models.CartResponse, error) {
+	cart, err := s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("cart not found")
 	}
 
 	// Validate product exists and has enough stock
-	product, err := s.productRepo.GetByID(productID)
+	product, err := s.productRepo.GetByID(ctx, productID)
 	if err != nil {
 		return nil, errors.New("product not found")
 	}
 
-	if product.Stock < quantity {
+	var variant *models.ProductVariant
+	if variantID != nil {
+		if variant = findVariant(product, *variantID); variant == nil {
+			return nil, errors.New("variant not found")
+		}
+		if quantity != math.Trunc(quantity) {
+			return nil, fmt.Errorf("%s %s is sold in whole packs", product.Name, variant.Name)
+		}
+	}
+
+	if stockOf(product, variant) < quantity {
 		return nil, errors.New("insufficient stock")
 	}
 
 	if quantity <= 0 {
 		// Remove item if quantity is 0 or negative
-		if err := s.cartRepo.RemoveItem(cart.ID, productID); err != nil {
+		if err := s.cartRepo.RemoveItem(ctx, cart.ID, productID, variantID); err != nil {
 			return nil, errors.New("failed to remove item")
 		}
 	} else {
-		if err := s.cartRepo.UpdateItemQuantity(cart.ID, productID, quantity); err != nil {
+		if err := s.cartRepo.UpdateItemQuantity(ctx, cart.ID, productID, variantID, quantity); err != nil {
 			return nil, errors.New("failed to update item quantity")
 		}
 	}
 
 	// Refresh cart data
-	cart, err = s.cartRepo.GetByUserID(userID)
+	cart, err = s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("failed to get updated cart")
 	}
 
-	return s.buildCartResponse(cart)
+	return buildCartResponse(ctx, cart, s.promotionRepo)
 }
 
-func (s *CartService) RemoveItem(userID uint, productID uint) (*models.CartResponse, error) {
-	cart, err := s.cartRepo.GetByUserID(userID)
+func (s *CartService) RemoveItem(ctx context.Context, userID uint, productID uint, variantID *uint) (*models.CartResponse, error) {
+	cart, err := s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("cart not found")
 	}
 
-	if err := s.cartRepo.RemoveItem(cart.ID, productID); err != nil {
+	if err := s.cartRepo.RemoveItem(ctx, cart.ID, productID, variantID); err != nil {
 		return nil, errors.New("failed to remove item")
 	}
 
 	// Refresh cart data
-	cart, err = s.cartRepo.GetByUserID(userID)
+	cart, err = s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("failed to get updated cart")
 	}
 
-	return s.buildCartResponse(cart)
+	return buildCartResponse(ctx, cart, s.promotionRepo)
 }
 
-func (s *CartService) ClearCart(userID uint) error {
-	cart, err := s.cartRepo.GetByUserID(userID)
+func (s *CartService) ClearCart(ctx context.Context, userID uint) error {
+	cart, err := s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return errors.New("cart not found")
 	}
 
-	return s.cartRepo.ClearCart(cart.ID)
+	return s.cartRepo.ClearCart(ctx, cart.ID)
 }
 
-func (s *CartService) AddMultipleItems(userID uint, items []models.CartItemRequest) (*models.CartResponse, error) {
-	cart, err := s.cartRepo.GetOrCreateByUserID(userID)
+func (s *CartService) AddMultipleItems(ctx context.Context, userID uint, items []models.CartItemRequest) (*models.CartResponse, error) {
+	cart, err := s.cartRepo.GetOrCreateByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("failed to get cart")
 	}
 
 	for _, req := range items {
 		// Validate product exists
-		product, err := s.productRepo.GetByID(req.ProductID)
+		product, err := s.productRepo.GetByID(ctx, req.ProductID)
 		if err != nil {
 			continue // Skip invalid products
 		}
 
+		variant, quantity, err := cartLine(product, &req)
+		if err != nil {
+			continue // Skip quantities that can't be expressed in the product's unit
+		}
+
 		// Check stock (add what's available)
-		quantity := req.Quantity
-		if product.Stock < quantity {
-			quantity = product.Stock
+		if stock := stockOf(product, variant); stock < quantity {
+			quantity = stock
+			if variant != nil {
+				quantity = math.Floor(stock)
+			}
 		}
 
 		if quantity > 0 {
 			item := &models.CartItem{
 				ProductID: req.ProductID,
+				VariantID: variantIDOf(variant),
 				Quantity:  quantity,
 			}
-			s.cartRepo.AddItem(cart.ID, item)
+			s.cartRepo.AddItem(ctx, cart.ID, item)
 		}
 	}
 
 	// Refresh cart data
-	cart, err = s.cartRepo.GetByUserID(userID)
+	cart, err = s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("failed to get updated cart")
 	}
 
-	return s.buildCartResponse(cart)
+	return buildCartResponse(ctx, cart, s.promotionRepo)
 }
 
-func (s *CartService) GetCartProductIDs(userID uint) ([]uint, error) {
-	cart, err := s.cartRepo.GetByUserID(userID)
+// ApplyCoupon enters a coupon code on the user's cart. Codes are
+// case-insensitive. A coupon that can't be used right now is rejected.
+func (s *CartService) ApplyCoupon(ctx context.Context, userID uint, code string) (*models.CartResponse, error) {
+	code = normalizeCouponCode(code)
+	promotion, err := s.promotionRepo.GetByCode(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("coupon %s is not valid", code)
+	}
+
+	cart, err := s.cartRepo.GetOrCreateByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("failed to get cart")
+	}
+
+	cart.CouponCode = &code
+	response, err := buildCartResponse(ctx, cart, s.promotionRepo)
+	if err != nil {
+		return nil, err
+	}
+	if response.CouponError != "" {
+		return nil, errors.New(response.CouponError)
+	}
+	// A product or category coupon has to match something in the cart
+	if !promotion.IsOrderLevel() && !couponMatchesCart(promotion, cart, response) {
+		return nil, fmt.Errorf("coupon %s doesn't apply to anything in your cart", code)
+	}
+
+	if err := s.cartRepo.SetCoupon(ctx, cart.ID, &code); err != nil {
+		return nil, errors.New("failed to apply coupon")
+	}
+	return response, nil
+}
+
+func (s *CartService) RemoveCoupon(ctx context.Context, userID uint) (*models.CartResponse, error) {
+	cart, err := s.cartRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("cart not found")
+	}
+
+	if err := s.cartRepo.SetCoupon(ctx, cart.ID, nil); err != nil {
+		return nil, errors.New("failed to remove coupon")
+	}
+	cart.CouponCode = nil
+
+	return buildCartResponse(ctx, cart, s.promotionRepo)
+}
+
+func (s *CartService) GetCartProductIDs(ctx context.Context, userID uint) ([]uint, error) {
+	cart, err := s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -178,8 +259,8 @@ func (s *CartService) GetCartProductIDs(userID uint) ([]uint, error) {
 	return productIDs, nil
 }
 
-func (s *CartService) GetCartItemNames(userID uint) ([]string, error) {
-	cart, err := s.cartRepo.GetByUserID(userID)
+func (s *CartService) GetCartItemNames(ctx context.Context, userID uint) ([]string, error) {
+	cart, err := s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +275,82 @@ func (s *CartService) GetCartItemNames(userID uint) ([]string, error) {
 	return names, nil
 }
 
-func (s *CartService) buildCartResponse(cart *models.Cart) (*models.CartResponse, error) {
+// toProductUnit expresses quantity, given in unit, in the unit the product is
+// sold and stocked in. An empty unit means the quantity already is.
+func toProductUnit(product *models.Product, quantity float64, unit models.Unit) (float64, error) {
+	if unit == "" || unit == product.Unit {
+		return quantity, nil
+	}
+
+	parsed, err := units.Parse(string(unit))
+	if err != nil {
+		return 0, err
+	}
+
+	converted, err := units.Convert(quantity, parsed, product.Unit, units.ProfileOf(product))
+	if err != nil {
+		return 0, fmt.Errorf("cannot measure %s in %s: %w", product.Name, unit, err)
+	}
+	return converted, nil
+}
+
+// cartLine works out which variant of product a request is for, if any, and
+// the quantity to store on the cart line: packs for a variant, otherwise the
+// product's unit. A product sold in variants gets the cheapest in-stock packs
+// covering the requested amount when the request names no variant.
+func cartLine(product *models.Product, req *models.CartItemRequest) (*models.ProductVariant, float64, error) {
+	if req.VariantID != nil {
+		variant := findVariant(product, *req.VariantID)
+		if variant == nil {
+			return nil, 0, fmt.Errorf("%s has no variant %d", product.Name, *req.VariantID)
+		}
+		if req.Unit == "" {
+			if req.Quantity != math.Trunc(req.Quantity) {
+				return nil, 0, fmt.Errorf("%s %s is sold in whole packs", product.Name, variant.Name)
+			}
+			return variant, req.Quantity, nil
+		}
+		quantity, err := toProductUnit(product, req.Quantity, req.Unit)
+		if err != nil {
+			return nil, 0, err
+		}
+		return variant, variantPacks(variant, quantity), nil
+	}
+
+	quantity, err := toProductUnit(product, req.Quantity, req.Unit)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(product.Variants) == 0 {
+		return nil, quantity, nil
+	}
+
+	variant, packs := cheapestVariant(product, quantity)
+	if variant == nil {
+		return nil, 0, errors.New("insufficient stock")
+	}
+	return variant, packs, nil
+}
+
+// stockOf is the stock a cart line draws from
+func stockOf(product *models.Product, variant *models.ProductVariant) float64 {
+	if variant != nil {
+		return variant.Stock
+	}
+	return product.Stock
+}
+
+func variantIDOf(variant *models.ProductVariant) *uint {
+	if variant == nil {
+		return nil
+	}
+	id := variant.ID
+	return &id
+}
+
+// buildCartResponse prices the lines of cart and applies the promotions that
+// are running now
+func buildCartResponse(ctx context.Context, cart *models.Cart, promotionRepo repository.PromotionStore) (*models.CartResponse, error) {
 	var totalPrice float64
 	var items []models.CartItemResponse
 
@@ -203,7 +359,32 @@ func (s *CartService) buildCartResponse(cart *models.Cart) (*models.CartResponse
 			continue
 		}
 
-		subtotal := item.Product.Price * item.Quantity
+		if item.VariantID != nil {
+			// Variant lines count packs at the variant's price
+			if item.Variant == nil {
+				continue // The variant was removed
+			}
+			subtotal := item.Variant.Price * item.Quantity
+			totalPrice += subtotal
+
+			items = append(items, models.CartItemResponse{
+				ID:          item.ID,
+				ProductID:   item.ProductID,
+				ProductName: item.Product.Name,
+				VariantID:   item.VariantID,
+				VariantName: item.Variant.Name,
+				Price:       item.Variant.Price,
+				Quantity:    item.Quantity,
+				Unit:        models.UnitPiece,
+				Subtotal:    subtotal,
+			})
+			continue
+		}
+
+		subtotal, err := units.Cost(item.Product.Price, item.Product.Unit, item.Quantity, item.Product.Unit, units.ProfileOf(item.Product))
+		if err != nil {
+			return nil, fmt.Errorf("cannot price %s: %w", item.Product.Name, err)
+		}
 		totalPrice += subtotal
 
 		items = append(items, models.CartItemResponse{
@@ -217,10 +398,14 @@ func (s *CartService) buildCartResponse(cart *models.Cart) (*models.CartResponse
 		})
 	}
 
-	return &models.CartResponse{
+	response := &models.CartResponse{
 		ID:         cart.ID,
 		Items:      items,
 		TotalPrice: totalPrice,
 		ItemCount:  len(items),
-	}, nil
+	}
+	if err := applyPromotions(ctx, promotionRepo, cart, response, time.Now()); err != nil {
+		return nil, errors.New("failed to apply promotions")
+	}
+	return response, nil
 }
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// FakeLLMProvider is a deterministic LLMProvider for tests and offline
+// development. It replies with the queued responses in order and keeps
+// repeating the last one; with nothing queued it returns an empty JSON array
+// or object depending on what the prompt asks for.
+type FakeLLMProvider struct {
+	mu        sync.Mutex
+	responses []string
+	prompts   []string
+}
+
+func NewFakeLLMProvider(responses ...string) *FakeLLMProvider {
+	return &FakeLLMProvider{responses: responses}
+}
+
+func (p *FakeLLMProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeLLMProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	call := len(p.prompts)
+	p.prompts = append(p.prompts, prompt)
+
+	if len(p.responses) == 0 {
+		if strings.Contains(prompt, "JSON array") {
+			return "[]", nil
+		}
+		return "{}", nil
+	}
+	if call >= len(p.responses) {
+		call = len(p.responses) - 1
+	}
+	return p.responses[call], nil
+}
+
+// Prompts returns every prompt received so far
+func (p *FakeLLMProvider) Prompts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.prompts...)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1"
+	defaultGeminiModel   = "gemini-2.5-flash"
+)
+
+// Gemini REST API structures
+type GeminiRequest struct {
+	Contents         []GeminiContent        `json:"contents"`
+	GenerationConfig GeminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type GeminiContent struct {
+	Parts []GeminiPart `json:"parts"`
+}
+
+type GeminiPart struct {
+	Text string `json:"text"`
+}
+
+type GeminiGenerationConfig struct {
+	Temperature float64 `json:"temperature"`
+}
+
+type GeminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+	Error *struct {
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+	} `json:"error,omitempty"`
+}
+
+// GeminiProvider calls the Gemini generateContent REST API
+type GeminiProvider struct {
+	apiKey      string
+	model       string
+	temperature float64
+	baseURL     string
+	client      *http.Client
+}
+
+func NewGeminiProvider(apiKey string, settings llmSettings) *GeminiProvider {
+	model := settings.model
+	if model == "" {
+		model = defaultGeminiModel
+	}
+	baseURL := settings.baseURL
+	if baseURL == "" {
+		baseURL = defaultGeminiBaseURL
+	}
+
+	return &GeminiProvider{
+		apiKey:      apiKey,
+		model:       model,
+		temperature: settings.temperature,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		client:      &http.Client{Timeout: settings.timeout},
+	}
+}
+
+func (p *GeminiProvider) Name() string {
+	return "gemini/" + p.model
+}
+
+func (p *GeminiProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	if p.apiKey == "" || p.apiKey == "your-gemini-api-key-here" {
+		return "", errors.New("Gemini API not configured. Please set GEMINI_API_KEY in .env file")
+	}
+
+	// The key goes in a header: errors from the client quote the URL, and
+	// those get logged
+	url := fmt.Sprintf("%s/models/%s:generateContent", p.baseURL, p.model)
+
+	reqBody := GeminiRequest{
+		Contents: []GeminiContent{
+			{
+				Parts: []GeminiPart{
+					{Text: prompt},
+				},
+			},
+		},
+		GenerationConfig: GeminiGenerationConfig{
+			Temperature: p.temperature,
+		},
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call Gemini API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var geminiResp GeminiResponse
+	if err := json.Unmarshal(body, &geminiResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %v (body: %s)", err, string(body))
+	}
+
+	if geminiResp.Error != nil {
+		return "", fmt.Errorf("Gemini API error: %s (code: %d)", geminiResp.Error.Message, geminiResp.Error.Code)
+	}
+
+	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
+		return "", errors.New("empty response from Gemini API")
+	}
+
+	return geminiResp.Candidates[0].Content.Parts[0].Text, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGeminiKey = "test-gemini-key"
+
+func TestGeminiProviderSendsKeyInHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("x-goog-api-key"); got != testGeminiKey {
+			t.Errorf("x-goog-api-key = %q, want %q", got, testGeminiKey)
+		}
+		if strings.Contains(r.URL.String(), testGeminiKey) {
+			t.Errorf("request URL %s has the API key", r.URL)
+		}
+		w.Write([]byte(`{"candidates": [{"content": {"parts": [{"text": "hello"}]}}]}`))
+	}))
+	defer srv.Close()
+
+	provider := NewGeminiProvider(testGeminiKey, llmSettings{baseURL: srv.URL, timeout: time.Second})
+	reply, err := provider.Generate(context.Background(), "hi")
+	if err != nil || reply != "hello" {
+		t.Errorf("Generate = %q, %v, want hello", reply, err)
+	}
+}
+
+func TestGeminiProviderFailureDoesNotLogKey(t *testing.T) {
+	// Nothing listens on a closed server's address, so the call fails in
+	// the client with an error quoting the URL
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	s := &AIService{provider: NewGeminiProvider(testGeminiKey, llmSettings{baseURL: srv.URL, timeout: time.Second})}
+	_, err := s.generate(context.Background(), "hi", 1)
+	if err == nil {
+		t.Fatal("generate against a closed server succeeded")
+	}
+	if strings.Contains(err.Error(), testGeminiKey) {
+		t.Errorf("error has the API key: %v", err)
+	}
+	if !strings.Contains(logs.String(), "LLM call failed") {
+		t.Errorf("failure wasn't logged: %s", logs.String())
+	}
+	if strings.Contains(logs.String(), testGeminiKey) {
+		t.Errorf("logs have the API key: %s", logs.String())
+	}
+}
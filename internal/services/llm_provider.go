@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+)
+
+// LLMProvider generates a text completion for a prompt. AIService talks to
+// language models only through this interface.
+type LLMProvider interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+	Name() string
+}
+
+// llmSettings are the provider-independent knobs read from config
+type llmSettings struct {
+	model       string
+	temperature float64
+	baseURL     string
+	timeout     time.Duration
+}
+
+// NewLLMProvider builds the provider selected by cfg.LLMProvider:
+// "gemini" (default), "openai" for any OpenAI-compatible server such as
+// llama.cpp or Ollama, or "fake" for deterministic offline replies.
+func NewLLMProvider(cfg *config.Config) (LLMProvider, error) {
+	temperature, err := strconv.ParseFloat(cfg.LLMTemperature, 64)
+	if err != nil {
+		temperature = 0.7
+	}
+
+	timeout, err := time.ParseDuration(cfg.LLMTimeout)
+	if err != nil || timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	settings := llmSettings{
+		model:       cfg.LLMModel,
+		temperature: temperature,
+		baseURL:     cfg.LLMBaseURL,
+		timeout:     timeout,
+	}
+
+	switch cfg.LLMProvider {
+	case "", "gemini":
+		return NewGeminiProvider(cfg.GeminiAPIKey, settings), nil
+	case "openai":
+		return NewOpenAIProvider(cfg.LLMAPIKey, settings), nil
+	case "fake":
+		return NewFakeLLMProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.LLMProvider)
+	}
+}
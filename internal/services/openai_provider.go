@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultOpenAIBaseURL = "https://api.openai.com/v1"
+	defaultOpenAIModel   = "gpt-4o-mini"
+)
+
+// OpenAI chat completions structures
+type OpenAIChatRequest struct {
+	Model       string              `json:"model"`
+	Messages    []OpenAIChatMessage `json:"messages"`
+	Temperature float64             `json:"temperature"`
+}
+
+type OpenAIChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type OpenAIChatResponse struct {
+	Choices []struct {
+		Message OpenAIChatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error,omitempty"`
+}
+
+// OpenAIProvider calls any server that implements the OpenAI chat completions
+// API. Point LLM_BASE_URL at e.g. http://localhost:11434/v1 (Ollama) or
+// http://localhost:8081/v1 (llama.cpp server) to run models locally.
+type OpenAIProvider struct {
+	apiKey      string
+	model       string
+	temperature float64
+	baseURL     string
+	client      *http.Client
+}
+
+func NewOpenAIProvider(apiKey string, settings llmSettings) *OpenAIProvider {
+	model := settings.model
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	baseURL := settings.baseURL
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+
+	return &OpenAIProvider{
+		apiKey:      apiKey,
+		model:       model,
+		temperature: settings.temperature,
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		client:      &http.Client{Timeout: settings.timeout},
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return "openai/" + p.model
+}
+
+func (p *OpenAIProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	reqBody := OpenAIChatRequest{
+		Model: p.model,
+		Messages: []OpenAIChatMessage{
+			{Role: "user", Content: prompt},
+		},
+		Temperature: p.temperature,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Local servers usually don't need a key
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call LLM API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %v", err)
+	}
+
+	var chatResp OpenAIChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %v (status: %d)", err, resp.StatusCode)
+	}
+
+	if chatResp.Error != nil {
+		return "", fmt.Errorf("LLM API error: %s (type: %s)", chatResp.Error.Message, chatResp.Error.Type)
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return "", errors.New("empty response from LLM API")
+	}
+
+	return chatResp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+// orderTransitions lists the statuses an order may move to from each status.
+// Delivered orders can only be refunded; cancelled and refunded are final.
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPending:        {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:           {models.OrderStatusPacked, models.OrderStatusCancelled, models.OrderStatusRefunded},
+	models.OrderStatusPacked:         {models.OrderStatusOutForDelivery, models.OrderStatusCancelled},
+	models.OrderStatusOutForDelivery: {models.OrderStatusDelivered},
+	models.OrderStatusDelivered:      {models.OrderStatusRefunded},
+	models.OrderStatusCancelled:      {},
+	models.OrderStatusRefunded:       {},
+}
+
+// CanTransition reports whether an order in status from may be moved to status to
+func CanTransition(from, to models.OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+type OrderService struct {
+	orderRepo          repository.OrderStore
+	cartRepo           repository.CartStore
+	productRepo        repository.ProductStore
+	promotionRepo      repository.PromotionStore
+	reservationService *ReservationService
+}
+
+func NewOrderService(orderRepo repository.OrderStore, cartRepo repository.CartStore, productRepo repository.ProductStore, promotionRepo repository.PromotionStore, reservationService *ReservationService) *OrderService {
+	return &OrderService{
+		orderRepo:          orderRepo,
+		cartRepo:           cartRepo,
+		productRepo:        productRepo,
+		promotionRepo:      promotionRepo,
+		reservationService: reservationService,
+	}
+}
+
+// Checkout turns the user's cart into an order. Stock is claimed (using the
+// user's reservation if there is one), promotion uses are counted, the order
+// is stored and the cart is cleared in a single transaction. A coupon on the
+// cart that can no longer be used fails the checkout rather than being
+// silently dropped.
+func (s *OrderService) Checkout(ctx context.Context, userID uint) (*models.Order, error) {
+	var order *models.Order
+
+	err := s.orderRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		cartRepo := s.cartRepo.WithTx(tx)
+		promotionRepo := s.promotionRepo.WithTx(tx)
+
+		cart, err := cartRepo.GetByUserID(ctx, userID)
+		if err != nil {
+			return errors.New("cart not found")
+		}
+
+		cartResponse, err := buildCartResponse(ctx, cart, promotionRepo)
+		if err != nil {
+			return err
+		}
+		if len(cartResponse.Items) == 0 {
+			return errors.New("cart is empty")
+		}
+		if cartResponse.CouponError != "" {
+			return errors.New(cartResponse.CouponError)
+		}
+
+		order = &models.Order{
+			UserID:        userID,
+			Status:        models.OrderStatusPending,
+			TotalPrice:    cartResponse.TotalPrice,
+			Subtotal:      cartResponse.Subtotal,
+			DiscountTotal: cartResponse.DiscountTotal,
+			CouponCode:    cartResponse.CouponCode,
+		}
+
+		// Each promotion counts one use per order, however many lines it
+		// discounts. They are redeemed in ID order, the order their rows are
+		// locked in, so concurrent checkouts can't deadlock.
+		names := make(map[uint]string)
+		var promotionIDs []uint
+		for _, discount := range cartResponse.Discounts {
+			if _, ok := names[discount.PromotionID]; !ok {
+				names[discount.PromotionID] = discount.Name
+				promotionIDs = append(promotionIDs, discount.PromotionID)
+			}
+		}
+		slices.Sort(promotionIDs)
+		for _, id := range promotionIDs {
+			if err := promotionRepo.Redeem(ctx, id, userID); err != nil {
+				switch {
+				case errors.Is(err, repository.ErrPromotionUsedUp):
+					return fmt.Errorf("%s is no longer available", names[id])
+				case errors.Is(err, repository.ErrPromotionUserLimit):
+					return fmt.Errorf("you have already used %s", names[id])
+				}
+				return errors.New("failed to apply promotions")
+			}
+		}
+		for _, discount := range cartResponse.Discounts {
+			order.Discounts = append(order.Discounts, models.OrderDiscount{
+				UserID:      userID,
+				PromotionID: discount.PromotionID,
+				Name:        discount.Name,
+				Type:        discount.Type,
+				Code:        discount.Code,
+				ProductID:   discount.ProductID,
+				Amount:      discount.Amount,
+			})
+		}
+
+		if err := s.reservationService.commitTx(ctx, tx, userID, cartResponse.Items); err != nil {
+			return err
+		}
+
+		for _, item := range cartResponse.Items {
+			order.Items = append(order.Items, models.OrderItem{
+				ProductID:   item.ProductID,
+				ProductName: item.ProductName,
+				VariantID:   item.VariantID,
+				VariantName: item.VariantName,
+				Price:       item.Price,
+				Unit:        item.Unit,
+				Quantity:    item.Quantity,
+				Subtotal:    item.Subtotal,
+			})
+		}
+
+		orderRepo := s.orderRepo.WithTx(tx)
+		if err := orderRepo.Create(ctx, order); err != nil {
+			return errors.New("failed to create order")
+		}
+
+		if err := orderRepo.AddStatusChange(ctx, &models.OrderStatusChange{
+			OrderID:     order.ID,
+			ToStatus:    models.OrderStatusPending,
+			ChangedByID: userID,
+		}); err != nil {
+			return errors.New("failed to record order status")
+		}
+
+		if err := cartRepo.ClearCart(ctx, cart.ID); err != nil {
+			return errors.New("failed to clear cart")
+		}
+		if cart.CouponCode != nil {
+			if err := cartRepo.SetCoupon(ctx, cart.ID, nil); err != nil {
+				return errors.New("failed to clear cart")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.orderRepo.GetByID(ctx, order.ID)
+}
+
+func (s *OrderService) GetUserOrders(ctx context.Context, userID uint) ([]models.Order, error) {
+	return s.orderRepo.GetByUserID(ctx, userID)
+}
+
+func (s *OrderService) GetUserOrder(ctx context.Context, userID uint, orderID uint) (*models.Order, error) {
+	order, err := s.orderRepo.GetByIDForUser(ctx, orderID, userID)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// Admin methods
+func (s *OrderService) GetAll(ctx context.Context, status models.OrderStatus) ([]models.Order, error) {
+	return s.orderRepo.GetAll(ctx, status)
+}
+
+func (s *OrderService) GetByID(ctx context.Context, id uint) (*models.Order, error) {
+	order, err := s.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// UpdateStatus moves an order to a new status on behalf of an admin. The
+// transition is validated against orderTransitions and recorded in the order
+// history; cancelling an order returns its items to stock and gives back the
+// promotion uses it counted.
+func (s *OrderService) UpdateStatus(ctx context.Context, orderID uint, adminID uint, req *models.OrderStatusUpdateRequest) (*models.Order, error) {
+	if _, known := orderTransitions[req.Status]; !known {
+		return nil, fmt.Errorf("unknown order status %q", req.Status)
+	}
+
+	err := s.orderRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		orderRepo := s.orderRepo.WithTx(tx)
+		productRepo := s.productRepo.WithTx(tx)
+
+		order, err := orderRepo.GetByIDForUpdate(ctx, orderID)
+		if err != nil {
+			return ErrOrderNotFound
+		}
+
+		if !CanTransition(order.Status, req.Status) {
+			return fmt.Errorf("invalid status transition from %s to %s", order.Status, req.Status)
+		}
+
+		if req.Status == models.OrderStatusCancelled {
+			for _, item := range order.Items {
+				if err := returnStock(ctx, productRepo, stockLineOf(item.ProductID, item.VariantID), item.Quantity); err != nil {
+					return errors.New("failed to restore stock")
+				}
+			}
+
+			promotionRepo := s.promotionRepo.WithTx(tx)
+			released := make(map[uint]bool)
+			for _, discount := range order.Discounts {
+				if released[discount.PromotionID] {
+					continue
+				}
+				if err := promotionRepo.Release(ctx, discount.PromotionID); err != nil {
+					return errors.New("failed to release promotions")
+				}
+				released[discount.PromotionID] = true
+			}
+		}
+
+		if err := orderRepo.UpdateStatus(ctx, order.ID, req.Status); err != nil {
+			return errors.New("failed to update order status")
+		}
+
+		return orderRepo.AddStatusChange(ctx, &models.OrderStatusChange{
+			OrderID:     order.ID,
+			FromStatus:  order.Status,
+			ToStatus:    req.Status,
+			ChangedByID: adminID,
+			Note:        req.Note,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.orderRepo.GetByID(ctx, orderID)
+}
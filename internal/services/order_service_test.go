@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	const (
+		pending        = models.OrderStatusPending
+		paid           = models.OrderStatusPaid
+		packed         = models.OrderStatusPacked
+		outForDelivery = models.OrderStatusOutForDelivery
+		delivered      = models.OrderStatusDelivered
+		cancelled      = models.OrderStatusCancelled
+		refunded       = models.OrderStatusRefunded
+	)
+	cases := []struct {
+		from, to models.OrderStatus
+		want     bool
+	}{
+		{pending, paid, true},
+		{pending, cancelled, true},
+		{paid, packed, true},
+		{paid, cancelled, true},
+		{paid, refunded, true},
+		{packed, outForDelivery, true},
+		{packed, cancelled, true},
+		{outForDelivery, delivered, true},
+		{delivered, refunded, true},
+
+		{pending, pending, false},
+		{pending, packed, false},
+		{pending, delivered, false},
+		{pending, refunded, false},
+		{paid, pending, false},
+		{paid, delivered, false},
+		{packed, paid, false},
+		{packed, refunded, false},
+		{outForDelivery, cancelled, false},
+		{outForDelivery, refunded, false},
+		{delivered, cancelled, false},
+		{delivered, outForDelivery, false},
+		{cancelled, pending, false},
+		{cancelled, paid, false},
+		{cancelled, refunded, false},
+		{refunded, paid, false},
+		{refunded, cancelled, false},
+		{"shipped", paid, false},
+		{pending, "shipped", false},
+	}
+
+	for _, tc := range cases {
+		if got := CanTransition(tc.from, tc.to); got != tc.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+)
+
+var ErrInvalidRolePermissions = errors.New("invalid role permissions")
+
+// ErrPermissionDenied is returned when staff try to give out more access
+// than they hold, or to change admins
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Mappings are re-read at least this often, so changes made by another
+// instance are picked up without a restart
+const permissionCacheTTL = time.Minute
+
+// PermissionService answers "may this role do that" from an in-memory copy
+// of role_permissions. Admin always has every permission.
+type PermissionService struct {
+	rolePermRepo repository.RolePermissionStore
+
+	mu       sync.RWMutex
+	cache    map[models.Role]map[models.Permission]bool
+	loadedAt time.Time
+}
+
+func NewPermissionService(rolePermRepo repository.RolePermissionStore) *PermissionService {
+	return &PermissionService{rolePermRepo: rolePermRepo}
+}
+
+// HasPermission implements middleware.PermissionChecker
+func (s *PermissionService) HasPermission(ctx context.Context, role models.Role, perm models.Permission) (bool, error) {
+	if role == models.RoleAdmin {
+		return true, nil
+	}
+
+	cache, err := s.mappings(ctx)
+	if err != nil {
+		return false, err
+	}
+	return cache[role][perm], nil
+}
+
+// GetAll lists every role with its permissions
+func (s *PermissionService) GetAll(ctx context.Context) ([]models.RolePermissionsResponse, error) {
+	cache, err := s.mappings(ctx)
+	if err != nil {
+		return nil, errors.New("failed to load permissions")
+	}
+
+	var response []models.RolePermissionsResponse
+	for _, role := range models.AllRoles {
+		perms := []models.Permission{}
+		if role == models.RoleAdmin {
+			perms = append(perms, models.AllPermissions...)
+		} else {
+			for perm := range cache[role] {
+				perms = append(perms, perm)
+			}
+			sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+		}
+		response = append(response, models.RolePermissionsResponse{Role: role, Permissions: perms})
+	}
+	return response, nil
+}
+
+// SetRolePermissions replaces the permissions of a staff role on behalf of a
+// user with role caller. Staff can't change their own role and can only
+// grant permissions they hold themselves.
+func (s *PermissionService) SetRolePermissions(ctx context.Context, caller, role models.Role, perms []models.Permission) (*models.RolePermissionsResponse, error) {
+	if !role.IsValid() {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidRolePermissions, role)
+	}
+	if role == models.RoleAdmin {
+		return nil, fmt.Errorf("%w: admin permissions can't be changed", ErrInvalidRolePermissions)
+	}
+
+	seen := make(map[models.Permission]bool)
+	unique := []models.Permission{}
+	for _, perm := range perms {
+		if !perm.IsValid() {
+			return nil, fmt.Errorf("%w: unknown permission %q", ErrInvalidRolePermissions, perm)
+		}
+		if !seen[perm] {
+			seen[perm] = true
+			unique = append(unique, perm)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i] < unique[j] })
+
+	if caller != models.RoleAdmin {
+		if role == caller {
+			return nil, fmt.Errorf("%w: you can't change the permissions of your own role", ErrPermissionDenied)
+		}
+		cache, err := s.mappings(ctx)
+		if err != nil {
+			return nil, errors.New("failed to load permissions")
+		}
+		for _, perm := range unique {
+			if !cache[role][perm] && !cache[caller][perm] {
+				return nil, fmt.Errorf("%w: you can't grant %q without holding it", ErrPermissionDenied, perm)
+			}
+		}
+	}
+
+	if err := s.rolePermRepo.ReplaceForRole(ctx, role, unique); err != nil {
+		return nil, errors.New("failed to update permissions")
+	}
+	s.invalidate()
+
+	return &models.RolePermissionsResponse{Role: role, Permissions: unique}, nil
+}
+
+// CanAssignRole returns ErrPermissionDenied unless a user with role caller
+// may give role to someone: admins may give any role, staff only roles
+// whose permissions they hold themselves
+func (s *PermissionService) CanAssignRole(ctx context.Context, caller, role models.Role) error {
+	if caller == models.RoleAdmin {
+		return nil
+	}
+	if role == models.RoleAdmin {
+		return fmt.Errorf("%w: only admins can grant the admin role", ErrPermissionDenied)
+	}
+
+	cache, err := s.mappings(ctx)
+	if err != nil {
+		return errors.New("failed to load permissions")
+	}
+	for _, perm := range models.AllPermissions {
+		if cache[role][perm] && !cache[caller][perm] {
+			return fmt.Errorf("%w: role %q has %q, which you don't hold", ErrPermissionDenied, role, perm)
+		}
+	}
+	return nil
+}
+
+func (s *PermissionService) mappings(ctx context.Context) (map[models.Role]map[models.Permission]bool, error) {
+	s.mu.RLock()
+	cache, loadedAt := s.cache, s.loadedAt
+	s.mu.RUnlock()
+	if cache != nil && time.Since(loadedAt) < permissionCacheTTL {
+		return cache, nil
+	}
+
+	rows, err := s.rolePermRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cache = make(map[models.Role]map[models.Permission]bool)
+	for _, row := range rows {
+		if cache[row.Role] == nil {
+			cache[row.Role] = make(map[models.Permission]bool)
+		}
+		cache[row.Role][row.Permission] = true
+	}
+
+	s.mu.Lock()
+	s.cache, s.loadedAt = cache, time.Now()
+	s.mu.Unlock()
+	return cache, nil
+}
+
+func (s *PermissionService) invalidate() {
+	s.mu.Lock()
+	s.cache = nil
+	s.mu.Unlock()
+}
@@ -0,0 +1,497 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bexiiiii/smart_food_store/internal/barcode"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"github.com/bexiiiii/smart_food_store/internal/units"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidImport is returned for CSV files that can't be read at all, e.g.
+// a missing or unknown header column. Problems with single rows are
+// reported in ProductImportResult.Errors instead.
+var ErrInvalidImport = errors.New("invalid import file")
+
+// ProductCSVColumns is the column order of exports; imports accept any
+// order and any subset that includes sku or name
+var ProductCSVColumns = []string{"sku", "barcode", "name", "description", "price", "stock", "unit", "category", "density", "piece_weight", "image_url"}
+
+// errRollback aborts the import transaction without reporting an error
+var errRollback = errors.New("rollback")
+
+// productRow is one parsed CSV row. Nil fields were empty or missing and
+// are left unchanged on update.
+type productRow struct {
+	line        int
+	sku         *string
+	barcode     *string
+	name        *string
+	description *string
+	price       *float64
+	stock       *float64
+	unit        *models.Unit
+	categoryID  *uint
+	density     *float64
+	pieceWeight *float64
+	imageURL    *string
+}
+
+// Import creates and updates products from CSV. A row updates the product
+// with the same SKU or, without a SKU match, the same name; otherwise it
+// creates one. Empty cells leave fields unchanged. All rows are applied in
+// one transaction, and nothing is applied if any row is invalid or dryRun
+// is set. Every product created or updated gets a product.import entry in
+// the audit log, written in the same transaction; actor gives its actor and
+// IP.
+func (s *ProductService) Import(ctx context.Context, r io.Reader, dryRun bool, actor models.AuditEntry) (*models.ProductImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: can't read header: %w", ErrInvalidImport, err)
+	}
+	columns, err := importColumns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.categoryRepo.GetAll(ctx)
+	if err != nil {
+		return nil, errors.New("failed to load categories")
+	}
+	categoryIDs := make(map[string]uint, len(categories))
+	for _, category := range categories {
+		categoryIDs[strings.ToLower(category.Name)] = category.ID
+	}
+
+	result := &models.ProductImportResult{DryRun: dryRun, Errors: []models.ProductImportError{}}
+	var readErr error
+	err = s.productRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		productRepo := s.productRepo.WithTx(tx)
+		seen := make(map[string]int)
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					result.Errors = append(result.Errors, models.ProductImportError{Row: parseErr.StartLine, Message: parseErr.Err.Error()})
+					continue
+				}
+				readErr = err
+				return err
+			}
+			line, _ := reader.FieldPos(0)
+			if isBlankRecord(record) {
+				continue
+			}
+			result.Rows++
+
+			row, rowErrors := parseProductRow(line, columns, record, categoryIDs)
+			if key := row.key(); key != "" {
+				if first, ok := seen[key]; ok {
+					rowErrors = append(rowErrors, models.ProductImportError{Row: line, Message: fmt.Sprintf("same product as row %d", first)})
+				} else {
+					seen[key] = line
+				}
+			}
+			if len(rowErrors) > 0 {
+				result.Errors = append(result.Errors, rowErrors...)
+				continue
+			}
+
+			product, before, rowErr, err := importProductRow(ctx, productRepo, row)
+			if err != nil {
+				return err
+			}
+			if rowErr != nil {
+				result.Errors = append(result.Errors, *rowErr)
+				continue
+			}
+			if before == nil {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+
+			// Entries of a failed import would be rolled back anyway
+			if dryRun || len(result.Errors) > 0 {
+				continue
+			}
+			after, err := productRepo.GetByID(ctx, product.ID)
+			if err != nil {
+				return err
+			}
+			entry := actor
+			entry.Action = "product.import"
+			entry.EntityType = models.AuditEntityProduct
+			entry.EntityID = strconv.FormatUint(uint64(product.ID), 10)
+			if before != nil {
+				entry.Before = before
+			}
+			entry.After = after
+			if err := s.auditService.RecordTx(ctx, tx, &entry); err != nil {
+				return err
+			}
+		}
+
+		if len(result.Errors) > 0 || dryRun {
+			return errRollback
+		}
+		return nil
+	})
+	if readErr != nil {
+		// Keeps e.g. the *http.MaxBytesError of an oversized upload
+		return nil, fmt.Errorf("failed to read import: %w", readErr)
+	}
+	if err != nil && err != errRollback {
+		return nil, errors.New("failed to import products")
+	}
+
+	if len(result.Errors) == 0 && !dryRun && result.Created+result.Updated > 0 {
+		s.notifyChange(ctx)
+	}
+	return result, nil
+}
+
+func importColumns(header []string) (map[string]int, error) {
+	known := make(map[string]bool, len(ProductCSVColumns))
+	for _, column := range ProductCSVColumns {
+		known[column] = true
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			// Spreadsheet programs like to start CSV files with a BOM
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown column %q (expected %s)", ErrInvalidImport, name, strings.Join(ProductCSVColumns, ", "))
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidImport, name)
+		}
+		columns[name] = i
+	}
+
+	_, hasSKU := columns["sku"]
+	_, hasName := columns["name"]
+	if !hasSKU && !hasName {
+		return nil, fmt.Errorf("%w: a sku or name column is required", ErrInvalidImport)
+	}
+	return columns, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseProductRow validates a record with the same rules as
+// ProductCreateRequest and ProductUpdateRequest
+func parseProductRow(line int, columns map[string]int, record []string, categoryIDs map[string]uint) (*productRow, []models.ProductImportError) {
+	row := &productRow{line: line}
+	var rowErrors []models.ProductImportError
+	fail := func(column, format string, args ...interface{}) {
+		rowErrors = append(rowErrors, models.ProductImportError{Row: line, Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+
+	cell := func(column string) *string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return nil
+		}
+		value := unescapeCSVFormula(strings.TrimSpace(record[i]))
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+	number := func(column string, min float64, inclusive bool) *float64 {
+		value := cell(column)
+		if value == nil {
+			return nil
+		}
+		n, err := strconv.ParseFloat(*value, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			fail(column, "%q is not a number", *value)
+			return nil
+		}
+		if n < min || (!inclusive && n == min) {
+			if inclusive {
+				fail(column, "must be at least %g", min)
+			} else {
+				fail(column, "must be greater than %g", min)
+			}
+			return nil
+		}
+		return &n
+	}
+
+	row.sku = cell("sku")
+	if row.sku != nil && utf8.RuneCountInString(*row.sku) > 64 {
+		fail("sku", "must be at most 64 characters")
+	}
+	if value := cell("barcode"); value != nil {
+		code, err := barcode.Normalize(*value)
+		if err != nil {
+			fail("barcode", "%v", err)
+		} else {
+			row.barcode = &code
+		}
+	}
+	row.name = cell("name")
+	if row.name != nil && (utf8.RuneCountInString(*row.name) < 2 || utf8.RuneCountInString(*row.name) > 150) {
+		fail("name", "must be 2 to 150 characters")
+	}
+	row.description = cell("description")
+	if row.description != nil && utf8.RuneCountInString(*row.description) > 500 {
+		fail("description", "must be at most 500 characters")
+	}
+	row.price = number("price", 0, false)
+	row.stock = number("stock", 0, true)
+	row.density = number("density", 0, true)
+	row.pieceWeight = number("piece_weight", 0, true)
+	row.imageURL = cell("image_url")
+
+	if value := cell("unit"); value != nil {
+		unit, err := units.Parse(*value)
+		if err != nil {
+			fail("unit", "%v", err)
+		} else {
+			row.unit = &unit
+		}
+	}
+	if value := cell("category"); value != nil {
+		id, ok := categoryIDs[strings.ToLower(*value)]
+		if !ok {
+			fail("category", "unknown category %q", *value)
+		} else {
+			row.categoryID = &id
+		}
+	}
+
+	if row.sku == nil && row.name == nil {
+		fail("", "sku or name is required")
+	}
+	return row, rowErrors
+}
+
+// key identifies the product a row is about, to catch the same product
+// listed twice
+func (r *productRow) key() string {
+	if r.sku != nil {
+		return "sku:" + *r.sku
+	}
+	if r.name != nil {
+		return "name:" + strings.ToLower(*r.name)
+	}
+	return ""
+}
+
+// importProductRow writes one row. It returns the product and, if the row
+// updated one, the product as GetByID loaded it before. A database error
+// ends the import, since the transaction can't continue.
+func importProductRow(ctx context.Context, productRepo repository.ProductStore, row *productRow) (*models.Product, *models.Product, *models.ProductImportError, error) {
+	rowError := func(message string) *models.ProductImportError {
+		return &models.ProductImportError{Row: row.line, Message: message}
+	}
+
+	var product *models.Product
+	if row.sku != nil {
+		if existing, err := productRepo.GetBySKU(ctx, *row.sku); err == nil {
+			product = existing
+		}
+	}
+	if product == nil && row.name != nil {
+		matches, err := productRepo.GetByName(ctx, *row.name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		// Without a SKU match, only products that have no SKU yet (or the
+		// same one) can be matched by name
+		var candidates []models.Product
+		for _, match := range matches {
+			if match.SKU == nil || (row.sku != nil && *match.SKU == *row.sku) {
+				candidates = append(candidates, match)
+			}
+		}
+		if len(candidates) > 1 {
+			return nil, nil, rowError(fmt.Sprintf("%d products are named %q; add a sku column to tell them apart", len(candidates), *row.name)), nil
+		}
+		if len(candidates) == 1 {
+			product = &candidates[0]
+		}
+		if product == nil && row.sku == nil && len(matches) > 0 {
+			return nil, nil, rowError(fmt.Sprintf("%q already has a SKU; add a sku column to update it", *row.name)), nil
+		}
+	}
+
+	// SKUs and barcodes are unique across products and variants
+	if row.sku != nil {
+		if variant, err := productRepo.GetVariantBySKU(ctx, *row.sku); err == nil {
+			return nil, nil, rowError(fmt.Sprintf("sku %q is already used by variant %d of product %d", *row.sku, variant.ID, variant.ProductID)), nil
+		}
+	}
+	if row.barcode != nil {
+		if existing, err := productRepo.GetByBarcode(ctx, *row.barcode); err == nil && (product == nil || existing.ID != product.ID) {
+			return nil, nil, rowError(fmt.Sprintf("barcode %s is already used by product %d", *row.barcode, existing.ID)), nil
+		}
+		if variant, err := productRepo.GetVariantByBarcode(ctx, *row.barcode); err == nil {
+			return nil, nil, rowError(fmt.Sprintf("barcode %s is already used by variant %d of product %d", *row.barcode, variant.ID, variant.ProductID)), nil
+		}
+	}
+
+	if product == nil {
+		if row.name == nil || row.price == nil || row.unit == nil || row.categoryID == nil {
+			return nil, nil, rowError("new products need name, price, unit and category"), nil
+		}
+		product = &models.Product{}
+		applyProductRow(product, row)
+		if err := productRepo.Create(ctx, product); err != nil {
+			return nil, nil, nil, err
+		}
+		return product, nil, nil, recordPriceChange(ctx, productRepo, product, nil, models.PriceSourceImport)
+	}
+
+	before, err := productRepo.GetByID(ctx, product.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	oldPrice := product.Price
+	applyProductRow(product, row)
+	if err := productRepo.Update(ctx, product); err != nil {
+		return nil, nil, nil, err
+	}
+	if product.Price == oldPrice {
+		return product, before, nil, nil
+	}
+	return product, before, nil, recordPriceChange(ctx, productRepo, product, &oldPrice, models.PriceSourceImport)
+}
+
+func applyProductRow(product *models.Product, row *productRow) {
+	if row.sku != nil {
+		product.SKU = row.sku
+	}
+	if row.barcode != nil {
+		product.Barcode = row.barcode
+	}
+	if row.name != nil {
+		product.Name = *row.name
+	}
+	if row.description != nil {
+		product.Description = *row.description
+	}
+	if row.price != nil {
+		product.Price = *row.price
+	}
+	if row.stock != nil {
+		product.Stock = *row.stock
+	}
+	if row.unit != nil {
+		product.Unit = *row.unit
+	}
+	if row.categoryID != nil {
+		product.CategoryID = *row.categoryID
+		product.Category = nil
+	}
+	if row.density != nil {
+		product.Density = *row.density
+	}
+	if row.pieceWeight != nil {
+		product.PieceWeight = *row.pieceWeight
+	}
+	if row.imageURL != nil {
+		product.ImageURL = *row.imageURL
+	}
+}
+
+// Export writes every product as CSV, in the format Import reads
+func (s *ProductService) Export(ctx context.Context, w io.Writer) error {
+	products, err := s.productRepo.GetAll(ctx)
+	if err != nil {
+		return errors.New("failed to load products")
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(ProductCSVColumns); err != nil {
+		return err
+	}
+	for _, product := range products {
+		sku, code, category := "", "", ""
+		if product.SKU != nil {
+			sku = *product.SKU
+		}
+		if product.Barcode != nil {
+			code = *product.Barcode
+		}
+		if product.Category != nil {
+			category = product.Category.Name
+		}
+		record := []string{
+			escapeCSVFormula(sku),
+			code,
+			escapeCSVFormula(product.Name),
+			escapeCSVFormula(product.Description),
+			formatCSVNumber(product.Price),
+			formatCSVNumber(product.Stock),
+			string(product.Unit),
+			escapeCSVFormula(category),
+			formatCSVNumber(product.Density),
+			formatCSVNumber(product.PieceWeight),
+			escapeCSVFormula(product.ImageURL),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Spreadsheets run a cell starting with one of these as a formula
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// escapeCSVFormula prefixes text that a spreadsheet would run as a formula
+// with a quote, which makes it plain text
+func escapeCSVFormula(s string) string {
+	if s != "" && strings.IndexByte(csvFormulaPrefixes, s[0]) >= 0 {
+		return "'" + s
+	}
+	return s
+}
+
+// unescapeCSVFormula undoes escapeCSVFormula, so exports import back as they
+// were
+func unescapeCSVFormula(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.IndexByte(csvFormulaPrefixes, s[1]) >= 0 {
+		return s[1:]
+	}
+	return s
+}
+
+func formatCSVNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
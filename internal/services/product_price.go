@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+// recordPriceChange adds product's current price to its price history.
+// oldPrice is nil for a new product.
+func recordPriceChange(ctx context.Context, productRepo repository.ProductStore, product *models.Product, oldPrice *float64, source models.PriceChangeSource) error {
+	return productRepo.CreatePriceChange(ctx, &models.PriceChange{
+		ProductID: product.ID,
+		OldPrice:  oldPrice,
+		Price:     product.Price,
+		Source:    source,
+	})
+}
+
+// recordVariantPriceChange adds variant's current price to the price history
+// of its product. oldPrice is nil for a new variant.
+func recordVariantPriceChange(ctx context.Context, productRepo repository.ProductStore, variant *models.ProductVariant, oldPrice *float64) error {
+	return productRepo.CreatePriceChange(ctx, &models.PriceChange{
+		ProductID: variant.ProductID,
+		VariantID: &variant.ID,
+		OldPrice:  oldPrice,
+		Price:     variant.Price,
+		Source:    models.PriceSourceManual,
+	})
+}
+
+// GetPriceHistory returns a product's price changes, oldest first. With days
+// above 0, only changes from the last days days are included.
+func (s *ProductService) GetPriceHistory(ctx context.Context, productID uint, days int) (*models.PriceHistoryResponse, error) {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+
+	var since *time.Time
+	if days > 0 {
+		from := time.Now().AddDate(0, 0, -days)
+		since = &from
+	}
+	changes, err := s.productRepo.GetPriceHistory(ctx, productID, since)
+	if err != nil {
+		return nil, errors.New("failed to get price history")
+	}
+
+	return &models.PriceHistoryResponse{
+		ProductID: product.ID,
+		Price:     product.Price,
+		Unit:      product.Unit,
+		Changes:   changes,
+	}, nil
+}
+
+// SchedulePrice sets a future price for a product. The price scheduler
+// applies it once req.EffectiveAt has passed.
+func (s *ProductService) SchedulePrice(ctx context.Context, productID uint, req *models.ScheduledPriceRequest) (*models.ScheduledPrice, error) {
+	if _, err := s.productRepo.GetByID(ctx, productID); err != nil {
+		return nil, ErrProductNotFound
+	}
+	if !req.EffectiveAt.After(time.Now()) {
+		return nil, errors.New("effective_at must be in the future")
+	}
+
+	scheduled := &models.ScheduledPrice{
+		ProductID:   productID,
+		Price:       req.Price,
+		EffectiveAt: req.EffectiveAt,
+	}
+	if err := s.productRepo.CreateScheduledPrice(ctx, scheduled); err != nil {
+		return nil, errors.New("failed to schedule price")
+	}
+	return scheduled, nil
+}
+
+func (s *ProductService) GetScheduledPrices(ctx context.Context, productID uint) ([]models.ScheduledPrice, error) {
+	if _, err := s.productRepo.GetByID(ctx, productID); err != nil {
+		return nil, ErrProductNotFound
+	}
+	return s.productRepo.GetScheduledPrices(ctx, productID)
+}
+
+// CancelScheduledPrice deletes a scheduled price that hasn't been applied yet
+func (s *ProductService) CancelScheduledPrice(ctx context.Context, productID, id uint) error {
+	scheduled, err := s.productRepo.GetScheduledPrice(ctx, productID, id)
+	if err != nil {
+		return errors.New("scheduled price not found")
+	}
+	if scheduled.AppliedAt != nil {
+		return errors.New("scheduled price has already been applied")
+	}
+	if err := s.productRepo.DeleteScheduledPrice(ctx, id); err != nil {
+		return errors.New("failed to cancel scheduled price")
+	}
+	return nil
+}
+
+// ApplyScheduledPrices sets the price of every product with a scheduled
+// price due at now and returns how many changed a price. When several are due
+// for one product they're applied in order, so the latest one wins and each
+// shows up in the price history.
+func (s *ProductService) ApplyScheduledPrices(ctx context.Context, now time.Time) (int, error) {
+	due, err := s.productRepo.GetDueScheduledPrices(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, scheduled := range due {
+		changed := false
+		err = s.productRepo.Transaction(ctx, func(tx *gorm.DB) error {
+			productRepo := s.productRepo.WithTx(tx)
+
+			marked, err := productRepo.MarkScheduledPriceApplied(ctx, scheduled.ID, now)
+			if err != nil || !marked {
+				return err
+			}
+			product, err := productRepo.GetByID(ctx, scheduled.ProductID)
+			if err != nil {
+				return err
+			}
+			if product.Price == scheduled.Price {
+				return nil
+			}
+
+			oldPrice := product.Price
+			if err := productRepo.UpdatePrice(ctx, product.ID, scheduled.Price); err != nil {
+				return err
+			}
+			changed = true
+			return productRepo.CreatePriceChange(ctx, &models.PriceChange{
+				ProductID:        product.ID,
+				OldPrice:         &oldPrice,
+				Price:            scheduled.Price,
+				Source:           models.PriceSourceSchedule,
+				ScheduledPriceID: &scheduled.ID,
+			})
+		})
+		if err != nil {
+			break
+		}
+		if changed {
+			applied++
+		}
+	}
+
+	if applied > 0 {
+		s.notifyChange(ctx)
+	}
+	return applied, err
+}
+
+// StartPriceScheduler applies due scheduled prices every interval until ctx
+// is cancelled. The returned channel is closed once the scheduler has stopped.
+func (s *ProductService) StartPriceScheduler(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				applied, err := s.ApplyScheduledPrices(ctx, now)
+				if err != nil {
+					slog.ErrorContext(ctx, "Scheduled price update failed", "error", err)
+				}
+				if applied > 0 {
+					slog.InfoContext(ctx, "Applied scheduled prices", "count", applied)
+				}
+			}
+		}
+	}()
+	return done
+}
@@ -1,75 +1,204 @@
 package services
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/bexiiiii/smart_food_store/internal/models"
 	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"github.com/bexiiiii/smart_food_store/internal/units"
+	"gorm.io/gorm"
 )
 
+// ErrInvalidProductQuery is returned for listing filters or cursors that
+// can't be applied
+var ErrInvalidProductQuery = errors.New("invalid product query")
+
+const defaultProductPageSize = 20
+
 type ProductService struct {
-	productRepo  *repository.ProductRepository
-	categoryRepo *repository.CategoryRepository
+	productRepo  repository.ProductStore
+	categoryRepo repository.CategoryStore
+	auditService *AuditService
+	onChange     []func(ctx context.Context)
 }
 
-func NewProductService(productRepo *repository.ProductRepository, categoryRepo *repository.CategoryRepository) *ProductService {
+func NewProductService(productRepo repository.ProductStore, categoryRepo repository.CategoryStore, auditService *AuditService) *ProductService {
 	return &ProductService{
 		productRepo:  productRepo,
 		categoryRepo: categoryRepo,
+		auditService: auditService,
+	}
+}
+
+// OnChange registers fn to run after a product is created, updated or
+// deleted, e.g. to invalidate caches built from the catalog
+func (s *ProductService) OnChange(fn func(ctx context.Context)) {
+	s.onChange = append(s.onChange, fn)
+}
+
+func (s *ProductService) notifyChange(ctx context.Context) {
+	for _, fn := range s.onChange {
+		fn(ctx)
 	}
 }
 
 // Product methods
-func (s *ProductService) Create(req *models.ProductCreateRequest) (*models.Product, error) {
+func (s *ProductService) Create(ctx context.Context, req *models.ProductCreateRequest) (*models.Product, error) {
 	// Validate category exists
-	_, err := s.categoryRepo.GetByID(req.CategoryID)
+	_, err := s.categoryRepo.GetByID(ctx, req.CategoryID)
 	if err != nil {
 		return nil, errors.New("category not found")
 	}
 
+	unit, err := units.Parse(string(req.Unit))
+	if err != nil {
+		return nil, err
+	}
+
+	sku, err := s.checkSKU(ctx, req.SKU, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	code, err := s.checkBarcode(ctx, req.Barcode, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	product := &models.Product{
+		SKU:         sku,
+		Barcode:     code,
 		Name:        req.Name,
 		Description: req.Description,
 		Price:       req.Price,
 		Stock:       req.Stock,
-		Unit:        req.Unit,
+		Unit:        unit,
+		Density:     req.Density,
+		PieceWeight: req.PieceWeight,
 		CategoryID:  req.CategoryID,
 		ImageURL:    req.ImageURL,
 	}
 
-	if err := s.productRepo.Create(product); err != nil {
+	err = s.productRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		productRepo := s.productRepo.WithTx(tx)
+		if err := productRepo.Create(ctx, product); err != nil {
+			return err
+		}
+		return recordPriceChange(ctx, productRepo, product, nil, models.PriceSourceManual)
+	})
+	if err != nil {
 		return nil, errors.New("failed to create product")
 	}
+	s.notifyChange(ctx)
 
-	return s.productRepo.GetByID(product.ID)
+	return s.productRepo.GetByID(ctx, product.ID)
 }
 
-func (s *ProductService) GetByID(id uint) (*models.Product, error) {
-	return s.productRepo.GetByID(id)
+func (s *ProductService) GetByID(ctx context.Context, id uint) (*models.Product, error) {
+	return s.productRepo.GetByID(ctx, id)
 }
 
-func (s *ProductService) GetAll() ([]models.Product, error) {
-	return s.productRepo.GetAll()
-}
+// List returns one page of products for q. Invalid filters or cursors are
+// reported as ErrInvalidProductQuery.
+func (s *ProductService) List(ctx context.Context, q *models.ProductQuery) (*models.ProductListResponse, error) {
+	if q.Limit == 0 {
+		q.Limit = defaultProductPageSize
+	}
+	if q.Sort == "" {
+		q.Sort = "created_at"
+		if q.Query != "" {
+			q.Sort = "relevance"
+		}
+	}
+	if q.Order == "" {
+		q.Order = "asc"
+		if q.Sort == "relevance" {
+			q.Order = "desc"
+		}
+	}
+	if q.Sort == "relevance" {
+		if q.Query == "" {
+			return nil, fmt.Errorf("%w: sorting by relevance requires q", ErrInvalidProductQuery)
+		}
+		// Ranks depend on the query text, so relevance pages by offset only
+		if q.Cursor != "" {
+			return nil, fmt.Errorf("%w: cursor pagination is not available when sorting by relevance", ErrInvalidProductQuery)
+		}
+	}
+	if q.Unit != "" {
+		unit, err := units.Parse(string(q.Unit))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProductQuery, err)
+		}
+		q.Unit = unit
+	}
+	if q.MinPrice != nil && q.MaxPrice != nil && *q.MinPrice > *q.MaxPrice {
+		return nil, fmt.Errorf("%w: min_price is greater than max_price", ErrInvalidProductQuery)
+	}
 
-func (s *ProductService) GetByCategory(categoryID uint) ([]models.Product, error) {
-	return s.productRepo.GetByCategory(categoryID)
-}
+	var after *repository.ProductCursor
+	if q.Cursor != "" {
+		cursor, err := decodeProductCursor(q.Cursor, q.Sort, q.Order)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProductQuery, err)
+		}
+		after = cursor
+	} else if q.Page == 0 {
+		q.Page = 1
+	}
 
-func (s *ProductService) Search(query string) ([]models.Product, error) {
-	return s.productRepo.Search(query)
+	products, total, err := s.productRepo.List(ctx, q, after)
+	if err != nil {
+		return nil, errors.New("failed to list products")
+	}
+
+	response := &models.ProductListResponse{
+		Items: products,
+		Total: total,
+		Limit: q.Limit,
+	}
+	if after == nil {
+		response.Page = q.Page
+	}
+	if len(products) > q.Limit {
+		response.Items = products[:q.Limit]
+		if q.Sort != "relevance" {
+			response.NextCursor = encodeProductCursor(&response.Items[q.Limit-1], q.Sort, q.Order)
+		}
+	}
+
+	return response, nil
 }
 
-func (s *ProductService) GetByIDs(ids []uint) ([]models.Product, error) {
-	return s.productRepo.GetByIDs(ids)
+func (s *ProductService) GetByIDs(ctx context.Context, ids []uint) ([]models.Product, error) {
+	return s.productRepo.GetByIDs(ctx, ids)
 }
 
-func (s *ProductService) Update(id uint, req *models.ProductUpdateRequest) (*models.Product, error) {
-	product, err := s.productRepo.GetByID(id)
+func (s *ProductService) Update(ctx context.Context, id uint, req *models.ProductUpdateRequest) (*models.Product, error) {
+	product, err := s.productRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, errors.New("product not found")
 	}
+	oldPrice := product.Price
 
+	if req.SKU != nil {
+		sku, err := s.checkSKU(ctx, *req.SKU, id, 0)
+		if err != nil {
+			return nil, err
+		}
+		product.SKU = sku
+	}
+	if req.Barcode != nil {
+		code, err := s.checkBarcode(ctx, *req.Barcode, id, 0)
+		if err != nil {
+			return nil, err
+		}
+		product.Barcode = code
+	}
 	if req.Name != nil {
 		product.Name = *req.Name
 	}
@@ -83,11 +212,21 @@ func (s *ProductService) Update(id uint, req *models.ProductUpdateRequest) (*mod
 		product.Stock = *req.Stock
 	}
 	if req.Unit != nil {
-		product.Unit = *req.Unit
+		unit, err := units.Parse(string(*req.Unit))
+		if err != nil {
+			return nil, err
+		}
+		product.Unit = unit
+	}
+	if req.Density != nil {
+		product.Density = *req.Density
+	}
+	if req.PieceWeight != nil {
+		product.PieceWeight = *req.PieceWeight
 	}
 	if req.CategoryID != nil {
 		// Validate category exists
-		_, err := s.categoryRepo.GetByID(*req.CategoryID)
+		_, err := s.categoryRepo.GetByID(ctx, *req.CategoryID)
 		if err != nil {
 			return nil, errors.New("category not found")
 		}
@@ -97,61 +236,139 @@ func (s *ProductService) Update(id uint, req *models.ProductUpdateRequest) (*mod
 		product.ImageURL = *req.ImageURL
 	}
 
-	if err := s.productRepo.Update(product); err != nil {
+	// Price changes go into the price history along with the update
+	err = s.productRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		productRepo := s.productRepo.WithTx(tx)
+		if err := productRepo.Update(ctx, product); err != nil {
+			return err
+		}
+		if product.Price == oldPrice {
+			return nil
+		}
+		return recordPriceChange(ctx, productRepo, product, &oldPrice, models.PriceSourceManual)
+	})
+	if err != nil {
 		return nil, errors.New("failed to update product")
 	}
+	s.notifyChange(ctx)
 
-	return s.productRepo.GetByID(id)
+	return s.productRepo.GetByID(ctx, id)
 }
 
-func (s *ProductService) Delete(id uint) error {
-	return s.productRepo.Delete(id)
+func (s *ProductService) Delete(ctx context.Context, id uint) error {
+	if err := s.productRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.notifyChange(ctx)
+	return nil
 }
 
-func (s *ProductService) UpdateStock(id uint, quantity float64) error {
-	return s.productRepo.UpdateStock(id, quantity)
+func (s *ProductService) UpdateStock(ctx context.Context, id uint, quantity float64) error {
+	return s.productRepo.UpdateStock(ctx, id, quantity)
 }
 
-func (s *ProductService) GetAllWithStock() ([]models.Product, error) {
-	return s.productRepo.GetAllWithStock()
+func (s *ProductService) GetAllWithStock(ctx context.Context) ([]models.Product, error) {
+	return s.productRepo.GetAllWithStock(ctx)
 }
 
 // Category methods
-func (s *ProductService) CreateCategory(req *models.CategoryCreateRequest) (*models.Category, error) {
+func (s *ProductService) CreateCategory(ctx context.Context, req *models.CategoryCreateRequest) (*models.Category, error) {
 	category := &models.Category{
 		Name: req.Name,
 	}
 
-	if err := s.categoryRepo.Create(category); err != nil {
+	if err := s.categoryRepo.Create(ctx, category); err != nil {
 		return nil, errors.New("failed to create category")
 	}
 
 	return category, nil
 }
 
-func (s *ProductService) GetCategoryByID(id uint) (*models.Category, error) {
-	return s.categoryRepo.GetByID(id)
+func (s *ProductService) GetCategoryByID(ctx context.Context, id uint) (*models.Category, error) {
+	return s.categoryRepo.GetByID(ctx, id)
 }
 
-func (s *ProductService) GetAllCategories() ([]models.Category, error) {
-	return s.categoryRepo.GetAll()
+func (s *ProductService) GetAllCategories(ctx context.Context) ([]models.Category, error) {
+	return s.categoryRepo.GetAll(ctx)
 }
 
-func (s *ProductService) UpdateCategory(id uint, name string) (*models.Category, error) {
-	category, err := s.categoryRepo.GetByID(id)
+func (s *ProductService) UpdateCategory(ctx context.Context, id uint, name string) (*models.Category, error) {
+	category, err := s.categoryRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, errors.New("category not found")
 	}
 
 	category.Name = name
 
-	if err := s.categoryRepo.Update(category); err != nil {
+	if err := s.categoryRepo.Update(ctx, category); err != nil {
 		return nil, errors.New("failed to update category")
 	}
 
 	return category, nil
 }
 
-func (s *ProductService) DeleteCategory(id uint) error {
-	return s.categoryRepo.Delete(id)
+func (s *ProductService) DeleteCategory(ctx context.Context, id uint) error {
+	return s.categoryRepo.Delete(ctx, id)
+}
+
+// productCursor is the JSON payload of an opaque next_cursor. Sort and order
+// are included so a cursor can't be replayed against a different ordering.
+type productCursor struct {
+	Sort  string          `json:"s"`
+	Order string          `json:"o"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+func encodeProductCursor(last *models.Product, sort, order string) string {
+	var value interface{}
+	switch sort {
+	case "price":
+		value = last.Price
+	case "name":
+		value = last.Name
+	default:
+		value = last.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	raw, _ := json.Marshal(value)
+	data, _ := json.Marshal(productCursor{Sort: sort, Order: order, Value: raw, ID: last.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeProductCursor(encoded, sort, order string) (*repository.ProductCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	var cursor productCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	if cursor.Sort != sort || cursor.Order != order {
+		return nil, errors.New("cursor was issued for a different sort order")
+	}
+
+	result := &repository.ProductCursor{ID: cursor.ID}
+	switch sort {
+	case "price":
+		var price float64
+		err = json.Unmarshal(cursor.Value, &price)
+		result.Value = price
+	case "name":
+		var name string
+		err = json.Unmarshal(cursor.Value, &name)
+		result.Value = name
+	default:
+		var createdAt string
+		if err = json.Unmarshal(cursor.Value, &createdAt); err == nil {
+			result.Value, err = time.Parse(time.RFC3339Nano, createdAt)
+		}
+	}
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	return result, nil
 }
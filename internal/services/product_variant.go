@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/bexiiiii/smart_food_store/internal/barcode"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"gorm.io/gorm"
+)
+
+var ErrProductNotFound = errors.New("product not found")
+
+func (s *ProductService) CreateVariant(ctx context.Context, productID uint, req *models.ProductVariantCreateRequest) (*models.Product, error) {
+	if _, err := s.productRepo.GetByID(ctx, productID); err != nil {
+		return nil, ErrProductNotFound
+	}
+
+	sku, err := s.checkSKU(ctx, req.SKU, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	code, err := s.checkBarcode(ctx, req.Barcode, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	variant := &models.ProductVariant{
+		ProductID: productID,
+		Name:      req.Name,
+		SKU:       sku,
+		Barcode:   code,
+		Size:      req.Size,
+		Price:     req.Price,
+		Stock:     req.Stock,
+	}
+	err = s.productRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		productRepo := s.productRepo.WithTx(tx)
+		if err := productRepo.CreateVariant(ctx, variant); err != nil {
+			return err
+		}
+		return recordVariantPriceChange(ctx, productRepo, variant, nil)
+	})
+	if err != nil {
+		return nil, errors.New("failed to create variant")
+	}
+	s.notifyChange(ctx)
+
+	return s.productRepo.GetByID(ctx, productID)
+}
+
+func (s *ProductService) UpdateVariant(ctx context.Context, productID, variantID uint, req *models.ProductVariantUpdateRequest) (*models.Product, error) {
+	variant, err := s.productRepo.GetVariant(ctx, productID, variantID)
+	if err != nil {
+		return nil, errors.New("variant not found")
+	}
+
+	if req.SKU != nil {
+		sku, err := s.checkSKU(ctx, *req.SKU, 0, variantID)
+		if err != nil {
+			return nil, err
+		}
+		variant.SKU = sku
+	}
+	if req.Barcode != nil {
+		code, err := s.checkBarcode(ctx, *req.Barcode, 0, variantID)
+		if err != nil {
+			return nil, err
+		}
+		variant.Barcode = code
+	}
+	if req.Name != nil {
+		variant.Name = *req.Name
+	}
+	if req.Size != nil {
+		variant.Size = *req.Size
+	}
+	oldPrice := variant.Price
+	if req.Price != nil {
+		variant.Price = *req.Price
+	}
+	if req.Stock != nil {
+		variant.Stock = *req.Stock
+	}
+
+	// Price changes go into the price history along with the update
+	err = s.productRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		productRepo := s.productRepo.WithTx(tx)
+		if err := productRepo.UpdateVariant(ctx, variant); err != nil {
+			return err
+		}
+		if variant.Price == oldPrice {
+			return nil
+		}
+		return recordVariantPriceChange(ctx, productRepo, variant, &oldPrice)
+	})
+	if err != nil {
+		return nil, errors.New("failed to update variant")
+	}
+	s.notifyChange(ctx)
+
+	return s.productRepo.GetByID(ctx, productID)
+}
+
+func (s *ProductService) DeleteVariant(ctx context.Context, productID, variantID uint) error {
+	if _, err := s.productRepo.GetVariant(ctx, productID, variantID); err != nil {
+		return errors.New("variant not found")
+	}
+	if err := s.productRepo.DeleteVariant(ctx, variantID); err != nil {
+		return errors.New("failed to delete variant")
+	}
+	s.notifyChange(ctx)
+	return nil
+}
+
+// GetByBarcode finds the product, or the product variant, a scanned barcode
+// is printed on. Malformed codes are reported as barcode.ErrInvalid.
+func (s *ProductService) GetByBarcode(ctx context.Context, code string) (*models.BarcodeLookupResponse, error) {
+	normalized, err := barcode.Normalize(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if product, err := s.productRepo.GetByBarcode(ctx, normalized); err == nil {
+		return &models.BarcodeLookupResponse{Product: product}, nil
+	}
+
+	variant, err := s.productRepo.GetVariantByBarcode(ctx, normalized)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+	product, err := s.productRepo.GetByID(ctx, variant.ProductID)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
+	return &models.BarcodeLookupResponse{Product: product, Variant: variant}, nil
+}
+
+// checkSKU trims a SKU and makes sure no other product or variant uses it.
+// productID or variantID is the product or variant being saved (0 for a new
+// one). An empty SKU is returned as nil (no SKU).
+func (s *ProductService) checkSKU(ctx context.Context, sku string, productID, variantID uint) (*string, error) {
+	sku = strings.TrimSpace(sku)
+	if sku == "" {
+		return nil, nil
+	}
+	if existing, err := s.productRepo.GetBySKU(ctx, sku); err == nil && (variantID != 0 || existing.ID != productID) {
+		return nil, fmt.Errorf("sku %q is already used by product %d", sku, existing.ID)
+	}
+	if existing, err := s.productRepo.GetVariantBySKU(ctx, sku); err == nil && existing.ID != variantID {
+		return nil, fmt.Errorf("sku %q is already used by variant %d of product %d", sku, existing.ID, existing.ProductID)
+	}
+	return &sku, nil
+}
+
+// checkBarcode validates and normalizes a barcode and makes sure no other
+// product or variant uses it, like checkSKU
+func (s *ProductService) checkBarcode(ctx context.Context, code string, productID, variantID uint) (*string, error) {
+	if strings.TrimSpace(code) == "" {
+		return nil, nil
+	}
+	normalized, err := barcode.Normalize(code)
+	if err != nil {
+		return nil, err
+	}
+	if existing, err := s.productRepo.GetByBarcode(ctx, normalized); err == nil && (variantID != 0 || existing.ID != productID) {
+		return nil, fmt.Errorf("barcode %s is already used by product %d", normalized, existing.ID)
+	}
+	if existing, err := s.productRepo.GetVariantByBarcode(ctx, normalized); err == nil && existing.ID != variantID {
+		return nil, fmt.Errorf("barcode %s is already used by variant %d of product %d", normalized, existing.ID, existing.ProductID)
+	}
+	return &normalized, nil
+}
+
+// findVariant returns the variant of product with the given ID, or nil
+func findVariant(product *models.Product, variantID uint) *models.ProductVariant {
+	for i := range product.Variants {
+		if product.Variants[i].ID == variantID {
+			return &product.Variants[i]
+		}
+	}
+	return nil
+}
+
+// variantPacks is the number of whole packs of variant needed for quantity,
+// given in the product's unit
+func variantPacks(variant *models.ProductVariant, quantity float64) float64 {
+	// Allow for float noise so 3 x 0.1 kg doesn't become 4 packs
+	return math.Ceil(quantity/variant.Size - 1e-9)
+}
+
+// cheapestVariant picks the in-stock variant of product that covers quantity
+// (in the product's unit) for the lowest price, preferring fewer packs on a
+// tie. It returns nil if no variant has enough packs in stock.
+func cheapestVariant(product *models.Product, quantity float64) (*models.ProductVariant, float64) {
+	var best *models.ProductVariant
+	var bestPacks float64
+	for i := range product.Variants {
+		variant := &product.Variants[i]
+		packs := variantPacks(variant, quantity)
+		if packs < 1 || variant.Stock < packs {
+			continue
+		}
+		if best == nil {
+			best, bestPacks = variant, packs
+			continue
+		}
+		cost, bestCost := packs*variant.Price, bestPacks*best.Price
+		if cost < bestCost || (cost == bestCost && packs < bestPacks) {
+			best, bestPacks = variant, packs
+		}
+	}
+	return best, bestPacks
+}
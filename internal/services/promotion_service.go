@@ -0,0 +1,386 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+)
+
+var ErrPromotionNotFound = errors.New("promotion not found")
+
+type PromotionService struct {
+	promotionRepo repository.PromotionStore
+	productRepo   repository.ProductStore
+	categoryRepo  repository.CategoryStore
+}
+
+func NewPromotionService(promotionRepo repository.PromotionStore, productRepo repository.ProductStore, categoryRepo repository.CategoryStore) *PromotionService {
+	return &PromotionService{
+		promotionRepo: promotionRepo,
+		productRepo:   productRepo,
+		categoryRepo:  categoryRepo,
+	}
+}
+
+func (s *PromotionService) Create(ctx context.Context, req *models.PromotionCreateRequest) (*models.Promotion, error) {
+	promotion := &models.Promotion{
+		Name:         req.Name,
+		Type:         req.Type,
+		Value:        req.Value,
+		BuyQuantity:  req.BuyQuantity,
+		GetQuantity:  req.GetQuantity,
+		ProductID:    req.ProductID,
+		CategoryID:   req.CategoryID,
+		StartsAt:     req.StartsAt,
+		EndsAt:       req.EndsAt,
+		UsageLimit:   req.UsageLimit,
+		PerUserLimit: req.PerUserLimit,
+		Active:       req.Active == nil || *req.Active,
+	}
+	if code := normalizeCouponCode(req.Code); code != "" {
+		promotion.Code = &code
+	}
+
+	if err := s.validate(ctx, promotion); err != nil {
+		return nil, err
+	}
+
+	if err := s.promotionRepo.Create(ctx, promotion); err != nil {
+		return nil, errors.New("failed to create promotion")
+	}
+	return promotion, nil
+}
+
+func (s *PromotionService) GetAll(ctx context.Context) ([]models.Promotion, error) {
+	return s.promotionRepo.GetAll(ctx)
+}
+
+func (s *PromotionService) GetByID(ctx context.Context, id uint) (*models.Promotion, error) {
+	promotion, err := s.promotionRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, ErrPromotionNotFound
+	}
+	return promotion, nil
+}
+
+func (s *PromotionService) Update(ctx context.Context, id uint, req *models.PromotionUpdateRequest) (*models.Promotion, error) {
+	promotion, err := s.promotionRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, ErrPromotionNotFound
+	}
+
+	if req.Name != nil {
+		promotion.Name = *req.Name
+	}
+	if req.Type != nil {
+		promotion.Type = *req.Type
+	}
+	if req.Value != nil {
+		promotion.Value = *req.Value
+	}
+	if req.BuyQuantity != nil {
+		promotion.BuyQuantity = *req.BuyQuantity
+	}
+	if req.GetQuantity != nil {
+		promotion.GetQuantity = *req.GetQuantity
+	}
+	if req.ProductID != nil {
+		promotion.ProductID = zeroToNil(*req.ProductID)
+	}
+	if req.CategoryID != nil {
+		promotion.CategoryID = zeroToNil(*req.CategoryID)
+	}
+	if req.Code != nil {
+		promotion.Code = nil
+		if code := normalizeCouponCode(*req.Code); code != "" {
+			promotion.Code = &code
+		}
+	}
+	if req.StartsAt != nil {
+		promotion.StartsAt = req.StartsAt
+	}
+	if req.EndsAt != nil {
+		promotion.EndsAt = req.EndsAt
+	}
+	if req.UsageLimit != nil {
+		promotion.UsageLimit = nil
+		if *req.UsageLimit > 0 {
+			promotion.UsageLimit = req.UsageLimit
+		}
+	}
+	if req.PerUserLimit != nil {
+		promotion.PerUserLimit = nil
+		if *req.PerUserLimit > 0 {
+			promotion.PerUserLimit = req.PerUserLimit
+		}
+	}
+	if req.Active != nil {
+		promotion.Active = *req.Active
+	}
+
+	if err := s.validate(ctx, promotion); err != nil {
+		return nil, err
+	}
+
+	if err := s.promotionRepo.Update(ctx, promotion); err != nil {
+		return nil, errors.New("failed to update promotion")
+	}
+	return promotion, nil
+}
+
+func (s *PromotionService) Delete(ctx context.Context, id uint) error {
+	if _, err := s.promotionRepo.GetByID(ctx, id); err != nil {
+		return ErrPromotionNotFound
+	}
+	return s.promotionRepo.Delete(ctx, id)
+}
+
+// validate checks that a promotion can be applied as configured
+func (s *PromotionService) validate(ctx context.Context, p *models.Promotion) error {
+	switch p.Type {
+	case models.PromotionPercentage:
+		if p.Value <= 0 || p.Value > 100 {
+			return errors.New("a percentage promotion needs a value between 0 and 100")
+		}
+	case models.PromotionFixed:
+		if p.Value <= 0 {
+			return errors.New("a fixed promotion needs a positive value")
+		}
+	case models.PromotionBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return errors.New("a buy_x_get_y promotion needs positive buy_quantity and get_quantity")
+		}
+		if p.IsOrderLevel() {
+			return errors.New("a buy_x_get_y promotion needs a product_id or category_id")
+		}
+	default:
+		return fmt.Errorf("unknown promotion type %q (expected percentage, fixed or buy_x_get_y)", p.Type)
+	}
+
+	if p.ProductID != nil && p.CategoryID != nil {
+		return errors.New("set product_id or category_id, not both")
+	}
+	if p.ProductID != nil {
+		if _, err := s.productRepo.GetByID(ctx, *p.ProductID); err != nil {
+			return errors.New("product not found")
+		}
+	}
+	if p.CategoryID != nil {
+		if _, err := s.categoryRepo.GetByID(ctx, *p.CategoryID); err != nil {
+			return errors.New("category not found")
+		}
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if p.Code != nil {
+		if existing, err := s.promotionRepo.GetByCode(ctx, *p.Code); err == nil && existing.ID != p.ID {
+			return fmt.Errorf("coupon code %s is already used by promotion %d", *p.Code, existing.ID)
+		}
+	}
+	return nil
+}
+
+// normalizeCouponCode makes coupon codes case-insensitive
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func zeroToNil(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// applyPromotions fills in the discounts of a cart response that holds the
+// cart's priced lines. Every line gets the best promotion that matches it;
+// order-level promotions then apply, one after another, to what is left.
+// A coupon entered on the cart that can't be used is reported in
+// CouponError and otherwise ignored.
+func applyPromotions(ctx context.Context, promotionRepo repository.PromotionStore, cart *models.Cart, response *models.CartResponse, now time.Time) error {
+	code := ""
+	if cart.CouponCode != nil {
+		code = *cart.CouponCode
+		response.CouponCode = code
+	}
+
+	promotions, err := promotionRepo.GetActive(ctx, now, code)
+	if err != nil {
+		return err
+	}
+
+	var usable []models.Promotion
+	couponUsable := false
+	for _, promotion := range promotions {
+		if promotion.PerUserLimit != nil {
+			used, err := promotionRepo.CountUserOrders(ctx, promotion.ID, cart.UserID)
+			if err != nil {
+				return err
+			}
+			if used >= int64(*promotion.PerUserLimit) {
+				continue
+			}
+		}
+		if promotion.Code != nil {
+			couponUsable = true
+		}
+		usable = append(usable, promotion)
+	}
+	if code != "" && !couponUsable {
+		response.CouponError = couponError(ctx, promotionRepo, code, now)
+	}
+
+	discountCart(response, cartCategories(cart), usable)
+	return nil
+}
+
+// couponError explains why a coupon that isn't among the usable promotions
+// doesn't apply
+func couponError(ctx context.Context, promotionRepo repository.PromotionStore, code string, now time.Time) string {
+	promotion, err := promotionRepo.GetByCode(ctx, code)
+	switch {
+	case err != nil || !promotion.Active:
+		return fmt.Sprintf("coupon %s is not valid", code)
+	case promotion.StartsAt != nil && now.Before(*promotion.StartsAt):
+		return fmt.Sprintf("coupon %s is not valid until %s", code, promotion.StartsAt.Format(time.RFC3339))
+	case promotion.EndsAt != nil && !now.Before(*promotion.EndsAt):
+		return fmt.Sprintf("coupon %s has expired", code)
+	case promotion.UsageLimit != nil && promotion.UsedCount >= *promotion.UsageLimit:
+		return fmt.Sprintf("coupon %s has been used up", code)
+	default:
+		return fmt.Sprintf("you have already used coupon %s", code)
+	}
+}
+
+// discountCart applies promotions to the lines of response. categories maps
+// each cart line ID to its product's category.
+func discountCart(response *models.CartResponse, categories map[uint]uint, promotions []models.Promotion) {
+	var subtotal float64
+	for _, item := range response.Items {
+		subtotal += item.Subtotal
+	}
+
+	discounts := []models.AppliedDiscount{}
+	var total float64
+	for i := range response.Items {
+		item := &response.Items[i]
+
+		var best *models.Promotion
+		var bestAmount float64
+		for j := range promotions {
+			promotion := &promotions[j]
+			if !promotionMatches(promotion, item, categories[item.ID]) {
+				continue
+			}
+			if amount := lineDiscount(promotion, item); amount > bestAmount {
+				best, bestAmount = promotion, amount
+			}
+		}
+		if best != nil {
+			discount := appliedDiscount(best, bestAmount)
+			discount.CartItemID = &item.ID
+			discount.ProductID = &item.ProductID
+			discounts = append(discounts, discount)
+			total += bestAmount
+		}
+	}
+
+	for i := range promotions {
+		promotion := &promotions[i]
+		if !promotion.IsOrderLevel() {
+			continue
+		}
+		remaining := subtotal - total
+		var amount float64
+		switch promotion.Type {
+		case models.PromotionPercentage:
+			amount = remaining * promotion.Value / 100
+		case models.PromotionFixed:
+			amount = math.Min(promotion.Value, remaining)
+		}
+		if amount = roundCents(amount); amount > 0 {
+			discounts = append(discounts, appliedDiscount(promotion, amount))
+			total += amount
+		}
+	}
+
+	response.Subtotal = subtotal
+	response.Discounts = discounts
+	response.DiscountTotal = roundCents(total)
+	response.TotalPrice = subtotal - response.DiscountTotal
+}
+
+func promotionMatches(promotion *models.Promotion, item *models.CartItemResponse, categoryID uint) bool {
+	switch {
+	case promotion.ProductID != nil:
+		return *promotion.ProductID == item.ProductID
+	case promotion.CategoryID != nil:
+		return *promotion.CategoryID == categoryID
+	default:
+		return false
+	}
+}
+
+// couponMatchesCart reports whether a product or category promotion matches
+// any line of the cart priced in response
+func couponMatchesCart(promotion *models.Promotion, cart *models.Cart, response *models.CartResponse) bool {
+	categories := cartCategories(cart)
+	for i := range response.Items {
+		if promotionMatches(promotion, &response.Items[i], categories[response.Items[i].ID]) {
+			return true
+		}
+	}
+	return false
+}
+
+// cartCategories maps each line ID of cart to its product's category
+func cartCategories(cart *models.Cart) map[uint]uint {
+	categories := make(map[uint]uint, len(cart.Items))
+	for _, item := range cart.Items {
+		if item.Product != nil {
+			categories[item.ID] = item.Product.CategoryID
+		}
+	}
+	return categories
+}
+
+// lineDiscount is what promotion takes off one cart line, at most the line's
+// subtotal. Quantities are in the line's unit (packs for a variant).
+func lineDiscount(promotion *models.Promotion, item *models.CartItemResponse) float64 {
+	var amount float64
+	switch promotion.Type {
+	case models.PromotionPercentage:
+		amount = item.Subtotal * promotion.Value / 100
+	case models.PromotionFixed:
+		amount = math.Min(promotion.Value, item.Price) * item.Quantity
+	case models.PromotionBuyXGetY:
+		// Every full set of buy + get units has get units free
+		sets := math.Floor(item.Quantity/(promotion.BuyQuantity+promotion.GetQuantity) + 1e-9)
+		amount = sets * promotion.GetQuantity * item.Price
+	}
+	return roundCents(math.Min(amount, item.Subtotal))
+}
+
+func appliedDiscount(promotion *models.Promotion, amount float64) models.AppliedDiscount {
+	discount := models.AppliedDiscount{
+		PromotionID: promotion.ID,
+		Name:        promotion.Name,
+		Type:        promotion.Type,
+		Amount:      amount,
+	}
+	if promotion.Code != nil {
+		discount.Code = *promotion.Code
+	}
+	return discount
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+func TestLineDiscount(t *testing.T) {
+	tomatoes := models.CartItemResponse{Price: 4, Quantity: 1.5, Unit: models.UnitKilogram, Subtotal: 6}
+	cans := models.CartItemResponse{Price: 2.5, Quantity: 3, Unit: models.UnitPiece, Subtotal: 7.5}
+	cases := []struct {
+		name      string
+		promotion models.Promotion
+		item      models.CartItemResponse
+		want      float64
+	}{
+		{"percent of a weighed line", models.Promotion{Type: models.PromotionPercentage, Value: 10}, tomatoes, 0.6},
+		{"percent of a counted line", models.Promotion{Type: models.PromotionPercentage, Value: 20}, cans, 1.5},
+		{"percent rounds to cents", models.Promotion{Type: models.PromotionPercentage, Value: 15}, models.CartItemResponse{Price: 0.99, Quantity: 1, Subtotal: 0.99}, 0.15},
+		{"fixed per kilogram", models.Promotion{Type: models.PromotionFixed, Value: 1}, tomatoes, 1.5},
+		{"fixed per kilogram, part of a kilogram", models.Promotion{Type: models.PromotionFixed, Value: 1}, models.CartItemResponse{Price: 4, Quantity: 0.25, Unit: models.UnitKilogram, Subtotal: 1}, 0.25},
+		{"fixed per piece", models.Promotion{Type: models.PromotionFixed, Value: 0.5}, cans, 1.5},
+		{"fixed above the unit price", models.Promotion{Type: models.PromotionFixed, Value: 5}, tomatoes, 6},
+		{"percent above 100", models.Promotion{Type: models.PromotionPercentage, Value: 150}, cans, 7.5},
+		{"buy 2 get 1", models.Promotion{Type: models.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}, cans, 2.5},
+		{"buy 2 get 1, incomplete set", models.Promotion{Type: models.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1}, models.CartItemResponse{Price: 2.5, Quantity: 2, Subtotal: 5}, 0},
+	}
+
+	for _, tc := range cases {
+		if got := lineDiscount(&tc.promotion, &tc.item); got != tc.want {
+			t.Errorf("%s: lineDiscount = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDiscountCart(t *testing.T) {
+	tomatoID, cansID, vegetables := uint(10), uint(20), uint(1)
+	items := []models.CartItemResponse{
+		{ID: 1, ProductID: tomatoID, Price: 4, Quantity: 1.5, Unit: models.UnitKilogram, Subtotal: 6},
+		{ID: 2, ProductID: cansID, Price: 2.5, Quantity: 3, Unit: models.UnitPiece, Subtotal: 7.5},
+	}
+	categories := map[uint]uint{1: vegetables}
+
+	percent := func(id uint, value float64) models.Promotion {
+		return models.Promotion{ID: id, Type: models.PromotionPercentage, Value: value}
+	}
+	fixed := func(id uint, value float64) models.Promotion {
+		return models.Promotion{ID: id, Type: models.PromotionFixed, Value: value}
+	}
+	onProduct := func(p models.Promotion, productID uint) models.Promotion {
+		p.ProductID = &productID
+		return p
+	}
+	onCategory := func(p models.Promotion, categoryID uint) models.Promotion {
+		p.CategoryID = &categoryID
+		return p
+	}
+
+	cases := []struct {
+		name       string
+		promotions []models.Promotion
+		amounts    []float64 // of the applied discounts, in order
+		total      float64
+	}{
+		{"none", nil, nil, 0},
+		{"percent on a category", []models.Promotion{onCategory(percent(1, 10), vegetables)}, []float64{0.6}, 0.6},
+		{"fixed per kilogram on a product", []models.Promotion{onProduct(fixed(1, 1), tomatoID)}, []float64{1.5}, 1.5},
+		{"best line promotion wins", []models.Promotion{onCategory(percent(1, 10), vegetables), onProduct(fixed(2, 1), tomatoID)}, []float64{1.5}, 1.5},
+		{"one promotion per line", []models.Promotion{onProduct(fixed(1, 1), tomatoID), onProduct(percent(2, 20), cansID)}, []float64{1.5, 1.5}, 3},
+		{"fixed on the order", []models.Promotion{fixed(1, 5)}, []float64{5}, 5},
+		{"fixed on the order, capped at the total", []models.Promotion{fixed(1, 20)}, []float64{13.5}, 13.5},
+		{"percent on the order", []models.Promotion{percent(1, 10)}, []float64{1.35}, 1.35},
+		{"order discounts apply after line discounts", []models.Promotion{onProduct(fixed(1, 1), tomatoID), percent(2, 10), fixed(3, 2)}, []float64{1.5, 1.2, 2}, 4.7},
+	}
+
+	for _, tc := range cases {
+		response := &models.CartResponse{Items: items}
+		discountCart(response, categories, tc.promotions)
+
+		var amounts []float64
+		for _, d := range response.Discounts {
+			amounts = append(amounts, d.Amount)
+		}
+		if !slices.Equal(amounts, tc.amounts) || response.DiscountTotal != tc.total {
+			t.Errorf("%s: discounts = %v totalling %v, want %v totalling %v", tc.name, amounts, response.DiscountTotal, tc.amounts, tc.total)
+		}
+		if response.Subtotal != 13.5 || response.TotalPrice != 13.5-tc.total {
+			t.Errorf("%s: subtotal %v, total %v", tc.name, response.Subtotal, response.TotalPrice)
+		}
+	}
+}
@@ -1,27 +1,33 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sort"
 
 	"github.com/bexiiiii/smart_food_store/internal/models"
 	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"github.com/bexiiiii/smart_food_store/internal/units"
 )
 
 type RecipeService struct {
-	recipeRepo  *repository.RecipeRepository
-	productRepo *repository.ProductRepository
-	cartRepo    *repository.CartRepository
+	recipeRepo    repository.RecipeStore
+	productRepo   repository.ProductStore
+	cartRepo      repository.CartStore
+	promotionRepo repository.PromotionStore
 }
 
-func NewRecipeService(recipeRepo *repository.RecipeRepository, productRepo *repository.ProductRepository, cartRepo *repository.CartRepository) *RecipeService {
+func NewRecipeService(recipeRepo repository.RecipeStore, productRepo repository.ProductStore, cartRepo repository.CartStore, promotionRepo repository.PromotionStore) *RecipeService {
 	return &RecipeService{
-		recipeRepo:  recipeRepo,
-		productRepo: productRepo,
-		cartRepo:    cartRepo,
+		recipeRepo:    recipeRepo,
+		productRepo:   productRepo,
+		cartRepo:      cartRepo,
+		promotionRepo: promotionRepo,
 	}
 }
 
-func (s *RecipeService) Create(req *models.RecipeCreateRequest) (*models.Recipe, error) {
+func (s *RecipeService) Create(ctx context.Context, req *models.RecipeCreateRequest) (*models.Recipe, error) {
 	recipe := &models.Recipe{
 		Name:         req.Name,
 		Description:  req.Description,
@@ -34,40 +40,62 @@ func (s *RecipeService) Create(req *models.RecipeCreateRequest) (*models.Recipe,
 
 	for _, ing := range req.Ingredients {
 		// Validate product exists
-		_, err := s.productRepo.GetByID(ing.ProductID)
+		product, err := s.productRepo.GetByID(ctx, ing.ProductID)
 		if err != nil {
 			return nil, errors.New("invalid product in ingredients")
 		}
 
+		unit, err := ingredientUnit(product, ing.Unit)
+		if err != nil {
+			return nil, err
+		}
+		if err := ingredientVariant(product, ing.VariantID); err != nil {
+			return nil, err
+		}
+
 		recipe.Ingredients = append(recipe.Ingredients, models.RecipeIngredient{
 			ProductID: ing.ProductID,
+			VariantID: ing.VariantID,
 			Quantity:  ing.Quantity,
-			Unit:      ing.Unit,
+			Unit:      unit,
 			Notes:     ing.Notes,
 		})
 	}
 
-	if err := s.recipeRepo.Create(recipe); err != nil {
+	if err := s.recipeRepo.Create(ctx, recipe); err != nil {
 		return nil, errors.New("failed to create recipe")
 	}
 
-	return s.recipeRepo.GetByID(recipe.ID)
+	return s.recipeRepo.GetByID(ctx, recipe.ID)
+}
+
+// GetByID returns a published (approved) recipe
+func (s *RecipeService) GetByID(ctx context.Context, id uint) (*models.Recipe, error) {
+	recipe, err := s.recipeRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if recipe.Status != models.RecipeStatusApproved {
+		return nil, errors.New("recipe not found")
+	}
+	return recipe, nil
 }
 
-func (s *RecipeService) GetByID(id uint) (*models.Recipe, error) {
-	return s.recipeRepo.GetByID(id)
+func (s *RecipeService) GetAll(ctx context.Context) ([]models.Recipe, error) {
+	return s.recipeRepo.GetAll(ctx, models.RecipeStatusApproved)
 }
 
-func (s *RecipeService) GetAll() ([]models.Recipe, error) {
-	return s.recipeRepo.GetAll()
+// GetByStatus lists recipes in any review status, for admins
+func (s *RecipeService) GetByStatus(ctx context.Context, status models.RecipeStatus) ([]models.Recipe, error) {
+	return s.recipeRepo.GetAll(ctx, status)
 }
 
-func (s *RecipeService) Search(query string) ([]models.Recipe, error) {
-	return s.recipeRepo.Search(query)
+func (s *RecipeService) Search(ctx context.Context, query string) ([]models.Recipe, error) {
+	return s.recipeRepo.Search(ctx, query)
 }
 
-func (s *RecipeService) Update(id uint, req *models.RecipeCreateRequest) (*models.Recipe, error) {
-	recipe, err := s.recipeRepo.GetByID(id)
+func (s *RecipeService) Update(ctx context.Context, id uint, req *models.RecipeCreateRequest) (*models.Recipe, error) {
+	recipe, err := s.recipeRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, errors.New("recipe not found")
 	}
@@ -82,33 +110,77 @@ func (s *RecipeService) Update(id uint, req *models.RecipeCreateRequest) (*model
 
 	recipe.Ingredients = nil
 	for _, ing := range req.Ingredients {
+		product, err := s.productRepo.GetByID(ctx, ing.ProductID)
+		if err != nil {
+			return nil, errors.New("invalid product in ingredients")
+		}
+
+		unit, err := ingredientUnit(product, ing.Unit)
+		if err != nil {
+			return nil, err
+		}
+		if err := ingredientVariant(product, ing.VariantID); err != nil {
+			return nil, err
+		}
+
 		recipe.Ingredients = append(recipe.Ingredients, models.RecipeIngredient{
 			RecipeID:  id,
 			ProductID: ing.ProductID,
+			VariantID: ing.VariantID,
 			Quantity:  ing.Quantity,
-			Unit:      ing.Unit,
+			Unit:      unit,
 			Notes:     ing.Notes,
 		})
 	}
 
-	if err := s.recipeRepo.Update(recipe); err != nil {
+	if err := s.recipeRepo.Update(ctx, recipe); err != nil {
 		return nil, errors.New("failed to update recipe")
 	}
 
-	return s.recipeRepo.GetByID(id)
+	return s.recipeRepo.GetByID(ctx, id)
+}
+
+func (s *RecipeService) Delete(ctx context.Context, id uint) error {
+	return s.recipeRepo.Delete(ctx, id)
+}
+
+// ingredientUnit normalizes an ingredient unit and makes sure it can be
+// converted to the unit the product is sold in
+func ingredientUnit(product *models.Product, unit models.Unit) (models.Unit, error) {
+	parsed, err := units.Parse(string(unit))
+	if err != nil {
+		return "", err
+	}
+	if _, err := units.Convert(1, parsed, product.Unit, units.ProfileOf(product)); err != nil {
+		return "", fmt.Errorf("invalid unit for %s: %w", product.Name, err)
+	}
+	return parsed, nil
+}
+
+// ingredientVariant makes sure an ingredient's pack, if it names one, is a
+// variant of the product
+func ingredientVariant(product *models.Product, variantID *uint) error {
+	if variantID != nil && findVariant(product, *variantID) == nil {
+		return fmt.Errorf("%s has no variant %d", product.Name, *variantID)
+	}
+	return nil
 }
 
-func (s *RecipeService) Delete(id uint) error {
-	return s.recipeRepo.Delete(id)
+// scaledIngredient is a recipe ingredient scaled to a number of servings,
+// along with the quantity to put in the cart: packs for a product sold in
+// variants, otherwise the amount in the product's own unit.
+type scaledIngredient struct {
+	models.AIIngredient
+	cartQuantity float64
 }
 
-func (s *RecipeService) CalculateIngredients(recipeID uint, servings int) ([]models.AIIngredient, float64, error) {
-	recipe, err := s.recipeRepo.GetByID(recipeID)
+func (s *RecipeService) scaleIngredients(ctx context.Context, recipeID uint, servings int) ([]scaledIngredient, float64, error) {
+	recipe, err := s.GetByID(ctx, recipeID)
 	if err != nil {
 		return nil, 0, errors.New("recipe not found")
 	}
 
-	var ingredients []models.AIIngredient
+	var ingredients []scaledIngredient
 	var totalPrice float64
 
 	// Calculate ratio based on servings
@@ -119,31 +191,74 @@ func (s *RecipeService) CalculateIngredients(recipeID uint, servings int) ([]mod
 			continue
 		}
 
+		unit := ing.Unit
+		if unit == "" {
+			unit = ing.Product.Unit
+		}
+
 		adjustedQuantity := ing.Quantity * ratio
-		price := ing.Product.Price * adjustedQuantity
-
-		ingredients = append(ingredients, models.AIIngredient{
-			ProductID:   ing.ProductID,
-			ProductName: ing.Product.Name,
-			Quantity:    adjustedQuantity,
-			Unit:        ing.Unit,
-			Available:   ing.Product.Stock >= adjustedQuantity,
-			Price:       price,
-		})
+		profile := units.ProfileOf(ing.Product)
+
+		productQuantity, err := units.Convert(adjustedQuantity, unit, ing.Product.Unit, profile)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cannot measure %s: %w", ing.Product.Name, err)
+		}
+		ingredient := scaledIngredient{
+			AIIngredient: models.AIIngredient{
+				ProductID:   ing.ProductID,
+				ProductName: ing.Product.Name,
+				Quantity:    adjustedQuantity,
+				Unit:        unit,
+				Available:   ing.Product.Stock >= productQuantity,
+				Price:       ing.Product.Price * productQuantity,
+			},
+			cartQuantity: productQuantity,
+		}
 
-		totalPrice += price
+		// Products sold in variants are bought in whole packs: the
+		// recipe's pack if it names one, else the cheapest that covers it
+		variant := ing.Variant
+		if variant == nil && len(ing.Product.Variants) > 0 {
+			variant, _ = cheapestVariant(ing.Product, productQuantity)
+		}
+		if variant != nil {
+			packs := variantPacks(variant, productQuantity)
+			ingredient.VariantID = variantIDOf(variant)
+			ingredient.VariantName = variant.Name
+			ingredient.Packs = packs
+			ingredient.Available = variant.Stock >= packs
+			ingredient.Price = variant.Price * packs
+			ingredient.cartQuantity = packs
+		}
+
+		ingredients = append(ingredients, ingredient)
+		totalPrice += ingredient.Price
 	}
 
 	return ingredients, totalPrice, nil
 }
 
-func (s *RecipeService) AddRecipeToCart(userID uint, recipeID uint, servings int) (*models.CartResponse, error) {
-	ingredients, _, err := s.CalculateIngredients(recipeID, servings)
+func (s *RecipeService) CalculateIngredients(ctx context.Context, recipeID uint, servings int) ([]models.AIIngredient, float64, error) {
+	scaled, totalPrice, err := s.scaleIngredients(ctx, recipeID, servings)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ingredients []models.AIIngredient
+	for _, ing := range scaled {
+		ingredients = append(ingredients, ing.AIIngredient)
+	}
+
+	return ingredients, totalPrice, nil
+}
+
+func (s *RecipeService) AddRecipeToCart(ctx context.Context, userID uint, recipeID uint, servings int) (*models.CartResponse, error) {
+	ingredients, _, err := s.scaleIngredients(ctx, recipeID, servings)
 	if err != nil {
 		return nil, err
 	}
 
-	cart, err := s.cartRepo.GetOrCreateByUserID(userID)
+	cart, err := s.cartRepo.GetOrCreateByUserID(ctx, userID)
 	if err != nil {
 		return nil, errors.New("failed to get cart")
 	}
@@ -153,52 +268,168 @@ func (s *RecipeService) AddRecipeToCart(userID uint, recipeID uint, servings int
 			continue // Skip unavailable items
 		}
 
+		// Cart quantities are in the product's unit, or packs for a variant
 		item := &models.CartItem{
 			ProductID: ing.ProductID,
-			Quantity:  ing.Quantity,
+			VariantID: ing.VariantID,
+			Quantity:  ing.cartQuantity,
 		}
 
-		if err := s.cartRepo.AddItem(cart.ID, item); err != nil {
+		if err := s.cartRepo.AddItem(ctx, cart.ID, item); err != nil {
 			continue
 		}
 	}
 
 	// Return updated cart
-	cart, err = s.cartRepo.GetByUserID(userID)
+	cart, err = s.cartRepo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	return buildCartResponse(cart)
+	return buildCartResponse(ctx, cart, s.promotionRepo)
 }
 
-func buildCartResponse(cart *models.Cart) (*models.CartResponse, error) {
-	var totalPrice float64
-	var items []models.CartItemResponse
+// DuplicateRecipeError is returned when a saved AI suggestion matches an
+// existing recipe by normalized name and ingredient set
+type DuplicateRecipeError struct {
+	Existing *models.Recipe
+}
 
-	for _, item := range cart.Items {
-		if item.Product == nil {
-			continue
+func (e *DuplicateRecipeError) Error() string {
+	return fmt.Sprintf("recipe already exists (id %d)", e.Existing.ID)
+}
+
+// SaveAISuggestion stores an AI suggestion as a recipe pending admin review.
+// Every ingredient must reference an existing product in a unit that can be
+// converted to the product's unit.
+func (s *RecipeService) SaveAISuggestion(ctx context.Context, userID uint, suggestion *models.AIRecipeSuggestion) (*models.Recipe, error) {
+	if models.NormalizeRecipeName(suggestion.Name) == "" {
+		return nil, errors.New("recipe name is required")
+	}
+	if len(suggestion.Ingredients) == 0 {
+		return nil, errors.New("recipe must have at least one ingredient")
+	}
+
+	servings := suggestion.Servings
+	if servings < 1 {
+		servings = 1
+	}
+
+	recipe := &models.Recipe{
+		Name:         suggestion.Name,
+		Description:  suggestion.Description,
+		Instructions: suggestion.Instructions,
+		Servings:     servings,
+		PrepTime:     suggestion.PrepTime,
+		CookTime:     suggestion.CookTime,
+		CreatedByID:  &userID,
+	}
+
+	for _, ing := range suggestion.Ingredients {
+		product, err := s.productRepo.GetByID(ctx, ing.ProductID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid product %d in ingredients", ing.ProductID)
+		}
+		if ing.Quantity <= 0 {
+			return nil, fmt.Errorf("invalid quantity for %s", product.Name)
 		}
 
-		subtotal := item.Product.Price * item.Quantity
-		totalPrice += subtotal
+		unit, err := ingredientUnit(product, ing.Unit)
+		if err != nil {
+			return nil, err
+		}
+		if err := ingredientVariant(product, ing.VariantID); err != nil {
+			return nil, err
+		}
 
-		items = append(items, models.CartItemResponse{
-			ID:          item.ID,
-			ProductID:   item.ProductID,
-			ProductName: item.Product.Name,
-			Price:       item.Product.Price,
-			Quantity:    item.Quantity,
-			Unit:        item.Product.Unit,
-			Subtotal:    subtotal,
+		recipe.Ingredients = append(recipe.Ingredients, models.RecipeIngredient{
+			ProductID: ing.ProductID,
+			VariantID: ing.VariantID,
+			Quantity:  ing.Quantity,
+			Unit:      unit,
 		})
 	}
 
-	return &models.CartResponse{
-		ID:         cart.ID,
-		Items:      items,
-		TotalPrice: totalPrice,
-		ItemCount:  len(items),
-	}, nil
+	existing, err := s.findDuplicate(ctx, recipe)
+	if err != nil {
+		return nil, errors.New("failed to check for duplicate recipes")
+	}
+	if existing != nil {
+		return nil, &DuplicateRecipeError{Existing: existing}
+	}
+
+	if err := s.recipeRepo.SaveAIGenerated(ctx, recipe); err != nil {
+		return nil, errors.New("failed to save recipe")
+	}
+
+	return s.recipeRepo.GetByID(ctx, recipe.ID)
+}
+
+// findDuplicate returns an existing recipe with the same normalized name and
+// the same set of products, or nil
+func (s *RecipeService) findDuplicate(ctx context.Context, recipe *models.Recipe) (*models.Recipe, error) {
+	candidates, err := s.recipeRepo.GetByNormalizedName(ctx, models.NormalizeRecipeName(recipe.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	want := ingredientSet(recipe.Ingredients)
+	for i := range candidates {
+		if equalUintSlices(ingredientSet(candidates[i].Ingredients), want) {
+			return &candidates[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ingredientSet returns the sorted, distinct product IDs of ingredients
+func ingredientSet(ingredients []models.RecipeIngredient) []uint {
+	seen := make(map[uint]bool)
+	var ids []uint
+	for _, ing := range ingredients {
+		if !seen[ing.ProductID] {
+			seen[ing.ProductID] = true
+			ids = append(ids, ing.ProductID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func equalUintSlices(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Approve publishes a pending or rejected recipe
+func (s *RecipeService) Approve(ctx context.Context, id uint, adminID uint) (*models.Recipe, error) {
+	return s.review(ctx, id, adminID, models.RecipeStatusApproved)
+}
+
+// Reject hides a recipe from the public listing
+func (s *RecipeService) Reject(ctx context.Context, id uint, adminID uint) (*models.Recipe, error) {
+	return s.review(ctx, id, adminID, models.RecipeStatusRejected)
+}
+
+func (s *RecipeService) review(ctx context.Context, id uint, adminID uint, status models.RecipeStatus) (*models.Recipe, error) {
+	recipe, err := s.recipeRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, errors.New("recipe not found")
+	}
+	if recipe.Status == status {
+		return nil, fmt.Errorf("recipe is already %s", status)
+	}
+
+	if err := s.recipeRepo.UpdateStatus(ctx, id, status, adminID); err != nil {
+		return nil, errors.New("failed to update recipe status")
+	}
+
+	return s.recipeRepo.GetByID(ctx, id)
 }
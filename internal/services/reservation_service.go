@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bexiiiii/smart_food_store/internal/config"
+	"github.com/bexiiiii/smart_food_store/internal/models"
+	"github.com/bexiiiii/smart_food_store/internal/repository"
+	"gorm.io/gorm"
+)
+
+// sweepBatchSize caps how many expired holds a single sweep releases, so one
+// transaction never locks too many rows.
+const sweepBatchSize = 100
+
+type ReservationService struct {
+	reservationRepo repository.ReservationStore
+	cartRepo        repository.CartStore
+	productRepo     repository.ProductStore
+	holdTTL         time.Duration
+}
+
+func NewReservationService(reservationRepo repository.ReservationStore, cartRepo repository.CartStore, productRepo repository.ProductStore, cfg *config.Config) *ReservationService {
+	holdTTL, err := time.ParseDuration(cfg.StockHoldTTL)
+	if err != nil || holdTTL <= 0 {
+		holdTTL = 15 * time.Minute
+	}
+
+	return &ReservationService{
+		reservationRepo: reservationRepo,
+		cartRepo:        cartRepo,
+		productRepo:     productRepo,
+		holdTTL:         holdTTL,
+	}
+}
+
+// Reserve places a hold on stock for every item in the user's cart. Any
+// previous holds of the user are released first, so calling Reserve again
+// simply refreshes the hold. Either every item is held or none is.
+func (s *ReservationService) Reserve(ctx context.Context, userID uint) (*models.ReservationResponse, error) {
+	response := &models.ReservationResponse{
+		ExpiresAt: time.Now().Add(s.holdTTL),
+	}
+
+	err := s.reservationRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		if err := s.releaseTx(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		cart, err := s.cartRepo.WithTx(tx).GetByUserID(ctx, userID)
+		if err != nil {
+			return errors.New("cart not found")
+		}
+		if len(cart.Items) == 0 {
+			return errors.New("cart is empty")
+		}
+
+		productRepo := s.productRepo.WithTx(tx)
+		reservationRepo := s.reservationRepo.WithTx(tx)
+
+		for _, item := range cart.Items {
+			if err := takeStock(ctx, productRepo, stockLineOf(item.ProductID, item.VariantID), item.Quantity); err != nil {
+				if errors.Is(err, repository.ErrInsufficientStock) {
+					return fmt.Errorf("insufficient stock for %s", productName(item.Product, item.ProductID))
+				}
+				return errors.New("failed to reserve stock")
+			}
+
+			reservation := models.StockReservation{
+				UserID:    userID,
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Quantity:  item.Quantity,
+				Status:    models.ReservationActive,
+				ExpiresAt: response.ExpiresAt,
+			}
+			if err := reservationRepo.Create(ctx, &reservation); err != nil {
+				return errors.New("failed to reserve stock")
+			}
+			response.Items = append(response.Items, reservation)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Release gives back all stock currently held for the user
+func (s *ReservationService) Release(ctx context.Context, userID uint) error {
+	return s.reservationRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		return s.releaseTx(ctx, tx, userID)
+	})
+}
+
+// ReleaseExpired puts the stock of expired holds back on the shelf and
+// returns how many holds were released.
+func (s *ReservationService) ReleaseExpired(ctx context.Context) (int, error) {
+	released := 0
+
+	err := s.reservationRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		reservationRepo := s.reservationRepo.WithTx(tx)
+		productRepo := s.productRepo.WithTx(tx)
+
+		expired, err := reservationRepo.GetExpiredForUpdate(ctx, time.Now(), sweepBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, reservation := range expired {
+			if err := returnStock(ctx, productRepo, stockLineOf(reservation.ProductID, reservation.VariantID), reservation.Quantity); err != nil {
+				return err
+			}
+			if err := reservationRepo.UpdateStatus(ctx, reservation.ID, models.ReservationReleased); err != nil {
+				return err
+			}
+			released++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return released, nil
+}
+
+// StartSweeper releases expired holds every interval until ctx is cancelled.
+// The returned channel is closed once the sweeper has stopped.
+func (s *ReservationService) StartSweeper(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				released, err := s.ReleaseExpired(ctx)
+				if err != nil {
+					slog.ErrorContext(ctx, "Stock reservation sweep failed", "error", err)
+					continue
+				}
+				if released > 0 {
+					slog.InfoContext(ctx, "Released expired stock reservations", "count", released)
+				}
+			}
+		}
+	}()
+	return done
+}
+
+// commitTx claims stock for the given order lines inside tx. Stock already
+// held for the user is used first and only the remainder is decremented;
+// surplus holds are returned to stock. All of the user's holds end up
+// consumed or released.
+func (s *ReservationService) commitTx(ctx context.Context, tx *gorm.DB, userID uint, items []models.CartItemResponse) error {
+	reservationRepo := s.reservationRepo.WithTx(tx)
+	productRepo := s.productRepo.WithTx(tx)
+
+	holds, err := reservationRepo.GetActiveByUserForUpdate(ctx, userID)
+	if err != nil {
+		return errors.New("failed to load stock reservations")
+	}
+
+	held := make(map[stockLine]float64)
+	for _, hold := range holds {
+		held[stockLineOf(hold.ProductID, hold.VariantID)] += hold.Quantity
+	}
+
+	ordered := make(map[stockLine]bool)
+	for _, item := range items {
+		line := stockLineOf(item.ProductID, item.VariantID)
+		ordered[line] = true
+		covered := held[line]
+		delete(held, line)
+
+		var err error
+		switch {
+		case covered > item.Quantity:
+			err = returnStock(ctx, productRepo, line, covered-item.Quantity)
+		case covered < item.Quantity:
+			err = takeStock(ctx, productRepo, line, item.Quantity-covered)
+		}
+		if err != nil {
+			if errors.Is(err, repository.ErrInsufficientStock) {
+				return fmt.Errorf("insufficient stock for %s", item.ProductName)
+			}
+			return errors.New("failed to update stock")
+		}
+	}
+
+	// Holds for products that are no longer in the cart go back to stock
+	for line, quantity := range held {
+		if err := returnStock(ctx, productRepo, line, quantity); err != nil {
+			return errors.New("failed to update stock")
+		}
+	}
+
+	for _, hold := range holds {
+		status := models.ReservationReleased
+		if ordered[stockLineOf(hold.ProductID, hold.VariantID)] {
+			status = models.ReservationConsumed
+		}
+		if err := reservationRepo.UpdateStatus(ctx, hold.ID, status); err != nil {
+			return errors.New("failed to update stock reservation")
+		}
+	}
+
+	return nil
+}
+
+func (s *ReservationService) releaseTx(ctx context.Context, tx *gorm.DB, userID uint) error {
+	reservationRepo := s.reservationRepo.WithTx(tx)
+	productRepo := s.productRepo.WithTx(tx)
+
+	holds, err := reservationRepo.GetActiveByUserForUpdate(ctx, userID)
+	if err != nil {
+		return errors.New("failed to load stock reservations")
+	}
+
+	for _, hold := range holds {
+		if err := returnStock(ctx, productRepo, stockLineOf(hold.ProductID, hold.VariantID), hold.Quantity); err != nil {
+			return errors.New("failed to release stock")
+		}
+		if err := reservationRepo.UpdateStatus(ctx, hold.ID, models.ReservationReleased); err != nil {
+			return errors.New("failed to release stock")
+		}
+	}
+
+	return nil
+}
+
+// stockLine is where a cart line's stock is kept: on the product, or on one
+// of its variants
+type stockLine struct {
+	productID uint
+	variantID uint // 0 for the product itself
+}
+
+func stockLineOf(productID uint, variantID *uint) stockLine {
+	line := stockLine{productID: productID}
+	if variantID != nil {
+		line.variantID = *variantID
+	}
+	return line
+}
+
+// takeStock decrements stock only if enough is left, see
+// ProductRepository.UpdateStock
+func takeStock(ctx context.Context, productRepo repository.ProductStore, line stockLine, quantity float64) error {
+	if line.variantID != 0 {
+		return productRepo.UpdateVariantStock(ctx, line.variantID, quantity)
+	}
+	return productRepo.UpdateStock(ctx, line.productID, quantity)
+}
+
+func returnStock(ctx context.Context, productRepo repository.ProductStore, line stockLine, quantity float64) error {
+	if line.variantID != 0 {
+		return productRepo.RestoreVariantStock(ctx, line.variantID, quantity)
+	}
+	return productRepo.RestoreStock(ctx, line.productID, quantity)
+}
+
+func productName(product *models.Product, id uint) string {
+	if product != nil && product.Name != "" {
+		return product.Name
+	}
+	return fmt.Sprintf("product %d", id)
+}
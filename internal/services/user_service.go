@@ -1,7 +1,13 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/bexiiiii/smart_food_store/internal/config"
@@ -12,23 +18,50 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked
+	// refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrSessionRevoked is returned by ValidateAccessToken for tokens whose
+	// session was logged out or whose user logged out everywhere
+	ErrSessionRevoked = errors.New("session has been revoked")
+	// ErrEmailNotVerified is returned by Login, Refresh and
+	// ValidateAccessToken when verification is required
+	ErrEmailNotVerified = errors.New("email address is not verified")
+	// ErrUserNotFound is returned when the user to change doesn't exist
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// Revoked sessions are kept this long so replayed refresh tokens are still
+// recognized as reuse rather than as unknown tokens
+const revokedSessionRetention = 7 * 24 * time.Hour
+
 type UserService struct {
-	userRepo *repository.UserRepository
-	cartRepo *repository.CartRepository
-	config   *config.Config
+	userRepo    repository.UserStore
+	cartRepo    repository.CartStore
+	sessionRepo repository.SessionStore
+	config      *config.Config
+	onRegister  []func(ctx context.Context, user *models.User)
 }
 
-func NewUserService(userRepo *repository.UserRepository, cartRepo *repository.CartRepository, cfg *config.Config) *UserService {
+func NewUserService(userRepo repository.UserStore, cartRepo repository.CartStore, sessionRepo repository.SessionStore, cfg *config.Config) *UserService {
 	return &UserService{
-		userRepo: userRepo,
-		cartRepo: cartRepo,
-		config:   cfg,
+		userRepo:    userRepo,
+		cartRepo:    cartRepo,
+		sessionRepo: sessionRepo,
+		config:      cfg,
 	}
 }
 
-func (s *UserService) Register(req *models.UserRegisterRequest) (*models.AuthResponse, error) {
+// OnRegister registers fn to run after a new account is created, e.g. to
+// send the verification email
+func (s *UserService) OnRegister(fn func(ctx context.Context, user *models.User)) {
+	s.onRegister = append(s.onRegister, fn)
+}
+
+func (s *UserService) Register(ctx context.Context, req *models.UserRegisterRequest, client models.ClientInfo) (*models.AuthResponse, error) {
 	// Check if user already exists
-	existingUser, err := s.userRepo.GetByEmail(req.Email)
+	existingUser, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err == nil && existingUser != nil {
 		return nil, errors.New("user with this email already exists")
 	}
@@ -47,36 +80,39 @@ func (s *UserService) Register(req *models.UserRegisterRequest) (*models.AuthRes
 		Role:     models.RoleUser,
 	}
 
-	if err := s.userRepo.Create(user); err != nil {
+	if err := s.userRepo.Create(ctx, user); err != nil {
 		return nil, errors.New("failed to create user")
 	}
 
 	// Create cart for user
-	_, err = s.cartRepo.GetOrCreateByUserID(user.ID)
+	_, err = s.cartRepo.GetOrCreateByUserID(ctx, user.ID)
 	if err != nil {
 		return nil, errors.New("failed to create cart for user")
 	}
 
-	// Generate JWT token
-	token, err := s.generateToken(user)
-	if err != nil {
-		return nil, errors.New("failed to generate token")
+	for _, fn := range s.onRegister {
+		fn(ctx, user)
 	}
 
-	return &models.AuthResponse{
-		Token: token,
-		User: models.UserResponse{
-			ID:    user.ID,
-			Name:  user.Name,
-			Email: user.Email,
-			Role:  user.Role,
-		},
-	}, nil
+	// Unverified accounts get no session until the link is followed
+	if s.verificationRequired(user) {
+		return &models.AuthResponse{
+			User: models.UserResponse{
+				ID:            user.ID,
+				Name:          user.Name,
+				Email:         user.Email,
+				Role:          user.Role,
+				EmailVerified: user.EmailVerified,
+			},
+			VerificationRequired: true,
+		}, nil
+	}
+	return s.startSession(ctx, user, client)
 }
 
-func (s *UserService) Login(req *models.UserLoginRequest) (*models.AuthResponse, error) {
+func (s *UserService) Login(ctx context.Context, req *models.UserLoginRequest, client models.ClientInfo) (*models.AuthResponse, error) {
 	// Find user by email
-	user, err := s.userRepo.GetByEmail(req.Email)
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, errors.New("invalid email or password")
@@ -89,39 +125,30 @@ func (s *UserService) Login(req *models.UserLoginRequest) (*models.AuthResponse,
 		return nil, errors.New("invalid email or password")
 	}
 
-	// Generate JWT token
-	token, err := s.generateToken(user)
-	if err != nil {
-		return nil, errors.New("failed to generate token")
+	if s.verificationRequired(user) {
+		return nil, ErrEmailNotVerified
 	}
 
-	return &models.AuthResponse{
-		Token: token,
-		User: models.UserResponse{
-			ID:    user.ID,
-			Name:  user.Name,
-			Email: user.Email,
-			Role:  user.Role,
-		},
-	}, nil
+	return s.startSession(ctx, user, client)
 }
 
-func (s *UserService) GetByID(id uint) (*models.UserResponse, error) {
-	user, err := s.userRepo.GetByID(id)
+func (s *UserService) GetByID(ctx context.Context, id uint) (*models.UserResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
 
 	return &models.UserResponse{
-		ID:    user.ID,
-		Name:  user.Name,
-		Email: user.Email,
-		Role:  user.Role,
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
 	}, nil
 }
 
-func (s *UserService) GetAll() ([]models.UserResponse, error) {
-	users, err := s.userRepo.GetAll()
+func (s *UserService) GetAll(ctx context.Context) ([]models.UserResponse, error) {
+	users, err := s.userRepo.GetAll(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -129,38 +156,271 @@ func (s *UserService) GetAll() ([]models.UserResponse, error) {
 	var response []models.UserResponse
 	for _, user := range users {
 		response = append(response, models.UserResponse{
-			ID:    user.ID,
-			Name:  user.Name,
-			Email: user.Email,
-			Role:  user.Role,
+			ID:            user.ID,
+			Name:          user.Name,
+			Email:         user.Email,
+			Role:          user.Role,
+			EmailVerified: user.EmailVerified,
 		})
 	}
 
 	return response, nil
 }
 
-func (s *UserService) UpdateRole(id uint, role models.Role) error {
-	return s.userRepo.UpdateRole(id, role)
+// UpdateRole changes a user's role on behalf of a user with role caller.
+// Only admins can change the role of an admin.
+func (s *UserService) UpdateRole(ctx context.Context, caller models.Role, id uint, role models.Role) error {
+	if err := s.checkManageable(ctx, caller, id); err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdateRole(ctx, id, role); err != nil {
+		return errors.New("failed to update role")
+	}
+	return nil
 }
 
-func (s *UserService) Delete(id uint) error {
-	return s.userRepo.Delete(id)
+// Delete deletes a user on behalf of a user with role caller. Only admins
+// can delete an admin.
+func (s *UserService) Delete(ctx context.Context, caller models.Role, id uint) error {
+	if err := s.checkManageable(ctx, caller, id); err != nil {
+		return err
+	}
+	if err := s.userRepo.Delete(ctx, id); err != nil {
+		return errors.New("failed to delete user")
+	}
+	return nil
 }
 
-func (s *UserService) generateToken(user *models.User) (string, error) {
-	duration, err := time.ParseDuration(s.config.JWTExpiration)
+// checkManageable returns ErrPermissionDenied if the user is an admin and
+// caller isn't
+func (s *UserService) checkManageable(ctx context.Context, caller models.Role, id uint) error {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return errors.New("failed to find user")
+	}
+	if user.Role == models.RoleAdmin && caller != models.RoleAdmin {
+		return fmt.Errorf("%w: only admins can change or delete admin accounts", ErrPermissionDenied)
+	}
+	return nil
+}
+
+// startSession creates a session for a fresh sign-in and issues its tokens
+func (s *UserService) startSession(ctx context.Context, user *models.User, client models.ClientInfo) (*models.AuthResponse, error) {
+	now := time.Now()
+	if err := s.sessionRepo.DeleteStaleForUser(ctx, user.ID, now, now.Add(-revokedSessionRetention)); err != nil {
+		return nil, errors.New("failed to create session")
+	}
+
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	userAgent := client.UserAgent
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	session := &models.Session{
+		UserID:     user.ID,
+		TokenHash:  refreshHash,
+		ExpiresAt:  now.Add(s.refreshTTL()),
+		LastUsedAt: now,
+		UserAgent:  userAgent,
+		IP:         client.IP,
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, errors.New("failed to create session")
+	}
+
+	return s.authResponse(user, session, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token. The
+// old refresh token stops working; presenting it again is treated as theft
+// and revokes the whole session.
+func (s *UserService) Refresh(ctx context.Context, refreshToken string) (*models.AuthResponse, error) {
+	hash := hashToken(refreshToken)
+	var (
+		user     *models.User
+		session  *models.Session
+		newToken string
+		reused   bool
+	)
+
+	err := s.sessionRepo.Transaction(ctx, func(tx *gorm.DB) error {
+		sessionRepo := s.sessionRepo.WithTx(tx)
+
+		var err error
+		session, err = sessionRepo.GetByTokenHashForUpdate(ctx, hash)
+		if err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if session.RevokedAt != nil || !session.ExpiresAt.After(now) {
+			return ErrInvalidRefreshToken
+		}
+
+		if session.TokenHash != hash {
+			// An already rotated token: someone else holds a copy
+			reused = true
+			return sessionRepo.Revoke(ctx, session.ID, now)
+		}
+
+		user, err = s.userRepo.WithTx(tx).GetByID(ctx, session.UserID)
+		if err != nil {
+			return ErrInvalidRefreshToken
+		}
+		if s.verificationRequired(user) {
+			return ErrEmailNotVerified
+		}
+
+		var newHash string
+		newToken, newHash, err = newRefreshToken()
+		if err != nil {
+			return err
+		}
+
+		session.TokenHash = newHash
+		session.PreviousTokenHash = hash
+		session.ExpiresAt = now.Add(s.refreshTTL())
+		session.LastUsedAt = now
+		return sessionRepo.Rotate(ctx, session.ID, hash, newHash, session.ExpiresAt, now)
+	})
+	if reused {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrEmailNotVerified) {
+			return nil, err
+		}
+		return nil, errors.New("failed to refresh session")
+	}
+
+	return s.authResponse(user, session, newToken)
+}
+
+// Logout revokes a single session
+func (s *UserService) Logout(ctx context.Context, userID, sessionID uint) error {
+	if err := s.sessionRepo.RevokeForUser(ctx, sessionID, userID, time.Now()); err != nil {
+		return errors.New("failed to log out")
+	}
+	return nil
+}
+
+// LogoutAll revokes every session of the user and invalidates all access
+// tokens issued so far
+func (s *UserService) LogoutAll(ctx context.Context, userID uint) error {
+	if err := s.userRepo.IncrementTokenVersion(ctx, userID); err != nil {
+		return errors.New("failed to log out")
+	}
+	if err := s.sessionRepo.RevokeAllForUser(ctx, userID, time.Now()); err != nil {
+		return errors.New("failed to log out")
+	}
+	return nil
+}
+
+// ValidateAccessToken checks that the session behind an access token is still
+// active and the token version is current, and returns the user's current
+// role. Used by AuthMiddleware.
+func (s *UserService) ValidateAccessToken(ctx context.Context, userID, sessionID uint, version int) (models.Role, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrSessionRevoked
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.TokenVersion != version {
+		return "", ErrSessionRevoked
+	}
+	if s.verificationRequired(user) {
+		return "", ErrEmailNotVerified
+	}
+
+	active, err := s.sessionRepo.IsActive(ctx, sessionID, userID, time.Now())
 	if err != nil {
-		duration = 24 * time.Hour
+		return "", err
 	}
+	if !active {
+		return "", ErrSessionRevoked
+	}
+	return user.Role, nil
+}
+
+// verificationRequired reports whether the user may not sign in until their
+// email address is verified
+func (s *UserService) verificationRequired(user *models.User) bool {
+	return !user.EmailVerified && s.config.RequireEmailVerification == "true"
+}
 
+func (s *UserService) authResponse(user *models.User, session *models.Session, refreshToken string) (*models.AuthResponse, error) {
+	token, expiresAt, err := s.generateToken(user, session.ID)
+	if err != nil {
+		return nil, errors.New("failed to generate token")
+	}
+
+	return &models.AuthResponse{
+		Token:            token,
+		ExpiresAt:        &expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: &session.ExpiresAt,
+		User: models.UserResponse{
+			ID:            user.ID,
+			Name:          user.Name,
+			Email:         user.Email,
+			Role:          user.Role,
+			EmailVerified: user.EmailVerified,
+		},
+	}, nil
+}
+
+func (s *UserService) generateToken(user *models.User, sessionID uint) (string, time.Time, error) {
+	duration, err := time.ParseDuration(s.config.JWTExpiration)
+	if err != nil || duration <= 0 {
+		duration = 15 * time.Minute
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(duration)
 	claims := jwt.MapClaims{
 		"user_id": user.ID,
 		"email":   user.Email,
 		"role":    user.Role,
-		"exp":     time.Now().Add(duration).Unix(),
-		"iat":     time.Now().Unix(),
+		"sid":     sessionID,
+		"ver":     user.TokenVersion,
+		"exp":     expiresAt.Unix(),
+		"iat":     now.Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.config.JWTSecret))
+	signed, err := token.SignedString([]byte(s.config.JWTSecret))
+	return signed, expiresAt, err
+}
+
+func (s *UserService) refreshTTL() time.Duration {
+	duration, err := time.ParseDuration(s.config.JWTRefreshExpiration)
+	if err != nil || duration <= 0 {
+		duration = 30 * 24 * time.Hour
+	}
+	return duration
+}
+
+// newRefreshToken returns a random opaque token and the hash stored for it
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
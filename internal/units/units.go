@@ -0,0 +1,154 @@
+// Package units converts quantities between the store's units of measure.
+//
+// Mass (g, kg), volume (ml, l) and count (pcs) are separate dimensions.
+// Converting inside a dimension is always possible; converting across
+// dimensions needs product facts such as density or the weight of a piece.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bexiiiii/smart_food_store/internal/models"
+)
+
+var (
+	ErrUnknownUnit       = errors.New("unknown unit")
+	ErrIncompatibleUnits = errors.New("incompatible units")
+)
+
+type Dimension string
+
+const (
+	Mass   Dimension = "mass"
+	Volume Dimension = "volume"
+	Count  Dimension = "count"
+)
+
+// Profile holds the product facts needed for cross-dimension conversion.
+// Zero values mean "unknown".
+type Profile struct {
+	Density     float64 // grams per millilitre
+	PieceWeight float64 // grams per piece
+}
+
+type unitInfo struct {
+	dimension Dimension
+	factor    float64 // size of the unit in the base unit of its dimension (g, ml, pcs)
+}
+
+var known = map[models.Unit]unitInfo{
+	models.UnitGram:       {Mass, 1},
+	models.UnitKilogram:   {Mass, 1000},
+	models.UnitMilliliter: {Volume, 1},
+	models.UnitLiter:      {Volume, 1000},
+	models.UnitPiece:      {Count, 1},
+}
+
+var aliases = map[string]models.Unit{
+	"g": models.UnitGram, "gr": models.UnitGram, "gram": models.UnitGram, "grams": models.UnitGram,
+	"kg": models.UnitKilogram, "kilo": models.UnitKilogram, "kilogram": models.UnitKilogram, "kilograms": models.UnitKilogram,
+	"ml": models.UnitMilliliter, "milliliter": models.UnitMilliliter, "milliliters": models.UnitMilliliter, "millilitre": models.UnitMilliliter, "millilitres": models.UnitMilliliter,
+	"l": models.UnitLiter, "liter": models.UnitLiter, "liters": models.UnitLiter, "litre": models.UnitLiter, "litres": models.UnitLiter,
+	"pcs": models.UnitPiece, "pc": models.UnitPiece, "piece": models.UnitPiece, "pieces": models.UnitPiece,
+}
+
+// Parse normalizes a unit name such as "Grams" or "litre" to a models.Unit
+func Parse(s string) (models.Unit, error) {
+	unit, ok := aliases[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownUnit, s)
+	}
+	return unit, nil
+}
+
+// DimensionOf reports what a unit measures
+func DimensionOf(unit models.Unit) (Dimension, error) {
+	info, ok := known[unit]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownUnit, unit)
+	}
+	return info.dimension, nil
+}
+
+// ProfileOf returns the conversion facts stored on a product
+func ProfileOf(product *models.Product) Profile {
+	if product == nil {
+		return Profile{}
+	}
+	return Profile{Density: product.Density, PieceWeight: product.PieceWeight}
+}
+
+// Convert expresses quantity (measured in from) in the unit to
+func Convert(quantity float64, from, to models.Unit, profile Profile) (float64, error) {
+	fromInfo, ok := known[from]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownUnit, from)
+	}
+	toInfo, ok := known[to]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownUnit, to)
+	}
+
+	base := quantity * fromInfo.factor
+	if fromInfo.dimension != toInfo.dimension {
+		grams, err := toGrams(base, fromInfo.dimension, profile)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s to %s: %v", ErrIncompatibleUnits, from, to, err)
+		}
+		base, err = fromGrams(grams, toInfo.dimension, profile)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s to %s: %v", ErrIncompatibleUnits, from, to, err)
+		}
+	}
+
+	return base / toInfo.factor, nil
+}
+
+// Cost prices quantity (measured in unit) for a product sold at price per priceUnit
+func Cost(price float64, priceUnit models.Unit, quantity float64, unit models.Unit, profile Profile) (float64, error) {
+	converted, err := Convert(quantity, unit, priceUnit, profile)
+	if err != nil {
+		return 0, err
+	}
+	return price * converted, nil
+}
+
+// toGrams turns an amount in the base unit of dimension into grams
+func toGrams(amount float64, dimension Dimension, profile Profile) (float64, error) {
+	switch dimension {
+	case Mass:
+		return amount, nil
+	case Volume:
+		if profile.Density <= 0 {
+			return 0, errors.New("density is unknown")
+		}
+		return amount * profile.Density, nil
+	case Count:
+		if profile.PieceWeight <= 0 {
+			return 0, errors.New("piece weight is unknown")
+		}
+		return amount * profile.PieceWeight, nil
+	}
+	return 0, fmt.Errorf("unsupported dimension %q", dimension)
+}
+
+// fromGrams turns grams into an amount in the base unit of dimension
+func fromGrams(grams float64, dimension Dimension, profile Profile) (float64, error) {
+	switch dimension {
+	case Mass:
+		return grams, nil
+	case Volume:
+		if profile.Density <= 0 {
+			return 0, errors.New("density is unknown")
+		}
+		return grams / profile.Density, nil
+	case Count:
+		if profile.PieceWeight <= 0 {
+			return 0, errors.New("piece weight is unknown")
+		}
+		return grams / profile.PieceWeight, nil
+	}
+	return 0, fmt.Errorf("unsupported dimension %q", dimension)
+}